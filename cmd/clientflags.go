@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+// requestSigningHMACSHA256 is the only supported --pangolin-request-signing
+const requestSigningHMACSHA256 = "hmac-sha256"
+
+// clientFlags are the flags shaping how the Pangolin API is talked to, shared
+// by the controller and the export subcommand so that both reach the same API
+type clientFlags struct {
+	requestSigning string
+	userAgent      string
+	fieldNaming    string
+}
+
+func (f *clientFlags) bind(fs *flag.FlagSet) {
+	fs.StringVar(&f.requestSigning, "pangolin-request-signing", "",
+		"Sign Pangolin API requests in addition to the bearer token. Supported: "+requestSigningHMACSHA256+", keyed with the hmac-key of the API key secret.")
+	fs.StringVar(&f.userAgent, "pangolin-user-agent", "",
+		"User-Agent header sent with Pangolin API requests. If empty, "+pangolin.DefaultUserAgent()+" is sent.")
+	fs.StringVar(&f.fieldNaming, "pangolin-field-naming", "camelCase",
+		"Naming of the fields of Pangolin API request and response bodies: camelCase or snake_case, depending on the Pangolin version.")
+}
+
+// options returns the client options for the flags, signing requests with
+// hmacKey if request signing is enabled
+func (f *clientFlags) options(hmacKey string) ([]pangolin.ClientOption, error) {
+	var opts []pangolin.ClientOption
+	switch f.requestSigning {
+	case "":
+	case requestSigningHMACSHA256:
+		opts = append(opts, pangolin.WithRequestSigner(pangolin.NewHMACSigner([]byte(hmacKey))))
+	default:
+		return nil, fmt.Errorf("unsupported request signing %q, must be empty or %s", f.requestSigning, requestSigningHMACSHA256)
+	}
+	if f.userAgent != "" {
+		opts = append(opts, pangolin.WithUserAgent(f.userAgent))
+	}
+	switch pangolin.FieldNaming(f.fieldNaming) {
+	case "":
+	case pangolin.FieldNamingCamelCase, pangolin.FieldNamingSnakeCase:
+		opts = append(opts, pangolin.WithFieldNaming(pangolin.FieldNaming(f.fieldNaming)))
+	default:
+		return nil, fmt.Errorf("unsupported field naming %q, must be %s or %s", f.fieldNaming, pangolin.FieldNamingCamelCase, pangolin.FieldNamingSnakeCase)
+	}
+	return opts, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+// apiKeyEnv and hmacKeyEnv hold the API key and the request signing key for
+// the export subcommand, so that they don't show up in the process list
+const (
+	apiKeyEnv  = "PANGOLIN_API_KEY"
+	hmacKeyEnv = "PANGOLIN_HMAC_KEY"
+)
+
+// runExport implements the export subcommand: it writes the resources the
+// controller created, i.e. those tagged with the Ingress they belong to and,
+// if given, with --instance-id, with their targets and rules, as JSON to the
+// --output file or stdout.
+func runExport(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	baseURL := fs.String("pangolin-base-url", "https://api.tunnel.tf", "The base URL for the Pangolin API.")
+	orgID := fs.String("pangolin-org-id", "", "The organization identifier in Pangolin.")
+	instanceID := fs.String("instance-id", "", "Only export resources created by the controller instance with this --instance-id.")
+	output := fs.String("output", "-", "File to write the snapshot to. If -, it is written to stdout.")
+	var pangolinFlags clientFlags
+	pangolinFlags.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *orgID == "" {
+		return fmt.Errorf("--pangolin-org-id is required")
+	}
+	// Signed requests may be accepted without a bearer token
+	apiKey := os.Getenv(apiKeyEnv)
+	if apiKey == "" && pangolinFlags.requestSigning == "" {
+		return fmt.Errorf("the API key must be set in %s", apiKeyEnv)
+	}
+	hmacKey := os.Getenv(hmacKeyEnv)
+	if pangolinFlags.requestSigning != "" && hmacKey == "" {
+		return fmt.Errorf("the request signing key must be set in %s", hmacKeyEnv)
+	}
+	opts, err := pangolinFlags.options(hmacKey)
+	if err != nil {
+		return err
+	}
+
+	c := pangolin.NewClient(*baseURL, apiKey, *orgID, opts...)
+	defer c.Close()
+	snapshots, err := c.Export(ctx, func(res *pangolin.Resource) bool {
+		return isExportedResource(*instanceID, res)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export resources: %w", err)
+	}
+
+	if *output == "-" {
+		return writeSnapshot(stdout, snapshots)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := writeSnapshot(f, snapshots); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isExportedResource reports whether res was created by the controller
+// instance with instanceID, or by any instance if instanceID is empty. The
+// name prefix alone doesn't tell apart clusters sharing an organization.
+func isExportedResource(instanceID string, res *pangolin.Resource) bool {
+	if res.Metadata[pangolin.MetadataIngress] == "" {
+		return false
+	}
+	return instanceID == "" || res.Metadata[pangolin.MetadataInstanceID] == instanceID
+}
+
+func writeSnapshot(w io.Writer, snapshots []pangolin.ResourceSnapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snapshots); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+func TestRunExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/org/test-org/resources":
+			_, _ = w.Write([]byte(`{"data":{"resources":[` +
+				`{"resourceId":1,"name":"pangolin-controller-app","metadata":{"kubernetes.ingress":"default/app","kubernetes.instance-id":"cluster-a"}},` +
+				`{"resourceId":2,"name":"other-app"},` +
+				`{"resourceId":3,"name":"pangolin-controller-web","metadata":{"kubernetes.ingress":"default/web","kubernetes.instance-id":"cluster-b"}}]}}`))
+		case "/v1/resource/1/targets":
+			_, _ = w.Write([]byte(`{"data":{"targets":[{"targetId":10,"port":80}]}}`))
+		case "/v1/resource/1/rules":
+			_, _ = w.Write([]byte(`{"data":{"rules":[]}}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv(apiKeyEnv, "test-key")
+	var out bytes.Buffer
+	err := runExport(context.Background(), []string{"--pangolin-base-url", server.URL, "--pangolin-org-id", "test-org", "--instance-id", "cluster-a"}, &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var snapshots []pangolin.ResourceSnapshot
+	if err := json.Unmarshal(out.Bytes(), &snapshots); err != nil {
+		t.Fatalf("Expected a JSON snapshot, got %q: %v", out.String(), err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Resource.Name != "pangolin-controller-app" {
+		t.Fatalf("Expected only the resource of this cluster to be exported, got %+v", snapshots)
+	}
+	if len(snapshots[0].Targets) != 1 || snapshots[0].Targets[0].ID != 10 {
+		t.Errorf("Expected the resource's target in the snapshot, got %+v", snapshots[0].Targets)
+	}
+}
+
+func TestRunExportClientFlags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != "backup/1.0" {
+			t.Errorf("Expected User-Agent backup/1.0, got %q", got)
+		}
+		if r.Header.Get(pangolin.HMACSignatureHeader) == "" {
+			t.Errorf("Expected %s %s to be signed", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/org/test-org/resources":
+			_, _ = w.Write([]byte(`{"data":{"resources":[{"resource_id":1,"name":"pangolin-controller-app","metadata":{"kubernetes.ingress":"default/app"}}]}}`))
+		case "/v1/resource/1/targets":
+			_, _ = w.Write([]byte(`{"data":{"targets":[{"target_id":10,"port":80}]}}`))
+		case "/v1/resource/1/rules":
+			_, _ = w.Write([]byte(`{"data":{"rules":[]}}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv(apiKeyEnv, "")
+	t.Setenv(hmacKeyEnv, "secret")
+	var out bytes.Buffer
+	err := runExport(context.Background(), []string{
+		"--pangolin-base-url", server.URL,
+		"--pangolin-org-id", "test-org",
+		"--pangolin-field-naming", "snake_case",
+		"--pangolin-request-signing", "hmac-sha256",
+		"--pangolin-user-agent", "backup/1.0",
+	}, &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var snapshots []pangolin.ResourceSnapshot
+	if err := json.Unmarshal(out.Bytes(), &snapshots); err != nil {
+		t.Fatalf("Expected a JSON snapshot, got %q: %v", out.String(), err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Resource.ID != 1 || len(snapshots[0].Targets) != 1 || snapshots[0].Targets[0].ID != 10 {
+		t.Errorf("Expected the snake_case resource and its target to be exported, got %+v", snapshots)
+	}
+}
+
+func TestRunExportRequiresAPIKey(t *testing.T) {
+	t.Setenv(apiKeyEnv, "")
+	err := runExport(context.Background(), []string{"--pangolin-org-id", "test-org"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), apiKeyEnv) {
+		t.Errorf("Expected an error mentioning %s, got %v", apiKeyEnv, err)
+	}
+}
@@ -4,17 +4,21 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/vinzenz/pangolin-ingress-controller/internal/controller"
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
 )
 
 var (
@@ -27,37 +31,167 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(ctrl.SetupSignalHandler(), os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var ingressClass string
+	var disableLegacyIngressClassAnnotation bool
+	var controllerName string
+	var ingressLabelSelector string
 	var pangolinBaseURL string
 	var pangolinAPIKeySecret string
 	var pangolinAPIKeyNamespace string
 	var pangolinOrgID string
 	var pangolinSiteNiceID string
+	var defaultSiteRegion string
 	var resourcePrefix string
+	var pangolinFlags clientFlags
+	var annotationPrefix string
+	var finalizerName string
+	var enableServiceExposure bool
+	var targetConcurrency int
+	var defaultTargetWeight int
+	var targetDrainPeriod time.Duration
+	var reconcileDebounce time.Duration
+	var minReconcileInterval time.Duration
+	var requeueJitter float64
+	var statusPollInterval time.Duration
+	var statusPollTimeout time.Duration
+	var maxResources int
+	var maxResponseBytes int64
+	var maxConcurrentWrites int
+	var writeLatencyThreshold time.Duration
+	var maxConcurrentRequests int
+	var requestCompressionThreshold int
+	var resourceCacheTTL time.Duration
+	var operationTimeout time.Duration
+	var disableHTTP2 bool
+	var defaultDomain string
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var startupSelfTest bool
+	var probeTimeout time.Duration
+	var disableIngressMetrics bool
+	var instanceID string
+	var allowForeignInstanceResources bool
+	var transactionalCreate bool
+	var duplicatePathPolicy string
+	var cleanupOnUnmanage bool
+	var tlsOnlyHosts string
+	var exclusiveHosts bool
+	var mirrorLabels string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 20, "Maximum sustained queries per second to the Kubernetes API server.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 30, "Maximum burst of queries to the Kubernetes API server.")
 	flag.StringVar(&ingressClass, "ingress-class", "pangolin", "The ingress class this controller manages.")
+	flag.StringVar(&controllerName, "controller-name", "",
+		"Only manage Ingresses selecting the ingress class through spec.ingressClassName if its IngressClass exists and has this controller. "+
+			"If empty, the IngressClass is not checked.")
+	flag.BoolVar(&disableLegacyIngressClassAnnotation, "disable-legacy-ingress-class-annotation", false,
+		"Ignore the deprecated kubernetes.io/ingress.class annotation and only manage Ingresses by spec.ingressClassName.")
+	flag.StringVar(&ingressLabelSelector, "ingress-label-selector", "",
+		"Only manage Ingresses whose labels match this selector (e.g. team=web,env!=dev). If empty, all Ingresses of the class are managed.")
 	flag.StringVar(&pangolinBaseURL, "pangolin-base-url", "https://api.tunnel.tf", "The base URL for the Pangolin API.")
 	flag.StringVar(&pangolinAPIKeySecret, "pangolin-api-key-secret", "pangolin-api-key", "The name of the secret containing the Pangolin API key.")
 	flag.StringVar(&pangolinAPIKeyNamespace, "pangolin-api-key-namespace", "pangolin-system", "The namespace of the secret containing the Pangolin API key.")
 	flag.StringVar(&pangolinOrgID, "pangolin-org-id", "", "The organization identifier in Pangolin.")
-	flag.StringVar(&pangolinSiteNiceID, "pangolin-site-nice-id", "", "The Pangolin site nice ID to attach resources/targets to.")
+	flag.StringVar(&pangolinSiteNiceID, "pangolin-site-nice-id", "", "The default Pangolin site nice ID to attach targets to. If empty, the first online site is used.")
+	flag.StringVar(&defaultSiteRegion, "default-site-region", "", "Without a default site, prefer the first online site in this region before falling back to the first online site.")
+	flag.Int64Var(&maxResponseBytes, "pangolin-max-response-bytes", pangolin.DefaultMaxResponseBytes, "Maximum size in bytes of Pangolin API response bodies.")
+	flag.IntVar(&maxConcurrentRequests, "pangolin-max-concurrent-requests", 0,
+		"Maximum number of Pangolin API requests of any kind in flight at once, shared by all reconciles. If 0, there is no limit.")
+	flag.IntVar(&requestCompressionThreshold, "pangolin-request-compression-threshold", 0,
+		"Gzip Pangolin API request bodies of at least this many bytes. Falls back to uncompressed bodies if the API rejects them. If 0, bodies are never compressed.")
+	flag.DurationVar(&resourceCacheTTL, "pangolin-resource-cache-ttl", 0,
+		"How long a Pangolin resource read from the API is served from memory. Writes to a resource drop its cached copy. If 0, resources are not cached.")
+	flag.DurationVar(&operationTimeout, "pangolin-operation-timeout", 0,
+		"How long a Pangolin API write answered with 202 Accepted is polled until its operation completes, blocking the reconcile. If 0, the operation is not polled and the Ingress is reconciled again after 15s instead.")
+	flag.BoolVar(&disableHTTP2, "pangolin-disable-http2", false,
+		"Force HTTP/1.1 for Pangolin API requests instead of negotiating HTTP/2, e.g. for proxies in front of Pangolin that misbehave under HTTP/2.")
+	flag.IntVar(&maxConcurrentWrites, "pangolin-max-concurrent-writes", 8,
+		"Maximum number of Pangolin API write requests in flight. If 0, writes are not limited.")
+	flag.DurationVar(&writeLatencyThreshold, "pangolin-write-latency-threshold", 2*time.Second,
+		"Lower the concurrent write limit while the p95 Pangolin API latency exceeds this, and raise it again as latency recovers. If 0, the limit is fixed.")
 	flag.StringVar(&resourcePrefix, "resource-prefix", "pangolin-controller", "Prefix for Pangolin resource names.")
+	flag.BoolVar(&enableServiceExposure, "enable-service-exposure", false,
+		"Expose Services annotated with pangolin.ingress.k8s.io/expose as raw TCP/UDP Pangolin resources. "+
+			"Turning it off leaves the Service finalizer in place, blocking the deletion of exposed Services until it is removed by hand.")
+	flag.IntVar(&targetConcurrency, "target-concurrency", 4, "Maximum number of targets of a single Ingress host reconciled in parallel.")
+	flag.IntVar(&defaultTargetWeight, "default-target-weight", 100,
+		"Load balancing weight (1-1000) of targets whose Ingress has no pangolin.ingress.k8s.io/target-weight annotation.")
+	flag.DurationVar(&targetDrainPeriod, "target-drain-period", 0,
+		"How long a stale target keeps serving established connections with weight 0 before it is deleted. If 0, it is deleted right away.")
+	flag.DurationVar(&reconcileDebounce, "reconcile-debounce", time.Second,
+		"Delay before an Ingress event is reconciled. Events for the same Ingress within the delay are coalesced into one reconcile. If 0, events are reconciled right away.")
+	flag.DurationVar(&minReconcileInterval, "min-reconcile-interval", 0,
+		"Least time between two reconciles of the same Ingress. Reconciles triggered earlier, e.g. by another controller rapidly editing it, are postponed and collapsed into one. Deletions are never postponed. If 0, there is no limit.")
+	flag.Float64Var(&requeueJitter, "requeue-jitter", 0.1,
+		"Lengthen requeue delays and error backoff by a random amount of up to this fraction (0-1), so that Ingresses failing together don't retry in bursts. If 0, there is no jitter.")
+	flag.DurationVar(&statusPollInterval, "status-poll-interval", 2*time.Second,
+		"Initial delay before re-checking whether Pangolin exposes a proxy IP for an Ingress. The delay doubles on every check.")
+	flag.DurationVar(&statusPollTimeout, "status-poll-timeout", time.Minute,
+		"How long to keep checking for a proxy IP before the Ingress status falls back to the rule host.")
+	flag.IntVar(&maxResources, "max-resources", 0,
+		"Maximum number of Pangolin resources the controller creates. Creation is refused once reached. If 0, there is no limit.")
+	flag.StringVar(&defaultDomain, "default-domain", "", "Host that Ingress rules without a host are routed to. If empty, such rules are skipped.")
+	flag.StringVar(&annotationPrefix, "annotation-prefix", "pangolin.ingress.k8s.io", "Prefix for the Ingress annotations read and written by the controller.")
+	flag.StringVar(&finalizerName, "finalizer-name", "pangolin.ingress.k8s.io/finalizer",
+		"Finalizer added to managed Ingresses, and with a -service suffix to exposed Services. Controller instances managing disjoint sets of Ingresses should use distinct names.")
+	flag.BoolVar(&startupSelfTest, "startup-self-test", false,
+		"Create and delete a throwaway Pangolin resource at startup and report the replica unready until that succeeds.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", 10*time.Second,
+		"Timeout of the periodic Pangolin API probe. The replica is only ready while the last probe succeeded and its caches have synced.")
+	flag.BoolVar(&disableIngressMetrics, "disable-ingress-metrics", false,
+		"Disable metrics with one series per Ingress, such as pangolin_ingress_last_sync_timestamp_seconds.")
+	flag.StringVar(&instanceID, "instance-id", "",
+		"ID recorded in the metadata of the Pangolin resources this controller creates. Resources tagged with another ID are neither modified nor deleted.")
+	flag.BoolVar(&allowForeignInstanceResources, "allow-foreign-instance-resources", false,
+		"Modify and delete Pangolin resources tagged with another --instance-id, e.g. to take them over after a migration.")
+	flag.BoolVar(&cleanupOnUnmanage, "cleanup-on-unmanage", false,
+		"Delete the Pangolin resources of an Ingress and remove its finalizer when it moves to another class or out of the label selector. "+
+			"By default they are left in place and only cleaned up when the Ingress is deleted.")
+	flag.BoolVar(&transactionalCreate, "transactional-create", false,
+		"Create new Pangolin resources together with their targets and rules in a single request, so that a failure leaves nothing half-created. "+
+			"Falls back to separate requests if the Pangolin API does not support it.")
+	flag.StringVar(&duplicatePathPolicy, "duplicate-path-policy", "first-wins",
+		"Which backend a path listed more than once for a host is routed to: first-wins or last-wins. A Warning event is recorded either way.")
+	flag.StringVar(&tlsOnlyHosts, "tls-only-hosts", "skip",
+		"What to do with hosts listed in spec.tls but in no rule: skip them with an event, or create a placeholder Pangolin resource without targets "+
+			"holding their certificate (only for Ingresses without other hosts).")
+	flag.BoolVar(&exclusiveHosts, "exclusive-hosts", false,
+		"Let only one Ingress route a host: an Ingress declaring a host already claimed by another one is refused with a HostConflict event "+
+			"instead of sharing its Pangolin resource.")
+	flag.StringVar(&mirrorLabels, "mirror-labels", "",
+		"Comma-separated Ingress label keys, or key prefixes ending in *, copied into the metadata of its Pangolin resources and targets. "+
+			"Labels with keys starting with kubernetes. are never copied.")
 
 	opts := zap.Options{}
+	pangolinFlags.bind(flag.CommandLine)
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	if err := applyKubeAPIRateLimits(restConfig, kubeAPIQPS, kubeAPIBurst); err != nil {
+		setupLog.Error(err, "invalid Kubernetes API rate limits")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
@@ -69,28 +203,71 @@ func main() {
 		os.Exit(1)
 	}
 
-	if pangolinOrgID == "" {
-		setupLog.Error(fmt.Errorf("missing pangolin org id"), "pangolin org id must be configured via --pangolin-org-id")
+	ingressReconciler, err := controller.NewIngressReconciler(mgr.GetClient(), mgr.GetScheme(), controller.ReconcilerOptions{
+		Recorder:                            mgr.GetEventRecorderFor("pangolin-ingress-controller"),
+		IngressClass:                        ingressClass,
+		ControllerName:                      controllerName,
+		DisableLegacyIngressClassAnnotation: disableLegacyIngressClassAnnotation,
+		IngressLabelSelector:                ingressLabelSelector,
+		ResourcePrefix:                      resourcePrefix,
+		AnnotationPrefix:                    annotationPrefix,
+		FinalizerName:                       finalizerName,
+		TargetConcurrency:                   targetConcurrency,
+		DefaultTargetWeight:                 defaultTargetWeight,
+		TargetDrainPeriod:                   targetDrainPeriod,
+		ReconcileDebounce:                   reconcileDebounce,
+		MinReconcileInterval:                minReconcileInterval,
+		RequeueJitter:                       requeueJitter,
+		StatusPollInterval:                  statusPollInterval,
+		StatusPollTimeout:                   statusPollTimeout,
+		MaxResources:                        maxResources,
+		DefaultDomain:                       defaultDomain,
+		PangolinBaseURL:                     pangolinBaseURL,
+		MaxResponseBytes:                    maxResponseBytes,
+		UserAgent:                           pangolinFlags.userAgent,
+		MaxConcurrentWrites:                 maxConcurrentWrites,
+		WriteLatencyThreshold:               writeLatencyThreshold,
+		MaxConcurrentRequests:               maxConcurrentRequests,
+		RequestCompressionThreshold:         requestCompressionThreshold,
+		ResourceCacheTTL:                    resourceCacheTTL,
+		OperationTimeout:                    operationTimeout,
+		FieldNaming:                         pangolinFlags.fieldNaming,
+		DisableHTTP2:                        disableHTTP2,
+		APIKeySecret:                        pangolinAPIKeySecret,
+		APIKeyNamespace:                     pangolinAPIKeyNamespace,
+		RequestSigning:                      pangolinFlags.requestSigning,
+		OrgID:                               pangolinOrgID,
+		SiteNiceID:                          pangolinSiteNiceID,
+		DefaultSiteRegion:                   defaultSiteRegion,
+		StartupSelfTest:                     startupSelfTest,
+		ProbeTimeout:                        probeTimeout,
+		DisableIngressMetrics:               disableIngressMetrics,
+		InstanceID:                          instanceID,
+		AllowForeignInstanceResources:       allowForeignInstanceResources,
+		CleanupOnUnmanage:                   cleanupOnUnmanage,
+		TransactionalCreate:                 transactionalCreate,
+		DuplicatePathPolicy:                 duplicatePathPolicy,
+		TLSOnlyHosts:                        tlsOnlyHosts,
+		ExclusiveHosts:                      exclusiveHosts,
+		MirrorLabels:                        splitList(mirrorLabels),
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to configure controller", "controller", "Ingress")
 		os.Exit(1)
 	}
-	if pangolinSiteNiceID == "" {
-		setupLog.Error(fmt.Errorf("missing pangolin site nice id"), "pangolin site nice id must be configured via --pangolin-site-nice-id")
+	if err = ingressReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
 		os.Exit(1)
 	}
 
-	if err = (&controller.IngressReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		IngressClass:    ingressClass,
-		ResourcePrefix:  resourcePrefix,
-		PangolinBaseURL: pangolinBaseURL,
-		APIKeySecret:    pangolinAPIKeySecret,
-		APIKeyNamespace: pangolinAPIKeyNamespace,
-		OrgID:           pangolinOrgID,
-		SiteNiceID:      pangolinSiteNiceID,
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
-		os.Exit(1)
+	if enableServiceExposure {
+		if err = (&controller.ServiceReconciler{
+			Client:  mgr.GetClient(),
+			Ingress: ingressReconciler,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Service")
+			os.Exit(1)
+		}
 	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -102,9 +279,34 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("starting manager", "ingressClass", ingressClass)
+	setupLog.Info("starting manager", "ingressClass", ingressClass, "version", pangolin.Version)
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// applyKubeAPIRateLimits sets the client-go rate limits on cfg after checking
+// that they are usable: qps must be positive and burst at least qps.
+func applyKubeAPIRateLimits(cfg *rest.Config, qps float64, burst int) error {
+	if qps <= 0 {
+		return fmt.Errorf("--kube-api-qps must be positive, got %v", qps)
+	}
+	if burst < 1 || float64(burst) < qps {
+		return fmt.Errorf("--kube-api-burst must be at least 1 and not lower than --kube-api-qps, got %d", burst)
+	}
+	cfg.QPS = float32(qps)
+	cfg.Burst = burst
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestApplyKubeAPIRateLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		qps         float64
+		burst       int
+		expectError bool
+	}{
+		{name: "defaults", qps: 20, burst: 30},
+		{name: "fractional qps", qps: 0.5, burst: 1},
+		{name: "burst equal to qps", qps: 100, burst: 100},
+		{name: "zero qps", qps: 0, burst: 30, expectError: true},
+		{name: "negative qps", qps: -1, burst: 30, expectError: true},
+		{name: "zero burst", qps: 20, burst: 0, expectError: true},
+		{name: "burst below qps", qps: 50, burst: 10, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &rest.Config{}
+			err := applyKubeAPIRateLimits(cfg, tt.qps, tt.burst)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error for qps=%v burst=%d", tt.qps, tt.burst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.QPS != float32(tt.qps) {
+				t.Errorf("Expected QPS %v, got %v", tt.qps, cfg.QPS)
+			}
+			if cfg.Burst != tt.burst {
+				t.Errorf("Expected Burst %d, got %d", tt.burst, cfg.Burst)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{value: "", expected: nil},
+		{value: "team", expected: []string{"team"}},
+		{value: " team, app.kubernetes.io/* ,,", expected: []string{"team", "app.kubernetes.io/*"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitList(tt.value); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("splitList(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,646 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+// Defaults applied to health checks that are enabled without the
+// corresponding annotation. Pangolin only pushes health checks to Newt when
+// all of path, hostname, port, interval and method are set; hostname and port
+// depend on the target and are filled in when the target is built.
+const (
+	defaultHCPath     = "/"
+	defaultHCInterval = 30
+	defaultHCMethod   = "GET"
+)
+
+// forwardedHeadersPolicies are the values of the forwarded-headers annotation
+var forwardedHeadersPolicies = []string{
+	pangolin.ForwardedHeadersTrust, pangolin.ForwardedHeadersOverwrite, pangolin.ForwardedHeadersStrip,
+}
+
+// httpMethods are the methods accepted by the allowed-methods annotation
+var httpMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// Values of the exact-trailing-slash annotation, which controls how a trailing
+// slash of an Exact path is passed on to Pangolin
+const (
+	// exactTrailingSlashPreserve passes the path as written
+	exactTrailingSlashPreserve = "preserve"
+	// exactTrailingSlashStrip removes a trailing slash, e.g. /api/ becomes /api
+	exactTrailingSlashStrip = "strip"
+	// exactTrailingSlashAppend adds a missing trailing slash, e.g. /api
+	// becomes /api/
+	exactTrailingSlashAppend = "append"
+)
+
+// Values of the service-resolution annotation, which states how the cluster
+// DNS name of a backend Service resolves. Targets point at that name in every
+// mode; the mode only checks that the Service resolves as expected.
+const (
+	// serviceResolutionClusterIP expects the name to resolve to the cluster
+	// IP of the Service
+	serviceResolutionClusterIP = "clusterip"
+	// serviceResolutionHeadless expects a headless Service, whose name
+	// resolves to the addresses of its ready endpoints
+	serviceResolutionHeadless = "headless"
+)
+
+// ingressConfig is the configuration an Ingress carries in its annotations,
+// normalized and defaulted once per reconcile. Pointer fields are nil when
+// the annotation is absent, leaving the setting at its Pangolin default.
+type ingressConfig struct {
+	Enabled               *bool
+	SSO                   *bool
+	SSL                   *bool
+	BlockAccess           *bool
+	EmailWhitelistEnabled *bool
+	ApplyRules            *bool
+
+	StickySession *bool
+	WebSocket     *bool
+	// ForwardedHeaders is one of the pangolin.ForwardedHeaders* policies
+	ForwardedHeaders *string
+	TLSServerName    *string
+	SetHostHeader    *string
+	PostAuthPath     *string
+	Headers          []pangolin.Header
+	// ResponseHeaders are added to every response, keyed by header name
+	ResponseHeaders map[string]string
+	// AllowedMethods restricts the HTTP methods the proxy passes on; all
+	// methods are allowed when empty
+	AllowedMethods []string
+	// AllowCIDRs, if not empty, are the only client networks let through;
+	// DenyCIDRs are refused even if allowed
+	AllowCIDRs []string
+	DenyCIDRs  []string
+	// Priority orders the resource against resources with overlapping
+	// domains; nil means defaultResourcePriority
+	Priority  *int
+	RateLimit *pangolin.RateLimit
+	// Metadata is the user metadata merged into the metadata of the resource
+	// and its targets
+	Metadata map[string]string
+
+	// SiteIDs are the nice IDs of the sites serving the resource, if it is
+	// placed on more than one
+	SiteIDs []string
+
+	// BackendNamespace is empty unless the backend-namespace annotation is set
+	BackendNamespace string
+	// TargetAddress is empty unless the target-address annotation is set
+	TargetAddress string
+	// ServiceResolution is one of the serviceResolution* modes the backend
+	// Services are checked against; empty means they aren't checked
+	ServiceResolution string
+	// ExactTrailingSlash is one of the exactTrailingSlash* modes applied to
+	// Exact paths; empty means preserve
+	ExactTrailingSlash string
+	// ExistingResourceID is empty unless the existing-resource-id annotation
+	// names a pre-provisioned resource to manage
+	ExistingResourceID string
+	// TargetWeight is the weight of every target; nil means the default
+	TargetWeight       *int
+	DeletionProtection bool
+	// Ignore parks the Ingress without Pangolin resources
+	Ignore bool
+
+	HealthCheck healthCheckConfig
+}
+
+// healthCheckConfig holds the health check settings applied to every target
+// of an Ingress
+type healthCheckConfig struct {
+	Enabled           *bool
+	Path              *string
+	Scheme            *string
+	Mode              *string
+	Hostname          *string
+	Port              *int
+	Interval          *int
+	UnhealthyInterval *int
+	Timeout           *int
+	Headers           []pangolin.Header
+	FollowRedirects   *bool
+	Method            *string
+	Status            *int
+	TLSServerName     *string
+}
+
+// annotationCorrection records an annotation value that was rewritten during
+// normalization
+type annotationCorrection struct {
+	Key  string
+	From string
+	To   string
+}
+
+// Sources of a configDecision
+const (
+	configSourceAnnotation = "annotation"
+	configSourceDefault    = "default"
+)
+
+// configDecision records a config value and where it came from, so that the
+// effective configuration of an Ingress can be traced in the logs. Settings
+// left to their Pangolin default are not recorded.
+type configDecision struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// annotationParser reads annotation values under the reconciler's prefix,
+// collecting corrections and errors so that all problems of an Ingress are
+// reported at once
+type annotationParser struct {
+	r           *IngressReconciler
+	annotations map[string]string
+	corrections []annotationCorrection
+	decisions   []configDecision
+	errs        []error
+}
+
+// parseIngressConfig normalizes and validates the annotations of an Ingress.
+// Values are trimmed, booleans and enumerated values are matched case
+// insensitively, and health check defaults are filled in. The returned config
+// is usable even when an error is returned; unparsable values are left unset.
+// The returned decisions list every value set, in parse order.
+func (r *IngressReconciler) parseIngressConfig(annotations map[string]string) (*ingressConfig, []annotationCorrection, []configDecision, error) {
+	p := &annotationParser{r: r, annotations: annotations}
+	cfg := &ingressConfig{
+		Enabled:               p.boolValue(annotationEnabled),
+		SSO:                   p.boolValue(annotationSSO),
+		SSL:                   p.boolValue(annotationSSL),
+		BlockAccess:           p.boolValue(annotationBlockAccess),
+		EmailWhitelistEnabled: p.boolValue(annotationEmailWhitelistEnabled),
+		ApplyRules:            p.boolValue(annotationApplyRules),
+		StickySession:         p.boolValue(annotationStickySession),
+		WebSocket:             p.boolValue(annotationWebSocket),
+		ForwardedHeaders:      p.oneOf(annotationForwardedHeaders, strings.ToLower, forwardedHeadersPolicies...),
+		TLSServerName:         p.stringValue(annotationTLSServerName),
+		SetHostHeader:         p.stringValue(annotationSetHostHeader),
+		PostAuthPath:          p.stringValue(annotationPostAuthPath),
+		Headers:               p.headers(annotationHeaders),
+		ResponseHeaders:       p.responseHeaders(annotationResponseHeaders),
+		AllowedMethods:        p.methods(annotationAllowedMethods),
+		AllowCIDRs:            p.cidrs(annotationAllowCIDRs),
+		DenyCIDRs:             p.cidrs(annotationDenyCIDRs),
+		Priority:              p.intValue(annotationPriority, 1, maxResourcePriority),
+		RateLimit:             p.rateLimit(),
+		Metadata:              p.metadata(annotationMetadata),
+		SiteIDs:               p.list(annotationSiteIDs),
+		TargetWeight:          p.intValue(annotationTargetWeight, 1, maxTargetWeight),
+		HealthCheck: healthCheckConfig{
+			Enabled:           p.boolValue(annotationHCEnabled),
+			Path:              p.stringValue(annotationHCPath),
+			Scheme:            p.oneOf(annotationHCScheme, strings.ToLower, "http", "https"),
+			Mode:              p.normalized(annotationHCMode, strings.ToLower),
+			Hostname:          p.stringValue(annotationHCHostname),
+			Port:              p.intValue(annotationHCPort, 1, 65535),
+			Interval:          p.intValue(annotationHCInterval, 1, 0),
+			UnhealthyInterval: p.intValue(annotationHCUnhealthyInterval, 1, 0),
+			Timeout:           p.intValue(annotationHCTimeout, 1, 0),
+			Headers:           p.headers(annotationHCHeaders),
+			FollowRedirects:   p.boolValue(annotationHCFollowRedirects),
+			Method:            p.normalized(annotationHCMethod, strings.ToUpper),
+			Status:            p.intValue(annotationHCStatus, 100, 599),
+			TLSServerName:     p.stringValue(annotationHCTLSServerName),
+		},
+	}
+
+	if ns := p.normalized(annotationBackendNamespace, strings.ToLower); ns != nil {
+		cfg.BackendNamespace = *ns
+	}
+	if addr := p.targetAddress(annotationTargetAddress); addr != nil {
+		cfg.TargetAddress = *addr
+	}
+	if mode := p.oneOf(annotationServiceResolution, strings.ToLower,
+		serviceResolutionClusterIP, serviceResolutionHeadless); mode != nil {
+		cfg.ServiceResolution = *mode
+	}
+	if mode := p.oneOf(annotationExactTrailingSlash, strings.ToLower,
+		exactTrailingSlashPreserve, exactTrailingSlashStrip, exactTrailingSlashAppend); mode != nil {
+		cfg.ExactTrailingSlash = *mode
+	}
+	if id := p.intValue(annotationExistingResourceID, 1, 0); id != nil {
+		cfg.ExistingResourceID = strconv.Itoa(*id)
+	}
+	if protected := p.boolValue(annotationDeletionProtection); protected != nil {
+		cfg.DeletionProtection = *protected
+	} else {
+		p.decide(annotationDeletionProtection, false, configSourceDefault)
+	}
+
+	if ignore := p.boolValue(annotationIgnore); ignore != nil {
+		cfg.Ignore = *ignore
+	}
+
+	// PROXY protocol headers are only understood by raw TCP backends
+	if p.has(annotationProxyProtocol) {
+		p.errs = append(p.errs, fmt.Errorf("annotation %s is only supported for tcp resources",
+			p.r.annotationKey(annotationProxyProtocol)))
+	}
+
+	if hc := &cfg.HealthCheck; hc.Enabled != nil && *hc.Enabled {
+		if hc.Path == nil || *hc.Path == "" {
+			path := defaultHCPath
+			hc.Path = &path
+			p.decide(annotationHCPath, path, configSourceDefault)
+		}
+		if hc.Interval == nil {
+			interval := defaultHCInterval
+			hc.Interval = &interval
+			p.decide(annotationHCInterval, interval, configSourceDefault)
+		}
+		if hc.Method == nil || *hc.Method == "" {
+			method := defaultHCMethod
+			hc.Method = &method
+			p.decide(annotationHCMethod, method, configSourceDefault)
+		}
+	}
+
+	return cfg, p.corrections, p.decisions, utilerrors.NewAggregate(p.errs)
+}
+
+// decide records the value of the setting read from the named annotation
+func (p *annotationParser) decide(name string, value any, source string) {
+	p.decisions = append(p.decisions, configDecision{Key: p.r.annotationKey(name), Value: fmt.Sprint(value), Source: source})
+}
+
+// value returns the trimmed value of an annotation and whether it is set,
+// recording a correction if surrounding whitespace was removed
+func (p *annotationParser) value(name string) (string, bool) {
+	key := p.r.annotationKey(name)
+	raw, ok := p.annotations[key]
+	if !ok {
+		return "", false
+	}
+	v := strings.TrimSpace(raw)
+	if v != raw {
+		p.corrections = append(p.corrections, annotationCorrection{Key: key, From: raw, To: v})
+	}
+	return v, true
+}
+
+// has reports whether an annotation is set to a non-blank value
+func (p *annotationParser) has(name string) bool {
+	return strings.TrimSpace(p.annotations[p.r.annotationKey(name)]) != ""
+}
+
+// stringValue returns the trimmed value of a string annotation. An empty
+// value is kept, as it clears the corresponding Pangolin setting.
+func (p *annotationParser) stringValue(name string) *string {
+	v, ok := p.value(name)
+	if !ok {
+		return nil
+	}
+	p.decide(name, v, configSourceAnnotation)
+	return &v
+}
+
+// normalized returns the value of an annotation rewritten by normalize,
+// recording a correction if that changed it
+func (p *annotationParser) normalized(name string, normalize func(string) string) *string {
+	v := p.normalize(name, normalize)
+	if v != nil {
+		p.decide(name, *v, configSourceAnnotation)
+	}
+	return v
+}
+
+// normalize is like normalized, but leaves recording the decision to the
+// caller, which may still reject the value
+func (p *annotationParser) normalize(name string, normalize func(string) string) *string {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	if n := normalize(v); n != v {
+		p.corrections = append(p.corrections, annotationCorrection{Key: p.r.annotationKey(name), From: v, To: n})
+		v = n
+	}
+	return &v
+}
+
+// oneOf is like normalized, but also requires the result to be one of allowed
+func (p *annotationParser) oneOf(name string, normalize func(string) string, allowed ...string) *string {
+	v := p.normalize(name, normalize)
+	if v == nil {
+		return nil
+	}
+	for _, a := range allowed {
+		if *v == a {
+			p.decide(name, *v, configSourceAnnotation)
+			return v
+		}
+	}
+	p.errs = append(p.errs, fmt.Errorf("annotation %s must be one of %s, got %q",
+		p.r.annotationKey(name), strings.Join(allowed, ", "), *v))
+	return nil
+}
+
+// boolValue parses a boolean annotation case insensitively
+func (p *annotationParser) boolValue(name string) *bool {
+	v := p.normalize(name, strings.ToLower)
+	if v == nil {
+		return nil
+	}
+	b, err := strconv.ParseBool(*v)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("annotation %s must be true or false, got %q", p.r.annotationKey(name), *v))
+		return nil
+	}
+	p.decide(name, b, configSourceAnnotation)
+	return &b
+}
+
+// intValue parses an integer annotation that must be at least min and, if max
+// is positive, at most max
+func (p *annotationParser) intValue(name string, min, max int) *int {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < min || (max > 0 && i > max) {
+		bounds := fmt.Sprintf("at least %d", min)
+		if max > 0 {
+			bounds = fmt.Sprintf("between %d and %d", min, max)
+		}
+		p.errs = append(p.errs, fmt.Errorf("annotation %s must be an integer %s, got %q", p.r.annotationKey(name), bounds, v))
+		return nil
+	}
+	p.decide(name, i, configSourceAnnotation)
+	return &i
+}
+
+// headers parses a JSON array of {"name":"...","value":"..."} objects
+func (p *annotationParser) headers(name string) []pangolin.Header {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	var headers []pangolin.Header
+	if err := json.Unmarshal([]byte(v), &headers); err != nil {
+		p.errs = append(p.errs, fmt.Errorf("annotation %s must be a JSON array of headers: %w", p.r.annotationKey(name), err))
+		return nil
+	}
+	for _, h := range headers {
+		if strings.TrimSpace(h.Name) == "" {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains a header without a name", p.r.annotationKey(name)))
+			return nil
+		}
+	}
+	p.decide(name, v, configSourceAnnotation)
+	return headers
+}
+
+// responseHeaders parses a JSON object mapping header names to values.
+// Names must be valid HTTP header names and values must not span lines.
+func (p *annotationParser) responseHeaders(name string) map[string]string {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	key := p.r.annotationKey(name)
+
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(v), &headers); err != nil {
+		p.errs = append(p.errs, fmt.Errorf("annotation %s must be a JSON object of header names and values: %w", key, err))
+		return nil
+	}
+	names := make([]string, 0, len(headers))
+	for h := range headers {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+	for _, h := range names {
+		if !validHeaderName(h) {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains invalid header name %q", key, h))
+			return nil
+		}
+		if strings.ContainsAny(headers[h], "\r\n\x00") {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains an invalid value for header %q", key, h))
+			return nil
+		}
+	}
+	p.decide(name, v, configSourceAnnotation)
+	return headers
+}
+
+// methods parses a comma-separated list of HTTP methods case insensitively
+func (p *annotationParser) methods(name string) []string {
+	v := p.normalize(name, strings.ToUpper)
+	if v == nil {
+		return nil
+	}
+	key := p.r.annotationKey(name)
+
+	var methods []string
+	seen := make(map[string]bool)
+	for _, m := range strings.Split(*v, ",") {
+		m = strings.TrimSpace(m)
+		switch {
+		case m == "":
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains an empty entry", key))
+			return nil
+		case seen[m]:
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains %q more than once", key, m))
+			return nil
+		case !slices.Contains(httpMethods, m):
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains unknown HTTP method %q, must be one of %s",
+				key, m, strings.Join(httpMethods, ", ")))
+			return nil
+		}
+		seen[m] = true
+		methods = append(methods, m)
+	}
+	p.decide(name, strings.Join(methods, ","), configSourceAnnotation)
+	return methods
+}
+
+// validHeaderName reports whether name is a valid HTTP header name, a token
+// as defined by RFC 7230
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// metadata parses a metadata annotation, either a JSON object of strings or a
+// comma-separated list of key=value pairs. Keys under the reserved kubernetes.
+// prefix belong to the controller and are rejected.
+func (p *annotationParser) metadata(name string) map[string]string {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	key := p.r.annotationKey(name)
+
+	metadata := make(map[string]string)
+	if strings.HasPrefix(v, "{") {
+		if err := json.Unmarshal([]byte(v), &metadata); err != nil {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s must be a JSON object of strings: %w", key, err))
+			return nil
+		}
+	} else {
+		for _, pair := range strings.Split(v, ",") {
+			k, val, found := strings.Cut(pair, "=")
+			if !found {
+				p.errs = append(p.errs, fmt.Errorf("annotation %s must contain key=value pairs, got %q", key, strings.TrimSpace(pair)))
+				return nil
+			}
+			metadata[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch {
+		case strings.TrimSpace(k) == "":
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains an empty key", key))
+			return nil
+		case strings.HasPrefix(k, reservedMetadataPrefix):
+			p.errs = append(p.errs, fmt.Errorf("annotation %s must not set reserved key %q", key, k))
+			return nil
+		}
+	}
+	p.decide(name, v, configSourceAnnotation)
+	return metadata
+}
+
+// cidrs parses a comma-separated list of CIDRs such as 10.0.0.0/8 or
+// 2001:db8::/32, rejecting malformed, empty and duplicate entries
+func (p *annotationParser) cidrs(name string) []string {
+	v := p.normalize(name, strings.ToLower)
+	if v == nil {
+		return nil
+	}
+	key := p.r.annotationKey(name)
+
+	var cidrs []string
+	seen := make(map[string]bool)
+	for _, c := range strings.Split(*v, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains an empty entry", key))
+			return nil
+		}
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains invalid CIDR %q", key, c))
+			return nil
+		}
+		if seen[c] {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains %q more than once", key, c))
+			return nil
+		}
+		seen[c] = true
+		cidrs = append(cidrs, c)
+	}
+	p.decide(name, *v, configSourceAnnotation)
+	return cidrs
+}
+
+// list parses a comma-separated list annotation, rejecting empty and
+// duplicate entries
+func (p *annotationParser) list(name string) []string {
+	v, ok := p.value(name)
+	if !ok || v == "" {
+		return nil
+	}
+	var items []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains an empty entry", p.r.annotationKey(name)))
+			return nil
+		}
+		if seen[item] {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s contains %q more than once", p.r.annotationKey(name), item))
+			return nil
+		}
+		seen[item] = true
+		items = append(items, item)
+	}
+	p.decide(name, strings.Join(items, ","), configSourceAnnotation)
+	return items
+}
+
+// targetAddress parses an IP address or DNS name overriding the target host.
+// DNS names are lowercased.
+func (p *annotationParser) targetAddress(name string) *string {
+	v := p.normalize(name, strings.ToLower)
+	if v == nil {
+		return nil
+	}
+	if err := validateTargetAddress(*v); err != nil {
+		p.errs = append(p.errs, fmt.Errorf("annotation %s %w", p.r.annotationKey(name), err))
+		return nil
+	}
+	p.decide(name, *v, configSourceAnnotation)
+	return v
+}
+
+// validateTargetAddress checks that addr is an IP address or a DNS name
+func validateTargetAddress(addr string) error {
+	if net.ParseIP(addr) != nil {
+		return nil
+	}
+	if msgs := validation.IsDNS1123Subdomain(addr); len(msgs) > 0 {
+		return fmt.Errorf("must be an IP address or DNS name, got %q", addr)
+	}
+	return nil
+}
+
+// rateLimit returns the rate limit configured by the rate-limit annotations,
+// or nil if none is set. Both values must be positive integers and a burst
+// requires a rate.
+func (p *annotationParser) rateLimit() *pangolin.RateLimit {
+	rps := p.intValue(annotationRateLimitRPS, 1, 0)
+	burst := p.intValue(annotationRateLimitBurst, 1, 0)
+	if !p.has(annotationRateLimitRPS) {
+		if p.has(annotationRateLimitBurst) {
+			p.errs = append(p.errs, fmt.Errorf("annotation %s requires %s to be set",
+				p.r.annotationKey(annotationRateLimitBurst), p.r.annotationKey(annotationRateLimitRPS)))
+		}
+		return nil
+	}
+	if rps == nil {
+		return nil
+	}
+	rateLimit := &pangolin.RateLimit{RequestsPerSecond: *rps}
+	if burst != nil {
+		rateLimit.Burst = *burst
+	}
+	return rateLimit
+}
@@ -0,0 +1,513 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+func TestIngressReconciler_parseIngressConfig(t *testing.T) {
+	boolPtr := func(b bool) *bool { return &b }
+	intPtr := func(i int) *int { return &i }
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name                string
+		annotations         map[string]string
+		expected            *ingressConfig
+		expectedCorrections []annotationCorrection
+		expectedError       []string
+	}{
+		{
+			name:     "no annotations",
+			expected: &ingressConfig{},
+		},
+		{
+			name: "values are trimmed and lowercased",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/sso":                " TRUE ",
+				"pangolin.ingress.k8s.io/tls-server-name":    "backend.internal\n",
+				"pangolin.ingress.k8s.io/backend-namespace":  "Shared",
+				"pangolin.ingress.k8s.io/healthcheck-scheme": "HTTPS",
+			},
+			expected: &ingressConfig{
+				SSO:              boolPtr(true),
+				TLSServerName:    strPtr("backend.internal"),
+				BackendNamespace: "shared",
+				HealthCheck:      healthCheckConfig{Scheme: strPtr("https")},
+			},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/sso", From: " TRUE ", To: "TRUE"},
+				{Key: "pangolin.ingress.k8s.io/sso", From: "TRUE", To: "true"},
+				{Key: "pangolin.ingress.k8s.io/tls-server-name", From: "backend.internal\n", To: "backend.internal"},
+				{Key: "pangolin.ingress.k8s.io/healthcheck-scheme", From: "HTTPS", To: "https"},
+				{Key: "pangolin.ingress.k8s.io/backend-namespace", From: "Shared", To: "shared"},
+			},
+		},
+		{
+			name: "empty string clears the setting",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/set-host-header": "",
+			},
+			expected: &ingressConfig{SetHostHeader: strPtr("")},
+		},
+		{
+			name: "enabled health check gets defaults",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/healthcheck-enabled": "true",
+				"pangolin.ingress.k8s.io/healthcheck-method":  "head",
+			},
+			expected: &ingressConfig{
+				HealthCheck: healthCheckConfig{
+					Enabled:  boolPtr(true),
+					Path:     strPtr("/"),
+					Interval: intPtr(30),
+					Method:   strPtr("HEAD"),
+				},
+			},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/healthcheck-method", From: "head", To: "HEAD"},
+			},
+		},
+		{
+			name: "disabled health check gets no defaults",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/healthcheck-enabled": "false",
+			},
+			expected: &ingressConfig{HealthCheck: healthCheckConfig{Enabled: boolPtr(false)}},
+		},
+		{
+			name: "rate limit and deletion protection",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/rate-limit-rps":      "10",
+				"pangolin.ingress.k8s.io/rate-limit-burst":    "20",
+				"pangolin.ingress.k8s.io/deletion-protection": "true",
+				"pangolin.ingress.k8s.io/headers":             `[{"name":"X-Foo","value":"bar"}]`,
+			},
+			expected: &ingressConfig{
+				RateLimit:          &pangolin.RateLimit{RequestsPerSecond: 10, Burst: 20},
+				DeletionProtection: true,
+				Headers:            []pangolin.Header{{Name: "X-Foo", Value: "bar"}},
+			},
+		},
+		{
+			name: "metadata as key=value pairs",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/metadata": "team=payments, cost-center = 42,env=",
+			},
+			expected: &ingressConfig{
+				Metadata: map[string]string{"team": "payments", "cost-center": "42", "env": ""},
+			},
+		},
+		{
+			name: "metadata as JSON object",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/metadata": `{"team":"payments","env":"prod"}`,
+			},
+			expected: &ingressConfig{
+				Metadata: map[string]string{"team": "payments", "env": "prod"},
+			},
+		},
+		{
+			name: "metadata must not set reserved keys",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/metadata": "team=payments,kubernetes.ingress=other/ingress",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`metadata must not set reserved key "kubernetes.ingress"`},
+		},
+		{
+			name: "malformed metadata",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/metadata": "team",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`metadata must contain key=value pairs, got "team"`},
+		},
+		{
+			name: "invalid values are all reported",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/ssl":                "maybe",
+				"pangolin.ingress.k8s.io/healthcheck-port":   "70000",
+				"pangolin.ingress.k8s.io/healthcheck-scheme": "ftp",
+				"pangolin.ingress.k8s.io/headers":            "X-Foo: bar",
+			},
+			expected: &ingressConfig{},
+			expectedError: []string{
+				"pangolin.ingress.k8s.io/ssl must be true or false",
+				"pangolin.ingress.k8s.io/healthcheck-port must be an integer between 1 and 65535",
+				"pangolin.ingress.k8s.io/healthcheck-scheme must be one of http, https",
+				"pangolin.ingress.k8s.io/headers must be a JSON array of headers",
+			},
+		},
+		{
+			name: "header without a name",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/healthcheck-headers": `[{"name":" ","value":"bar"}]`,
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"healthcheck-headers contains a header without a name"},
+		},
+		{
+			name: "forwarded headers policy",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/forwarded-headers": "Strip",
+			},
+			expected: &ingressConfig{ForwardedHeaders: strPtr("strip")},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/forwarded-headers", From: "Strip", To: "strip"},
+			},
+		},
+		{
+			name: "invalid forwarded headers policy",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/forwarded-headers": "append",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`forwarded-headers must be one of trust, overwrite, strip, got "append"`},
+		},
+		{
+			name: "response headers",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/response-headers": `{"Strict-Transport-Security":"max-age=63072000; includeSubDomains","X-Content-Type-Options":"nosniff"}`,
+			},
+			expected: &ingressConfig{ResponseHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+			}},
+		},
+		{
+			name: "response headers not a JSON object",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/response-headers": "X-Frame-Options: DENY",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"response-headers must be a JSON object of header names and values"},
+		},
+		{
+			name: "malformed response header name",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/response-headers": `{"X-Frame-Options":"DENY","X Bad:Name":"1"}`,
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`response-headers contains invalid header name "X Bad:Name"`},
+		},
+		{
+			name: "empty response header name",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/response-headers": `{"":"1"}`,
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`response-headers contains invalid header name ""`},
+		},
+		{
+			name: "response header value spanning lines",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/response-headers": `{"X-Frame-Options":"DENY\r\nSet-Cookie: a=b"}`,
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`response-headers contains an invalid value for header "X-Frame-Options"`},
+		},
+		{
+			name: "allowed methods",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allowed-methods": "get, head,POST",
+			},
+			expected: &ingressConfig{AllowedMethods: []string{"GET", "HEAD", "POST"}},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/allowed-methods", From: "get, head,POST", To: "GET, HEAD,POST"},
+			},
+		},
+		{
+			name: "unknown allowed method",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allowed-methods": "GET,FETCH",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`allowed-methods contains unknown HTTP method "FETCH"`},
+		},
+		{
+			name: "duplicate allowed method",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allowed-methods": "GET,GET",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`allowed-methods contains "GET" more than once`},
+		},
+		{
+			name: "empty allowed method",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allowed-methods": "GET,,POST",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"allowed-methods contains an empty entry"},
+		},
+		{
+			name: "allow and deny CIDRs",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allow-cidrs": "10.0.0.0/8, 2001:DB8::/32",
+				"pangolin.ingress.k8s.io/deny-cidrs":  "10.0.13.0/24",
+			},
+			expected: &ingressConfig{
+				AllowCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+				DenyCIDRs:  []string{"10.0.13.0/24"},
+			},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/allow-cidrs", From: "10.0.0.0/8, 2001:DB8::/32", To: "10.0.0.0/8, 2001:db8::/32"},
+			},
+		},
+		{
+			name: "CIDR without prefix length",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allow-cidrs": "10.0.0.0/8,192.168.1.1",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`allow-cidrs contains invalid CIDR "192.168.1.1"`},
+		},
+		{
+			name: "malformed CIDR",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/deny-cidrs": "10.0.0.0/33",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`deny-cidrs contains invalid CIDR "10.0.0.0/33"`},
+		},
+		{
+			name: "empty CIDR",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/deny-cidrs": "10.0.0.0/8,",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"deny-cidrs contains an empty entry"},
+		},
+		{
+			name: "duplicate CIDR",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/allow-cidrs": "10.0.0.0/8,10.0.0.0/8",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`allow-cidrs contains "10.0.0.0/8" more than once`},
+		},
+		{
+			name: "exact trailing slash",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/exact-trailing-slash": " strip",
+			},
+			expected: &ingressConfig{ExactTrailingSlash: "strip"},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/exact-trailing-slash", From: " strip", To: "strip"},
+			},
+		},
+		{
+			name: "invalid exact trailing slash",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/exact-trailing-slash": "both",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`exact-trailing-slash must be one of preserve, strip, append, got "both"`},
+		},
+		{
+			name: "target weight",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/target-weight": "50",
+			},
+			expected: &ingressConfig{TargetWeight: intPtr(50)},
+		},
+		{
+			name: "target weight out of range",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/target-weight": "0",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"target-weight must be an integer between 1 and 1000"},
+		},
+		{
+			name: "priority",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/priority": " 10",
+			},
+			expected: &ingressConfig{Priority: intPtr(10)},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/priority", From: " 10", To: "10"},
+			},
+		},
+		{
+			name: "priority out of range",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/priority": "1001",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"priority must be an integer between 1 and 1000"},
+		},
+		{
+			name: "ignore",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/ignore": "true",
+			},
+			expected: &ingressConfig{Ignore: true},
+		},
+		{
+			name: "site IDs",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/site-ids": " eu-site, us-site ",
+			},
+			expected: &ingressConfig{SiteIDs: []string{"eu-site", "us-site"}},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/site-ids", From: " eu-site, us-site ", To: "eu-site, us-site"},
+			},
+		},
+		{
+			name: "empty site ID",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/site-ids": "eu-site,,us-site",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"site-ids contains an empty entry"},
+		},
+		{
+			name: "target address as IP",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/target-address": "10.0.0.12",
+			},
+			expected: &ingressConfig{TargetAddress: "10.0.0.12"},
+		},
+		{
+			name: "target address as DNS name",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/target-address": "App.Internal.Example.com",
+			},
+			expected: &ingressConfig{TargetAddress: "app.internal.example.com"},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/target-address", From: "App.Internal.Example.com", To: "app.internal.example.com"},
+			},
+		},
+		{
+			name: "invalid target address",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/target-address": "http://app:8080",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`target-address must be an IP address or DNS name, got "http://app:8080"`},
+		},
+		{
+			name: "headless service resolution",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/service-resolution": "Headless",
+			},
+			expected: &ingressConfig{ServiceResolution: "headless"},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/service-resolution", From: "Headless", To: "headless"},
+			},
+		},
+		{
+			name: "invalid service resolution",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/service-resolution": "nodeport",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`service-resolution must be one of clusterip, headless, got "nodeport"`},
+		},
+		{
+			name: "existing resource ID",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/existing-resource-id": " 42 ",
+			},
+			expected: &ingressConfig{ExistingResourceID: "42"},
+			expectedCorrections: []annotationCorrection{
+				{Key: "pangolin.ingress.k8s.io/existing-resource-id", From: " 42 ", To: "42"},
+			},
+		},
+		{
+			name: "invalid existing resource ID",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/existing-resource-id": "app",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{`existing-resource-id must be an integer at least 1, got "app"`},
+		},
+		{
+			name: "proxy protocol on an http resource",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/proxy-protocol": "v2",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"proxy-protocol is only supported for tcp resources"},
+		},
+		{
+			name: "burst without rps",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/rate-limit-burst": "10",
+			},
+			expected:      &ingressConfig{},
+			expectedError: []string{"rate-limit-burst requires pangolin.ingress.k8s.io/rate-limit-rps to be set"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &IngressReconciler{}
+			cfg, corrections, _, err := r.parseIngressConfig(tt.annotations)
+
+			if len(tt.expectedError) == 0 && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, want := range tt.expectedError {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error containing %q, got %v", want, err)
+				}
+			}
+			if !reflect.DeepEqual(cfg, tt.expected) {
+				t.Errorf("Expected config %+v, got %+v", tt.expected, cfg)
+			}
+			if !reflect.DeepEqual(corrections, tt.expectedCorrections) {
+				t.Errorf("Expected corrections %+v, got %+v", tt.expectedCorrections, corrections)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_parseIngressConfigPrefix(t *testing.T) {
+	r := &IngressReconciler{AnnotationPrefix: "example.com"}
+	cfg, _, _, err := r.parseIngressConfig(map[string]string{
+		"example.com/sso":             "false",
+		"pangolin.ingress.k8s.io/ssl": "true",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.SSO == nil || *cfg.SSO {
+		t.Errorf("Expected SSO to be read under the custom prefix, got %v", cfg.SSO)
+	}
+	if cfg.SSL != nil {
+		t.Errorf("Expected annotations under the default prefix to be ignored, got %v", *cfg.SSL)
+	}
+}
+
+func TestIngressReconciler_parseIngressConfigDecisions(t *testing.T) {
+	r := &IngressReconciler{}
+	_, _, decisions, err := r.parseIngressConfig(map[string]string{
+		"pangolin.ingress.k8s.io/sso":                 "TRUE",
+		"pangolin.ingress.k8s.io/ssl":                 "maybe",
+		"pangolin.ingress.k8s.io/healthcheck-enabled": "true",
+		"pangolin.ingress.k8s.io/healthcheck-port":    "8080",
+		"pangolin.ingress.k8s.io/healthcheck-method":  "",
+	})
+	if err == nil {
+		t.Fatal("Expected an error for the invalid ssl annotation")
+	}
+
+	expected := []configDecision{
+		{Key: "pangolin.ingress.k8s.io/sso", Value: "true", Source: "annotation"},
+		{Key: "pangolin.ingress.k8s.io/healthcheck-enabled", Value: "true", Source: "annotation"},
+		{Key: "pangolin.ingress.k8s.io/healthcheck-port", Value: "8080", Source: "annotation"},
+		{Key: "pangolin.ingress.k8s.io/deletion-protection", Value: "false", Source: "default"},
+		{Key: "pangolin.ingress.k8s.io/healthcheck-path", Value: "/", Source: "default"},
+		{Key: "pangolin.ingress.k8s.io/healthcheck-interval", Value: "30", Source: "default"},
+		{Key: "pangolin.ingress.k8s.io/healthcheck-method", Value: "GET", Source: "default"},
+	}
+	if !reflect.DeepEqual(decisions, expected) {
+		t.Errorf("Expected decisions %+v, got %+v", expected, decisions)
+	}
+}
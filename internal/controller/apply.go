@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fieldManager is the field manager of the controller's server-side applies.
+// It must stay stable: the fields it owns are only released by applies under
+// the same name.
+const fieldManager = "pangolin-ingress-controller"
+
+// applyOptions are the options of every server-side apply of the controller.
+// Ownership is forced so that the controller takes over its annotations from
+// the Update-based writes of earlier versions.
+var applyOptions = []client.PatchOption{client.FieldOwner(fieldManager), client.ForceOwnership}
+
+// managedAnnotations returns the controller-managed annotations among
+// annotations, which are the ones the controller owns on its objects
+func (r *IngressReconciler) managedAnnotations(annotations map[string]string) map[string]string {
+	managed := make(map[string]string)
+	for key, value := range annotations {
+		name, ok := strings.CutPrefix(key, r.annotationPrefix()+"/")
+		if ok && isControllerManagedAnnotation(name) {
+			managed[key] = value
+		}
+	}
+	return managed
+}
+
+// applyIngressAnnotations server-side applies the controller-managed
+// annotations of ingress. Unlike an Update, the apply carries no resource
+// version and only the controller's own fields, so it neither conflicts with
+// nor overwrites concurrent edits of the Ingress by others.
+func (r *IngressReconciler) applyIngressAnnotations(ctx context.Context, ingress *networkingv1.Ingress) error {
+	patch := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ingress.Name,
+			Namespace:   ingress.Namespace,
+			Annotations: r.managedAnnotations(ingress.Annotations),
+		},
+	}
+	return r.Patch(ctx, patch, client.Apply, applyOptions...)
+}
+
+// applyIngressStatus server-side applies the load balancer status of ingress
+func (r *IngressReconciler) applyIngressStatus(ctx context.Context, ingress *networkingv1.Ingress) error {
+	patch := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: networkingv1.SchemeGroupVersion.String(), Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ingress.Name,
+			Namespace: ingress.Namespace,
+		},
+		Status: networkingv1.IngressStatus{
+			LoadBalancer: *ingress.Status.LoadBalancer.DeepCopy(),
+		},
+	}
+	return r.Status().Patch(ctx, patch, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+// applyAnnotations server-side applies the controller-managed annotations of
+// service
+func (r *ServiceReconciler) applyAnnotations(ctx context.Context, service *corev1.Service) error {
+	patch := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        service.Name,
+			Namespace:   service.Namespace,
+			Annotations: r.Ingress.managedAnnotations(service.Annotations),
+		},
+	}
+	return r.Patch(ctx, patch, client.Apply, applyOptions...)
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestIngressReconciler_serverSideApply(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+
+	var applies []string
+	checkApply := func(kind string, patch client.Patch, opts client.PatchOptions) error {
+		if patch.Type() != types.ApplyPatchType {
+			return fmt.Errorf("expected a server-side apply of the %s, got a %s patch", kind, patch.Type())
+		}
+		if opts.FieldManager != fieldManager || opts.Force == nil || !*opts.Force {
+			return fmt.Errorf("expected a forced apply of the %s by %q, got field manager %q", kind, fieldManager, opts.FieldManager)
+		}
+		applies = append(applies, kind)
+		return nil
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				o := client.PatchOptions{}
+				o.ApplyOptions(opts)
+				if err := checkApply("annotations", patch, o); err != nil {
+					return err
+				}
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				o := client.SubResourcePatchOptions{}
+				o.ApplyOptions(opts)
+				if err := checkApply(subResource, patch, o.PatchOptions); err != nil {
+					return err
+				}
+				return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+			},
+			SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				return fmt.Errorf("expected the %s to be applied, not updated", subResource)
+			},
+		}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(applies) != 2 || applies[0] != "annotations" || applies[1] != "status" {
+		t.Errorf("Expected the annotations and the status to be applied, got %v", applies)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if updated.Annotations["pangolin.ingress.k8s.io/resource-id"] == "" {
+		t.Errorf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	if lb := updated.Status.LoadBalancer.Ingress; len(lb) != 1 || lb[0].IP != fakeProxyIP {
+		t.Errorf("Expected status IP %q, got %+v", fakeProxyIP, lb)
+	}
+}
+
+func TestIngressReconciler_applyConcurrentEdit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{"example.com/owner": "team-a"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{Client: fakeClient, Scheme: scheme}
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(ingress)
+
+	stale := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, key, stale); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+
+	// Another manager edits the Ingress after the controller read it
+	edited := stale.DeepCopy()
+	edited.Labels = map[string]string{"team": "b"}
+	edited.Annotations["example.com/owner"] = "team-b"
+	if err := fakeClient.Update(ctx, edited); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+
+	// An Update of the stale copy conflicts, the applies don't
+	stale.Annotations["pangolin.ingress.k8s.io/resource-id"] = "42"
+	stale.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: fakeProxyIP}}
+	if err := fakeClient.Update(ctx, stale.DeepCopy()); err == nil {
+		t.Fatalf("Expected an Update of the stale Ingress to conflict")
+	}
+	if err := reconciler.applyIngressAnnotations(ctx, stale); err != nil {
+		t.Fatalf("Unexpected error applying annotations: %v", err)
+	}
+	if err := reconciler.applyIngressStatus(ctx, stale); err != nil {
+		t.Fatalf("Unexpected error applying status: %v", err)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, key, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if updated.Annotations["pangolin.ingress.k8s.io/resource-id"] != "42" {
+		t.Errorf("Expected the applied resource ID annotation, got %v", updated.Annotations)
+	}
+	if updated.Annotations["example.com/owner"] != "team-b" || updated.Labels["team"] != "b" {
+		t.Errorf("Expected the concurrent edit to be kept, got labels %v and annotations %v", updated.Labels, updated.Annotations)
+	}
+	if lb := updated.Status.LoadBalancer.Ingress; len(lb) != 1 || lb[0].IP != fakeProxyIP {
+		t.Errorf("Expected status IP %q, got %+v", fakeProxyIP, lb)
+	}
+}
+
+func TestIngressReconciler_managedAnnotations(t *testing.T) {
+	reconciler := &IngressReconciler{AnnotationPrefix: "example.com"}
+	got := reconciler.managedAnnotations(map[string]string{
+		"example.com/resource-id":              "42",
+		"example.com/certificate-fingerprints": `{"42":"abc"}`,
+		"example.com/sso":                      "true",
+		"pangolin.ingress.k8s.io/resource-id":  "7",
+		corev1.LastAppliedConfigAnnotation:     "{}",
+	})
+	if len(got) != 2 || got["example.com/resource-id"] != "42" || got["example.com/certificate-fingerprints"] != `{"42":"abc"}` {
+		t.Errorf("Expected only the controller-managed annotations under the prefix, got %v", got)
+	}
+}
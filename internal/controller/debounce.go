@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+// debouncedHandler delays the requests enqueued by an event handler so that
+// events for the same object within the delay coalesce into one reconcile.
+// The workqueue keeps a single waiting entry per request and the reconciler
+// reads the object when the request is processed, so the last state is always
+// reconciled. Events that arrive while a request is being reconciled queue it
+// again once the delay has passed.
+type debouncedHandler struct {
+	handler.EventHandler
+	delay time.Duration
+}
+
+// debounce wraps h so that its requests are enqueued after delay. A
+// non-positive delay returns h unchanged.
+func debounce(h handler.EventHandler, delay time.Duration) handler.EventHandler {
+	if delay <= 0 {
+		return h
+	}
+	return &debouncedHandler{EventHandler: h, delay: delay}
+}
+
+func (h *debouncedHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Create(ctx, e, &delayedQueue{RateLimitingInterface: q, delay: h.delay})
+}
+
+func (h *debouncedHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Update(ctx, e, &delayedQueue{RateLimitingInterface: q, delay: h.delay})
+}
+
+func (h *debouncedHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Delete(ctx, e, &delayedQueue{RateLimitingInterface: q, delay: h.delay})
+}
+
+func (h *debouncedHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Generic(ctx, e, &delayedQueue{RateLimitingInterface: q, delay: h.delay})
+}
+
+// delayedQueue turns the Add calls of an event handler into AddAfter calls.
+// The delaying queue only keeps the earliest ready time of a waiting item, so
+// repeated adds do not push the reconcile further out.
+type delayedQueue struct {
+	workqueue.RateLimitingInterface
+	delay time.Duration
+}
+
+func (q *delayedQueue) Add(item interface{}) {
+	q.RateLimitingInterface.AddAfter(item, q.delay)
+}
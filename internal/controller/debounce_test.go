@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+func TestDebounce(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	h := debounce(&handler.EnqueueRequestForObject{}, delay)
+
+	update := func(generation int64) {
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Generation: generation}}
+		h.Update(context.Background(), event.UpdateEvent{ObjectOld: ingress, ObjectNew: ingress}, queue)
+	}
+	waitForLen := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(10 * delay)
+		for queue.Len() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d queued requests, got %d", want, queue.Len())
+			}
+			time.Sleep(delay / 10)
+		}
+	}
+
+	for i := int64(1); i <= 50; i++ {
+		update(i)
+	}
+	if got := queue.Len(); got != 0 {
+		t.Errorf("Expected requests to wait for the debounce delay, got %d queued", got)
+	}
+	waitForLen(1)
+	time.Sleep(2 * delay)
+	if got := queue.Len(); got != 1 {
+		t.Fatalf("Expected rapid updates to coalesce into 1 request, got %d", got)
+	}
+
+	// An update during the reconcile queues the request again afterwards
+	item, _ := queue.Get()
+	update(51)
+	time.Sleep(2 * delay)
+	if got := queue.Len(); got != 0 {
+		t.Errorf("Expected the request not to be queued while it is processed, got %d", got)
+	}
+	queue.Done(item)
+	waitForLen(1)
+}
+
+func TestDebounceDisabled(t *testing.T) {
+	h := &handler.EnqueueRequestForObject{}
+	if got := debounce(h, 0); got != handler.EventHandler(h) {
+		t.Errorf("Expected a zero delay to leave the handler unchanged, got %T", got)
+	}
+}
@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+)
+
+const (
+	envtestAPIKeySecret    = "pangolin-api-key"
+	envtestAPIKeyNamespace = "pangolin-system"
+	envtestTimeout         = 30 * time.Second
+)
+
+// startTestEnvironment starts a real kube-apiserver and etcd for the duration
+// of the test. It skips the test unless the control plane binaries are
+// available via KUBEBUILDER_ASSETS (see `make test-integration`).
+func startTestEnvironment(t *testing.T) (*rest.Config, client.Client) {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, skipping envtest integration test")
+	}
+
+	env := &envtest.Environment{}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("Failed to start test environment: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("Failed to stop test environment: %v", err)
+		}
+	})
+
+	k8sClient, err := client.New(cfg, client.Options{Scheme: newEnvtestScheme(t)})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return cfg, k8sClient
+}
+
+func newEnvtestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("Failed to build scheme: %v", err)
+	}
+	return scheme
+}
+
+// startTestManager creates the API key Secret and runs a manager with an
+// IngressReconciler talking to the Pangolin API at pangolinURL until the test
+// ends.
+func startTestManager(t *testing.T, cfg *rest.Config, k8sClient client.Client, pangolinURL string) {
+	t.Helper()
+	ctx := context.Background()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: envtestAPIKeyNamespace}}
+	if err := k8sClient.Create(ctx, ns); err != nil {
+		t.Fatalf("Failed to create namespace: %v", err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: envtestAPIKeySecret, Namespace: envtestAPIKeyNamespace},
+		Data:       map[string][]byte{"api-key": []byte("test-key")},
+	}
+	if err := k8sClient.Create(ctx, secret); err != nil {
+		t.Fatalf("Failed to create API key secret: %v", err)
+	}
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:                 newEnvtestScheme(t),
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	reconciler, err := NewIngressReconciler(mgr.GetClient(), mgr.GetScheme(), ReconcilerOptions{
+		Recorder:        mgr.GetEventRecorderFor("pangolin-ingress-controller"),
+		PangolinBaseURL: pangolinURL,
+		APIKeySecret:    envtestAPIKeySecret,
+		APIKeyNamespace: envtestAPIKeyNamespace,
+		OrgID:           fakeOrgID,
+		SiteNiceID:      fakeSiteNiceID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reconciler: %v", err)
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		t.Fatalf("Failed to set up reconciler: %v", err)
+	}
+
+	mgrCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Start(mgrCtx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Manager exited with error: %v", err)
+		}
+	})
+}
+
+// eventually polls check until it succeeds or the envtest timeout expires.
+func eventually(t *testing.T, what string, check func() error) {
+	t.Helper()
+	deadline := time.Now().Add(envtestTimeout)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s: %v", what, err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func TestEnvtest_IngressLifecycle(t *testing.T) {
+	cfg, k8sClient := startTestEnvironment(t)
+	fakePangolin := newFakePangolin(t)
+	startTestManager(t, cfg, k8sClient, fakePangolin.URL)
+	ctx := context.Background()
+
+	service := newTestService("app-service", 80)
+	if err := k8sClient.Create(ctx, service); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+	if err := k8sClient.Create(ctx, ingress); err != nil {
+		t.Fatalf("Failed to create ingress: %v", err)
+	}
+	key := client.ObjectKeyFromObject(ingress)
+
+	// Creation provisions the resource and target and publishes the status
+	var resourceID int
+	eventually(t, "resource creation", func() error {
+		current := &networkingv1.Ingress{}
+		if err := k8sClient.Get(ctx, key, current); err != nil {
+			return err
+		}
+		if !controllerutil.ContainsFinalizer(current, defaultFinalizerName) {
+			return fmt.Errorf("finalizer not added yet")
+		}
+		id, err := strconv.Atoi(current.Annotations["pangolin.ingress.k8s.io/resource-id"])
+		if err != nil {
+			return fmt.Errorf("resource ID annotation not set yet")
+		}
+		if fakePangolin.Resource(id) == nil {
+			return fmt.Errorf("resource %d not created", id)
+		}
+		if n := len(fakePangolin.Targets(id)); n != 1 {
+			return fmt.Errorf("expected 1 target, got %d", n)
+		}
+		lb := current.Status.LoadBalancer.Ingress
+		if len(lb) != 1 || lb[0].IP != fakeProxyIP {
+			return fmt.Errorf("status not updated yet: %+v", lb)
+		}
+		resourceID = id
+		return nil
+	})
+
+	// Deletion cleans up the resource before the finalizer is released
+	if err := k8sClient.Delete(ctx, ingress); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	eventually(t, "ingress deletion", func() error {
+		err := k8sClient.Get(ctx, key, &networkingv1.Ingress{})
+		if err == nil {
+			return fmt.Errorf("ingress still exists")
+		}
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	if fakePangolin.Resource(resourceID) != nil {
+		t.Errorf("Expected resource %d to be deleted", resourceID)
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin/pangolintest"
+)
+
+const (
+	fakeOrgID      = pangolintest.OrgID
+	fakeSiteNiceID = "test-site"
+	fakeSiteID     = 7
+	fakeProxyIP    = "203.0.113.10"
+)
+
+// fakePangolin is the in-memory Pangolin API of pangolintest, seeded with a
+// site and a domain, with the knobs controller tests need on top.
+type fakePangolin struct {
+	*pangolintest.Server
+
+	// failTarget, if set, makes target creation fail for matching requests
+	failTarget func(*pangolin.CreateTargetRequest) bool
+	// accepted, if set, answers requests with this method with 202 Accepted
+	// and an operation URL, without carrying them out
+	accepted string
+	// batchCreate serves the transactional create endpoint; without it the
+	// endpoint is missing like in Pangolin versions that lack it
+	batchCreate bool
+	// batchCreateNotFound answers the transactional create endpoint with a
+	// 404 API error, like for an organization that isn't visible yet
+	batchCreateNotFound bool
+}
+
+func newFakePangolin(t *testing.T) *fakePangolin {
+	t.Helper()
+	server, c := pangolintest.NewFakeServer()
+	c.Close()
+	t.Cleanup(server.Close)
+	server.AddSite(pangolin.Site{ID: fakeSiteID, NiceID: fakeSiteNiceID, Name: "Test Site", ProxyIP: fakeProxyIP, Online: true})
+	server.AddDomain(pangolin.Domain{ID: "domain-1", BaseDomain: "example.com"})
+
+	f := &fakePangolin{Server: server}
+	server.Intercept(f.intercept)
+	return f
+}
+
+// client returns a Pangolin client pointed at the fake server.
+func (f *fakePangolin) client() *pangolin.Client {
+	return pangolin.NewClient(f.URL, pangolintest.APIKey, fakeOrgID)
+}
+
+// unavailable answers requests with the given method with 503 Service
+// Unavailable, carrying retryAfter as Retry-After if set, until ClearFaults.
+func (f *fakePangolin) unavailable(method, retryAfter string) {
+	f.InjectFault(pangolintest.Fault{Method: method, Status: http.StatusServiceUnavailable, RetryAfter: retryAfter})
+}
+
+// allTargets returns the targets of all resources.
+func (f *fakePangolin) allTargets() []pangolin.Target {
+	var out []pangolin.Target
+	for _, res := range f.Resources() {
+		out = append(out, f.Targets(res.ID)...)
+	}
+	return out
+}
+
+func (f *fakePangolin) intercept(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method == f.accepted {
+		w.Header().Set("Location", "/v1/operation/1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"data":{"id":"1","status":"pending"}}`))
+		return true
+	}
+
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/resources:batchCreate") && f.batchCreateNotFound:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"organization not found"}`))
+		return true
+	case strings.HasSuffix(req.URL.Path, "/resources:batchCreate") && !f.batchCreate:
+		http.NotFound(w, req)
+		return true
+	case strings.HasSuffix(req.URL.Path, "/target") && req.Method == http.MethodPut && f.failTarget != nil:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return true
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		var target pangolin.CreateTargetRequest
+		if err := json.Unmarshal(body, &target); err == nil && f.failTarget(&target) {
+			http.Error(w, "target creation failed", http.StatusInternalServerError)
+			return true
+		}
+	}
+	return false
+}
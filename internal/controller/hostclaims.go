@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+)
+
+// hostConflictError reports a host that another Ingress already claimed
+// while ExclusiveHosts is set
+type hostConflictError struct {
+	host   string
+	holder string
+}
+
+func (e *hostConflictError) Error() string {
+	return fmt.Sprintf("host %s is already claimed by Ingress %s", e.host, e.holder)
+}
+
+// claimHost records owner as the Ingress routing host, unless another
+// Ingress claimed it first. It returns the Ingress holding the claim, which
+// is owner if the claim succeeded.
+func (r *IngressReconciler) claimHost(host, owner string) string {
+	r.hostMu.Lock()
+	defer r.hostMu.Unlock()
+	if holder, ok := r.hostOwners[host]; ok {
+		return holder
+	}
+	if r.hostOwners == nil {
+		r.hostOwners = make(map[string]string)
+	}
+	r.hostOwners[host] = owner
+	return owner
+}
+
+// releaseHost drops the claim of owner on host, if it holds it
+func (r *IngressReconciler) releaseHost(host, owner string) {
+	r.hostMu.Lock()
+	defer r.hostMu.Unlock()
+	if r.hostOwners[host] == owner {
+		delete(r.hostOwners, host)
+	}
+}
+
+// releaseHosts drops the claims of owner on all hosts not in keep, e.g. all
+// of them once the Ingress is deleted or no longer managed
+func (r *IngressReconciler) releaseHosts(owner string, keep map[string]bool) {
+	r.hostMu.Lock()
+	defer r.hostMu.Unlock()
+	for host, holder := range r.hostOwners {
+		if holder == owner && !keep[host] {
+			delete(r.hostOwners, host)
+		}
+	}
+}
@@ -2,110 +2,468 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
 )
 
 const (
-	pangolinFinalizerName = "pangolin.ingress.k8s.io/finalizer"
-	annotationResourceID  = "pangolin.ingress.k8s.io/resource-id"
+	// defaultFinalizerName is the finalizer added to managed Ingresses unless
+	// overridden via IngressReconciler.FinalizerName
+	defaultFinalizerName = "pangolin.ingress.k8s.io/finalizer"
+
+	// legacyIngressClassAnnotation selects the class of an Ingress predating
+	// spec.ingressClassName
+	legacyIngressClassAnnotation = "kubernetes.io/ingress.class"
+
+	// defaultTargetWeight is the weight of targets without the target-weight
+	// annotation unless overridden via IngressReconciler.DefaultTargetWeight.
+	// It is also Pangolin's default.
+	defaultTargetWeight = 100
+	// maxTargetWeight is the highest target weight accepted
+	maxTargetWeight = 1000
+
+	// defaultResourcePriority is the priority of resources of Ingresses
+	// without the priority annotation; lower priorities are matched first
+	defaultResourcePriority = 100
+	// maxResourcePriority is the highest resource priority accepted
+	maxResourcePriority = 1000
+
+	// defaultAnnotationPrefix is the prefix applied to all annotation names
+	// below unless overridden via IngressReconciler.AnnotationPrefix
+	defaultAnnotationPrefix = "pangolin.ingress.k8s.io"
+
+	// defaultTargetConcurrency is the number of targets of a single Ingress
+	// host reconciled in parallel unless overridden via
+	// IngressReconciler.TargetConcurrency
+	defaultTargetConcurrency = 4
+
+	// requestSigningHMACSHA256 signs Pangolin API requests with HMAC-SHA256
+	// using the hmac-key of the API key secret
+	requestSigningHMACSHA256 = "hmac-sha256"
+
+	// Policies for a path listed more than once for a host: the backend of
+	// the first or of the last occurrence is used
+	duplicatePathFirstWins = "first-wins"
+	duplicatePathLastWins  = "last-wins"
+
+	// Behaviors for hosts only listed in spec.tls: they are skipped with an
+	// event, or get a resource without targets holding their certificate
+	tlsOnlyHostsSkip        = "skip"
+	tlsOnlyHostsPlaceholder = "placeholder"
+
+	// defaultStatusPollInterval is the delay before re-checking whether
+	// Pangolin exposes a proxy IP for a resource unless overridden via
+	// IngressReconciler.StatusPollInterval; it doubles on every attempt
+	defaultStatusPollInterval = 2 * time.Second
+
+	// defaultStatusPollTimeout is how long an Ingress is requeued to wait for
+	// a proxy IP before its status falls back to the rule host, unless
+	// overridden via IngressReconciler.StatusPollTimeout
+	defaultStatusPollTimeout = time.Minute
+
+	// ingressClassRecheckInterval is how long the IngressClass is not looked
+	// up again after it turned out to be missing or owned by another
+	// controller
+	ingressClassRecheckInterval = 30 * time.Second
+
+	// operationPendingRequeue is the delay before an Ingress is reconciled
+	// again after Pangolin accepted one of its writes for asynchronous
+	// processing
+	operationPendingRequeue = 15 * time.Second
+
+	// Metadata keys the controller sets on resources and targets. Keys under
+	// reservedMetadataPrefix can't be set through the metadata annotation.
+	reservedMetadataPrefix = "kubernetes."
+	metadataIngress        = pangolin.MetadataIngress
+	metadataDrainStarted   = "kubernetes.drain-started"
+	// metadataOwners lists the Ingresses (comma-separated namespace/name)
+	// contributing paths to a resource, which is shared by all Ingresses of
+	// the same host
+	metadataOwners = pangolin.MetadataOwners
+	// metadataNamedPort records name=number for targets of a named Service
+	// port, so that the last known number survives the port briefly
+	// disappearing during a rollout
+	metadataNamedPort = "kubernetes.named-port"
+	// metadataInstanceID is the InstanceID of the controller instance that
+	// created a resource
+	metadataInstanceID = pangolin.MetadataInstanceID
+
+	// annotationResourceID records the resource of the first host of an
+	// Ingress, annotationResourceIDs the resources of all hosts as a JSON
+	// object keyed by host
+	annotationResourceID  = "resource-id"
+	annotationResourceIDs = "resource-ids"
+
+	// annotationLastError records the time and message of the last failed
+	// reconcile, until a reconcile succeeds again
+	annotationLastError = "last-error"
+	// maxLastErrorLength caps the message in the last-error annotation
+	maxLastErrorLength = 256
+
+	// annotationExistingResourceID makes the controller manage a resource
+	// provisioned in Pangolin beforehand instead of creating its own
+	annotationExistingResourceID = "existing-resource-id"
+
+	// annotationCertificateFingerprints records the SHA-256 fingerprint of the
+	// TLS certificate last uploaded to each resource, as a JSON object keyed
+	// by resource ID
+	annotationCertificateFingerprints = "certificate-fingerprints"
 
 	// SSO / access control annotations
-	annotationSSO                   = "pangolin.ingress.k8s.io/sso"
-	annotationSSL                   = "pangolin.ingress.k8s.io/ssl"
-	annotationBlockAccess           = "pangolin.ingress.k8s.io/block-access"
-	annotationEmailWhitelistEnabled = "pangolin.ingress.k8s.io/email-whitelist-enabled"
-	annotationApplyRules            = "pangolin.ingress.k8s.io/apply-rules"
+	annotationSSO                   = "sso"
+	annotationSSL                   = "ssl"
+	annotationBlockAccess           = "block-access"
+	annotationEmailWhitelistEnabled = "email-whitelist-enabled"
+	annotationApplyRules            = "apply-rules"
 
 	// Proxy settings annotations
-	annotationStickySession = "pangolin.ingress.k8s.io/sticky-session"
-	annotationTLSServerName = "pangolin.ingress.k8s.io/tls-server-name"
-	annotationSetHostHeader = "pangolin.ingress.k8s.io/set-host-header"
-	annotationHeaders       = "pangolin.ingress.k8s.io/headers"
-	annotationPostAuthPath  = "pangolin.ingress.k8s.io/post-auth-path"
+	annotationStickySession = "sticky-session"
+	annotationWebSocket     = "websocket"
+	// annotationForwardedHeaders sets the X-Forwarded-* header policy
+	annotationForwardedHeaders = "forwarded-headers"
+	annotationTLSServerName    = "tls-server-name"
+	annotationSetHostHeader    = "set-host-header"
+	annotationHeaders          = "headers"
+	// annotationResponseHeaders adds headers to every response, e.g.
+	// security headers such as Strict-Transport-Security
+	annotationResponseHeaders = "response-headers"
+	// annotationAllowedMethods restricts the HTTP methods passed on to the
+	// backends, e.g. GET,HEAD for a read-only site
+	annotationAllowedMethods = "allowed-methods"
+	annotationPostAuthPath   = "post-auth-path"
+
+	// annotationAllowCIDRs and annotationDenyCIDRs restrict the client
+	// networks that may reach the resource
+	annotationAllowCIDRs = "allow-cidrs"
+	annotationDenyCIDRs  = "deny-cidrs"
+	// annotationPriority orders the resource against resources with
+	// overlapping domains, e.g. a wildcard host; lower values win
+	annotationPriority = "priority"
+
+	// Rate limit annotations
+	annotationRateLimitRPS   = "rate-limit-rps"
+	annotationRateLimitBurst = "rate-limit-burst"
+
+	// annotationBackendNamespace overrides the namespace backend services are
+	// looked up in (and the target host is built from)
+	annotationBackendNamespace = "backend-namespace"
+
+	// annotationSite selects the Pangolin site (by nice ID) that hosts the
+	// targets, overriding the configured default site
+	annotationSite = "site"
+
+	// annotationSiteIDs places the resource on several Pangolin sites (a
+	// comma-separated list of nice IDs) for multi-region setups
+	annotationSiteIDs = "site-ids"
+
+	// annotationMetadata attaches user metadata to the Pangolin resource and
+	// its targets
+	annotationMetadata = "metadata"
+
+	// annotationTargetWeight sets the load balancing weight of the targets
+	annotationTargetWeight = "target-weight"
+
+	// annotationTargetAddress replaces the cluster DNS name of the backend
+	// Service as the target host, e.g. for split-horizon DNS
+	annotationTargetAddress = "target-address"
+
+	// annotationServiceResolution states how the cluster DNS name of the
+	// backend Services resolves: clusterip or headless
+	annotationServiceResolution = "service-resolution"
+
+	// annotationExactTrailingSlash controls the trailing slash of Exact
+	// paths: preserve (default), strip or append
+	annotationExactTrailingSlash = "exact-trailing-slash"
+
+	// annotationProxyProtocol sends a PROXY protocol header (v1 or v2) to
+	// the targets of tcp Services
+	annotationProxyProtocol = "proxy-protocol"
+
+	// annotationListenPort sets the public port of the raw TCP/UDP resource
+	// of an exposed Service
+	annotationListenPort = "listen-port"
+
+	// annotationIgnore parks an Ingress: it keeps the finalizer, but no
+	// Pangolin resource is created and an existing one is deleted
+	annotationIgnore = "ignore"
+
+	// annotationDeletionProtection keeps the Pangolin resource when the
+	// Ingress is deleted
+	annotationDeletionProtection = "deletion-protection"
 
 	// Resource enabled annotation
-	annotationEnabled = "pangolin.ingress.k8s.io/enabled"
+	annotationEnabled = "enabled"
 
 	// Health check annotations
-	annotationHCEnabled           = "pangolin.ingress.k8s.io/healthcheck-enabled"
-	annotationHCPath              = "pangolin.ingress.k8s.io/healthcheck-path"
-	annotationHCScheme            = "pangolin.ingress.k8s.io/healthcheck-scheme"
-	annotationHCMode              = "pangolin.ingress.k8s.io/healthcheck-mode"
-	annotationHCHostname          = "pangolin.ingress.k8s.io/healthcheck-hostname"
-	annotationHCPort              = "pangolin.ingress.k8s.io/healthcheck-port"
-	annotationHCInterval          = "pangolin.ingress.k8s.io/healthcheck-interval"
-	annotationHCUnhealthyInterval = "pangolin.ingress.k8s.io/healthcheck-unhealthy-interval"
-	annotationHCTimeout           = "pangolin.ingress.k8s.io/healthcheck-timeout"
-	annotationHCHeaders           = "pangolin.ingress.k8s.io/healthcheck-headers"
-	annotationHCFollowRedirects   = "pangolin.ingress.k8s.io/healthcheck-follow-redirects"
-	annotationHCMethod            = "pangolin.ingress.k8s.io/healthcheck-method"
-	annotationHCStatus            = "pangolin.ingress.k8s.io/healthcheck-status"
-	annotationHCTLSServerName     = "pangolin.ingress.k8s.io/healthcheck-tls-server-name"
+	annotationHCEnabled           = "healthcheck-enabled"
+	annotationHCPath              = "healthcheck-path"
+	annotationHCScheme            = "healthcheck-scheme"
+	annotationHCMode              = "healthcheck-mode"
+	annotationHCHostname          = "healthcheck-hostname"
+	annotationHCPort              = "healthcheck-port"
+	annotationHCInterval          = "healthcheck-interval"
+	annotationHCUnhealthyInterval = "healthcheck-unhealthy-interval"
+	annotationHCTimeout           = "healthcheck-timeout"
+	annotationHCHeaders           = "healthcheck-headers"
+	annotationHCFollowRedirects   = "healthcheck-follow-redirects"
+	annotationHCMethod            = "healthcheck-method"
+	annotationHCStatus            = "healthcheck-status"
+	annotationHCTLSServerName     = "healthcheck-tls-server-name"
 )
 
+// requiredAPIKeyScopes are the scopes the Pangolin API key must grant
+var requiredAPIKeyScopes = []string{pangolin.ScopeResourceWrite, pangolin.ScopeTargetWrite}
+
 // IngressReconciler reconciles an Ingress object
 type IngressReconciler struct {
 	client.Client
-	Scheme          *runtime.Scheme
-	IngressClass    string
-	ResourcePrefix  string
+	Scheme       *runtime.Scheme
+	Recorder     record.EventRecorder
+	IngressClass string
+	// ControllerName, if set, is the spec.controller an IngressClass named
+	// IngressClass must have for Ingresses selecting it through
+	// spec.ingressClassName to be managed. Without the IngressClass, or with
+	// one of another controller, they are ignored.
+	ControllerName string
+	// LabelSelector restricts the managed Ingresses to those whose labels
+	// match; nil matches all
+	LabelSelector labels.Selector
+	// DisableLegacyIngressClassAnnotation ignores the deprecated
+	// kubernetes.io/ingress.class annotation, so that only Ingresses whose
+	// IngressClassName matches are managed
+	DisableLegacyIngressClassAnnotation bool
+	ResourcePrefix                      string
+	// AnnotationPrefix is the prefix for all annotations read and written by
+	// the controller; defaults to pangolin.ingress.k8s.io
+	AnnotationPrefix string
+	// FinalizerName is the finalizer added to managed Ingresses; defaults to
+	// pangolin.ingress.k8s.io/finalizer. Controller instances managing
+	// disjoint sets of Ingresses should use distinct names.
+	FinalizerName string
+	// TargetConcurrency bounds how many targets of a single Ingress host are
+	// created or updated in parallel; defaults to 4
+	TargetConcurrency int
+	// DefaultTargetWeight is the weight of targets of Ingresses without the
+	// target-weight annotation; defaults to 100
+	DefaultTargetWeight int
+	// DefaultDomain is the host that Ingress rules without a host are routed
+	// to; if empty, such rules are skipped
+	DefaultDomain string
+	// MaxResources caps the number of Pangolin resources the controller
+	// creates; zero means no limit
+	MaxResources int
+	// TargetDrainPeriod is how long a target that is no longer needed keeps
+	// serving established connections with weight 0 before it is deleted;
+	// zero deletes it right away
+	TargetDrainPeriod time.Duration
+	// StatusPollInterval is the first delay before re-checking whether a
+	// resource has a proxy IP, doubling on every attempt; defaults to 2s
+	StatusPollInterval time.Duration
+	// StatusPollTimeout bounds the total time spent waiting for a proxy IP
+	// before the status falls back to the rule host; defaults to 1m
+	StatusPollTimeout time.Duration
+	// ReconcileDebounce delays reconciles triggered by Ingress events so that
+	// events within the delay coalesce into one reconcile; zero reconciles
+	// right away
+	ReconcileDebounce time.Duration
+	// MinReconcileInterval is the least time between two reconciles of the
+	// same Ingress; reconciles triggered earlier are postponed and collapse
+	// into one. Deletions are never postponed. Zero disables the limit.
+	MinReconcileInterval time.Duration
+	// RequeueJitter lengthens every requeue delay and error backoff by a
+	// random amount of up to this fraction of it; zero disables the jitter
+	RequeueJitter   float64
 	PangolinClient  *pangolin.Client
 	PangolinBaseURL string
+	// MaxResponseBytes limits the size of Pangolin API responses; defaults to
+	// pangolin.DefaultMaxResponseBytes
+	MaxResponseBytes int64
+	// UserAgent replaces the default User-Agent of Pangolin API requests
+	UserAgent string
+	// MaxConcurrentWrites and WriteLatencyThreshold configure the adaptive
+	// limit of concurrent Pangolin API writes; zero disables it
+	MaxConcurrentWrites   int
+	WriteLatencyThreshold time.Duration
+	// MaxConcurrentRequests caps the Pangolin API requests of any kind in
+	// flight across all reconciles; zero means no limit
+	MaxConcurrentRequests int
+	// RequestCompressionThreshold is the size in bytes from which Pangolin
+	// API request bodies are gzipped; zero disables compression
+	RequestCompressionThreshold int
+	// ResourceCacheTTL is how long a Pangolin resource read from the API is
+	// served from memory; zero disables the cache
+	ResourceCacheTTL time.Duration
+	// OperationTimeout is how long a Pangolin API write answered with 202
+	// Accepted is polled until it completes; zero doesn't poll, the Ingress
+	// is requeued instead
+	OperationTimeout time.Duration
+	// FieldNaming is the field naming scheme of the Pangolin API, camelCase
+	// or snake_case; empty means camelCase
+	FieldNaming string
+	// DisableHTTP2 forces HTTP/1.1 for Pangolin API requests
+	DisableHTTP2    bool
 	APIKeySecret    string
 	APIKeyNamespace string
-	OrgID           string
-	SiteNiceID      string
-	domainMu        sync.RWMutex
-	domainMap       map[string]string
-	siteMu          sync.RWMutex
-	siteCache       *pangolin.Site
+	// RequestSigning selects how Pangolin API requests are signed in addition
+	// to bearer authentication: empty (unsigned) or hmac-sha256
+	RequestSigning string
+	OrgID          string
+	SiteNiceID     string
+	// DefaultSiteRegion is the region whose online sites are preferred when
+	// neither an annotation nor SiteNiceID selects a site
+	DefaultSiteRegion string
+	// StartupSelfTest adds a readiness check that passes once a throwaway
+	// resource could be created and deleted
+	StartupSelfTest bool
+	// ProbeTimeout bounds each periodic probe of the Pangolin API, whose
+	// outcome the replica's readiness follows; defaults to 10s
+	ProbeTimeout time.Duration
+	// DisableIngressMetrics turns off the metrics with one series per
+	// Ingress, for clusters with many Ingresses
+	DisableIngressMetrics bool
+	// InstanceID tags the resources created by this controller instance.
+	// Resources tagged by another instance are neither modified nor deleted
+	// unless AllowForeignInstanceResources is set.
+	InstanceID                    string
+	AllowForeignInstanceResources bool
+	// CleanupOnUnmanage deletes the Pangolin resources of an Ingress and
+	// removes its finalizer once it moves to another class or out of the
+	// label selector. Otherwise they are left in place and only cleaned up
+	// when the Ingress is deleted.
+	CleanupOnUnmanage bool
+	// TransactionalCreate creates new resources together with their targets
+	// and rules in a single request, where the Pangolin API supports it
+	TransactionalCreate bool
+	// DuplicatePathPolicy selects which backend a path listed more than once
+	// for a host is routed to: first-wins (the default) or last-wins
+	DuplicatePathPolicy string
+	// TLSOnlyHosts selects what happens to hosts listed in spec.tls but in
+	// no rule: skip (the default) records an event, placeholder creates a
+	// resource without targets for the host's certificate
+	TLSOnlyHosts string
+	// ExclusiveHosts lets only one Ingress route a host: the first one
+	// reconciled claims it, and others declaring it are refused with a
+	// HostConflict event instead of sharing its resource
+	ExclusiveHosts bool
+	// MirrorLabels selects the Ingress labels copied into the metadata of its
+	// Pangolin resources and targets: exact label keys, or prefixes ending in
+	// *. Labels with a reserved key are never copied.
+	MirrorLabels []string
+
+	// batchCreateUnsupported is set once the Pangolin API turned out not to
+	// support transactional creates
+	batchCreateUnsupported atomic.Bool
+
+	clientMu       sync.Mutex
+	domainMu       sync.RWMutex
+	domainMap      map[string]string
+	siteMu         sync.RWMutex
+	siteCache      *pangolin.Site
+	readinessMu    sync.Mutex
+	readinessPolls map[types.NamespacedName]readinessPoll
+	// hostOwners maps the hosts claimed with ExclusiveHosts to the
+	// namespace/name of the claiming Ingress
+	hostMu     sync.Mutex
+	hostOwners map[string]string
+	// lastReconciles holds when each Ingress was last reconciled, for
+	// MinReconcileInterval
+	throttleMu     sync.Mutex
+	lastReconciles map[types.NamespacedName]time.Time
+	// ingressClassUnownedUntil is when the IngressClass is looked up again
+	// after it was found missing or owned by another controller
+	ingressClassMu           sync.Mutex
+	ingressClassUnownedUntil time.Time
+	// ingressClassGeneration is increased by every IngressClass change, so
+	// that a lookup in flight during the change doesn't cache its result
+	ingressClassGeneration uint64
+}
+
+// readinessPoll tracks the readiness checks made for an Ingress
+type readinessPoll struct {
+	attempt int
+	waited  time.Duration
 }
 
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/finalizers,verbs=update
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingressclasses,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
+// move the current state of the cluster closer to the desired state. Each
+// reconcile of a managed Ingress ends with a summary log line counting the
+// Pangolin resources, targets and rules it created, updated and deleted; the
+// individual changes, and the summaries of Ingresses that are gone or
+// belong to another controller, are logged at verbosity 1.
 func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	summary := &reconcileSummary{}
+	result, err := r.reconcile(withReconcileSummary(ctx, summary), req)
+	logger := log.FromContext(ctx)
+	if !summary.isManaged() {
+		logger = logger.V(1)
+	}
+	logger.Info("Reconcile summary", summary.keysAndValues(result, err)...)
+	return result, err
+}
+
+func (r *IngressReconciler) reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	log := log.FromContext(ctx)
 
 	// Initialize Pangolin client if needed
-	if r.PangolinClient == nil {
-		if err := r.initPangolinClient(ctx); err != nil {
-			log.Error(err, "Failed to initialize Pangolin client")
-			return ctrl.Result{}, err
-		}
+	if err := r.initPangolinClient(ctx); err != nil {
+		log.Error(err, "Failed to initialize Pangolin client")
+		return ctrl.Result{}, err
 	}
 
 	// Fetch the Ingress instance
 	ingress := &networkingv1.Ingress{}
-	err := r.Get(ctx, req.NamespacedName, ingress)
+	err = r.Get(ctx, req.NamespacedName, ingress)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Ingress not found, could have been deleted
-			log.Info("Ingress resource not found. Ignoring since object must be deleted")
+			log.V(1).Info("Ingress resource not found. Ignoring since object must be deleted")
+			ingressLastSync.DeleteLabelValues(req.Namespace, req.Name)
+			r.releaseHosts(req.String(), nil)
+			r.forgetReconcile(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request
@@ -113,203 +471,829 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	// Check if this ingress is for our ingress class
-	if !r.isManaged(ingress) {
+	// Check if this ingress is for our ingress class. An Ingress that is no
+	// longer managed (e.g. its labels changed) is still cleaned up on
+	// deletion, so that its finalizer doesn't block it forever.
+	cleanup := !ingress.DeletionTimestamp.IsZero() && controllerutil.ContainsFinalizer(ingress, r.finalizerName())
+	if !r.isManaged(ctx, ingress) && !cleanup {
+		if r.CleanupOnUnmanage && controllerutil.ContainsFinalizer(ingress, r.finalizerName()) {
+			return r.releaseIngress(ctx, ingress)
+		}
+		r.releaseHosts(req.String(), nil)
 		log.V(1).Info("Ingress not managed by this controller", "ingressClass", r.IngressClass)
 		return ctrl.Result{}, nil
 	}
 
-	log.Info("Reconciling Ingress", "name", ingress.Name, "namespace", ingress.Namespace)
+	// Collapse rapid edits, e.g. by another controller fighting over an
+	// annotation, into at most one Pangolin write cycle per interval
+	if ingress.DeletionTimestamp.IsZero() {
+		if wait := r.throttleReconcile(req.NamespacedName, time.Now()); wait > 0 {
+			log.V(1).Info("Ingress was reconciled recently, postponing", "after", wait)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	markManaged(ctx)
+	log.V(1).Info("Reconciling Ingress", "name", ingress.Name, "namespace", ingress.Namespace)
+	// Invalid annotations don't fail the reconcile, but are recorded as its
+	// error all the same. A deferred reconcile has neither failed nor
+	// succeeded yet.
+	var cfgErr error
+	defer func() {
+		lastErr := err
+		if lastErr == nil {
+			lastErr = cfgErr
+		}
+		if summary := summaryFrom(ctx); lastErr == nil && summary != nil && summary.isDeferred() {
+			return
+		}
+		r.recordLastError(ctx, ingress, lastErr)
+	}()
+
+	// Normalize the annotations once; everything below works on the parsed
+	// config rather than on raw annotation values
+	cfg, corrections, decisions, cfgErr := r.parseIngressConfig(ingress.Annotations)
+	for _, c := range corrections {
+		log.Info("Normalized annotation value", "annotation", c.Key, "from", c.From, "to", c.To)
+	}
+	for _, d := range decisions {
+		log.V(1).Info("Config value", "setting", d.Key, "value", d.Value, "source", d.Source)
+	}
 
 	// Handle deletion
 	if !ingress.DeletionTimestamp.IsZero() {
-		if controllerutil.ContainsFinalizer(ingress, pangolinFinalizerName) {
+		r.resetReadinessPoll(req.NamespacedName)
+		r.releaseHosts(req.String(), nil)
+		if controllerutil.ContainsFinalizer(ingress, r.finalizerName()) {
 			// Delete resources from Pangolin
-			if err := r.deletePangolinResources(ctx, ingress); err != nil {
+			if err := r.deletePangolinResources(ctx, ingress, cfg); err != nil {
+				if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+					return result, nil
+				}
 				log.Error(err, "Failed to delete Pangolin resources")
+				r.recordEvent(ingress, corev1.EventTypeWarning, "CleanupFailed",
+					"Keeping finalizer %s, failed to delete Pangolin resources: %v", r.finalizerName(), err)
 				return ctrl.Result{}, err
 			}
 
 			// Remove finalizer
-			controllerutil.RemoveFinalizer(ingress, pangolinFinalizerName)
+			controllerutil.RemoveFinalizer(ingress, r.finalizerName())
 			if err := r.Update(ctx, ingress); err != nil {
 				return ctrl.Result{}, err
 			}
+			r.recordFinalizerChange(ingress, "ingress", finalizerRemoved, r.finalizerName())
 		}
+		ingressLastSync.DeleteLabelValues(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// Invalid annotations won't fix themselves by retrying; report them and
+	// wait for the Ingress to change
+	if cfgErr != nil {
+		r.recordEvent(ingress, corev1.EventTypeWarning, "InvalidAnnotation", "%v", cfgErr)
+		log.Info("Ingress has invalid annotations, skipping", "reason", cfgErr.Error())
 		return ctrl.Result{}, nil
 	}
 
+	if len(ingress.Spec.Rules) == 0 && ingress.Spec.DefaultBackend == nil &&
+		(r.TLSOnlyHosts != tlsOnlyHostsPlaceholder || len(r.tlsOnlyHosts(ingress)) == 0) {
+		return r.reconcileEmptyIngress(ctx, ingress, cfg)
+	}
+
 	// Add finalizer if not present
-	if !controllerutil.ContainsFinalizer(ingress, pangolinFinalizerName) {
-		controllerutil.AddFinalizer(ingress, pangolinFinalizerName)
+	if !controllerutil.ContainsFinalizer(ingress, r.finalizerName()) {
+		controllerutil.AddFinalizer(ingress, r.finalizerName())
 		if err := r.Update(ctx, ingress); err != nil {
 			return ctrl.Result{}, err
 		}
+		r.recordFinalizerChange(ingress, "ingress", finalizerAdded, r.finalizerName())
+	}
+
+	if cfg.Ignore {
+		r.resetReadinessPoll(req.NamespacedName)
+		r.releaseHosts(req.String(), nil)
+		if err := r.parkIngress(ctx, ingress, cfg, "Ingress is ignored"); err != nil {
+			if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+				return result, nil
+			}
+			log.Error(err, "Failed to delete Pangolin resources of ignored Ingress")
+			return ctrl.Result{}, err
+		}
+		log.Info("Ingress is ignored, skipping resource creation", "name", ingress.Name)
+		return ctrl.Result{}, nil
 	}
 
 	// Process ingress rules and create/update Pangolin resources
-	if err := r.processIngressRules(ctx, ingress); err != nil {
+	drainRequeue, err := r.processIngressRules(ctx, ingress, cfg)
+	if err != nil {
+		if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+			return result, nil
+		}
 		log.Error(err, "Failed to process ingress rules")
 		return ctrl.Result{}, err
 	}
 
 	// Update ingress status
-	if err := r.updateIngressStatus(ctx, ingress); err != nil {
+	statusRequeue, err := r.updateIngressStatus(ctx, ingress, cfg)
+	if err != nil {
+		if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+			return result, nil
+		}
 		log.Error(err, "Failed to update ingress status")
 		return ctrl.Result{}, err
 	}
+	if !r.DisableIngressMetrics {
+		ingressLastSync.WithLabelValues(req.Namespace, req.Name).SetToCurrentTime()
+	}
+	if requeueAfter := earliestRequeue(drainRequeue, statusRequeue); requeueAfter > 0 {
+		return ctrl.Result{RequeueAfter: jitter(requeueAfter, r.RequeueJitter)}, nil
+	}
 
-	log.Info("Successfully reconciled Ingress", "name", ingress.Name)
+	log.V(1).Info("Successfully reconciled Ingress", "name", ingress.Name)
 	return ctrl.Result{}, nil
 }
 
-// isManaged checks if the ingress should be managed by this controller
-func (r *IngressReconciler) isManaged(ingress *networkingv1.Ingress) bool {
+// recordLastError sets the last-error annotation of ingress to the time and
+// message of err, or removes it once a reconcile succeeded, for dashboards
+// that show annotations rather than events or logs. The Ingress is only
+// written while it exists for sure, so that the apply never recreates it:
+// errors are recorded while it carries the finalizer, and the annotation is
+// not removed once its deletion completed.
+func (r *IngressReconciler) recordLastError(ctx context.Context, ingress *networkingv1.Ingress, err error) {
+	key := r.annotationKey(annotationLastError)
+	var writeErr error
+	if err == nil {
+		if _, ok := ingress.Annotations[key]; !ok || !ingress.DeletionTimestamp.IsZero() {
+			return
+		}
+		// A merge patch removes the annotation whoever set it
+		patch := client.MergeFrom(ingress.DeepCopy())
+		delete(ingress.Annotations, key)
+		writeErr = r.Patch(ctx, ingress, patch)
+	} else {
+		// An Ingress whose finalizer was removed may be gone already
+		if !ingress.DeletionTimestamp.IsZero() && !controllerutil.ContainsFinalizer(ingress, r.finalizerName()) {
+			return
+		}
+		// Retries failing the same way keep the time of the first failure
+		value := lastErrorValue(time.Now(), err)
+		if current, ok := ingress.Annotations[key]; ok && lastErrorMessage(current) == lastErrorMessage(value) {
+			return
+		}
+		if ingress.Annotations == nil {
+			ingress.Annotations = make(map[string]string)
+		}
+		ingress.Annotations[key] = value
+		writeErr = r.applyIngressAnnotations(ctx, ingress)
+	}
+	if writeErr != nil {
+		log.FromContext(ctx).Error(writeErr, "Failed to record the last reconcile error")
+	}
+}
+
+// lastErrorValue formats the last-error annotation: the time in RFC 3339 and
+// the error message, shortened to maxLastErrorLength
+func lastErrorValue(now time.Time, err error) string {
+	msg := strings.Join(strings.Fields(err.Error()), " ")
+	if runes := []rune(msg); len(runes) > maxLastErrorLength {
+		msg = string(runes[:maxLastErrorLength-3]) + "..."
+	}
+	return now.UTC().Format(time.RFC3339) + " " + msg
+}
+
+// lastErrorMessage returns the message of a last-error annotation value
+func lastErrorMessage(value string) string {
+	_, msg, _ := strings.Cut(value, " ")
+	return msg
+}
+
+// deferredRequeue reports whether err was caused by a Pangolin maintenance
+// window (a 503 with Retry-After) and, if so, returns a result requeueing the
+// Ingress once the window is over instead of retrying it with the usual
+// error backoff. A write Pangolin accepted for asynchronous processing is
+// likewise checked again after operationPendingRequeue. The delay is
+// jittered so that Ingresses postponed together don't all retry at the same
+// time. The reconcile is marked as deferred, so that it leaves the
+// last-error annotation as it is rather than counting as a success.
+func (r *IngressReconciler) deferredRequeue(ctx context.Context, ingress *networkingv1.Ingress, err error) (ctrl.Result, bool) {
+	errs := []error{err}
+	if agg, isAgg := err.(utilerrors.Aggregate); isAgg {
+		// Target failures are aggregated per path
+		errs = append(errs, agg.Errors()...)
+	}
+	for _, e := range errs {
+		if retryAfter, ok := pangolin.IsMaintenance(e); ok {
+			markDeferred(ctx)
+			log.FromContext(ctx).Info("Pangolin API is under maintenance, postponing reconcile", "retryAfter", retryAfter, "reason", err.Error())
+			r.recordEvent(ingress, corev1.EventTypeWarning, "PangolinMaintenance",
+				"Pangolin API is under maintenance, retrying in %v", retryAfter)
+			return ctrl.Result{RequeueAfter: jitter(retryAfter, r.RequeueJitter)}, true
+		}
+	}
+	for _, e := range errs {
+		if pangolin.IsOperationPending(e) {
+			markDeferred(ctx)
+			log.FromContext(ctx).Info("Pangolin is processing a write asynchronously, postponing reconcile", "after", operationPendingRequeue, "reason", e.Error())
+			r.recordEvent(ingress, corev1.EventTypeNormal, "OperationPending",
+				"Pangolin is processing a change asynchronously, checking again in %v", operationPendingRequeue)
+			return ctrl.Result{RequeueAfter: jitter(operationPendingRequeue, r.RequeueJitter)}, true
+		}
+	}
+	return ctrl.Result{}, false
+}
+
+// annotationPrefix returns the configured annotation prefix, falling back to
+// the default.
+func (r *IngressReconciler) annotationPrefix() string {
+	if r.AnnotationPrefix == "" {
+		return defaultAnnotationPrefix
+	}
+	return r.AnnotationPrefix
+}
+
+// finalizerName returns the configured finalizer name, falling back to the
+// default.
+func (r *IngressReconciler) finalizerName() string {
+	if r.FinalizerName == "" {
+		return defaultFinalizerName
+	}
+	return r.FinalizerName
+}
+
+// annotationKey returns the fully qualified key for an annotation name under
+// the configured annotation prefix.
+func (r *IngressReconciler) annotationKey(name string) string {
+	return r.annotationPrefix() + "/" + name
+}
+
+// isManaged checks if the ingress should be managed by this controller. As in
+// Kubernetes, spec.ingressClassName takes precedence over the legacy
+// annotation: an Ingress whose field names another class is not managed even
+// if its annotation names ours, and the other way around. Such a conflict
+// involving our class is logged.
+func (r *IngressReconciler) isManaged(ctx context.Context, ingress *networkingv1.Ingress) bool {
+	if r.LabelSelector != nil && !r.LabelSelector.Matches(labels.Set(ingress.Labels)) {
+		return false
+	}
+
+	legacyClass, hasLegacyClass := ingress.Annotations[legacyIngressClassAnnotation]
+
 	// Check IngressClassName field (newer API)
-	if ingress.Spec.IngressClassName != nil && *ingress.Spec.IngressClassName == r.IngressClass {
-		return true
+	if ingress.Spec.IngressClassName != nil && *ingress.Spec.IngressClassName != "" {
+		class := *ingress.Spec.IngressClassName
+		if hasLegacyClass && legacyClass != class && (class == r.IngressClass || legacyClass == r.IngressClass) {
+			log.FromContext(ctx).Info("Ingress class field and legacy annotation disagree, using the field",
+				"ingress", ingress.Namespace+"/"+ingress.Name, "ingressClassName", class, "annotation", legacyClass)
+		}
+		if class != r.IngressClass {
+			return false
+		}
+		return r.ownsIngressClass(ctx)
+	}
+
+	if r.DisableLegacyIngressClassAnnotation {
+		return false
 	}
 
 	// Check annotation (legacy support)
-	if class, ok := ingress.Annotations["kubernetes.io/ingress.class"]; ok && class == r.IngressClass {
+	if hasLegacyClass && legacyClass == r.IngressClass {
+		return true
+	}
+
+	return false
+}
+
+// ownsIngressClass reports whether the IngressClass r.IngressClass exists and
+// names r.ControllerName as its controller; it is always true without a
+// ControllerName. A negative result is kept for ingressClassRecheckInterval,
+// or until the IngressClass changes, so that the Ingresses of a missing class
+// don't look it up on every event. Lookup errors other than NotFound are
+// logged and the class is assumed to be owned, so that Ingresses aren't
+// dropped over a transient error.
+func (r *IngressReconciler) ownsIngressClass(ctx context.Context) bool {
+	if r.ControllerName == "" {
 		return true
 	}
+	r.ingressClassMu.Lock()
+	unowned := time.Now().Before(r.ingressClassUnownedUntil)
+	generation := r.ingressClassGeneration
+	r.ingressClassMu.Unlock()
+	if unowned {
+		return false
+	}
 
+	class := &networkingv1.IngressClass{}
+	err := r.Get(ctx, types.NamespacedName{Name: r.IngressClass}, class)
+	switch {
+	case errors.IsNotFound(err):
+		log.FromContext(ctx).V(1).Info("IngressClass not found, ignoring its Ingresses", "ingressClass", r.IngressClass)
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get IngressClass", "ingressClass", r.IngressClass)
+		return true
+	case class.Spec.Controller != r.ControllerName:
+		log.FromContext(ctx).V(1).Info("IngressClass belongs to another controller, ignoring its Ingresses",
+			"ingressClass", r.IngressClass, "controller", class.Spec.Controller)
+	default:
+		return true
+	}
+	r.ingressClassMu.Lock()
+	defer r.ingressClassMu.Unlock()
+	// A change of the IngressClass during the lookup makes the result stale
+	if generation == r.ingressClassGeneration {
+		r.ingressClassUnownedUntil = time.Now().Add(ingressClassRecheckInterval)
+	}
 	return false
 }
 
-// processIngressRules processes the rules in the ingress specification and creates Pangolin resources
-func (r *IngressReconciler) processIngressRules(ctx context.Context, ingress *networkingv1.Ingress) error {
+// ingressesForIngressClass maps a change of the managed IngressClass to the
+// Ingresses selecting it through spec.ingressClassName and matching
+// LabelSelector, after dropping a cached negative ownsIngressClass result.
+// Ingresses of a class created after them are thus reconciled right away.
+func (r *IngressReconciler) ingressesForIngressClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != r.IngressClass {
+		return nil
+	}
+	r.ingressClassMu.Lock()
+	r.ingressClassUnownedUntil = time.Time{}
+	r.ingressClassGeneration++
+	r.ingressClassMu.Unlock()
+
+	var opts []client.ListOption
+	if r.LabelSelector != nil {
+		opts = append(opts, client.MatchingLabelsSelector{Selector: r.LabelSelector})
+	}
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ingresses for IngressClass", "ingressClass", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, ingress := range ingresses.Items {
+		if ingress.Spec.IngressClassName == nil || *ingress.Spec.IngressClassName != r.IngressClass {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+		})
+	}
+	return requests
+}
+
+// ingressBackend is a single Ingress path resolved to its backend Service port.
+// servicePort is zero if the named port portName is currently missing from
+// the Service; the last known number is then taken from the existing target.
+type ingressBackend struct {
+	path             networkingv1.HTTPIngressPath
+	serviceNamespace string
+	serviceName      string
+	servicePort      int32
+	portName         string
+}
+
+// processIngressRules processes the rules in the ingress specification and
+// creates Pangolin resources. It returns a non-zero delay after which the
+// Ingress must be reconciled again to delete drained targets.
+func (r *IngressReconciler) processIngressRules(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig) (time.Duration, error) {
 	log := log.FromContext(ctx)
 
-	// Process each rule and create Pangolin resources
+	serviceNamespace, err := r.backendNamespace(ctx, ingress, cfg)
+	if err != nil {
+		log.Error(err, "Failed to resolve backend namespace")
+		return 0, err
+	}
+
+	// Resolve the backend of every path first, grouped by host in rule order.
+	// Rules repeating a host are merged, so each host maps to one resource
+	// holding the paths of all its rules. A path listed more than once is
+	// routed to one backend only, chosen by DuplicatePathPolicy.
+	var hosts []string
+	backends := make(map[string][]ingressBackend)
 	for _, rule := range ingress.Spec.Rules {
 		host := rule.Host
 		if host == "" {
-			log.Info("Skipping rule without host")
-			continue
+			if r.DefaultDomain == "" {
+				log.Info("Skipping rule without host")
+				continue
+			}
+			host = r.DefaultDomain
+			log.Info("Routing rule without host to the default domain", "host", host)
 		}
 
 		if rule.HTTP != nil {
 			for _, path := range rule.HTTP.Paths {
+				path = exactPath(path, cfg.ExactTrailingSlash)
+				duplicate := backendPathIndex(backends[host], path)
+				if duplicate >= 0 {
+					if r.DuplicatePathPolicy != duplicatePathLastWins {
+						r.recordEvent(ingress, corev1.EventTypeWarning, "DuplicatePath",
+							"Path %s of host %s is listed more than once, routing it to the first backend %s", ingressPath(path), host, backends[host][duplicate].serviceName)
+						log.Info("Skipping path already routed by an earlier rule for the host", "host", host, "path", path.Path)
+						continue
+					}
+					r.recordEvent(ingress, corev1.EventTypeWarning, "DuplicatePath",
+						"Path %s of host %s is listed more than once, routing it to the last backend", ingressPath(path), host)
+				}
+
+				if path.Backend.Service == nil {
+					log.Info("Skipping path without a service backend", "host", host, "path", path.Path)
+					continue
+				}
+
 				// Get the backend service
 				serviceName := path.Backend.Service.Name
 				service := &corev1.Service{}
 				err := r.Get(ctx, types.NamespacedName{
 					Name:      serviceName,
-					Namespace: ingress.Namespace,
+					Namespace: serviceNamespace,
 				}, service)
 				if err != nil {
-					log.Error(err, "Failed to get backend service", "service", serviceName)
-					return err
+					log.Error(err, "Failed to get backend service", "service", serviceName, "namespace", serviceNamespace)
+					return 0, err
 				}
 
-				// Determine service port
-				var servicePort int32
-				if path.Backend.Service.Port.Number != 0 {
-					servicePort = path.Backend.Service.Port.Number
-				} else {
-					// Find port by name
-					for _, port := range service.Spec.Ports {
-						if port.Name == path.Backend.Service.Port.Name {
-							servicePort = port.Port
-							break
-						}
-					}
+				if err := checkServiceResolution(service, cfg.ServiceResolution); err != nil {
+					r.recordEvent(ingress, corev1.EventTypeWarning, "ServiceResolutionMismatch", "%v", err)
+					log.Error(err, "Backend service doesn't match the service resolution", "service", serviceName, "namespace", serviceNamespace)
+					return 0, err
 				}
 
-				if servicePort == 0 {
-					return fmt.Errorf("could not determine service port for service %s", serviceName)
+				servicePort, portName := resolveServicePort(service, path.Backend.Service.Port)
+				if portName == "" && !hasServicePort(service, servicePort) {
+					r.recordEvent(ingress, corev1.EventTypeWarning, "InvalidServicePort",
+						"Service %s/%s has no port %d, skipping path %s", serviceNamespace, serviceName, servicePort, ingressPath(path))
+					log.Info("Skipping path whose backend port is not declared by the service",
+						"host", host, "path", path.Path, "service", serviceName, "servicePort", servicePort)
+					continue
 				}
 
-				log.Info("Processing ingress rule",
+				// A named port missing from a Service that already has
+				// targets may only be gone for the duration of a rollout;
+				// its last known number is looked up with the targets
+				if recorded, _ := r.recordedResourceID(ingress, host); servicePort == 0 && (portName == "" || recorded == "") {
+					return 0, fmt.Errorf("could not determine service port for service %s", serviceName)
+				}
+
+				log.V(1).Info("Processing ingress rule",
 					"host", host,
 					"path", path.Path,
-					"pathType", *path.PathType,
+					"pathType", pathType(path),
 					"service", serviceName,
+					"serviceNamespace", serviceNamespace,
 					"servicePort", servicePort,
 				)
 
-				// Create or update Pangolin resource
-				if err := r.createOrUpdatePangolinResource(ctx, ingress, host, path, serviceName, servicePort); err != nil {
-					log.Error(err, "Failed to create/update Pangolin resource")
-					return err
+				if _, ok := backends[host]; !ok {
+					hosts = append(hosts, host)
+				}
+				backend := ingressBackend{
+					path:             path,
+					serviceNamespace: serviceNamespace,
+					serviceName:      serviceName,
+					servicePort:      servicePort,
+					portName:         portName,
+				}
+				if duplicate >= 0 {
+					// last-wins: the later backend takes the place of the
+					// earlier one
+					backends[host][duplicate] = backend
+					continue
 				}
+				backends[host] = append(backends[host], backend)
 			}
 		}
 	}
 
-	return nil
+	// Hosts only listed in spec.tls have no paths to route; with
+	// TLSOnlyHosts set to placeholder, they get a resource without targets
+	// holding their certificate
+	for _, host := range r.tlsOnlyHosts(ingress) {
+		if r.TLSOnlyHosts != tlsOnlyHostsPlaceholder {
+			r.recordEvent(ingress, corev1.EventTypeNormal, "TLSOnlyHost",
+				"Host %s is only listed in spec.tls, no Pangolin resource is created for it", host)
+			log.Info("Skipping host only listed in spec.tls", "host", host)
+			continue
+		}
+		log.Info("Creating placeholder resource for host only listed in spec.tls", "host", host)
+		hosts = append(hosts, host)
+	}
+
+	// Process hosts in a fixed order so that reconciles don't depend on the
+	// order of the rules in the spec
+	sort.Strings(hosts)
+
+	// With ExclusiveHosts, a host claimed by another Ingress is skipped and
+	// the reconcile fails once the other hosts are done, so that it is
+	// retried until the claim is released
+	owner := ingress.Namespace + "/" + ingress.Name
+	if r.ExclusiveHosts {
+		keep := make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			keep[host] = true
+		}
+		r.releaseHosts(owner, keep)
+	}
+	var conflicts []error
+
+	var requeueAfter time.Duration
+	for _, host := range hosts {
+		holder := owner
+		if r.ExclusiveHosts {
+			holder = r.claimHost(host, owner)
+		}
+		var resourceID string
+		if holder != owner {
+			err = &hostConflictError{host: host, holder: holder}
+		} else {
+			// Create or update Pangolin resource
+			resourceID, err = r.createOrUpdatePangolinResource(ctx, ingress, cfg, host, backends[host])
+		}
+		if conflict, ok := err.(*hostConflictError); ok {
+			// The resource may also turn out to belong to another Ingress
+			// when it is created, e.g. after a restart emptied the claims
+			r.releaseHost(host, owner)
+			r.recordEvent(ingress, corev1.EventTypeWarning, "HostConflict",
+				"Host %s is already claimed by Ingress %s, not routing it", conflict.host, conflict.holder)
+			log.Info("Host is already claimed by another Ingress, skipping it", "host", host, "claimedBy", conflict.holder)
+			conflicts = append(conflicts, err)
+			continue
+		}
+		if err != nil {
+			log.Error(err, "Failed to create/update Pangolin resource")
+			return 0, err
+		}
+
+		drainAfter, err := r.reconcileTargets(ctx, ingress, cfg, resourceID, backends[host])
+		if err != nil {
+			log.Error(err, "Failed to reconcile Pangolin targets", "host", host, "resourceID", resourceID)
+			return 0, err
+		}
+		requeueAfter = earliestRequeue(requeueAfter, drainAfter)
+	}
+
+	// Forget the resources of hosts the Ingress no longer routes
+	keep := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		keep[host] = true
+	}
+	if r.pruneResourceIDs(ingress, keep) {
+		if err := r.applyIngressAnnotations(ctx, ingress); err != nil {
+			return 0, err
+		}
+	}
+
+	return requeueAfter, utilerrors.NewAggregate(conflicts)
+}
+
+// tlsOnlyHosts returns the hosts listed in spec.tls that cover no rule host,
+// sorted. Rules without a host count as rules of the default domain.
+func (r *IngressReconciler) tlsOnlyHosts(ingress *networkingv1.Ingress) []string {
+	var ruleHosts []string
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = r.DefaultDomain
+		}
+		ruleHosts = append(ruleHosts, host)
+	}
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, tls := range ingress.Spec.TLS {
+		for _, tlsHost := range tls.Hosts {
+			if tlsHost == "" || seen[tlsHost] {
+				continue
+			}
+			seen[tlsHost] = true
+			covers := false
+			for _, host := range ruleHosts {
+				covers = covers || tlsHostCovers(tlsHost, host)
+			}
+			if !covers {
+				hosts = append(hosts, tlsHost)
+			}
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// resourceName returns the name of the Pangolin resource for an Ingress host:
+// the configured prefix, the host and a discriminator derived from the
+// Ingress namespace and name. The name only depends on these, so it is stable
+// across reconciles, and two Ingresses never produce the same name.
+func (r *IngressReconciler) resourceName(ingress *networkingv1.Ingress, host string) string {
+	prefix := r.ResourcePrefix
+	if prefix == "" {
+		prefix = defaultResourcePrefix
+	}
+	sum := sha256.Sum256([]byte(ingress.Namespace + "/" + ingress.Name))
+	return fmt.Sprintf("%s-%s-%s", prefix, host, hex.EncodeToString(sum[:4]))
+}
+
+// backendPathIndex returns the index of the backend already routing path with
+// the same match type, or -1
+func backendPathIndex(backends []ingressBackend, path networkingv1.HTTPIngressPath) int {
+	for i, b := range backends {
+		if ingressPath(b.path) == ingressPath(path) && pathType(b.path) == pathType(path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveServicePort returns the number of the service port a backend refers
+// to, either directly or by name, and the name for named ports. A name not
+// declared by the service resolves to port 0.
+func resolveServicePort(service *corev1.Service, port networkingv1.ServiceBackendPort) (int32, string) {
+	if port.Number != 0 {
+		return port.Number, ""
+	}
+	for _, p := range service.Spec.Ports {
+		if p.Name == port.Name {
+			return p.Port, port.Name
+		}
+	}
+	return 0, port.Name
+}
+
+// hasServicePort reports whether service declares port. ExternalName
+// Services need not declare their ports, so any port is accepted for them.
+func hasServicePort(service *corev1.Service, port int32) bool {
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		return true
+	}
+	for _, p := range service.Spec.Ports {
+		if p.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// earliestRequeue returns the shorter of two requeue delays, ignoring zero
+// delays
+func earliestRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// backendNamespace returns the namespace backend services are resolved in:
+// the Ingress namespace, unless overridden by the backend-namespace
+// annotation, in which case the namespace must exist.
+func (r *IngressReconciler) backendNamespace(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig) (string, error) {
+	namespace := cfg.BackendNamespace
+	if namespace == "" || namespace == ingress.Namespace {
+		return ingress.Namespace, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return "", fmt.Errorf("backend namespace %s does not exist", namespace)
+		}
+		return "", fmt.Errorf("failed to get backend namespace %s: %w", namespace, err)
+	}
+	return namespace, nil
 }
 
-// updateIngressStatus updates the status of the ingress with load balancer information
-func (r *IngressReconciler) updateIngressStatus(ctx context.Context, ingress *networkingv1.Ingress) error {
+// updateIngressStatus updates the status of the ingress with load balancer
+// information, listing the proxy IP of every site serving the resource. While
+// Pangolin has not exposed a proxy IP for all of them yet, it returns a
+// non-zero delay after which the status should be checked again.
+func (r *IngressReconciler) updateIngressStatus(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig) (time.Duration, error) {
 	log := log.FromContext(ctx)
 
-	resourceID := ingress.Annotations[annotationResourceID]
+	resourceID := ingress.Annotations[r.annotationKey(annotationResourceID)]
 	if resourceID == "" {
 		log.V(1).Info("No resource ID found, skipping status update")
-		return nil
+		return 0, nil
 	}
 
-	if _, err := r.PangolinClient.GetResource(ctx, resourceID); err != nil {
+	resource, err := r.PangolinClient.GetResource(ctx, resourceID)
+	if err != nil {
 		log.Error(err, "Failed to get Pangolin resource", "resourceID", resourceID)
-		return err
+		return 0, err
 	}
 
-	site, err := r.getSiteInfo(ctx)
+	var sites []*pangolin.Site
+	if len(cfg.SiteIDs) > 0 {
+		sites, err = r.getSites(ctx, cfg.SiteIDs)
+	} else {
+		var site *pangolin.Site
+		site, err = r.resolveSite(ctx, ingress.Annotations, resource)
+		sites = []*pangolin.Site{site}
+	}
 	if err != nil {
 		log.Error(err, "Failed to fetch site info for status update", "siteNiceID", r.SiteNiceID)
-		return err
+		return 0, err
 	}
 
-	// Build the desired LoadBalancer status entry.
-	// Prefer the site's proxy IP; fall back to the first ingress rule hostname
-	// so that ArgoCD (and similar tools) see the Ingress as healthy.
-	var desired networkingv1.IngressLoadBalancerIngress
-	proxyIP := site.ProxyIP
-	if proxyIP != "" {
-		desired.IP = proxyIP
+	// Build the desired LoadBalancer status entries.
+	// Prefer the sites' proxy IPs; fall back to the first ingress rule
+	// hostname so that ArgoCD (and similar tools) see the Ingress as healthy.
+	var desired []networkingv1.IngressLoadBalancerIngress
+	var pending []string
+	seen := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		if site.ProxyIP == "" {
+			pending = append(pending, site.NiceID)
+			continue
+		}
+		if !seen[site.ProxyIP] {
+			seen[site.ProxyIP] = true
+			desired = append(desired, networkingv1.IngressLoadBalancerIngress{IP: site.ProxyIP})
+		}
+	}
+	key := types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}
+	if len(pending) > 0 {
+		// A freshly created resource may not have been provisioned yet; poll
+		// with backoff before settling for the addresses known so far
+		if delay, ok := r.nextReadinessPoll(key); ok {
+			r.invalidateSiteCache()
+			log.Info("Pangolin has not exposed a proxy IP yet, requeueing", "resourceID", resourceID, "sites", pending, "after", delay)
+			return delay, nil
+		}
 	} else {
+		r.resetReadinessPoll(key)
+	}
+	if len(desired) == 0 {
 		// Use the first rule host as the hostname fallback
 		for _, rule := range ingress.Spec.Rules {
 			if rule.Host != "" {
-				desired.Hostname = rule.Host
+				desired = append(desired, networkingv1.IngressLoadBalancerIngress{Hostname: rule.Host})
 				break
 			}
 		}
-		if desired.Hostname == "" {
-			log.Info("Configured site has no proxy IP and ingress has no host rules, skipping status update", "site", site.NiceID)
-			return nil
+		if len(desired) == 0 {
+			log.Info("Configured site has no proxy IP and ingress has no host rules, skipping status update", "sites", pending)
+			return 0, nil
 		}
 	}
 
-	needsUpdate := false
-	if len(ingress.Status.LoadBalancer.Ingress) == 0 {
-		needsUpdate = true
-	} else {
-		cur := ingress.Status.LoadBalancer.Ingress[0]
-		if cur.IP != desired.IP || cur.Hostname != desired.Hostname {
-			needsUpdate = true
+	if !loadBalancerAddressesEqual(ingress.Status.LoadBalancer.Ingress, desired) {
+		ingress.Status.LoadBalancer.Ingress = desired
+		if err := r.applyIngressStatus(ctx, ingress); err != nil {
+			log.Error(err, "Failed to update Ingress status")
+			return 0, err
 		}
+		log.Info("Updated Ingress status with Pangolin address", "name", ingress.Name, "ip", desired[0].IP, "hostname", desired[0].Hostname, "addresses", len(desired))
 	}
 
-	if needsUpdate {
-		ingress.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{desired}
-		if err := r.Status().Update(ctx, ingress); err != nil {
-			log.Error(err, "Failed to update Ingress status")
-			return err
+	return 0, nil
+}
+
+// loadBalancerAddressesEqual reports whether two status entry lists carry the
+// same set of IP and hostname pairs, regardless of their order. An entry only
+// matches one with both the same IP and the same hostname, so that adding a
+// hostname to an IP-only entry counts as a change.
+func loadBalancerAddressesEqual(a, b []networkingv1.IngressLoadBalancerIngress) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	type address struct{ ip, hostname string }
+	counts := make(map[address]int, len(a))
+	for _, lb := range a {
+		counts[address{lb.IP, lb.Hostname}]++
+	}
+	for _, lb := range b {
+		key := address{lb.IP, lb.Hostname}
+		if counts[key] == 0 {
+			return false
 		}
-		log.Info("Updated Ingress status with Pangolin address", "name", ingress.Name, "ip", desired.IP, "hostname", desired.Hostname)
+		counts[key]--
 	}
+	return true
+}
 
-	return nil
+// getSites looks up the sites with the given nice IDs, failing if any of them
+// does not exist
+func (r *IngressReconciler) getSites(ctx context.Context, niceIDs []string) ([]*pangolin.Site, error) {
+	sites := make([]*pangolin.Site, 0, len(niceIDs))
+	for _, niceID := range niceIDs {
+		site, err := r.PangolinClient.GetSiteByNiceID(ctx, niceID)
+		if err != nil {
+			if pangolin.IsNotFound(err) {
+				return nil, fmt.Errorf("site %s from annotation %s does not exist", niceID, r.annotationKey(annotationSiteIDs))
+			}
+			return nil, fmt.Errorf("failed to get site %s: %w", niceID, err)
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
 }
 
-// initPangolinClient initializes the Pangolin API client with API key from secret
+// initPangolinClient initializes the Pangolin API client with API key from
+// secret, unless it has already been initialized
 func (r *IngressReconciler) initPangolinClient(ctx context.Context) error {
 	log := log.FromContext(ctx)
 
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+	if r.PangolinClient != nil {
+		return nil
+	}
+
 	// Get API key from secret
 	secret := &corev1.Secret{}
 	err := r.Get(ctx, types.NamespacedName{
@@ -320,19 +1304,85 @@ func (r *IngressReconciler) initPangolinClient(ctx context.Context) error {
 		return fmt.Errorf("failed to get API key secret: %w", err)
 	}
 
+	var opts []pangolin.ClientOption
+	if r.RequestSigning == requestSigningHMACSHA256 {
+		hmacKey, ok := secret.Data["hmac-key"]
+		if !ok || len(hmacKey) == 0 {
+			return fmt.Errorf("hmac-key not found in secret %s/%s", r.APIKeyNamespace, r.APIKeySecret)
+		}
+		opts = append(opts, pangolin.WithRequestSigner(pangolin.NewHMACSigner(hmacKey)))
+	}
+
+	if r.UserAgent != "" {
+		opts = append(opts, pangolin.WithUserAgent(r.UserAgent))
+	}
+	if r.MaxConcurrentWrites > 0 {
+		opts = append(opts, pangolin.WithAdaptiveWriteConcurrency(r.MaxConcurrentWrites, r.WriteLatencyThreshold))
+	}
+	if r.MaxConcurrentRequests > 0 {
+		opts = append(opts, pangolin.WithMaxConcurrentRequests(r.MaxConcurrentRequests))
+	}
+	if r.RequestCompressionThreshold > 0 {
+		opts = append(opts, pangolin.WithRequestCompression(r.RequestCompressionThreshold))
+	}
+	if r.ResourceCacheTTL > 0 {
+		opts = append(opts, pangolin.WithResourceCache(r.ResourceCacheTTL))
+	}
+	if r.OperationTimeout > 0 {
+		opts = append(opts, pangolin.WithOperationTimeout(r.OperationTimeout))
+	}
+	if r.FieldNaming != "" {
+		opts = append(opts, pangolin.WithFieldNaming(pangolin.FieldNaming(r.FieldNaming)))
+	}
+	if r.DisableHTTP2 {
+		opts = append(opts, pangolin.WithHTTP2(false))
+	}
+
+	// Signed requests may be accepted without a bearer token
 	apiKey, ok := secret.Data["api-key"]
-	if !ok {
+	if !ok && r.RequestSigning == "" {
 		return fmt.Errorf("api-key not found in secret %s/%s", r.APIKeyNamespace, r.APIKeySecret)
 	}
 
-	r.PangolinClient = pangolin.NewClient(r.PangolinBaseURL, string(apiKey), r.OrgID)
-	log.Info("Initialized Pangolin client", "baseURL", r.PangolinBaseURL)
+	pangolinClient := pangolin.NewClient(r.PangolinBaseURL, string(apiKey), r.OrgID, opts...)
+	pangolinClient.SetMaxResponseBytes(r.MaxResponseBytes)
+	if err := r.verifyAPIKey(ctx, pangolinClient); err != nil {
+		pangolinClient.Close()
+		return err
+	}
+	r.PangolinClient = pangolinClient
+	log.Info("Initialized Pangolin client", "baseURL", r.PangolinBaseURL, "requestSigning", r.RequestSigning)
+
+	return nil
+}
+
+// verifyAPIKey fails fast on an API key of another organization or one
+// lacking the scopes needed to manage resources and targets. Pangolin
+// versions that don't report API key info are not verified.
+func (r *IngressReconciler) verifyAPIKey(ctx context.Context, c *pangolin.Client) error {
+	log := log.FromContext(ctx)
 
+	info, err := c.GetTokenInfo(ctx)
+	if err != nil {
+		if pangolin.IsNotFound(err) {
+			log.Info("Pangolin does not report API key scopes, skipping verification")
+			return nil
+		}
+		return fmt.Errorf("failed to get API key info: %w", err)
+	}
+	if info.OrgID != "" && info.OrgID != r.OrgID {
+		return fmt.Errorf("API key belongs to organization %q, not %q", info.OrgID, r.OrgID)
+	}
+	if missing := info.MissingScopes(requiredAPIKeyScopes...); len(missing) > 0 {
+		return fmt.Errorf("API key is missing required scopes: %s", strings.Join(missing, ", "))
+	}
 	return nil
 }
 
-// createOrUpdatePangolinResource creates or updates a Pangolin resource for an ingress rule
-func (r *IngressReconciler) createOrUpdatePangolinResource(ctx context.Context, ingress *networkingv1.Ingress, host string, path networkingv1.HTTPIngressPath, serviceName string, servicePort int32) error {
+// createOrUpdatePangolinResource creates or updates the Pangolin resource for
+// an ingress host and returns its ID. With TransactionalCreate, a new
+// resource is created together with the targets and rules of backends.
+func (r *IngressReconciler) createOrUpdatePangolinResource(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, host string, backends []ingressBackend) (string, error) {
 	log := log.FromContext(ctx)
 
 	// Parse host into subdomain and domain
@@ -340,263 +1390,1606 @@ func (r *IngressReconciler) createOrUpdatePangolinResource(ctx context.Context,
 	// In production, you'd want more sophisticated parsing
 	subdomain, domain := parseHost(host)
 
-	// Create resource name with configurable prefix
-	prefix := r.ResourcePrefix
-	if prefix == "" {
-		prefix = "pangolin-controller"
-	}
-	resourceName := fmt.Sprintf("%s-%s", prefix, host)
+	resourceName := r.resourceName(ingress, host)
 
-	// Check if resource already exists (stored in annotation)
-	resourceID := ingress.Annotations[annotationResourceID]
+	// Check if resource already exists (stored in annotation). A resource
+	// named by the user takes precedence and is never recreated.
+	resourceID, legacy := r.recordedResourceID(ingress, host)
+	if cfg.ExistingResourceID != "" {
+		resourceID, legacy = cfg.ExistingResourceID, false
+	}
 
 	var err error
 
 	if domain == "" {
-		return fmt.Errorf("host %s is missing a registrable domain", host)
+		return "", fmt.Errorf("host %s is missing a registrable domain", host)
 	}
 
 	domainID, err := r.resolveDomainID(ctx, domain)
 	if err != nil {
 		log.Error(err, "Failed to resolve domain ID", "domain", domain)
-		return err
+		return "", err
 	}
 
-	// Parse annotations for proxy and access control settings
-	annotations := ingress.Annotations
-	stickySession := parseBoolAnnotation(annotations, annotationStickySession)
-	postAuthPath := parseStringAnnotation(annotations, annotationPostAuthPath)
-
-	resourceReq := &pangolin.CreateResourceRequest{
-		Name:      resourceName,
-		Subdomain: subdomain,
-		HTTP:      true,
-		Protocol:  "tcp",
-		DomainID:  domainID,
-	}
-	if stickySession != nil && *stickySession {
-		resourceReq.StickySession = true
-	}
-	if postAuthPath != nil {
-		resourceReq.PostAuthPath = *postAuthPath
+	if _, err := r.getSites(ctx, cfg.SiteIDs); err != nil {
+		return "", err
 	}
 
-	updateReq := &pangolin.UpdateResourceRequest{
-		Name:                  resourceName,
-		Subdomain:             subdomain,
-		DomainID:              domainID,
-		Enabled:               parseBoolAnnotation(annotations, annotationEnabled),
-		SSO:                   parseBoolAnnotation(annotations, annotationSSO),
-		SSL:                   parseBoolAnnotation(annotations, annotationSSL),
-		BlockAccess:           parseBoolAnnotation(annotations, annotationBlockAccess),
-		EmailWhitelistEnabled: parseBoolAnnotation(annotations, annotationEmailWhitelistEnabled),
-		ApplyRules:            parseBoolAnnotation(annotations, annotationApplyRules),
-		StickySession:         stickySession,
-		TLSServerName:         parseStringAnnotation(annotations, annotationTLSServerName),
-		SetHostHeader:         parseStringAnnotation(annotations, annotationSetHostHeader),
-		PostAuthPath:          postAuthPath,
-		Headers:               parseHeadersAnnotation(annotations, annotationHeaders),
+	// current is the resource as found in Pangolin, if it already exists
+	var current *pangolin.Resource
+	if resourceID != "" {
+		if current, err = r.PangolinClient.GetResource(ctx, resourceID); err != nil {
+			if !pangolin.IsNotFound(err) {
+				log.Error(err, "Failed to get Pangolin resource", "resourceID", resourceID)
+				return "", fmt.Errorf("failed to get Pangolin resource %s: %w", resourceID, err)
+			}
+			if resourceID == cfg.ExistingResourceID {
+				err := fmt.Errorf("Pangolin resource %s from annotation %s does not exist",
+					resourceID, r.annotationKey(annotationExistingResourceID))
+				r.recordEvent(ingress, corev1.EventTypeWarning, "ResourceNotFound", "%v", err)
+				return "", err
+			}
+			// The resource was deleted out-of-band; recreate it
+			staleAnnotationTotal.Inc()
+			r.recordEvent(ingress, corev1.EventTypeWarning, "StaleResourceID",
+				"Pangolin resource %s referenced by annotation no longer exists, recreating it", resourceID)
+			log.Info("Pangolin resource referenced by annotation no longer exists, recreating", "resourceID", resourceID)
+			// The recreated resource has none of the certificates uploaded
+			// to the old one
+			if fingerprints := r.certificateFingerprints(ingress); fingerprints[resourceID] != "" {
+				delete(fingerprints, resourceID)
+				r.setCertificateFingerprints(ingress, fingerprints)
+			}
+			resourceID = ""
+			current = nil
+		}
+	}
+	// The resource-id annotation of an Ingress annotated before IDs were
+	// recorded per host may belong to another of its hosts
+	if legacy && current != nil && current.DomainID != "" && (current.Subdomain != subdomain || current.DomainID != domainID) {
+		resourceID = ""
+		current = nil
+	}
+	if err := r.checkInstance(ingress, current); err != nil {
+		return "", err
 	}
 
+	// Record an adopted resource like a created one, so that it is deleted
+	// with the Ingress and found again if the annotation is removed
+	if resourceID != "" && r.recordResourceID(ingress, host, resourceID) {
+		if err := r.applyIngressAnnotations(ctx, ingress); err != nil {
+			return "", err
+		}
+		if resourceID == cfg.ExistingResourceID {
+			log.Info("Adopted Pangolin resource from annotation", "resourceID", resourceID,
+				"annotation", r.annotationKey(annotationExistingResourceID))
+		}
+	}
+
+	owner := ingress.Namespace + "/" + ingress.Name
+	resourceReq := &pangolin.CreateResourceRequest{
+		Name:      resourceName,
+		Subdomain: subdomain,
+		HTTP:      true,
+		Protocol:  "tcp",
+		DomainID:  domainID,
+		RateLimit: cfg.RateLimit,
+		Metadata:  r.ingressMetadata(ingress, cfg),
+		SiteIDs:   cfg.SiteIDs,
+	}
+	resourceReq.Metadata[metadataOwners] = owner
+	r.tagInstance(resourceReq.Metadata)
+	if cfg.StickySession != nil && *cfg.StickySession {
+		resourceReq.StickySession = true
+	}
+	if cfg.WebSocket != nil && *cfg.WebSocket {
+		resourceReq.WebSocket = true
+	}
+	if cfg.ForwardedHeaders != nil {
+		resourceReq.ForwardedHeaders = *cfg.ForwardedHeaders
+	}
+	if cfg.PostAuthPath != nil {
+		resourceReq.PostAuthPath = *cfg.PostAuthPath
+	}
+	resourceReq.ResponseHeaders = cfg.ResponseHeaders
+	resourceReq.AllowedMethods = cfg.AllowedMethods
+	resourceReq.AllowCIDRs = cfg.AllowCIDRs
+	resourceReq.DenyCIDRs = cfg.DenyCIDRs
+	resourceReq.Priority = *intOrDefault(cfg.Priority, defaultResourcePriority)
+
+	updateReq := desiredResourceUpdate(cfg)
+	updateReq.Name = resourceName
+	updateReq.Subdomain = subdomain
+	updateReq.DomainID = domainID
+	updateReq.Metadata = r.ingressMetadata(ingress, cfg)
+	r.tagInstance(updateReq.Metadata)
+
 	var resource *pangolin.Resource
 
 	if resourceID != "" {
+		shareResource(updateReq, current, owner)
 		resource, err = r.PangolinClient.UpdateResource(ctx, resourceID, updateReq)
 		if err != nil {
 			log.Error(err, "Failed to update Pangolin resource", "resourceID", resourceID, "subdomain", subdomain, "domain", domain, "host", host)
-			return fmt.Errorf("failed to update Pangolin resource %s: %w", resourceID, err)
+			return "", fmt.Errorf("failed to update Pangolin resource %s: %w", resourceID, err)
 		}
-		log.Info("Updated Pangolin resource", "resourceID", resourceID, "name", resourceName)
+		countChange(ctx, summaryResources, summaryUpdated)
+		log.V(1).Info("Updated Pangolin resource", "resourceID", resourceID, "name", resourceName)
 	} else {
+		if err := r.checkResourceLimit(ctx, ingress); err != nil {
+			return "", err
+		}
+
 		// Create new resource
-		resource, err = r.PangolinClient.CreateResource(ctx, resourceReq)
+		resource, err = r.createResource(ctx, ingress, cfg, resourceReq, backends)
 		if err != nil {
 			if pangolin.IsConflict(err) {
 				// Resource already exists in Pangolin — adopt it
 				log.Info("Resource already exists, attempting to adopt", "host", host, "subdomain", subdomain)
 				resource, err = r.findExistingResource(ctx, subdomain, domainID)
 				if err != nil {
-					return fmt.Errorf("failed to adopt existing Pangolin resource for host %s: %w", host, err)
+					return "", fmt.Errorf("failed to adopt existing Pangolin resource for host %s: %w", host, err)
+				}
+				if err := r.checkInstance(ingress, resource); err != nil {
+					return "", err
+				}
+				if others := removeOwner(resourceOwners(resource), owner); r.ExclusiveHosts && len(others) > 0 {
+					return "", &hostConflictError{host: host, holder: others[0]}
 				}
 				log.Info("Adopted existing Pangolin resource", "resourceID", resource.ID, "name", resource.Name)
 			} else {
 				log.Error(err, "Failed to create Pangolin resource", "subdomain", subdomain, "domain", domain, "host", host)
-				return fmt.Errorf("failed to create Pangolin resource for host %s: %w", host, err)
+				return "", fmt.Errorf("failed to create Pangolin resource for host %s: %w", host, err)
 			}
 		} else {
-			log.Info("Created Pangolin resource", "resourceID", resource.ID, "name", resourceName)
+			countChange(ctx, summaryResources, summaryCreated)
+			log.V(1).Info("Created Pangolin resource", "resourceID", resource.ID, "name", resourceName)
 		}
 
 		// Store resource ID in annotation
-		if ingress.Annotations == nil {
-			ingress.Annotations = make(map[string]string)
-		}
 		resourceID = strconv.Itoa(resource.ID)
-		ingress.Annotations[annotationResourceID] = resourceID
-		if err := r.Update(ctx, ingress); err != nil {
-			return err
+		r.recordResourceID(ingress, host, resourceID)
+		if err := r.applyIngressAnnotations(ctx, ingress); err != nil {
+			return "", err
 		}
 
-		// Apply update settings (SSO, SSL, etc.) to the resource
+		// Apply update settings (SSO, SSL, etc.) to the resource. A resource
+		// adopted from another Ingress of the same host is shared with it.
+		shareResource(updateReq, resource, owner)
 		resource, err = r.PangolinClient.UpdateResource(ctx, resourceID, updateReq)
 		if err != nil {
 			log.Error(err, "Failed to apply settings to Pangolin resource", "resourceID", resourceID)
-			return fmt.Errorf("failed to apply settings to Pangolin resource %s: %w", resourceID, err)
+			return "", fmt.Errorf("failed to apply settings to Pangolin resource %s: %w", resourceID, err)
+		}
+	}
+
+	if err := r.syncCertificate(ctx, ingress, host, resourceID); err != nil {
+		log.Error(err, "Failed to sync TLS certificate", "resourceID", resourceID, "host", host)
+		return "", err
+	}
+
+	return resourceID, nil
+}
+
+// createResource creates a Pangolin resource. With TransactionalCreate, the
+// targets and rules of backends are created with it in a single request, so
+// that a failure or crash never leaves a resource without them behind. If the
+// API has no transactional endpoint, the controller falls back to creating
+// the resource alone for the rest of its lifetime, and the targets and rules
+// are created one by one afterwards. A 404 with an API error, e.g. for an
+// organization that isn't visible yet, only falls back for this create.
+func (r *IngressReconciler) createResource(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, req *pangolin.CreateResourceRequest, backends []ingressBackend) (*pangolin.Resource, error) {
+	log := log.FromContext(ctx)
+	if !r.TransactionalCreate || r.batchCreateUnsupported.Load() {
+		return r.PangolinClient.CreateResource(ctx, req)
+	}
+
+	batch, err := r.batchCreateRequest(ctx, ingress, cfg, req, backends)
+	if err != nil {
+		return nil, err
+	}
+	if batch == nil {
+		return r.PangolinClient.CreateResource(ctx, req)
+	}
+
+	created, err := r.PangolinClient.BatchCreateResource(ctx, batch)
+	if pangolin.IsBatchCreateUnsupported(err) {
+		r.batchCreateUnsupported.Store(true)
+		log.Info("Pangolin API does not support transactional creates, creating resources, targets and rules one by one")
+		return r.PangolinClient.CreateResource(ctx, req)
+	}
+	if pangolin.IsNotFound(err) {
+		log.Info("Transactional create failed, creating the resource alone", "reason", err.Error())
+		return r.PangolinClient.CreateResource(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for range created.Targets {
+		countChange(ctx, summaryTargets, summaryCreated)
+	}
+	for range created.Rules {
+		countChange(ctx, summaryRules, summaryCreated)
+	}
+	log.V(1).Info("Created Pangolin resource with its targets and rules in one transaction",
+		"resourceID", created.Resource.ID, "targets", len(created.Targets), "rules", len(created.Rules))
+	return &created.Resource, nil
+}
+
+// batchCreateRequest returns the transactional create of the resource req
+// with the targets and rules of backends, or nil if it can't be built up
+// front, e.g. because the port of a named backend port is unknown
+func (r *IngressReconciler) batchCreateRequest(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, req *pangolin.CreateResourceRequest, backends []ingressBackend) (*pangolin.BatchCreateResourceRequest, error) {
+	site, err := r.resolveSite(ctx, ingress.Annotations, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &pangolin.BatchCreateResourceRequest{Resource: req}
+	for _, backend := range backends {
+		if backend.servicePort == 0 {
+			return nil, nil
+		}
+		batch.Targets = append(batch.Targets, *r.desiredTarget(ingress, cfg, site, backend, backend.servicePort))
+	}
+
+	entries := ownRuleEntries(backends, ingress.Namespace+"/"+ingress.Name)
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].precedes(entries[b])
+	})
+	for priority, e := range entries {
+		batch.Rules = append(batch.Rules, pangolin.BatchResourceRule{
+			TargetIndex:   e.backend,
+			Path:          e.path,
+			PathMatchType: pathTypeToMatch(pathType(backends[e.backend].path)),
+			Priority:      priority + 1,
+			Enabled:       true,
+		})
+	}
+	return batch, nil
+}
+
+// tagInstance records the controller's InstanceID, if set, in the metadata of
+// a resource
+func (r *IngressReconciler) tagInstance(metadata map[string]string) {
+	if r.InstanceID != "" {
+		metadata[metadataInstanceID] = r.InstanceID
+	}
+}
+
+// foreignInstance returns the instance ID res is tagged with if it belongs to
+// another controller instance and must be left alone, and "" otherwise.
+// Untagged resources may be managed by every instance.
+func (r *IngressReconciler) foreignInstance(res *pangolin.Resource) string {
+	if res == nil || r.AllowForeignInstanceResources {
+		return ""
+	}
+	if id := res.Metadata[metadataInstanceID]; id != "" && id != r.InstanceID {
+		return id
+	}
+	return ""
+}
+
+// checkInstance returns an error, after emitting a Warning event on obj, if
+// res belongs to another controller instance
+func (r *IngressReconciler) checkInstance(obj client.Object, res *pangolin.Resource) error {
+	other := r.foreignInstance(res)
+	if other == "" {
+		return nil
+	}
+	err := fmt.Errorf("Pangolin resource %d is managed by controller instance %q, refusing to modify it", res.ID, other)
+	r.recordEvent(obj, corev1.EventTypeWarning, "ForeignInstanceResource", "%v", err)
+	return err
+}
+
+// desiredResourceUpdate returns the update setting every resource setting
+// managed through annotations. Settings whose annotation is unset are sent
+// with the value Pangolin gives a new HTTP resource, so that removing an
+// annotation reverts the setting rather than leaving the last value behind.
+func desiredResourceUpdate(cfg *ingressConfig) *pangolin.UpdateResourceRequest {
+	headers := cfg.Headers
+	if headers == nil {
+		headers = []pangolin.Header{}
+	}
+	responseHeaders := cfg.ResponseHeaders
+	if responseHeaders == nil {
+		responseHeaders = map[string]string{}
+	}
+	allowedMethods := cfg.AllowedMethods
+	if allowedMethods == nil {
+		allowedMethods = []string{}
+	}
+	allowCIDRs := cfg.AllowCIDRs
+	if allowCIDRs == nil {
+		allowCIDRs = []string{}
+	}
+	denyCIDRs := cfg.DenyCIDRs
+	if denyCIDRs == nil {
+		denyCIDRs = []string{}
+	}
+	siteIDs := cfg.SiteIDs
+	if siteIDs == nil {
+		siteIDs = []string{}
+	}
+	return &pangolin.UpdateResourceRequest{
+		Enabled:               boolOrDefault(cfg.Enabled, true),
+		SSO:                   boolOrDefault(cfg.SSO, true),
+		SSL:                   boolOrDefault(cfg.SSL, true),
+		BlockAccess:           boolOrDefault(cfg.BlockAccess, false),
+		EmailWhitelistEnabled: boolOrDefault(cfg.EmailWhitelistEnabled, false),
+		ApplyRules:            boolOrDefault(cfg.ApplyRules, false),
+		StickySession:         boolOrDefault(cfg.StickySession, false),
+		WebSocket:             boolOrDefault(cfg.WebSocket, false),
+		ForwardedHeaders:      stringOrDefault(cfg.ForwardedHeaders, pangolin.ForwardedHeadersTrust),
+		TLSServerName:         stringOrDefault(cfg.TLSServerName, ""),
+		SetHostHeader:         stringOrDefault(cfg.SetHostHeader, ""),
+		PostAuthPath:          stringOrDefault(cfg.PostAuthPath, ""),
+		Headers:               &headers,
+		ResponseHeaders:       &responseHeaders,
+		AllowedMethods:        &allowedMethods,
+		AllowCIDRs:            &allowCIDRs,
+		DenyCIDRs:             &denyCIDRs,
+		Priority:              intOrDefault(cfg.Priority, defaultResourcePriority),
+		RateLimit:             cfg.RateLimit,
+		SiteIDs:               &siteIDs,
+	}
+}
+
+// boolOrDefault returns v, or a pointer to def if v is nil
+func boolOrDefault(v *bool, def bool) *bool {
+	if v != nil {
+		return v
+	}
+	return &def
+}
+
+// intOrDefault returns v, or a pointer to def if v is nil
+func intOrDefault(v *int, def int) *int {
+	if v != nil {
+		return v
+	}
+	return &def
+}
+
+// stringOrDefault returns v, or a pointer to def if v is nil
+func stringOrDefault(v *string, def string) *string {
+	if v != nil {
+		return v
+	}
+	return &def
+}
+
+// shareResource adds owner to the owners of the existing resource current in
+// the metadata of req. While other Ingresses own the resource as well, its
+// name and kubernetes.ingress metadata are left as they are, so that the
+// owners don't keep overwriting each other.
+func shareResource(req *pangolin.UpdateResourceRequest, current *pangolin.Resource, owner string) {
+	owners := addOwner(resourceOwners(current), owner)
+	req.Metadata[metadataOwners] = strings.Join(owners, ",")
+	if len(owners) == 1 {
+		return
+	}
+	req.Name = current.Name
+	if first := current.Metadata[metadataIngress]; first != "" {
+		req.Metadata[metadataIngress] = first
+	}
+}
+
+// resourceOwners returns the Ingresses contributing to a resource. Resources
+// that predate the kubernetes.owners metadata are owned by the Ingress in
+// their kubernetes.ingress metadata, if any.
+func resourceOwners(res *pangolin.Resource) []string {
+	if res == nil {
+		return nil
+	}
+	if owners := res.Metadata[metadataOwners]; owners != "" {
+		return strings.Split(owners, ",")
+	}
+	if owner := res.Metadata[metadataIngress]; owner != "" {
+		return []string{owner}
+	}
+	return nil
+}
+
+// addOwner returns owners with owner added, sorted
+func addOwner(owners []string, owner string) []string {
+	result := []string{owner}
+	for _, o := range owners {
+		if o != owner {
+			result = append(result, o)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// removeOwner returns owners without owner
+func removeOwner(owners []string, owner string) []string {
+	var result []string
+	for _, o := range owners {
+		if o != owner {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// reconcileTargets creates or updates the targets of a resource for all
+// backends of a host, at most TargetConcurrency at a time. Failures are
+// aggregated in path order; stale targets are only cleaned up once every
+// backend has been reconciled successfully. While stale targets are being
+// drained, it returns the delay until the next one can be deleted.
+func (r *IngressReconciler) reconcileTargets(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, resourceID string, backends []ingressBackend) (time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	site, err := r.resolveSite(ctx, ingress.Annotations, nil)
+	if err != nil {
+		log.Error(err, "Failed to resolve site for target creation", "siteNiceID", r.SiteNiceID)
+		return 0, err
+	}
+
+	// Check for existing targets to avoid duplicates on restarts
+	existingTargets, err := r.PangolinClient.ListTargets(ctx, resourceID)
+	if err != nil {
+		log.Error(err, "Failed to list existing targets", "resourceID", resourceID)
+		return 0, fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+	}
+
+	// Targets matching a backend exactly are never moved to another port by
+	// a backend whose port changed
+	owner := ingress.Namespace + "/" + ingress.Name
+	matched := make(map[int]bool)
+	for _, backend := range backends {
+		for i := range existingTargets {
+			t := &existingTargets[i]
+			if t.SiteID == site.ID && t.IP == targetAddress(cfg, backend) && t.Port == int(backend.servicePort) && t.Path == ingressPath(backend.path) && ownsTarget(t, owner) {
+				matched[t.ID] = true
+			}
+		}
+	}
+
+	// Each worker only writes its own slot, so results stay in path order
+	// regardless of completion order
+	targetIDs := make([]int, len(backends))
+	errs := make([]error, len(backends))
+
+	var g errgroup.Group
+	g.SetLimit(r.targetConcurrency())
+	for i := range backends {
+		i := i
+		g.Go(func() error {
+			targetIDs[i], errs[i] = r.createOrUpdateTarget(ctx, ingress, cfg, resourceID, site, existingTargets, matched, backends[i])
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return 0, err
+	}
+
+	// Targets of other Ingresses sharing the resource are left alone
+	foreign := make(map[int]string)
+	for i := range existingTargets {
+		if t := &existingTargets[i]; !ownsTarget(t, owner) {
+			foreign[t.ID] = t.Metadata[metadataIngress]
+		}
+	}
+
+	// Bind every path to its target before stale targets are removed, so
+	// that no rule is left pointing at a deleted target
+	if err := r.syncResourceRules(ctx, resourceID, owner, backends, targetIDs, foreign); err != nil {
+		log.Error(err, "Failed to sync Pangolin resource rules", "resourceID", resourceID)
+		return 0, err
+	}
+
+	active := make(map[int]bool, len(targetIDs))
+	for _, id := range targetIDs {
+		active[id] = true
+	}
+
+	// Clean up stale targets that don't match any active one
+	var requeueAfter time.Duration
+	for _, t := range existingTargets {
+		if active[t.ID] || foreign[t.ID] != "" {
+			continue
+		}
+		drainAfter, err := r.removeStaleTarget(ctx, t)
+		if err != nil {
+			log.Error(err, "Failed to remove stale Pangolin target", "targetID", t.ID)
+			continue
+		}
+		requeueAfter = earliestRequeue(requeueAfter, drainAfter)
+	}
+
+	return requeueAfter, nil
+}
+
+// removeStaleTarget deletes a target that no backend maps to anymore. With a
+// TargetDrainPeriod, the target is first set to weight 0 and the time the
+// drain started is recorded in its metadata; it is only deleted once the
+// period has elapsed. Until then the remaining drain time is returned.
+func (r *IngressReconciler) removeStaleTarget(ctx context.Context, t pangolin.Target) (time.Duration, error) {
+	log := log.FromContext(ctx)
+	targetID := strconv.Itoa(t.ID)
+
+	if r.TargetDrainPeriod > 0 {
+		started, draining := drainStarted(t)
+		if !draining {
+			if _, err := r.PangolinClient.UpdateTarget(ctx, targetID, drainRequest(t, time.Now())); err != nil {
+				return 0, fmt.Errorf("failed to drain Pangolin target %s: %w", targetID, err)
+			}
+			countChange(ctx, summaryTargets, summaryUpdated)
+			log.V(1).Info("Draining stale Pangolin target", "targetID", targetID, "ip", t.IP, "port", t.Port, "drainPeriod", r.TargetDrainPeriod)
+			return r.TargetDrainPeriod, nil
+		}
+		if remaining := r.TargetDrainPeriod - time.Since(started); remaining > 0 {
+			log.V(1).Info("Stale Pangolin target still draining", "targetID", targetID, "remaining", remaining)
+			return remaining, nil
+		}
+	}
+
+	if err := r.PangolinClient.DeleteTarget(ctx, targetID); err != nil && !pangolin.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to delete Pangolin target %s: %w", targetID, err)
+	}
+	countChange(ctx, summaryTargets, summaryDeleted)
+	log.V(1).Info("Deleted stale Pangolin target", "targetID", targetID, "ip", t.IP, "port", t.Port)
+	return 0, nil
+}
+
+// drainStarted returns when draining of a target started, if it is draining
+func drainStarted(t pangolin.Target) (time.Time, bool) {
+	value, ok := t.Metadata[metadataDrainStarted]
+	if !ok {
+		return time.Time{}, false
+	}
+	started, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// An unreadable marker still means the target was being drained;
+		// restart the drain rather than deleting the target early
+		return time.Time{}, false
+	}
+	return started, true
+}
+
+// drainRequest returns the update that takes a target out of rotation while
+// keeping its established connections, marking it as draining since now
+func drainRequest(t pangolin.Target, now time.Time) *pangolin.CreateTargetRequest {
+	metadata := make(map[string]string, len(t.Metadata)+1)
+	for k, v := range t.Metadata {
+		metadata[k] = v
+	}
+	metadata[metadataDrainStarted] = now.UTC().Format(time.RFC3339)
+
+	weight := 0
+	return &pangolin.CreateTargetRequest{
+		SiteID:        t.SiteID,
+		IP:            t.IP,
+		Method:        t.Method,
+		Port:          t.Port,
+		Enabled:       t.Enabled,
+		Path:          t.Path,
+		PathMatchType: t.PathMatchType,
+		Weight:        &weight,
+		Metadata:      metadata,
+	}
+}
+
+// syncResourceRules creates or updates a resource rule binding each backend
+// path to its target and deletes the rules of paths no longer in the Ingress.
+// More specific paths get a higher priority (lower number): exact matches
+// first, then longer paths, then spec order. The rules of other Ingresses
+// sharing the resource, i.e. those bound to a target in foreign, are ordered
+// together with the paths of owner, ties going to the Ingress whose name
+// sorts first; they are only ever reprioritized, never changed otherwise or
+// deleted.
+func (r *IngressReconciler) syncResourceRules(ctx context.Context, resourceID, owner string, backends []ingressBackend, targetIDs []int, foreign map[int]string) error {
+	log := log.FromContext(ctx)
+
+	existingRules, err := r.PangolinClient.ListResourceRules(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to list rules for resource %s: %w", resourceID, err)
+	}
+
+	// Own paths are ordered by spec index, foreign rules by their current
+	// priority, which their Ingress derived from its spec order
+	entries := ownRuleEntries(backends, owner)
+	for i := range existingRules {
+		rule := &existingRules[i]
+		if other := foreign[rule.TargetID]; other != "" {
+			entries = append(entries, ruleEntry{
+				exact:   rule.PathMatchType == pathTypeToMatch(networkingv1.PathTypeExact),
+				path:    rule.Path,
+				owner:   other,
+				index:   rule.Priority,
+				backend: -1,
+				rule:    rule,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].precedes(entries[b])
+	})
+
+	keep := make(map[int]bool, len(entries))
+	for priority, e := range entries {
+		if e.rule != nil {
+			keep[e.rule.ID] = true
+			if e.rule.Priority == priority+1 {
+				continue
+			}
+			ruleID := strconv.Itoa(e.rule.ID)
+			if _, err := r.PangolinClient.UpdateResourceRule(ctx, resourceID, ruleID, &pangolin.ResourceRuleRequest{
+				TargetID:      e.rule.TargetID,
+				Path:          e.rule.Path,
+				PathMatchType: e.rule.PathMatchType,
+				Priority:      priority + 1,
+				Enabled:       e.rule.Enabled,
+			}); err != nil {
+				return fmt.Errorf("failed to reprioritize rule %s of %s for path %s: %w", ruleID, e.owner, e.rule.Path, err)
+			}
+			countChange(ctx, summaryRules, summaryUpdated)
+			log.V(1).Info("Reprioritized Pangolin resource rule of another Ingress", "ruleID", ruleID, "path", e.rule.Path, "ingress", e.owner, "priority", priority+1)
+			continue
+		}
+
+		i := e.backend
+		ruleReq := &pangolin.ResourceRuleRequest{
+			TargetID:      targetIDs[i],
+			Path:          ingressPath(backends[i].path),
+			PathMatchType: pathTypeToMatch(pathType(backends[i].path)),
+			Priority:      priority + 1,
+			Enabled:       true,
+		}
+
+		var existing *pangolin.ResourceRule
+		for j := range existingRules {
+			rule := &existingRules[j]
+			if !keep[rule.ID] && foreign[rule.TargetID] == "" && rule.Path == ruleReq.Path && rule.PathMatchType == ruleReq.PathMatchType {
+				existing = rule
+				break
+			}
+		}
+
+		if existing == nil {
+			rule, err := r.PangolinClient.CreateResourceRule(ctx, resourceID, ruleReq)
+			if err != nil {
+				return fmt.Errorf("failed to create rule for path %s: %w", ruleReq.Path, err)
+			}
+			keep[rule.ID] = true
+			countChange(ctx, summaryRules, summaryCreated)
+			log.V(1).Info("Created Pangolin resource rule", "ruleID", rule.ID, "path", ruleReq.Path, "targetID", ruleReq.TargetID)
+			continue
+		}
+
+		keep[existing.ID] = true
+		if existing.TargetID == ruleReq.TargetID && existing.Priority == ruleReq.Priority && existing.Enabled {
+			continue
+		}
+		ruleID := strconv.Itoa(existing.ID)
+		if _, err := r.PangolinClient.UpdateResourceRule(ctx, resourceID, ruleID, ruleReq); err != nil {
+			return fmt.Errorf("failed to update rule %s for path %s: %w", ruleID, ruleReq.Path, err)
+		}
+		countChange(ctx, summaryRules, summaryUpdated)
+		log.V(1).Info("Updated Pangolin resource rule", "ruleID", ruleID, "path", ruleReq.Path, "targetID", ruleReq.TargetID)
+	}
+
+	// Delete rules of paths that were removed from the Ingress
+	for _, rule := range existingRules {
+		if keep[rule.ID] {
+			continue
+		}
+		ruleID := strconv.Itoa(rule.ID)
+		if err := r.PangolinClient.DeleteResourceRule(ctx, resourceID, ruleID); err != nil && !pangolin.IsNotFound(err) {
+			return fmt.Errorf("failed to delete stale rule %s: %w", ruleID, err)
+		}
+		countChange(ctx, summaryRules, summaryDeleted)
+		log.V(1).Info("Deleted stale Pangolin resource rule", "ruleID", ruleID, "path", rule.Path)
+	}
+
+	return nil
+}
+
+// ownRuleEntries returns the rule entries of the paths of backends, which
+// belong to owner
+func ownRuleEntries(backends []ingressBackend, owner string) []ruleEntry {
+	entries := make([]ruleEntry, 0, len(backends))
+	for i := range backends {
+		entries = append(entries, ruleEntry{
+			exact:   pathType(backends[i].path) == networkingv1.PathTypeExact,
+			path:    ingressPath(backends[i].path),
+			owner:   owner,
+			index:   i,
+			backend: i,
+		})
+	}
+	return entries
+}
+
+// ruleEntry is a path of a resource in the order of its rules: either a
+// backend of the reconciled Ingress or an existing rule of another Ingress
+// sharing the resource
+type ruleEntry struct {
+	exact bool
+	path  string
+	// owner is the Ingress the path belongs to
+	owner string
+	// index orders entries of the same owner and specificity
+	index int
+	// backend is the index of an own backend, or -1 for a foreign rule
+	backend int
+	rule    *pangolin.ResourceRule
+}
+
+// precedes reports whether e should be matched before o: exact paths before
+// all others, then longer paths before shorter ones. Ties are broken by owner
+// and then index, so that every owner computes the same order.
+func (e ruleEntry) precedes(o ruleEntry) bool {
+	if e.exact != o.exact {
+		return e.exact
+	}
+	if len(e.path) != len(o.path) {
+		return len(e.path) > len(o.path)
+	}
+	if e.owner != o.owner {
+		return e.owner < o.owner
+	}
+	return e.index < o.index
+}
+
+// ingressPath returns the path of an Ingress path, defaulting to "/"
+func ingressPath(path networkingv1.HTTPIngressPath) string {
+	if path.Path == "" {
+		return "/"
+	}
+	return path.Path
+}
+
+// exactPath applies the exact-trailing-slash mode to an Exact path, so that
+// its target and its rule are both created with the same path. Other paths
+// and the root path are returned unchanged.
+func exactPath(path networkingv1.HTTPIngressPath, mode string) networkingv1.HTTPIngressPath {
+	p := ingressPath(path)
+	if pathType(path) != networkingv1.PathTypeExact || p == "/" {
+		return path
+	}
+	switch mode {
+	case exactTrailingSlashStrip:
+		path.Path = strings.TrimRight(p, "/")
+	case exactTrailingSlashAppend:
+		if !strings.HasSuffix(p, "/") {
+			path.Path = p + "/"
+		}
+	}
+	return path
+}
+
+// targetConcurrency returns the configured target worker limit, falling back
+// to the default.
+func (r *IngressReconciler) targetConcurrency() int {
+	if r.TargetConcurrency <= 0 {
+		return defaultTargetConcurrency
+	}
+	return r.TargetConcurrency
+}
+
+// createOrUpdateTarget creates or updates the target for a single backend and
+// returns its ID. Targets are matched without regard to their weight, so a
+// weight change updates the target in place and keeps its connections.
+// Updating a target that is being drained replaces its metadata and weight,
+// which puts it back into rotation. Without an exact match, a target of the
+// same path and address on another port, e.g. after the Service port number
+// changed, is moved to the new port in place unless it is in matched, the
+// targets matching another backend exactly.
+func (r *IngressReconciler) createOrUpdateTarget(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, resourceID string, site *pangolin.Site, existingTargets []pangolin.Target, matched map[int]bool, backend ingressBackend) (int, error) {
+	log := log.FromContext(ctx)
+	serviceName := backend.serviceName
+	servicePort := backend.servicePort
+
+	targetIP := targetAddress(cfg, backend)
+	targetPath := ingressPath(backend.path)
+	owner := ingress.Namespace + "/" + ingress.Name
+
+	if servicePort == 0 {
+		lastKnown, ok := lastKnownNamedPort(existingTargets, owner, site.ID, targetIP, targetPath, backend.portName)
+		if !ok {
+			return 0, fmt.Errorf("could not determine service port for service %s", serviceName)
+		}
+		log.Info("Named service port not found, using the last known port number", "service", serviceName, "portName", backend.portName, "port", lastKnown)
+		servicePort = lastKnown
+	}
+	targetPort := int(servicePort)
+
+	// Look for a target that matches our site, IP, port and path. Targets
+	// created before a crash or failed reconcile are found here and updated,
+	// so retries never create duplicates.
+	var existingTarget *pangolin.Target
+	for i := range existingTargets {
+		t := &existingTargets[i]
+		if t.SiteID == site.ID && t.IP == targetIP && t.Port == targetPort && t.Path == targetPath && ownsTarget(t, owner) {
+			existingTarget = t
+			break
+		}
+	}
+	if existingTarget == nil {
+		pathMatchType := pathTypeToMatch(pathType(backend.path))
+		for i := range existingTargets {
+			t := &existingTargets[i]
+			if !matched[t.ID] && t.SiteID == site.ID && t.IP == targetIP && t.Path == targetPath && t.PathMatchType == pathMatchType && t.Metadata[metadataIngress] == owner {
+				existingTarget = t
+				log.V(1).Info("Service port changed, moving the Pangolin target to the new port", "targetID", t.ID, "service", serviceName, "oldPort", t.Port, "port", targetPort)
+				break
+			}
+		}
+	}
+
+	targetReq := r.desiredTarget(ingress, cfg, site, backend, servicePort)
+	weight := *targetReq.Weight
+
+	var activeTargetID int
+	if existingTarget != nil {
+		// Target already exists — update it instead of creating a duplicate
+		targetIDStr := strconv.Itoa(existingTarget.ID)
+		if _, err := r.PangolinClient.UpdateTarget(ctx, targetIDStr, targetReq); err != nil {
+			log.Error(err, "Failed to update Pangolin target", "targetID", targetIDStr, "resourceID", resourceID)
+			return 0, fmt.Errorf("failed to update Pangolin target %s: %w", targetIDStr, err)
+		}
+		activeTargetID = existingTarget.ID
+		countChange(ctx, summaryTargets, summaryUpdated)
+		log.V(1).Info("Updated existing Pangolin target", "targetID", targetIDStr, "service", serviceName, "port", servicePort, "weight", weight)
+	} else {
+		// No matching target — create a new one
+		newTarget, createErr := r.PangolinClient.CreateTarget(ctx, resourceID, targetReq)
+		if createErr != nil {
+			log.Error(createErr, "Failed to create Pangolin target", "resourceID", resourceID, "service", serviceName, "port", servicePort)
+			return 0, fmt.Errorf("failed to create Pangolin target for service %s:%d: %w", serviceName, servicePort, createErr)
+		}
+		activeTargetID = newTarget.ID
+		countChange(ctx, summaryTargets, summaryCreated)
+		log.V(1).Info("Created Pangolin target", "targetID", newTarget.ID, "service", serviceName, "port", servicePort)
+	}
+
+	return activeTargetID, nil
+}
+
+// targetAddress returns the address targets of backend point to: the
+// cluster DNS name of its Service unless the target-address annotation is set
+func targetAddress(cfg *ingressConfig, backend ingressBackend) string {
+	if cfg.TargetAddress != "" {
+		return cfg.TargetAddress
+	}
+	return fmt.Sprintf("%s.%s.svc.cluster.local", backend.serviceName, backend.serviceNamespace)
+}
+
+// checkServiceResolution checks that the cluster DNS name of service resolves
+// the way mode states. An empty mode accepts any Service.
+func checkServiceResolution(service *corev1.Service, mode string) error {
+	headless := service.Spec.ClusterIP == corev1.ClusterIPNone
+	switch mode {
+	case serviceResolutionClusterIP:
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			return fmt.Errorf("service resolution is %s, but Service %s/%s is of type ExternalName", mode, service.Namespace, service.Name)
+		}
+		if headless {
+			return fmt.Errorf("service resolution is %s, but Service %s/%s is headless", mode, service.Namespace, service.Name)
+		}
+	case serviceResolutionHeadless:
+		if !headless {
+			return fmt.Errorf("service resolution is %s, but Service %s/%s has a cluster IP", mode, service.Namespace, service.Name)
+		}
+	}
+	return nil
+}
+
+// targetWeight returns the weight of the targets of an Ingress: its
+// target-weight annotation, or else the controller's default
+func (r *IngressReconciler) targetWeight(cfg *ingressConfig) int {
+	if cfg.TargetWeight != nil {
+		return *cfg.TargetWeight
+	}
+	if r.DefaultTargetWeight > 0 {
+		return r.DefaultTargetWeight
+	}
+	return defaultTargetWeight
+}
+
+// desiredTarget returns the target for backend on site, served on
+// servicePort
+func (r *IngressReconciler) desiredTarget(ingress *networkingv1.Ingress, cfg *ingressConfig, site *pangolin.Site, backend ingressBackend, servicePort int32) *pangolin.CreateTargetRequest {
+	hc := cfg.HealthCheck
+	targetIP := targetAddress(cfg, backend)
+	weight := r.targetWeight(cfg)
+
+	targetReq := &pangolin.CreateTargetRequest{
+		SiteID:              site.ID,
+		IP:                  targetIP,
+		Method:              "http",
+		Port:                int(servicePort),
+		Enabled:             true,
+		Path:                ingressPath(backend.path),
+		PathMatchType:       pathTypeToMatch(pathType(backend.path)),
+		Weight:              &weight,
+		Metadata:            r.ingressMetadata(ingress, cfg),
+		HCEnabled:           hc.Enabled,
+		HCPath:              hc.Path,
+		HCScheme:            hc.Scheme,
+		HCMode:              hc.Mode,
+		HCHostname:          hc.Hostname,
+		HCPort:              hc.Port,
+		HCInterval:          hc.Interval,
+		HCUnhealthyInterval: hc.UnhealthyInterval,
+		HCTimeout:           hc.Timeout,
+		HCHeaders:           hc.Headers,
+		HCFollowRedirects:   hc.FollowRedirects,
+		HCMethod:            hc.Method,
+		HCStatus:            hc.Status,
+		HCTLSServerName:     hc.TLSServerName,
+	}
+
+	if backend.portName != "" {
+		targetReq.Metadata[metadataNamedPort] = fmt.Sprintf("%s=%d", backend.portName, servicePort)
+	}
+
+	// Path, interval and method defaults were filled in when the annotations
+	// were parsed; hostname and port default to the target itself
+	if hc.Enabled != nil && *hc.Enabled {
+		if targetReq.HCHostname == nil {
+			targetReq.HCHostname = &targetIP
+		}
+		if targetReq.HCPort == nil {
+			p := int(servicePort)
+			targetReq.HCPort = &p
+		}
+	}
+	return targetReq
+}
+
+// syncCertificate uploads the certificate from the TLS secret covering host to
+// the Pangolin resource. The fingerprint of the uploaded certificate is stored
+// per resource in an annotation so that unchanged certificates are not
+// re-uploaded on every reconcile, while rotated ones are.
+func (r *IngressReconciler) syncCertificate(ctx context.Context, ingress *networkingv1.Ingress, host, resourceID string) error {
+	log := log.FromContext(ctx)
+
+	secretName := tlsSecretForHost(ingress, host)
+	if secretName == "" {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      secretName,
+		Namespace: ingress.Namespace,
+	}, secret)
+	if err != nil {
+		return fmt.Errorf("failed to get TLS secret %s/%s: %w", ingress.Namespace, secretName, err)
+	}
+
+	certPEM := secret.Data[corev1.TLSCertKey]
+	keyPEM := secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return fmt.Errorf("TLS secret %s/%s must contain %s and %s", ingress.Namespace, secretName, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+
+	fingerprint, err := certificateFingerprint(certPEM)
+	if err != nil {
+		return fmt.Errorf("invalid certificate in TLS secret %s/%s: %w", ingress.Namespace, secretName, err)
+	}
+	fingerprints := r.certificateFingerprints(ingress)
+	if fingerprints[resourceID] == fingerprint {
+		log.V(1).Info("TLS certificate unchanged, skipping upload", "resourceID", resourceID, "secret", secretName)
+		return nil
+	}
+
+	if err := r.PangolinClient.UploadCertificate(ctx, resourceID, certPEM, keyPEM); err != nil {
+		return fmt.Errorf("failed to upload TLS certificate to Pangolin resource %s: %w", resourceID, err)
+	}
+	log.Info("Uploaded TLS certificate to Pangolin resource", "resourceID", resourceID, "secret", secretName, "fingerprint", fingerprint)
+
+	fingerprints[resourceID] = fingerprint
+	r.setCertificateFingerprints(ingress, fingerprints)
+	return r.applyIngressAnnotations(ctx, ingress)
+}
+
+// certificateFingerprints returns the certificate fingerprints recorded per
+// resource ID in the certificate-fingerprints annotation of an Ingress. An
+// unparsable value counts as no fingerprints, so that the certificates are
+// uploaded again.
+func (r *IngressReconciler) certificateFingerprints(ingress *networkingv1.Ingress) map[string]string {
+	fingerprints := map[string]string{}
+	value := ingress.Annotations[r.annotationKey(annotationCertificateFingerprints)]
+	if value == "" {
+		return fingerprints
+	}
+	if err := json.Unmarshal([]byte(value), &fingerprints); err != nil {
+		return map[string]string{}
+	}
+	return fingerprints
+}
+
+// setCertificateFingerprints writes fingerprints to the
+// certificate-fingerprints annotation, or removes it if there are none
+func (r *IngressReconciler) setCertificateFingerprints(ingress *networkingv1.Ingress, fingerprints map[string]string) {
+	key := r.annotationKey(annotationCertificateFingerprints)
+	if len(fingerprints) == 0 {
+		delete(ingress.Annotations, key)
+		return
+	}
+	// Maps are marshalled with sorted keys, so the value is stable
+	value, _ := json.Marshal(fingerprints)
+	if ingress.Annotations == nil {
+		ingress.Annotations = make(map[string]string)
+	}
+	ingress.Annotations[key] = string(value)
+}
+
+// pruneCertificateFingerprints drops the fingerprints of resources no longer
+// recorded for the Ingress, so that a recreated resource gets its
+// certificate again, and reports whether the annotations changed
+func (r *IngressReconciler) pruneCertificateFingerprints(ingress *networkingv1.Ingress) bool {
+	fingerprints := r.certificateFingerprints(ingress)
+	if len(fingerprints) == 0 {
+		return false
+	}
+	recorded := make(map[string]bool)
+	for _, id := range r.allResourceIDs(ingress) {
+		recorded[id] = true
+	}
+	pruned := false
+	for id := range fingerprints {
+		if !recorded[id] {
+			delete(fingerprints, id)
+			pruned = true
+		}
+	}
+	if pruned {
+		r.setCertificateFingerprints(ingress, fingerprints)
+	}
+	return pruned
+}
+
+// tlsSecretForHost returns the name of the TLS secret whose hosts cover host,
+// or an empty string if the Ingress has no TLS configuration for it.
+func tlsSecretForHost(ingress *networkingv1.Ingress, host string) string {
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" {
+			continue
+		}
+		for _, h := range tls.Hosts {
+			if tlsHostCovers(h, host) {
+				return tls.SecretName
+			}
+		}
+	}
+	return ""
+}
+
+// tlsHostCovers reports whether a host of spec.tls, possibly a wildcard such
+// as *.example.com, covers host
+func tlsHostCovers(tlsHost, host string) bool {
+	if tlsHost == host {
+		return true
+	}
+	if strings.HasPrefix(tlsHost, "*.") {
+		if i := strings.Index(host, "."); i > 0 && host[i+1:] == tlsHost[2:] {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateFingerprint returns the hex-encoded SHA-256 digest of the first
+// certificate in a PEM bundle.
+func certificateFingerprint(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("no PEM-encoded certificate found")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// tlsSecretIndex is the field index of Ingresses by the names of the Secrets
+// referenced in their spec.tls
+const tlsSecretIndex = "spec.tls.secretName"
+
+// ingressTLSSecrets returns the index values of an Ingress for tlsSecretIndex
+func ingressTLSSecrets(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	var secrets []string
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName != "" {
+			secrets = append(secrets, tls.SecretName)
+		}
+	}
+	return secrets
+}
+
+// ingressesForTLSSecret maps a Secret to the managed Ingresses in its namespace
+// that reference it in spec.tls, looked up through tlsSecretIndex, so that
+// certificate rotations are re-uploaded.
+func (r *IngressReconciler) ingressesForTLSSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{tlsSecretIndex: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ingresses for TLS secret", "secret", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+		if !r.isManaged(ctx, ingress) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+		})
+	}
+	return requests
+}
+
+// backendServiceIndex is the field index of Ingresses by the namespace/name of
+// the Services their paths route to
+const backendServiceIndex = "spec.rules.http.paths.backend.service"
+
+// ingressBackendServices returns the index values of an Ingress for
+// backendServiceIndex. Services are resolved in the namespace of the
+// backend-namespace annotation, if set, like in processIngressRules.
+func (r *IngressReconciler) ingressBackendServices(obj client.Object) []string {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	namespace := strings.ToLower(strings.TrimSpace(ingress.Annotations[r.annotationKey(annotationBackendNamespace)]))
+	if namespace == "" {
+		namespace = ingress.Namespace
+	}
+	var services []string
+	seen := make(map[string]bool)
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service == nil {
+				continue
+			}
+			key := namespace + "/" + path.Backend.Service.Name
+			if !seen[key] {
+				seen[key] = true
+				services = append(services, key)
+			}
+		}
+	}
+	return services
+}
+
+// ingressesForService maps a created or deleted Service, or one whose ports
+// changed, to the managed Ingresses routing to it, looked up through
+// backendServiceIndex. An Ingress switched to a Service that didn't exist yet,
+// e.g. while the Service is renamed, is thus reconciled as soon as the Service
+// appears, and its targets follow a named port that disappears or comes back
+// with a new number during a rollout instead of waiting for the next edit.
+func (r *IngressReconciler) ingressesForService(ctx context.Context, obj client.Object) []reconcile.Request {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.MatchingFields{backendServiceIndex: obj.GetNamespace() + "/" + obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Ingresses for Service", "service", obj.GetName(), "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range ingresses.Items {
+		ingress := &ingresses.Items[i]
+		if !r.isManaged(ctx, ingress) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace},
+		})
+	}
+	return requests
+}
+
+// findExistingResource searches for an existing Pangolin resource matching the
+// given subdomain and domainID. This is used to adopt resources that already
+// exist when a create returns 409 Conflict.
+func (r *IngressReconciler) findExistingResource(ctx context.Context, subdomain, domainID string) (*pangolin.Resource, error) {
+	resources, err := r.PangolinClient.ListResources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+	for i := range resources {
+		res := &resources[i]
+		if res.Subdomain == subdomain && res.DomainID == domainID {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find existing resource with subdomain %q and domainID %q", subdomain, domainID)
+}
+
+// checkResourceLimit returns an error, after emitting a Warning event on obj,
+// if creating another Pangolin resource would exceed MaxResources. Resources
+// are counted by the controller's name prefix.
+func (r *IngressReconciler) checkResourceLimit(ctx context.Context, obj client.Object) error {
+	if r.MaxResources <= 0 {
+		return nil
+	}
+
+	resources, err := r.PangolinClient.ListResources(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list resources: %w", err)
+	}
+	prefix := r.ResourcePrefix
+	if prefix == "" {
+		prefix = defaultResourcePrefix
+	}
+	count := 0
+	for _, res := range resources {
+		if strings.HasPrefix(res.Name, prefix+"-") {
+			count++
+		}
+	}
+	managedResources.Set(float64(count))
+
+	if count >= r.MaxResources {
+		err := fmt.Errorf("refusing to create Pangolin resource: the controller already manages %d resources, limit is %d", count, r.MaxResources)
+		r.recordEvent(obj, corev1.EventTypeWarning, "ResourceLimitReached", "%v", err)
+		log.FromContext(ctx).Error(err, "Pangolin resource limit reached, check for runaway Ingresses or raise --max-resources",
+			"managedResources", count, "maxResources", r.MaxResources)
+		return err
+	}
+	return nil
+}
+
+// parkIngress deletes the Pangolin resource of an Ingress that is ignored or
+// has nothing to route, if it has one, and forgets its ID so that a new
+// resource is created once that changes. A resource under deletion protection
+// is retained and reused. reason describes the Ingress in the event.
+func (r *IngressReconciler) parkIngress(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig, reason string) error {
+	resourceIDs := r.allResourceIDs(ingress)
+	if len(resourceIDs) == 0 {
+		return nil
+	}
+	if err := r.deletePangolinResources(ctx, ingress, cfg); err != nil {
+		return err
+	}
+	if cfg.DeletionProtection {
+		return nil
+	}
+
+	r.forgetResourceIDs(ingress)
+	if err := r.Update(ctx, ingress); err != nil {
+		return err
+	}
+	r.recordEvent(ingress, corev1.EventTypeNormal, "ResourceDeleted",
+		"%s, deleted Pangolin resource %s", reason, strings.Join(resourceIDs, ", "))
+	return nil
+}
+
+// reconcileEmptyIngress handles an Ingress with neither rules nor a default
+// backend. Resources left over from earlier rules are deleted and the
+// finalizer, which has nothing left to clean up, is removed; otherwise there
+// is nothing to do but to tell the user.
+func (r *IngressReconciler) reconcileEmptyIngress(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	r.resetReadinessPoll(client.ObjectKeyFromObject(ingress))
+	r.releaseHosts(client.ObjectKeyFromObject(ingress).String(), nil)
+
+	key := r.annotationKey(annotationResourceID)
+	if ingress.Annotations[key] == "" {
+		r.recordEvent(ingress, corev1.EventTypeNormal, "NothingToRoute",
+			"Ingress has neither rules nor a default backend, no Pangolin resource is created")
+	} else if err := r.parkIngress(ctx, ingress, cfg, "Ingress has no rules left"); err != nil {
+		if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+			return result, nil
+		}
+		log.Error(err, "Failed to delete Pangolin resources of Ingress without rules")
+		return ctrl.Result{}, err
+	}
+
+	if ingress.Annotations[key] == "" && controllerutil.ContainsFinalizer(ingress, r.finalizerName()) {
+		controllerutil.RemoveFinalizer(ingress, r.finalizerName())
+		if err := r.Update(ctx, ingress); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.recordFinalizerChange(ingress, "ingress", finalizerRemoved, r.finalizerName())
+	}
+	log.Info("Ingress has neither rules nor a default backend, nothing to route", "name", ingress.Name)
+	return ctrl.Result{}, nil
+}
+
+// releaseIngress hands an Ingress that is no longer managed, but still carries
+// the finalizer, over to whichever controller manages it now: its Pangolin
+// resources are deleted, unless under deletion protection, and the
+// resource-id annotation and the finalizer are removed.
+func (r *IngressReconciler) releaseIngress(ctx context.Context, ingress *networkingv1.Ingress) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	r.resetReadinessPoll(client.ObjectKeyFromObject(ingress))
+	r.releaseHosts(client.ObjectKeyFromObject(ingress).String(), nil)
+
+	cfg, _, _, _ := r.parseIngressConfig(ingress.Annotations)
+	if err := r.deletePangolinResources(ctx, ingress, cfg); err != nil {
+		if result, ok := r.deferredRequeue(ctx, ingress, err); ok {
+			return result, nil
 		}
+		log.Error(err, "Failed to delete Pangolin resources of unmanaged Ingress")
+		return ctrl.Result{}, err
 	}
 
-	site, err := r.getSiteInfo(ctx)
-	if err != nil {
-		log.Error(err, "Failed to resolve site for target creation", "siteNiceID", r.SiteNiceID)
-		return err
+	if !cfg.DeletionProtection {
+		r.forgetResourceIDs(ingress)
+	}
+	controllerutil.RemoveFinalizer(ingress, r.finalizerName())
+	if err := r.Update(ctx, ingress); err != nil {
+		return ctrl.Result{}, err
 	}
+	r.recordFinalizerChange(ingress, "ingress", finalizerRemoved, r.finalizerName())
+	ingressLastSync.DeleteLabelValues(ingress.Namespace, ingress.Name)
+	r.recordEvent(ingress, corev1.EventTypeNormal, "Unmanaged",
+		"Ingress is no longer managed by this controller, cleaned up its Pangolin resources")
+	log.Info("Released Ingress that is no longer managed", "name", ingress.Name)
+	return ctrl.Result{}, nil
+}
 
-	targetIP := fmt.Sprintf("%s.%s.svc.cluster.local", serviceName, ingress.Namespace)
-	targetPort := int(servicePort)
-	targetPath := path.Path
-	if targetPath == "" {
-		targetPath = "/"
+// deletePangolinResources deletes all Pangolin resources associated with an
+// ingress: the ones recorded in its resource-id and resource-ids annotations
+// and any other one
+// naming the ingress in its metadata, e.g. one whose ID is no longer
+// recorded. Of a resource shared with other Ingresses of the same host, only
+// the targets and rules of the ingress are deleted.
+func (r *IngressReconciler) deletePangolinResources(ctx context.Context, ingress *networkingv1.Ingress, cfg *ingressConfig) error {
+	log := log.FromContext(ctx)
+
+	resourceIDs := r.allResourceIDs(ingress)
+	if len(resourceIDs) == 0 {
+		log.Info("No Pangolin resource ID found, skipping deletion")
+		return nil
 	}
 
-	// Check for existing targets to avoid duplicates on restarts
-	existingTargets, err := r.PangolinClient.ListTargets(ctx, resourceID)
+	if cfg.DeletionProtection {
+		r.recordEvent(ingress, corev1.EventTypeWarning, "ResourceRetained",
+			"Deletion protection is enabled, Pangolin resource %s was retained", strings.Join(resourceIDs, ", "))
+		log.Info("Deletion protection enabled, retaining Pangolin resource", "resourceIDs", resourceIDs)
+		return nil
+	}
+
+	resources, err := r.PangolinClient.ListResourcesForIngress(ctx, ingress.Namespace, ingress.Name)
 	if err != nil {
-		log.Error(err, "Failed to list existing targets", "resourceID", resourceID)
-		return fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+		return fmt.Errorf("failed to list Pangolin resources of the Ingress: %w", err)
+	}
+	recorded := make(map[string]bool, len(resourceIDs))
+	for _, id := range resourceIDs {
+		recorded[id] = true
+	}
+	for _, res := range resources {
+		if id := strconv.Itoa(res.ID); !recorded[id] {
+			resourceIDs = append(resourceIDs, id)
+		}
 	}
 
-	// Look for a target that matches our site, IP, and port
-	var existingTarget *pangolin.Target
-	for i := range existingTargets {
-		t := &existingTargets[i]
-		if t.SiteID == site.ID && t.IP == targetIP && t.Port == targetPort {
-			existingTarget = t
-			break
+	owner := ingress.Namespace + "/" + ingress.Name
+	for _, id := range resourceIDs {
+		if err := r.deletePangolinResource(ctx, id, owner); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	targetReq := &pangolin.CreateTargetRequest{
-		SiteID:              site.ID,
-		IP:                  targetIP,
-		Method:              "http",
-		Port:                targetPort,
-		Enabled:             true,
-		Path:                targetPath,
-		PathMatchType:       pathTypeToMatch(path.PathType),
-		HCEnabled:           parseBoolAnnotation(annotations, annotationHCEnabled),
-		HCPath:              parseStringAnnotation(annotations, annotationHCPath),
-		HCScheme:            parseStringAnnotation(annotations, annotationHCScheme),
-		HCMode:              parseStringAnnotation(annotations, annotationHCMode),
-		HCHostname:          parseStringAnnotation(annotations, annotationHCHostname),
-		HCPort:              parseIntAnnotation(annotations, annotationHCPort),
-		HCInterval:          parseIntAnnotation(annotations, annotationHCInterval),
-		HCUnhealthyInterval: parseIntAnnotation(annotations, annotationHCUnhealthyInterval),
-		HCTimeout:           parseIntAnnotation(annotations, annotationHCTimeout),
-		HCHeaders:           parseHeadersAnnotation(annotations, annotationHCHeaders),
-		HCFollowRedirects:   parseBoolAnnotation(annotations, annotationHCFollowRedirects),
-		HCMethod:            parseStringAnnotation(annotations, annotationHCMethod),
-		HCStatus:            parseIntAnnotation(annotations, annotationHCStatus),
-		HCTLSServerName:     parseStringAnnotation(annotations, annotationHCTLSServerName),
-	}
-
-	// Pangolin requires hcPath, hcHostname, hcPort, hcInterval, and hcMethod
-	// to all be non-null for health checks to be pushed to Newt. When health
-	// checks are enabled, fill in sensible defaults for any missing fields.
-	if targetReq.HCEnabled != nil && *targetReq.HCEnabled {
-		if targetReq.HCPath == nil {
-			s := "/"
-			targetReq.HCPath = &s
+// deletePangolinResource deletes a single resource of owner, or only the
+// targets and rules of owner if the resource is shared
+func (r *IngressReconciler) deletePangolinResource(ctx context.Context, resourceID, owner string) error {
+	log := log.FromContext(ctx)
+
+	// A resource shared with other Ingresses of the host is left to them
+	res, err := r.PangolinClient.GetResource(ctx, resourceID)
+	if err != nil {
+		if pangolin.IsNotFound(err) {
+			log.Info("Pangolin resource already deleted", "resourceID", resourceID)
+			return nil
 		}
-		if targetReq.HCHostname == nil {
-			targetReq.HCHostname = &targetIP
+		return fmt.Errorf("failed to get Pangolin resource %s: %w", resourceID, err)
+	}
+	if other := r.foreignInstance(res); other != "" {
+		log.Info("Leaving Pangolin resource of another controller instance", "resourceID", resourceID, "instanceID", other)
+		return nil
+	}
+	if others := removeOwner(resourceOwners(res), owner); len(others) > 0 {
+		return r.leaveSharedResource(ctx, res, owner, others)
+	}
+
+	if err := r.deleteResourceTargets(ctx, resourceID); err != nil {
+		if pangolin.IsNotFound(err) {
+			log.Info("Pangolin resource already deleted", "resourceID", resourceID)
+			return nil
 		}
-		if targetReq.HCPort == nil {
-			p := int(servicePort)
-			targetReq.HCPort = &p
+		return err
+	}
+	if err := r.PangolinClient.DeleteResource(ctx, resourceID); err != nil {
+		if pangolin.IsNotFound(err) {
+			log.Info("Pangolin resource already deleted", "resourceID", resourceID)
+			return nil
 		}
-		if targetReq.HCInterval == nil {
-			i := 30
-			targetReq.HCInterval = &i
+		log.Error(err, "Failed to delete Pangolin resource", "resourceID", resourceID)
+		return err
+	}
+
+	countChange(ctx, summaryResources, summaryDeleted)
+	log.V(1).Info("Deleted Pangolin resource", "resourceID", resourceID)
+	return nil
+}
+
+// deleteResourceTargets deletes every target of a resource about to be
+// deleted, rather than relying on Pangolin to remove them with the resource.
+// The targets are listed from the resource, so that targets of Services in
+// other namespaces, e.g. from before the backend-namespace annotation
+// changed, or still draining, are cleaned up as well.
+func (r *IngressReconciler) deleteResourceTargets(ctx context.Context, resourceID string) error {
+	targets, err := r.PangolinClient.ListTargets(ctx, resourceID)
+	if err != nil {
+		if pangolin.IsNotFound(err) {
+			return err
 		}
-		if targetReq.HCMethod == nil {
-			m := "GET"
-			targetReq.HCMethod = &m
+		return fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+	}
+	for _, t := range targets {
+		targetID := strconv.Itoa(t.ID)
+		if err := r.PangolinClient.DeleteTarget(ctx, targetID); err != nil && !pangolin.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Pangolin target %s: %w", targetID, err)
 		}
+		countChange(ctx, summaryTargets, summaryDeleted)
 	}
+	return nil
+}
 
-	var activeTargetID int
-	if existingTarget != nil {
-		// Target already exists — update it instead of creating a duplicate
-		targetIDStr := strconv.Itoa(existingTarget.ID)
-		_, err = r.PangolinClient.UpdateTarget(ctx, targetIDStr, targetReq)
-		if err != nil {
-			log.Error(err, "Failed to update Pangolin target", "targetID", targetIDStr, "resourceID", resourceID)
-			return fmt.Errorf("failed to update Pangolin target %s: %w", targetIDStr, err)
-		}
-		activeTargetID = existingTarget.ID
-		log.Info("Updated existing Pangolin target", "targetID", targetIDStr, "service", serviceName, "port", servicePort)
-	} else {
-		// No matching target — create a new one
-		newTarget, createErr := r.PangolinClient.CreateTarget(ctx, resourceID, targetReq)
-		if createErr != nil {
-			log.Error(createErr, "Failed to create Pangolin target", "resourceID", resourceID, "service", serviceName, "port", servicePort)
-			return fmt.Errorf("failed to create Pangolin target for service %s:%d: %w", serviceName, servicePort, createErr)
+// leaveSharedResource deletes the targets and rules owner contributed to a
+// resource shared with other Ingresses and hands the resource over to the
+// remaining owners
+func (r *IngressReconciler) leaveSharedResource(ctx context.Context, res *pangolin.Resource, owner string, owners []string) error {
+	log := log.FromContext(ctx)
+	resourceID := strconv.Itoa(res.ID)
+
+	targets, err := r.PangolinClient.ListTargets(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+	}
+	own := make(map[int]bool)
+	for _, t := range targets {
+		if t.Metadata[metadataIngress] == owner {
+			own[t.ID] = true
 		}
-		activeTargetID = newTarget.ID
-		log.Info("Created Pangolin target", "targetID", newTarget.ID, "service", serviceName, "port", servicePort)
 	}
 
-	// Clean up stale targets that don't match the active one
-	for _, t := range existingTargets {
-		if t.ID == activeTargetID {
+	// Rules go first, so that none is left pointing at a deleted target
+	rules, err := r.PangolinClient.ListResourceRules(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to list rules for resource %s: %w", resourceID, err)
+	}
+	for _, rule := range rules {
+		if !own[rule.TargetID] {
 			continue
 		}
-		staleID := strconv.Itoa(t.ID)
-		if delErr := r.PangolinClient.DeleteTarget(ctx, staleID); delErr != nil {
-			log.Error(delErr, "Failed to delete stale Pangolin target", "targetID", staleID)
-		} else {
-			log.Info("Deleted stale Pangolin target", "targetID", staleID, "ip", t.IP, "port", t.Port)
+		ruleID := strconv.Itoa(rule.ID)
+		if err := r.PangolinClient.DeleteResourceRule(ctx, resourceID, ruleID); err != nil && !pangolin.IsNotFound(err) {
+			return fmt.Errorf("failed to delete rule %s: %w", ruleID, err)
 		}
+		countChange(ctx, summaryRules, summaryDeleted)
+	}
+	for id := range own {
+		targetID := strconv.Itoa(id)
+		if err := r.PangolinClient.DeleteTarget(ctx, targetID); err != nil && !pangolin.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Pangolin target %s: %w", targetID, err)
+		}
+		countChange(ctx, summaryTargets, summaryDeleted)
+	}
+
+	metadata := make(map[string]string, len(res.Metadata))
+	for k, v := range res.Metadata {
+		metadata[k] = v
 	}
+	metadata[metadataOwners] = strings.Join(owners, ",")
+	if metadata[metadataIngress] == owner {
+		metadata[metadataIngress] = owners[0]
+	}
+	if _, err := r.PangolinClient.UpdateResource(ctx, resourceID, &pangolin.UpdateResourceRequest{
+		RateLimit: res.RateLimit,
+		Metadata:  metadata,
+	}); err != nil {
+		return fmt.Errorf("failed to update owners of Pangolin resource %s: %w", resourceID, err)
+	}
+	countChange(ctx, summaryResources, summaryUpdated)
 
+	log.Info("Left shared Pangolin resource", "resourceID", resourceID, "remainingOwners", owners)
 	return nil
 }
 
-// findExistingResource searches for an existing Pangolin resource matching the
-// given subdomain and domainID. This is used to adopt resources that already
-// exist when a create returns 409 Conflict.
-func (r *IngressReconciler) findExistingResource(ctx context.Context, subdomain, domainID string) (*pangolin.Resource, error) {
-	resources, err := r.PangolinClient.ListResources(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list resources: %w", err)
+// ingressMetadata returns the metadata of the Pangolin resource and targets of
+// an Ingress: the labels selected by MirrorLabels, overridden by the user
+// metadata from the annotation, plus the controller's own keys, which always
+// take precedence
+func (r *IngressReconciler) ingressMetadata(ingress *networkingv1.Ingress, cfg *ingressConfig) map[string]string {
+	metadata := make(map[string]string, len(cfg.Metadata)+1)
+	for k, v := range ingress.Labels {
+		if r.mirrorsLabel(k) {
+			metadata[k] = v
+		}
 	}
-	for i := range resources {
-		res := &resources[i]
-		if res.Subdomain == subdomain && res.DomainID == domainID {
-			return res, nil
+	for k, v := range cfg.Metadata {
+		metadata[k] = v
+	}
+	metadata[metadataIngress] = ingress.Namespace + "/" + ingress.Name
+	return metadata
+}
+
+// mirrorsLabel reports whether the Ingress label key is copied into metadata
+func (r *IngressReconciler) mirrorsLabel(key string) bool {
+	if strings.HasPrefix(key, reservedMetadataPrefix) {
+		return false
+	}
+	for _, pattern := range r.MirrorLabels {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
 		}
 	}
-	return nil, fmt.Errorf("could not find existing resource with subdomain %q and domainID %q", subdomain, domainID)
+	return false
 }
 
-// deletePangolinResources deletes all Pangolin resources associated with an ingress
-func (r *IngressReconciler) deletePangolinResources(ctx context.Context, ingress *networkingv1.Ingress) error {
-	log := log.FromContext(ctx)
+// ownsTarget reports whether a target may be reused by the Ingress whose
+// kubernetes.ingress metadata is owner. Targets tagged with another Ingress
+// are never taken over; untagged targets predate the metadata and are.
+func ownsTarget(t *pangolin.Target, owner string) bool {
+	tagged, ok := t.Metadata[metadataIngress]
+	return !ok || tagged == owner
+}
 
-	resourceID := ingress.Annotations[annotationResourceID]
-	if resourceID == "" {
-		log.Info("No Pangolin resource ID found, skipping deletion")
-		return nil
+// lastKnownNamedPort returns the port number recorded for the named port
+// portName on the target of owner with the given site, address and path
+func lastKnownNamedPort(targets []pangolin.Target, owner string, siteID int, ip, path, portName string) (int32, bool) {
+	for i := range targets {
+		t := &targets[i]
+		if t.SiteID != siteID || t.IP != ip || t.Path != path || t.Metadata[metadataIngress] != owner {
+			continue
+		}
+		name, number, ok := strings.Cut(t.Metadata[metadataNamedPort], "=")
+		if !ok || name != portName {
+			continue
+		}
+		port, err := strconv.ParseInt(number, 10, 32)
+		if err != nil || port <= 0 {
+			continue
+		}
+		return int32(port), true
 	}
+	return 0, false
+}
 
-	// Delete the resource (targets will be deleted automatically)
-	if err := r.PangolinClient.DeleteResource(ctx, resourceID); err != nil {
-		log.Error(err, "Failed to delete Pangolin resource", "resourceID", resourceID)
-		return err
+// recordEvent emits an event for obj if an event recorder is configured
+func (r *IngressReconciler) recordEvent(obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
 	}
+	r.Recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
 
-	log.Info("Deleted Pangolin resource", "resourceID", resourceID)
-	return nil
+// recordFinalizerChange counts a finalizer added to (finalizerAdded) or
+// removed from (finalizerRemoved) obj once the change was persisted, and
+// reports it with an event on obj
+func (r *IngressReconciler) recordFinalizerChange(obj client.Object, kind, operation, finalizer string) {
+	finalizerOperationsTotal.WithLabelValues(kind, operation).Inc()
+	if operation == finalizerAdded {
+		r.recordEvent(obj, corev1.EventTypeNormal, "FinalizerAdded",
+			"Added finalizer %s, deletion waits until the Pangolin resources are cleaned up", finalizer)
+		return
+	}
+	r.recordEvent(obj, corev1.EventTypeNormal, "FinalizerRemoved", "Removed finalizer %s", finalizer)
 }
 
 // parseHost parses a hostname into subdomain and domain
@@ -617,6 +3010,81 @@ func parseHost(host string) (subdomain, domain string) {
 	return subdomain, domain
 }
 
+// Sources a site can be resolved from, in order of preference
+const (
+	siteSourceResource    = "resource"
+	siteSourceAnnotation  = "annotation"
+	siteSourceDefault     = "default"
+	siteSourceRegion      = "region"
+	siteSourceFirstOnline = "first-online"
+)
+
+// resolveSite determines the Pangolin site for an object and logs which source
+// it was resolved from. See lookupSite for the order of preference.
+func (r *IngressReconciler) resolveSite(ctx context.Context, annotations map[string]string, resource *pangolin.Resource) (*pangolin.Site, error) {
+	site, source, err := r.lookupSite(ctx, annotations, resource)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).V(1).Info("Resolved Pangolin site", "site", site.NiceID, "siteID", site.ID, "source", source)
+	return site, nil
+}
+
+// lookupSite resolves the site from, in order: the site the resource is
+// attached to (if any), the site annotation, the configured default site, the
+// online site with the lowest ID in the default region and, as a last resort,
+// the online site with the lowest ID in the organization.
+func (r *IngressReconciler) lookupSite(ctx context.Context, annotations map[string]string, resource *pangolin.Resource) (*pangolin.Site, string, error) {
+	if resource != nil && resource.SiteID != 0 {
+		site, err := r.PangolinClient.GetSite(ctx, strconv.Itoa(resource.SiteID))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get site %d of resource %d: %w", resource.SiteID, resource.ID, err)
+		}
+		return site, siteSourceResource, nil
+	}
+
+	if niceID := strings.TrimSpace(annotations[r.annotationKey(annotationSite)]); niceID != "" {
+		site, err := r.PangolinClient.GetSiteByNiceID(ctx, niceID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get site %s from annotation: %w", niceID, err)
+		}
+		return site, siteSourceAnnotation, nil
+	}
+
+	if r.SiteNiceID != "" {
+		site, err := r.getSiteInfo(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		return site, siteSourceDefault, nil
+	}
+
+	sites, err := r.PangolinClient.ListSites(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list sites: %w", err)
+	}
+	var first, inRegion *pangolin.Site
+	for i := range sites {
+		if !sites[i].Online {
+			continue
+		}
+		if first == nil || sites[i].ID < first.ID {
+			first = &sites[i]
+		}
+		if r.DefaultSiteRegion != "" && strings.EqualFold(sites[i].Region, r.DefaultSiteRegion) &&
+			(inRegion == nil || sites[i].ID < inRegion.ID) {
+			inRegion = &sites[i]
+		}
+	}
+	if inRegion != nil {
+		return inRegion, siteSourceRegion, nil
+	}
+	if first == nil {
+		return nil, "", fmt.Errorf("no online Pangolin site found in organization %s", r.OrgID)
+	}
+	return first, siteSourceFirstOnline, nil
+}
+
 func (r *IngressReconciler) getSiteInfo(ctx context.Context) (*pangolin.Site, error) {
 	if r.SiteNiceID == "" {
 		return nil, fmt.Errorf("pangolin site nice ID is not configured")
@@ -641,6 +3109,49 @@ func (r *IngressReconciler) getSiteInfo(ctx context.Context) (*pangolin.Site, er
 	return site, nil
 }
 
+// invalidateSiteCache drops the cached site so that it is fetched again
+func (r *IngressReconciler) invalidateSiteCache() {
+	r.siteMu.Lock()
+	r.siteCache = nil
+	r.siteMu.Unlock()
+}
+
+// nextReadinessPoll returns the delay before the next readiness check of an
+// Ingress, or false once the poll timeout has been used up. Delays start at
+// the poll interval and double, but never run past the timeout.
+func (r *IngressReconciler) nextReadinessPoll(key types.NamespacedName) (time.Duration, bool) {
+	interval, timeout := r.StatusPollInterval, r.StatusPollTimeout
+	if interval <= 0 {
+		interval = defaultStatusPollInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultStatusPollTimeout
+	}
+
+	r.readinessMu.Lock()
+	defer r.readinessMu.Unlock()
+	if r.readinessPolls == nil {
+		r.readinessPolls = make(map[types.NamespacedName]readinessPoll)
+	}
+	poll := r.readinessPolls[key]
+	if poll.waited >= timeout {
+		return 0, false
+	}
+	delay := interval << poll.attempt
+	if remaining := timeout - poll.waited; delay <= 0 || delay > remaining {
+		delay = remaining
+	}
+	r.readinessPolls[key] = readinessPoll{attempt: poll.attempt + 1, waited: poll.waited + delay}
+	return delay, true
+}
+
+// resetReadinessPoll forgets the readiness checks made for an Ingress
+func (r *IngressReconciler) resetReadinessPoll(key types.NamespacedName) {
+	r.readinessMu.Lock()
+	delete(r.readinessPolls, key)
+	r.readinessMu.Unlock()
+}
+
 func (r *IngressReconciler) resolveDomainID(ctx context.Context, baseDomain string) (string, error) {
 	r.domainMu.RLock()
 	if r.domainMap != nil {
@@ -676,11 +3187,18 @@ func (r *IngressReconciler) resolveDomainID(ctx context.Context, baseDomain stri
 	return resolved, nil
 }
 
-func pathTypeToMatch(pt *networkingv1.PathType) string {
-	if pt == nil {
-		return "prefix"
+// pathType returns the PathType of path. An unset PathType is treated as
+// ImplementationSpecific, the default of earlier Ingress API versions.
+func pathType(path networkingv1.HTTPIngressPath) networkingv1.PathType {
+	if path.PathType == nil {
+		return networkingv1.PathTypeImplementationSpecific
 	}
-	switch *pt {
+	return *path.PathType
+}
+
+// pathTypeToMatch maps an Ingress PathType to a Pangolin path match type
+func pathTypeToMatch(pt networkingv1.PathType) string {
+	switch pt {
 	case networkingv1.PathTypeExact:
 		return "exact"
 	case networkingv1.PathTypeImplementationSpecific:
@@ -690,59 +3208,25 @@ func pathTypeToMatch(pt *networkingv1.PathType) string {
 	}
 }
 
-// parseBoolAnnotation returns a *bool from an annotation value, or nil if not set.
-func parseBoolAnnotation(annotations map[string]string, key string) *bool {
-	v, ok := annotations[key]
-	if !ok || v == "" {
-		return nil
-	}
-	b, err := strconv.ParseBool(v)
-	if err != nil {
-		return nil
-	}
-	return &b
-}
-
-// parseStringAnnotation returns a *string from an annotation value, or nil if not set.
-func parseStringAnnotation(annotations map[string]string, key string) *string {
-	v, ok := annotations[key]
-	if !ok {
-		return nil
-	}
-	return &v
-}
-
-// parseIntAnnotation returns a *int from an annotation value, or nil if not set.
-func parseIntAnnotation(annotations map[string]string, key string) *int {
-	v, ok := annotations[key]
-	if !ok || v == "" {
-		return nil
-	}
-	i, err := strconv.Atoi(v)
-	if err != nil {
-		return nil
-	}
-	return &i
-}
-
-// parseHeadersAnnotation parses a JSON array of {"name":"...","value":"..."} objects from an annotation.
-func parseHeadersAnnotation(annotations map[string]string, key string) []pangolin.Header {
-	v, ok := annotations[key]
-	if !ok || v == "" {
-		return nil
-	}
-	var headers []pangolin.Header
-	if err := json.Unmarshal([]byte(v), &headers); err != nil {
-		return nil
-	}
-	return headers
+// isControllerManagedAnnotation reports whether an annotation name is written
+// by the controller itself and must therefore not trigger reconciliation.
+func isControllerManagedAnnotation(name string) bool {
+	return name == annotationResourceID || name == annotationResourceIDs || name == annotationCertificateFingerprints || name == annotationLastError
 }
 
 // pangolinAnnotationChangedPredicate triggers reconciliation when any
-// pangolin.ingress.k8s.io/* annotation changes EXCEPT the controller-managed
-// resource-id annotation (which the controller itself writes).
+// annotation under the configured prefix changes EXCEPT the controller-managed
+// ones (which the controller itself writes).
 type pangolinAnnotationChangedPredicate struct {
 	predicate.Funcs
+	prefix string
+}
+
+// isUserAnnotation reports whether key is a user-facing annotation under the
+// predicate's prefix.
+func (p pangolinAnnotationChangedPredicate) isUserAnnotation(key string) bool {
+	name, ok := strings.CutPrefix(key, p.prefix+"/")
+	return ok && !isControllerManagedAnnotation(name)
 }
 
 func (p pangolinAnnotationChangedPredicate) Update(e event.UpdateEvent) bool {
@@ -752,10 +3236,7 @@ func (p pangolinAnnotationChangedPredicate) Update(e event.UpdateEvent) bool {
 	oldAnn := e.ObjectOld.GetAnnotations()
 	newAnn := e.ObjectNew.GetAnnotations()
 	for key, newVal := range newAnn {
-		if key == annotationResourceID {
-			continue
-		}
-		if !strings.HasPrefix(key, "pangolin.ingress.k8s.io/") {
+		if !p.isUserAnnotation(key) {
 			continue
 		}
 		if oldAnn[key] != newVal {
@@ -764,10 +3245,7 @@ func (p pangolinAnnotationChangedPredicate) Update(e event.UpdateEvent) bool {
 	}
 	// Check for removed pangolin annotations
 	for key := range oldAnn {
-		if key == annotationResourceID {
-			continue
-		}
-		if !strings.HasPrefix(key, "pangolin.ingress.k8s.io/") {
+		if !p.isUserAnnotation(key) {
 			continue
 		}
 		if _, exists := newAnn[key]; !exists {
@@ -777,13 +3255,108 @@ func (p pangolinAnnotationChangedPredicate) Update(e event.UpdateEvent) bool {
 	return false
 }
 
+// servicePortsChangedPredicate passes the creation and deletion of Services,
+// and updates changing their ports, so that targets follow a port number
+// change, or a named port disappearing and coming back during a rollout,
+// without waiting for the next edit of the Ingress
+type servicePortsChangedPredicate struct {
+	predicate.Funcs
+}
+
+func (servicePortsChangedPredicate) Update(e event.UpdateEvent) bool {
+	oldService, ok := e.ObjectOld.(*corev1.Service)
+	if !ok {
+		return false
+	}
+	newService, ok := e.ObjectNew.(*corev1.Service)
+	if !ok {
+		return false
+	}
+	return !equality.Semantic.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports)
+}
+
+func (servicePortsChangedPredicate) Generic(event.GenericEvent) bool {
+	return false
+}
+
 // SetupWithManager sets up the controller with the Manager
 func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&networkingv1.Ingress{}).
-		WithEventFilter(predicate.Or(
-			predicate.GenerationChangedPredicate{},
-			pangolinAnnotationChangedPredicate{},
-		)).
-		Complete(r)
+	// Release the Pangolin client's connections when the manager stops
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		if r.PangolinClient != nil {
+			r.PangolinClient.Close()
+		}
+		return nil
+	})); err != nil {
+		return err
+	}
+	probeTimeout := r.ProbeTimeout
+	if probeTimeout <= 0 {
+		probeTimeout = defaultProbeTimeout
+	}
+	probe := newAPIProbe(r, apiProbeInterval, probeTimeout)
+	if err := mgr.Add(probe); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("pangolin-api", probe.Check); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("cache-sync", cacheSyncedCheck(mgr.GetCache())); err != nil {
+		return err
+	}
+	if r.StartupSelfTest {
+		selfTest := newSelfTest(r, selfTestRetryInterval)
+		if err := mgr.Add(selfTest); err != nil {
+			return err
+		}
+		if err := mgr.AddReadyzCheck("pangolin-self-test", selfTest.Check); err != nil {
+			return err
+		}
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, tlsSecretIndex, ingressTLSSecrets); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &networkingv1.Ingress{}, backendServiceIndex, r.ingressBackendServices); err != nil {
+		return err
+	}
+
+	changed := []predicate.Predicate{
+		predicate.GenerationChangedPredicate{},
+		pangolinAnnotationChangedPredicate{prefix: r.annotationPrefix()},
+	}
+	if r.LabelSelector != nil {
+		// Relabeling an Ingress can bring it in or out of scope
+		changed = append(changed, predicate.LabelChangedPredicate{})
+	}
+	if r.CleanupOnUnmanage {
+		// Changing the legacy class annotation moves an Ingress between
+		// controllers without a generation change
+		changed = append(changed, predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return e.ObjectOld.GetAnnotations()[legacyIngressClassAnnotation] != e.ObjectNew.GetAnnotations()[legacyIngressClassAnnotation]
+			},
+		})
+	}
+
+	// Ingresses are watched rather than registered with For so that rapid
+	// successive edits can be debounced into a single reconcile
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("ingress").
+		WithOptions(controller.Options{
+			RateLimiter: jitterRateLimiter(workqueue.DefaultControllerRateLimiter(), r.RequeueJitter),
+		}).
+		Watches(&networkingv1.Ingress{},
+			debounce(&handler.EnqueueRequestForObject{}, r.ReconcileDebounce),
+			builder.WithPredicates(predicate.Or(changed...))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForTLSSecret)).
+		// Backend Services are watched for their creation, deletion and port
+		// changes; other changes are picked up by the next reconcile
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForService),
+			builder.WithPredicates(servicePortsChangedPredicate{}))
+	if r.ControllerName != "" {
+		b = b.Watches(&networkingv1.IngressClass{}, handler.EnqueueRequestsFromMapFunc(r.ingressesForIngressClass))
+	}
+	return b.Complete(r)
 }
@@ -2,17 +2,45 @@ package controller
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
 )
 
 func TestIngressReconciler_Reconcile(t *testing.T) {
@@ -97,6 +125,7 @@ func TestIngressReconciler_Reconcile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			fakePangolin := newFakePangolin(t)
 			objs := []runtime.Object{tt.ingress}
 			if tt.service != nil {
 				objs = append(objs, tt.service)
@@ -109,9 +138,12 @@ func TestIngressReconciler_Reconcile(t *testing.T) {
 				Build()
 
 			reconciler := &IngressReconciler{
-				Client:       fakeClient,
-				Scheme:       scheme,
-				IngressClass: "pangolin",
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
 			}
 
 			req := ctrl.Request{
@@ -142,9 +174,11 @@ func TestIngressReconciler_Reconcile(t *testing.T) {
 
 func TestIngressReconciler_isManaged(t *testing.T) {
 	tests := []struct {
-		name     string
-		ingress  *networkingv1.Ingress
-		expected bool
+		name                    string
+		ingress                 *networkingv1.Ingress
+		disableLegacyAnnotation bool
+		labelSelector           string
+		expected                bool
 	}{
 		{
 			name: "Managed via IngressClassName",
@@ -175,18 +209,5528 @@ func TestIngressReconciler_isManaged(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "Managed via IngressClassName with legacy annotation disabled",
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					IngressClassName: func() *string { s := "pangolin"; return &s }(),
+				},
+			},
+			disableLegacyAnnotation: true,
+			expected:                true,
+		},
+		{
+			name: "Annotation ignored with legacy annotation disabled",
+			ingress: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"kubernetes.io/ingress.class": "pangolin",
+					},
+				},
+			},
+			disableLegacyAnnotation: true,
+			expected:                false,
+		},
+		{
+			name: "Managed with matching labels",
+			ingress: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"team": "web", "env": "prod"},
+				},
+				Spec: networkingv1.IngressSpec{
+					IngressClassName: func() *string { s := "pangolin"; return &s }(),
+				},
+			},
+			labelSelector: "team=web,env!=dev",
+			expected:      true,
+		},
+		{
+			name: "Not managed with non-matching labels",
+			ingress: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"team": "web", "env": "dev"},
+				},
+				Spec: networkingv1.IngressSpec{
+					IngressClassName: func() *string { s := "pangolin"; return &s }(),
+				},
+			},
+			labelSelector: "team=web,env!=dev",
+			expected:      false,
+		},
+		{
+			name: "Not managed without labels",
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					IngressClassName: func() *string { s := "pangolin"; return &s }(),
+				},
+			},
+			labelSelector: "team",
+			expected:      false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			reconciler := &IngressReconciler{
-				IngressClass: "pangolin",
+				IngressClass:                        "pangolin",
+				DisableLegacyIngressClassAnnotation: tt.disableLegacyAnnotation,
+			}
+			if tt.labelSelector != "" {
+				selector, err := labels.Parse(tt.labelSelector)
+				if err != nil {
+					t.Fatalf("Failed to parse selector: %v", err)
+				}
+				reconciler.LabelSelector = selector
 			}
 
-			result := reconciler.isManaged(tt.ingress)
+			result := reconciler.isManaged(context.Background(), tt.ingress)
 			if result != tt.expected {
 				t.Errorf("Expected %v but got %v", tt.expected, result)
 			}
 		})
 	}
 }
+
+func TestIngressReconciler_reconcileSummary(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("app", "app.example.com", "web", 80)
+	apiPath := ingress.Spec.Rules[0].HTTP.Paths[0]
+	apiPath.Path = "/api"
+	apiPath.Backend.Service = &networkingv1.IngressServiceBackend{Name: "api", Port: networkingv1.ServiceBackendPort{Number: 8080}}
+	ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, apiPath)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	// reconcileLogs returns the lines a reconcile logged up to verbosity
+	reconcileLogs := func(verbosity int) []map[string]interface{} {
+		t.Helper()
+		var lines []map[string]interface{}
+		ctx := log.IntoContext(context.Background(), funcr.NewJSON(func(obj string) {
+			var line map[string]interface{}
+			if err := json.Unmarshal([]byte(obj), &line); err != nil {
+				t.Errorf("Failed to parse log line %s: %v", obj, err)
+				return
+			}
+			lines = append(lines, line)
+		}, funcr.Options{Verbosity: verbosity}))
+		if _, err := reconciler.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return lines
+	}
+	// reconcile returns the fields of the summary line of a reconcile, which
+	// replaces the progress lines at verbosity 0
+	reconcile := func() map[string]interface{} {
+		t.Helper()
+		var summaries []map[string]interface{}
+		for _, line := range reconcileLogs(0) {
+			switch line["msg"] {
+			case "Reconcile summary":
+				summaries = append(summaries, line)
+			case "Reconciling Ingress", "Successfully reconciled Ingress", "Processing ingress rule":
+				t.Errorf("Expected %q to be logged at verbosity 1 only", line["msg"])
+			}
+		}
+		if len(summaries) != 1 {
+			t.Fatalf("Expected a single summary line, got %v", summaries)
+		}
+		return summaries[0]
+	}
+	expectCounts := func(summary map[string]interface{}, expected map[string]float64) {
+		t.Helper()
+		for _, object := range summaryObjects {
+			for _, op := range summaryOperations {
+				key := object + op
+				if summary[key] != expected[key] {
+					t.Errorf("Expected %s=%v, got %v", key, expected[key], summary[key])
+				}
+			}
+		}
+		if summary["outcome"] != "success" {
+			t.Errorf("Expected outcome success, got %v", summary["outcome"])
+		}
+	}
+
+	expectCounts(reconcile(), map[string]float64{"resourcesCreated": 1, "targetsCreated": 2, "rulesCreated": 2})
+
+	// An unchanged Ingress only updates the resource and its targets
+	expectCounts(reconcile(), map[string]float64{"resourcesUpdated": 1, "targetsUpdated": 2})
+
+	// Dropping a path deletes its target and rule, and moves the remaining
+	// rule up to the first priority
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	updated.Spec.Rules[0].HTTP.Paths = updated.Spec.Rules[0].HTTP.Paths[:1]
+	if err := fakeClient.Update(context.Background(), updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	expectCounts(reconcile(), map[string]float64{"resourcesUpdated": 1, "targetsUpdated": 1, "targetsDeleted": 1, "rulesUpdated": 1, "rulesDeleted": 1})
+
+	// Deleting the Ingress deletes its remaining target and its resource
+	if err := fakeClient.Delete(context.Background(), updated); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	expectCounts(reconcile(), map[string]float64{"targetsDeleted": 1, "resourcesDeleted": 1})
+
+	// The summary of an Ingress that is gone is only logged at verbosity 1
+	if lines := reconcileLogs(0); len(lines) != 0 {
+		t.Errorf("Expected no log lines for a deleted Ingress, got %v", lines)
+	}
+	var summaries int
+	for _, line := range reconcileLogs(1) {
+		if line["msg"] == "Reconcile summary" {
+			summaries++
+		}
+	}
+	if summaries != 1 {
+		t.Errorf("Expected a summary line at verbosity 1 for a deleted Ingress, got %d", summaries)
+	}
+}
+
+func TestIngressReconciler_lastError(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("broken", "app.example.com", "app-service", 80)
+	var patches int
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				patches++
+				return c.Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	lastError := func() (string, bool) {
+		t.Helper()
+		updated := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		value, ok := updated.Annotations["pangolin.ingress.k8s.io/last-error"]
+		return value, ok
+	}
+
+	// The backend Service is missing
+	if _, err := reconciler.Reconcile(ctx, req); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	value, ok := lastError()
+	if !ok {
+		t.Fatalf("Expected the last-error annotation to be set")
+	}
+	timestamp, msg, _ := strings.Cut(value, " ")
+	if _, err := time.Parse(time.RFC3339, timestamp); err != nil {
+		t.Errorf("Expected the annotation to start with a timestamp, got %q", value)
+	}
+	if !strings.Contains(msg, "app-service") {
+		t.Errorf("Expected the annotation to name the missing Service, got %q", value)
+	}
+
+	// A retry failing the same way doesn't write the Ingress again
+	before := patches
+	if _, err := reconciler.Reconcile(ctx, req); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if patches != before {
+		t.Errorf("Expected no patch for an unchanged error, got %d", patches-before)
+	}
+	if again, _ := lastError(); again != value {
+		t.Errorf("Expected the annotation to stay %q, got %q", value, again)
+	}
+
+	if err := fakeClient.Create(ctx, newTestService("app-service", 80)); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, ok := lastError(); ok {
+		t.Errorf("Expected the last-error annotation to be removed, got %q", value)
+	}
+
+	// Invalid annotations are recorded although the reconcile succeeds
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	updated.Annotations["pangolin.ingress.k8s.io/rate-limit-burst"] = "10"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, ok := lastError(); !ok || !strings.Contains(value, "rate-limit") {
+		t.Errorf("Expected the last-error annotation to record the invalid annotation, got %q", value)
+	}
+}
+
+func TestLastErrorValue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	if got, expected := lastErrorValue(now, fmt.Errorf("failed to get\n  service")), "2024-05-01T10:30:00Z failed to get service"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	got := lastErrorValue(now, fmt.Errorf("%s", strings.Repeat("x", 1000)))
+	if _, msg, _ := strings.Cut(got, " "); len(msg) != maxLastErrorLength || !strings.HasSuffix(msg, "...") {
+		t.Errorf("Expected the message to be shortened to %d characters, got %d", maxLastErrorLength, len(msg))
+	}
+}
+
+func TestIngressReconciler_isManagedClassConflict(t *testing.T) {
+	className := func(s string) *string { return &s }
+
+	tests := []struct {
+		name          string
+		className     *string
+		annotation    string
+		expected      bool
+		expectWarning bool
+	}{
+		{name: "field names another class", className: className("nginx"), annotation: "pangolin", expected: false, expectWarning: true},
+		{name: "annotation names another class", className: className("pangolin"), annotation: "nginx", expected: true, expectWarning: true},
+		{name: "field and annotation agree", className: className("pangolin"), annotation: "pangolin", expected: true},
+		{name: "conflict between other classes", className: className("nginx"), annotation: "traefik", expected: false},
+		{name: "empty field falls back to the annotation", className: className(""), annotation: "pangolin", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs []string
+			ctx := log.IntoContext(context.Background(), funcr.New(func(prefix, args string) {
+				logs = append(logs, args)
+			}, funcr.Options{}))
+
+			ingress := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Namespace:   "default",
+					Annotations: map[string]string{"kubernetes.io/ingress.class": tt.annotation},
+				},
+				Spec: networkingv1.IngressSpec{IngressClassName: tt.className},
+			}
+			reconciler := &IngressReconciler{IngressClass: "pangolin"}
+
+			if got := reconciler.isManaged(ctx, ingress); got != tt.expected {
+				t.Errorf("Expected managed %v, got %v", tt.expected, got)
+			}
+			warned := false
+			for _, l := range logs {
+				if strings.Contains(l, "Ingress class field and legacy annotation disagree") {
+					warned = true
+				}
+			}
+			if warned != tt.expectWarning {
+				t.Errorf("Expected conflict warning %v, got logs %v", tt.expectWarning, logs)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_ingressClassController(t *testing.T) {
+	const controllerName = "k8s.io/pangolin-ingress-controller"
+	ingressClass := func(controller string) *networkingv1.IngressClass {
+		return &networkingv1.IngressClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "pangolin"},
+			Spec:       networkingv1.IngressClassSpec{Controller: controller},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		controllerName string
+		class          *networkingv1.IngressClass
+		expected       bool
+		expectedGets   int
+	}{
+		{name: "class of this controller", controllerName: controllerName, class: ingressClass(controllerName), expected: true, expectedGets: 2},
+		{name: "missing class", controllerName: controllerName, expected: false, expectedGets: 1},
+		{name: "class of another controller", controllerName: controllerName, class: ingressClass("example.com/other"), expected: false, expectedGets: 1},
+		{name: "check disabled", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("web", "app.example.com", "web", 80)
+			objs := []runtime.Object{ingress, newTestService("web", 80)}
+			if tt.class != nil {
+				objs = append(objs, tt.class)
+			}
+			var gets int
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(objs...).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						if _, ok := obj.(*networkingv1.IngressClass); ok {
+							gets++
+						}
+						return c.Get(ctx, key, obj, opts...)
+					},
+				}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				ControllerName: tt.controllerName,
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			ctx := context.Background()
+
+			// A negative result is cached, so the second check doesn't look
+			// up the class again
+			for i := 0; i < 2; i++ {
+				if got := reconciler.isManaged(ctx, ingress); got != tt.expected {
+					t.Errorf("Expected isManaged %v, got %v", tt.expected, got)
+				}
+			}
+			if gets != tt.expectedGets {
+				t.Errorf("Expected %d IngressClass lookups, got %d", tt.expectedGets, gets)
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Expected an ignored Ingress to reconcile without error, got %v", err)
+			}
+			if created := fakePangolin.Count(http.MethodPut, "/resource") > 0; created != tt.expected {
+				t.Errorf("Expected a resource to be created: %v, got %v", tt.expected, created)
+			}
+			if tt.expected {
+				return
+			}
+
+			// Creating or fixing the IngressClass drops the cached result and
+			// enqueues the Ingress
+			owned := ingressClass(controllerName)
+			if tt.class != nil {
+				owned = tt.class.DeepCopy()
+				owned.Spec.Controller = controllerName
+				if err := fakeClient.Delete(ctx, tt.class); err != nil {
+					t.Fatalf("Failed to delete IngressClass: %v", err)
+				}
+				owned.ResourceVersion = ""
+			}
+			if err := fakeClient.Create(ctx, owned); err != nil {
+				t.Fatalf("Failed to create IngressClass: %v", err)
+			}
+			requests := reconciler.ingressesForIngressClass(ctx, owned)
+			if len(requests) != 1 || requests[0].NamespacedName != req.NamespacedName {
+				t.Errorf("Expected the Ingress to be enqueued, got %v", requests)
+			}
+			if !reconciler.isManaged(ctx, ingress) {
+				t.Error("Expected the Ingress to be managed once its IngressClass is owned")
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_ingressesForIngressClassSelector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	selected := newTestIngress("web", "web.example.com", "web", 80)
+	selected.Labels = map[string]string{"team": "web"}
+	other := newTestIngress("api", "api.example.com", "api", 80)
+	other.Labels = map[string]string{"team": "api"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(selected, other).
+		Build()
+	selector, _ := labels.Parse("team=web")
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		ControllerName: "k8s.io/pangolin-ingress-controller",
+		LabelSelector:  selector,
+	}
+
+	class := &networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: "pangolin"}}
+	requests := reconciler.ingressesForIngressClass(context.Background(), class)
+	if len(requests) != 1 || requests[0].Name != "web" {
+		t.Errorf("Expected only the selected Ingress to be enqueued, got %v", requests)
+	}
+}
+
+func TestIngressReconciler_tlsOnlyHosts(t *testing.T) {
+	tests := []struct {
+		name              string
+		behavior          string
+		withoutRules      bool
+		tlsHosts          []string
+		expectedSubdomain string
+		expectedUploads   int
+		expectedEvent     string
+	}{
+		{
+			name:              "skipped next to a rule host",
+			tlsHosts:          []string{"app.example.com", "certs.example.com"},
+			expectedSubdomain: "app",
+			expectedUploads:   1,
+			expectedEvent:     "Normal TLSOnlyHost Host certs.example.com is only listed in spec.tls, no Pangolin resource is created for it",
+		},
+		{
+			name:          "skipped without rules",
+			behavior:      tlsOnlyHostsSkip,
+			withoutRules:  true,
+			tlsHosts:      []string{"certs.example.com"},
+			expectedEvent: "Normal NothingToRoute",
+		},
+		{
+			name:              "placeholder without rules",
+			behavior:          tlsOnlyHostsPlaceholder,
+			withoutRules:      true,
+			tlsHosts:          []string{"certs.example.com"},
+			expectedSubdomain: "certs",
+			expectedUploads:   1,
+		},
+		{
+			name:              "placeholder next to a rule host",
+			behavior:          tlsOnlyHostsPlaceholder,
+			tlsHosts:          []string{"certs.example.com"},
+			expectedSubdomain: "app",
+			expectedUploads:   1,
+		},
+		{
+			name:              "wildcard covering a rule host",
+			behavior:          tlsOnlyHostsPlaceholder,
+			tlsHosts:          []string{"*.example.com"},
+			expectedSubdomain: "app",
+			expectedUploads:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("certs", "app.example.com", "app-service", 80)
+			if tt.withoutRules {
+				ingress.Spec.Rules = nil
+			}
+			ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: tt.tlsHosts, SecretName: "certs-tls"}}
+			certPEM, keyPEM := generateTestCertificate(t, "certs.example.com")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "certs-tls", Namespace: "default"},
+				Type:       corev1.SecretTypeTLS,
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       certPEM,
+					corev1.TLSPrivateKeyKey: keyPEM,
+				},
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80), secret).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+				TLSOnlyHosts:   tt.behavior,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			rawID := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]
+			if tt.expectedSubdomain == "" {
+				if rawID != "" {
+					t.Errorf("Expected no resource, got %s", rawID)
+				}
+			} else {
+				id, err := strconv.Atoi(rawID)
+				if err != nil {
+					t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+				}
+				if got := fakePangolin.Resource(id).Subdomain; got != tt.expectedSubdomain {
+					t.Errorf("Expected subdomain %q, got %q", tt.expectedSubdomain, got)
+				}
+				expectedTargets := 1
+				if tt.withoutRules {
+					expectedTargets = 0
+				}
+				if got := len(fakePangolin.Targets(id)); got != expectedTargets {
+					t.Errorf("Expected %d targets, got %d", expectedTargets, got)
+				}
+			}
+			if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != tt.expectedUploads {
+				t.Errorf("Expected %d certificate uploads, got %d", tt.expectedUploads, got)
+			}
+
+			dropFinalizerEvents(recorder)
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if tt.expectedEvent == "" {
+				if len(events) > 0 {
+					t.Errorf("Expected no events, got %v", events)
+				}
+			} else if len(events) != 1 || !strings.HasPrefix(events[0], tt.expectedEvent) {
+				t.Errorf("Expected event %q, got %v", tt.expectedEvent, events)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_syncCertificate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("tls-ingress", "app.example.com", "app-service", 80)
+	ingress.Spec.TLS = []networkingv1.IngressTLS{{
+		Hosts:      []string{"*.example.com"},
+		SecretName: "app-tls",
+	}}
+	certPEM, keyPEM := generateTestCertificate(t, "app.example.com")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80), secret).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 1 {
+		t.Fatalf("Expected 1 certificate upload after initial reconcile, got %d", got)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	wantFingerprint, _ := certificateFingerprint(certPEM)
+	resourceID := updated.Annotations[reconciler.annotationKey(annotationResourceID)]
+	if got := reconciler.certificateFingerprints(updated)[resourceID]; got != wantFingerprint {
+		t.Errorf("Expected fingerprint annotation %q, got %q", wantFingerprint, got)
+	}
+
+	// An unchanged certificate must not be uploaded again
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 1 {
+		t.Errorf("Expected certificate upload to be skipped when unchanged, got %d uploads", got)
+	}
+
+	// A rotated certificate is uploaded again
+	rotatedCert, rotatedKey := generateTestCertificate(t, "app.example.com")
+	secret.Data[corev1.TLSCertKey] = rotatedCert
+	secret.Data[corev1.TLSPrivateKeyKey] = rotatedKey
+	if err := fakeClient.Update(ctx, secret); err != nil {
+		t.Fatalf("Failed to rotate secret: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 2 {
+		t.Errorf("Expected rotated certificate to be uploaded, got %d uploads", got)
+	}
+}
+
+func TestIngressReconciler_syncCertificateSharedSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	// Both hosts are covered by the same wildcard secret
+	ingress := newTestIngress("tls-ingress", "app.example.com", "app-service", 80)
+	other := newTestIngress("tls-ingress", "www.example.com", "app-service", 80)
+	ingress.Spec.Rules = append(ingress.Spec.Rules, other.Spec.Rules[0])
+	ingress.Spec.TLS = []networkingv1.IngressTLS{{
+		Hosts:      []string{"*.example.com"},
+		SecretName: "wildcard-tls",
+	}}
+	certPEM, keyPEM := generateTestCertificate(t, "*.example.com")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "wildcard-tls", Namespace: "default"},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80), secret).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		Recorder:       record.NewFakeRecorder(10),
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	ids := reconciler.recordedResourceIDs(updated)
+	if len(ids) != 2 {
+		t.Fatalf("Expected 2 recorded resources, got %v", ids)
+	}
+	for host, id := range ids {
+		resourceID, _ := strconv.Atoi(id)
+		if _, ok := fakePangolin.Certificate(resourceID); !ok {
+			t.Errorf("Expected the certificate to be uploaded to the resource of %s", host)
+		}
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 2 {
+		t.Fatalf("Expected 2 certificate uploads, got %d", got)
+	}
+
+	// Neither resource gets the unchanged certificate again
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 2 {
+		t.Errorf("Expected certificate uploads to be skipped when unchanged, got %d uploads", got)
+	}
+
+	// A resource deleted out-of-band is recreated and gets the certificate
+	// again, and the fingerprint of the old one is dropped
+	staleID, _ := strconv.Atoi(ids["www.example.com"])
+	if err := fakePangolin.client().DeleteResource(ctx, strconv.Itoa(staleID)); err != nil {
+		t.Fatalf("Failed to delete resource: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/certificate"); got != 3 {
+		t.Errorf("Expected the certificate to be uploaded to the recreated resource, got %d uploads", got)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	fingerprints := reconciler.certificateFingerprints(updated)
+	if _, ok := fingerprints[strconv.Itoa(staleID)]; ok {
+		t.Errorf("Expected the fingerprint of deleted resource %d to be dropped, got %v", staleID, fingerprints)
+	}
+	if len(fingerprints) != 2 {
+		t.Errorf("Expected a fingerprint per resource, got %v", fingerprints)
+	}
+}
+
+func TestIngressReconciler_ingressesForTLSSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	withTLS := newTestIngress("with-tls", "app.example.com", "app-service", 80)
+	withTLS.Spec.TLS = []networkingv1.IngressTLS{
+		{Hosts: []string{"www.example.com"}, SecretName: "www-tls"},
+		{Hosts: []string{"app.example.com"}, SecretName: "app-tls"},
+	}
+	withoutTLS := newTestIngress("without-tls", "other.example.com", "other-service", 80)
+	otherNamespace := newTestIngress("other-namespace", "app.example.org", "app-service", 80)
+	otherNamespace.Namespace = "other"
+	otherNamespace.Spec.TLS = withTLS.Spec.TLS
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(withTLS, withoutTLS, otherNamespace).
+		WithIndex(&networkingv1.Ingress{}, tlsSecretIndex, ingressTLSSecrets).
+		Build()
+	reconciler := &IngressReconciler{Client: fakeClient, IngressClass: "pangolin"}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-tls", Namespace: "default"}}
+	requests := reconciler.ingressesForTLSSecret(context.Background(), secret)
+	if len(requests) != 1 || requests[0].Name != "with-tls" {
+		t.Errorf("Expected only with-tls to be enqueued, got %v", requests)
+	}
+
+	// Rotating the certificate enqueues the Ingress through the watch handler
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	rotated := secret.DeepCopy()
+	rotated.Data = map[string][]byte{corev1.TLSCertKey: []byte("rotated")}
+	handler.EnqueueRequestsFromMapFunc(reconciler.ingressesForTLSSecret).
+		Update(context.Background(), event.UpdateEvent{ObjectOld: secret, ObjectNew: rotated}, queue)
+	if queue.Len() != 1 {
+		t.Fatalf("Expected one Ingress to be enqueued, got %d", queue.Len())
+	}
+	item, _ := queue.Get()
+	expected := reconcile.Request{NamespacedName: types.NamespacedName{Name: "with-tls", Namespace: "default"}}
+	if item != expected {
+		t.Errorf("Expected %v to be enqueued, got %v", expected, item)
+	}
+}
+
+func TestIngressReconciler_serviceRename(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("app", "app.example.com", "web", 80)
+	unrelated := newTestIngress("unrelated", "other.example.com", "other", 80)
+	reconciler := &IngressReconciler{
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, unrelated, newTestService("web", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		WithIndex(&networkingv1.Ingress{}, backendServiceIndex, reconciler.ingressBackendServices).
+		Build()
+	reconciler.Client = fakeClient
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	// The Ingress is switched to the new name before the Service is renamed,
+	// so the reconcile fails until the new Service exists
+	updated.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name = "web-v2"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err == nil {
+		t.Fatal("Expected the reconcile to fail while the new Service is missing")
+	}
+
+	renamed := newTestService("web-v2", 80)
+	if err := fakeClient.Create(ctx, renamed); err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	if err := fakeClient.Delete(ctx, newTestService("web", 80)); err != nil {
+		t.Fatalf("Failed to delete service: %v", err)
+	}
+
+	// Creating the new Service enqueues only the Ingress routing to it
+	requests := reconciler.ingressesForService(ctx, renamed)
+	if len(requests) != 1 || requests[0] != req {
+		t.Fatalf("Expected %v to be enqueued for the new Service, got %v", req, requests)
+	}
+	if requests := reconciler.ingressesForService(ctx, newTestService("unknown", 80)); len(requests) != 0 {
+		t.Errorf("Expected no Ingress to be enqueued for an unreferenced Service, got %v", requests)
+	}
+
+	if _, err := reconciler.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].IP != "web-v2.default.svc.cluster.local" {
+		t.Errorf("Expected the target of the old Service to be replaced by one for web-v2, got %+v", targets)
+	}
+}
+
+func TestIngressReconciler_servicePortChange(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("app", "app.example.com", "web", 0)
+	ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+	service := newTestService("web", 8080)
+	service.Spec.Ports[0].Name = "http"
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, service).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Port != 8080 {
+		t.Fatalf("Expected a single target on port 8080, got %+v", targets)
+	}
+	targetID := targets[0].ID
+
+	// The named port now resolves to another number
+	current := &corev1.Service{}
+	if err := fakeClient.Get(ctx, types.NamespacedName{Name: "web", Namespace: "default"}, current); err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	current.Spec.Ports[0].Port = 9090
+	if err := fakeClient.Update(ctx, current); err != nil {
+		t.Fatalf("Failed to update service: %v", err)
+	}
+	creates := fakePangolin.Count(http.MethodPut, "/target")
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	targets = fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].ID != targetID || targets[0].Port != 9090 {
+		t.Errorf("Expected target %d to be moved to port 9090 in place, got %+v", targetID, targets)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/target"); got != creates {
+		t.Errorf("Expected no target to be created, got %d creates", got-creates)
+	}
+	if got := fakePangolin.Count(http.MethodPost, fmt.Sprintf("/target/%d", targetID)); got == 0 {
+		t.Error("Expected the target to be updated")
+	}
+	if got := targets[0].Metadata["kubernetes.named-port"]; got != "http=9090" {
+		t.Errorf("Expected named port metadata http=9090, got %q", got)
+	}
+}
+
+// newTestIngress returns a managed Ingress with a single host and path.
+func newTestIngress(name, host, serviceName string, port int32) *networkingv1.Ingress {
+	ingressClassName := "pangolin"
+	pathTypePrefix := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &ingressClassName,
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathTypePrefix,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: serviceName,
+									Port: networkingv1.ServiceBackendPort{Number: port},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+// dropFinalizerEvents removes the FinalizerAdded and FinalizerRemoved events
+// from recorder, keeping the other events in order
+func dropFinalizerEvents(recorder *record.FakeRecorder) {
+	var kept []string
+	for len(recorder.Events) > 0 {
+		if e := <-recorder.Events; !strings.Contains(e, " FinalizerAdded ") && !strings.Contains(e, " FinalizerRemoved ") {
+			kept = append(kept, e)
+		}
+	}
+	for _, e := range kept {
+		recorder.Events <- e
+	}
+}
+
+// newTestService returns a Service in the default namespace exposing port.
+func newTestService(name string, port int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Port: port}},
+		},
+	}
+}
+
+// generateTestCertificate returns a self-signed PEM certificate and key.
+func generateTestCertificate(t *testing.T, host string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Failed to generate serial: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestIngressReconciler_annotationPrefix(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("prefixed", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"ingress.example.org/enabled":     "false",
+		"pangolin.ingress.k8s.io/enabled": "true",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:           fakeClient,
+		Scheme:           scheme,
+		IngressClass:     "pangolin",
+		AnnotationPrefix: "ingress.example.org",
+		PangolinClient:   fakePangolin.client(),
+		OrgID:            fakeOrgID,
+		SiteNiceID:       fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	resourceID := updated.Annotations["ingress.example.org/resource-id"]
+	if resourceID == "" {
+		t.Fatalf("Expected resource ID under the configured prefix, got annotations %v", updated.Annotations)
+	}
+	if _, ok := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; ok {
+		t.Errorf("Expected no resource ID under the default prefix")
+	}
+
+	id, _ := strconv.Atoi(resourceID)
+	res := fakePangolin.Resource(id)
+	if res == nil {
+		t.Fatalf("Expected resource %s to exist", resourceID)
+	}
+	if res.Enabled {
+		t.Errorf("Expected enabled annotation under the configured prefix to disable the resource")
+	}
+}
+
+func TestPangolinAnnotationChangedPredicate(t *testing.T) {
+	p := pangolinAnnotationChangedPredicate{prefix: "ingress.example.org"}
+
+	tests := []struct {
+		name     string
+		old, new map[string]string
+		expected bool
+	}{
+		{
+			name:     "Annotation under prefix changed",
+			old:      map[string]string{"ingress.example.org/sso": "true"},
+			new:      map[string]string{"ingress.example.org/sso": "false"},
+			expected: true,
+		},
+		{
+			name:     "Annotation under prefix removed",
+			old:      map[string]string{"ingress.example.org/sso": "true"},
+			new:      map[string]string{},
+			expected: true,
+		},
+		{
+			name:     "Annotation under other prefix changed",
+			old:      map[string]string{"pangolin.ingress.k8s.io/sso": "true"},
+			new:      map[string]string{"pangolin.ingress.k8s.io/sso": "false"},
+			expected: false,
+		},
+		{
+			name:     "Controller-managed annotation changed",
+			old:      map[string]string{},
+			new:      map[string]string{"ingress.example.org/resource-id": "42"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := event.UpdateEvent{
+				ObjectOld: &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: tt.old}},
+				ObjectNew: &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: tt.new}},
+			}
+			if got := p.Update(e); got != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestServicePortsChangedPredicate(t *testing.T) {
+	p := servicePortsChangedPredicate{}
+	ports := func(ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: ports},
+		}
+	}
+	http := corev1.ServicePort{Name: "http", Port: 80}
+
+	tests := []struct {
+		name     string
+		old, new *corev1.Service
+		expected bool
+	}{
+		{name: "port number changed", old: ports(http), new: ports(corev1.ServicePort{Name: "http", Port: 8080}), expected: true},
+		{name: "named port removed", old: ports(http), new: ports(), expected: true},
+		{name: "named port back", old: ports(), new: ports(http), expected: true},
+		{name: "ports unchanged", old: ports(http), new: ports(http), expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.expected {
+				t.Errorf("Expected %v but got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Other updates of a Service, e.g. of its labels, are not passed
+	relabeled := ports(http)
+	relabeled.Labels = map[string]string{"team": "a"}
+	if p.Update(event.UpdateEvent{ObjectOld: ports(http), ObjectNew: relabeled}) {
+		t.Errorf("Expected a Service update without port changes to be dropped")
+	}
+	if !p.Create(event.CreateEvent{Object: ports(http)}) || !p.Delete(event.DeleteEvent{Object: ports(http)}) {
+		t.Errorf("Expected Service creations and deletions to be passed")
+	}
+	if p.Generic(event.GenericEvent{Object: ports(http)}) {
+		t.Errorf("Expected generic Service events to be dropped")
+	}
+}
+
+func TestIngressReconciler_backendNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	tests := []struct {
+		name             string
+		backendNamespace string
+		serviceNamespace string
+		expectedTargetIP string
+		expectedError    bool
+	}{
+		{
+			name:             "Same-namespace default",
+			serviceNamespace: "default",
+			expectedTargetIP: "app-service.default.svc.cluster.local",
+		},
+		{
+			name:             "Cross-namespace backend",
+			backendNamespace: "shared",
+			serviceNamespace: "shared",
+			expectedTargetIP: "app-service.shared.svc.cluster.local",
+		},
+		{
+			name:             "Nonexistent backend namespace",
+			backendNamespace: "missing",
+			serviceNamespace: "default",
+			expectedError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("cross-ns", "app.example.com", "app-service", 80)
+			if tt.backendNamespace != "" {
+				ingress.Annotations = map[string]string{
+					"pangolin.ingress.k8s.io/backend-namespace": tt.backendNamespace,
+				}
+			}
+			service := newTestService("app-service", 80)
+			service.Namespace = tt.serviceNamespace
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(
+					ingress,
+					service,
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+					&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shared"}},
+				).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			_, err := reconciler.Reconcile(context.Background(), req)
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, _ := strconv.Atoi(updated.Annotations[reconciler.annotationKey(annotationResourceID)])
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 {
+				t.Fatalf("Expected 1 target, got %d", len(targets))
+			}
+			if targets[0].IP != tt.expectedTargetIP {
+				t.Errorf("Expected target IP %q, got %q", tt.expectedTargetIP, targets[0].IP)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_deleteCrossNamespaceTargets(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ctx := context.Background()
+	ingress := newTestIngress("cross-ns", "app.example.com", "app-service", 80)
+	sharedService := newTestService("app-service", 80)
+	sharedService.Namespace = "shared"
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			ingress,
+			newTestService("app-service", 80),
+			sharedService,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shared"}},
+		).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:            fakeClient,
+		Scheme:            scheme,
+		IngressClass:      "pangolin",
+		PangolinClient:    fakePangolin.client(),
+		OrgID:             fakeOrgID,
+		SiteNiceID:        fakeSiteNiceID,
+		TargetDrainPeriod: time.Hour,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	get := func() *networkingv1.Ingress {
+		t.Helper()
+		updated := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		return updated
+	}
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Moving the backend to another namespace leaves the old target draining
+	// next to the new one
+	updated := get()
+	updated.Annotations["pangolin.ingress.k8s.io/backend-namespace"] = "shared"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, err := strconv.Atoi(get().Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", get().Annotations)
+	}
+	targets := fakePangolin.Targets(id)
+	ips := make(map[string]bool)
+	for _, target := range targets {
+		ips[target.IP] = true
+	}
+	expectedIPs := map[string]bool{"app-service.default.svc.cluster.local": true, "app-service.shared.svc.cluster.local": true}
+	if !reflect.DeepEqual(ips, expectedIPs) {
+		t.Fatalf("Expected targets in both namespaces, got %+v", targets)
+	}
+
+	if err := fakeClient.Delete(ctx, get()); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, target := range targets {
+		if got := fakePangolin.Count(http.MethodDelete, "/target/"+strconv.Itoa(target.ID)); got != 1 {
+			t.Errorf("Expected target %d (%s) to be deleted once, got %d deletes", target.ID, target.IP, got)
+		}
+	}
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted", id)
+	}
+}
+
+func TestIngressReconciler_existingResourceID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ctx := context.Background()
+	existing, err := fakePangolin.client().CreateResource(ctx, &pangolin.CreateResourceRequest{
+		Name: "pre-provisioned", Subdomain: "legacy", HTTP: true, Protocol: "tcp", DomainID: "domain-1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	existingID := strconv.Itoa(existing.ID)
+
+	tests := []struct {
+		name          string
+		resourceID    string
+		expectedError string
+	}{
+		{name: "adopts the resource", resourceID: existingID},
+		{name: "missing resource", resourceID: "999", expectedError: "Pangolin resource 999 from annotation pangolin.ingress.k8s.io/existing-resource-id does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := newTestIngress("adopt", "app.example.com", "app-service", 80)
+			ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/existing-resource-id": tt.resourceID}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			creates := fakePangolin.Count(http.MethodPut, "/resource")
+
+			_, err := reconciler.Reconcile(ctx, req)
+			if got := fakePangolin.Count(http.MethodPut, "/resource") - creates; got != 0 {
+				t.Errorf("Expected no resource to be created, got %d creates", got)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("Expected error %q, got %v", tt.expectedError, err)
+				}
+				dropFinalizerEvents(recorder)
+				if e := <-recorder.Events; !strings.Contains(e, "ResourceNotFound") {
+					t.Errorf("Expected a ResourceNotFound event, got %q", e)
+				}
+				if id := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; id != "" {
+					t.Errorf("Expected no resource ID to be recorded, got %q", id)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if id := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; id != tt.resourceID {
+				t.Errorf("Expected resource ID %s to be recorded, got %q", tt.resourceID, id)
+			}
+			res := fakePangolin.Resource(existing.ID)
+			if res == nil || res.Name != reconciler.resourceName(ingress, "app.example.com") {
+				t.Errorf("Expected the existing resource to be updated for the Ingress, got %+v", res)
+			}
+			if targets := fakePangolin.Targets(existing.ID); len(targets) != 1 {
+				t.Errorf("Expected the target to be added to the existing resource, got %+v", targets)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_finalizerEvents(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("web", "app.example.com", "web", 80)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("web", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		Recorder:       recorder,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	expectFinalizerChange := func(operation, reason string) {
+		t.Helper()
+		before := testutil.ToFloat64(finalizerOperationsTotal.WithLabelValues("ingress", operation))
+		if _, err := reconciler.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := testutil.ToFloat64(finalizerOperationsTotal.WithLabelValues("ingress", operation)) - before; got != 1 {
+			t.Errorf("Expected the %s counter to increase by 1, got %v", operation, got)
+		}
+		var found bool
+		for len(recorder.Events) > 0 {
+			if e := <-recorder.Events; strings.HasPrefix(e, "Normal "+reason+" ") && strings.Contains(e, "pangolin.ingress.k8s.io/finalizer") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a %s event", reason)
+		}
+	}
+
+	expectFinalizerChange(finalizerAdded, "FinalizerAdded")
+
+	// A reconcile that leaves the finalizer alone counts nothing
+	added := testutil.ToFloat64(finalizerOperationsTotal.WithLabelValues("ingress", finalizerAdded))
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := testutil.ToFloat64(finalizerOperationsTotal.WithLabelValues("ingress", finalizerAdded)); got != added {
+		t.Errorf("Expected no finalizer to be added again, counter went from %v to %v", added, got)
+	}
+
+	if err := fakeClient.Delete(ctx, ingress); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	expectFinalizerChange(finalizerRemoved, "FinalizerRemoved")
+}
+
+func TestIngressReconciler_staleResourceID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("stale", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/resource-id": "999",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		Recorder:       recorder,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	before := testutil.ToFloat64(staleAnnotationTotal)
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := testutil.ToFloat64(staleAnnotationTotal) - before; got != 1 {
+		t.Errorf("Expected stale annotation counter to increase by 1, got %v", got)
+	}
+
+	dropFinalizerEvents(recorder)
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, corev1.EventTypeWarning) || !strings.Contains(e, "StaleResourceID") {
+			t.Errorf("Expected StaleResourceID warning event, got %q", e)
+		}
+	default:
+		t.Errorf("Expected a StaleResourceID event")
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	newID := updated.Annotations[reconciler.annotationKey(annotationResourceID)]
+	if newID == "" || newID == "999" {
+		t.Errorf("Expected the resource to be recreated with a new ID, got %q", newID)
+	}
+}
+
+func TestIngressReconciler_parallelTargets(t *testing.T) {
+	const numPaths = 20
+
+	tests := []struct {
+		name        string
+		failPort    int
+		expectError bool
+	}{
+		{name: "all targets created"},
+		{name: "single failing target", failPort: 8007, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			if tt.failPort != 0 {
+				fakePangolin.failTarget = func(req *pangolin.CreateTargetRequest) bool {
+					return req.Port == tt.failPort
+				}
+			}
+
+			ingress := newTestIngress("fanout", "app.example.com", "svc-0", 8000)
+			paths := ingress.Spec.Rules[0].HTTP.Paths[:0]
+			objects := []runtime.Object{ingress}
+			for i := 0; i < numPaths; i++ {
+				path := ingress.Spec.Rules[0].HTTP.Paths[0]
+				path.Path = fmt.Sprintf("/svc-%d", i)
+				path.Backend.Service = &networkingv1.IngressServiceBackend{
+					Name: fmt.Sprintf("svc-%d", i),
+					Port: networkingv1.ServiceBackendPort{Number: int32(8000 + i)},
+				}
+				paths = append(paths, path)
+				objects = append(objects, newTestService(fmt.Sprintf("svc-%d", i), int32(8000+i)))
+			}
+			ingress.Spec.Rules[0].HTTP.Paths = paths
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(objects...).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:            fakeClient,
+				Scheme:            scheme,
+				IngressClass:      "pangolin",
+				TargetConcurrency: 5,
+				PangolinClient:    fakePangolin.client(),
+				OrgID:             fakeOrgID,
+				SiteNiceID:        fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			_, err := reconciler.Reconcile(context.Background(), req)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error for the failing target")
+				}
+				if !strings.Contains(err.Error(), "svc-7:8007") {
+					t.Errorf("Expected the error to name the failing backend, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+
+			expected := numPaths
+			if tt.failPort != 0 {
+				expected--
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != expected {
+				t.Errorf("Expected %d targets, got %d", expected, len(targets))
+			}
+			for _, target := range targets {
+				if want := fmt.Sprintf("/svc-%d", target.Port-8000); target.Path != want {
+					t.Errorf("Expected target on port %d to have path %q, got %q", target.Port, want, target.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_crashRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		// failUpdate fails recording the resource ID on the Ingress, as if
+		// the controller crashed right after creating the resource
+		failUpdate bool
+		// failTargets fails all target creates, as if the controller crashed
+		// between creating the resource and its targets
+		failTargets bool
+	}{
+		{name: "crash before the resource ID is recorded", failUpdate: true},
+		{name: "crash between resource and target creation", failTargets: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			crashed := false
+			if tt.failTargets {
+				fakePangolin.failTarget = func(*pangolin.CreateTargetRequest) bool { return !crashed }
+			}
+
+			ingress := newTestIngress("app", "app.example.com", "web", 80)
+			api := ingress.Spec.Rules[0].HTTP.Paths[0]
+			api.Path = "/api"
+			api.Backend.Service = &networkingv1.IngressServiceBackend{
+				Name: "api",
+				Port: networkingv1.ServiceBackendPort{Number: 8080},
+			}
+			ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, api)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 8080)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+						if _, ok := obj.GetAnnotations()["pangolin.ingress.k8s.io/resource-id"]; ok && tt.failUpdate && !crashed {
+							return fmt.Errorf("connection lost")
+						}
+						return c.Patch(ctx, obj, patch, opts...)
+					},
+				}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err == nil {
+				t.Fatalf("Expected the interrupted reconcile to fail")
+			}
+			crashed = true
+
+			// Reconciling again, twice, must converge without duplicates
+			for i := 0; i < 2; i++ {
+				if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			resources := len(fakePangolin.Resources())
+			if resources != 1 {
+				t.Errorf("Expected a single Pangolin resource, got %d", resources)
+			}
+			if got := len(fakePangolin.Targets(id)); got != 2 {
+				t.Errorf("Expected 2 targets, got %d", got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_transactionalCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported bool
+		// notFound answers the endpoint with a 404 API error, which doesn't
+		// mean that the endpoint is missing
+		notFound bool
+	}{
+		{name: "transactional create", supported: true},
+		{name: "fallback to sequential creates"},
+		{name: "fallback on a 404 API error", notFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			fakePangolin.batchCreate = tt.supported
+			fakePangolin.batchCreateNotFound = tt.notFound
+
+			ingress := newTestIngress("app", "app.example.com", "web", 80)
+			api := ingress.Spec.Rules[0].HTTP.Paths[0]
+			api.Path = "/api"
+			api.Backend.Service = &networkingv1.IngressServiceBackend{
+				Name: "api",
+				Port: networkingv1.ServiceBackendPort{Number: 8080},
+			}
+			ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, api)
+			other := newTestIngress("other", "other.example.com", "web", 80)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, other, newTestService("web", 80), newTestService("api", 8080)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:              fakeClient,
+				Scheme:              scheme,
+				IngressClass:        "pangolin",
+				PangolinClient:      fakePangolin.client(),
+				OrgID:               fakeOrgID,
+				SiteNiceID:          fakeSiteNiceID,
+				TransactionalCreate: true,
+			}
+			ctx := context.Background()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			// Reconciling twice must converge without creating anything twice
+			for i := 0; i < 2; i++ {
+				if _, err := reconciler.Reconcile(ctx, req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 2 {
+				t.Fatalf("Expected 2 targets, got %+v", targets)
+			}
+			targetPaths := make(map[int]string)
+			for _, target := range targets {
+				targetPaths[target.ID] = target.Path
+			}
+			rules := fakePangolin.Rules(id)
+			if len(rules) != 2 || rules[0].Path != "/api" || rules[1].Path != "/" {
+				t.Fatalf("Expected rules for /api and /, got %+v", rules)
+			}
+			for _, rule := range rules {
+				if targetPaths[rule.TargetID] != rule.Path {
+					t.Errorf("Expected the rule for %s to route to its target, got target %d", rule.Path, rule.TargetID)
+				}
+			}
+
+			resources, sequential := 1, 2
+			if tt.supported {
+				resources, sequential = 0, 0
+			}
+			if got := fakePangolin.Count(http.MethodPost, "/resources:batchCreate"); got != 1 {
+				t.Errorf("Expected a single transactional create, got %d", got)
+			}
+			if got := fakePangolin.Count(http.MethodPut, "/resource"); got != resources {
+				t.Errorf("Expected %d sequential resource creates, got %d", resources, got)
+			}
+			if got := fakePangolin.Count(http.MethodPut, "/target"); got != sequential {
+				t.Errorf("Expected %d sequential target creates, got %d", sequential, got)
+			}
+			if got := fakePangolin.Count(http.MethodPut, "/rule"); got != sequential {
+				t.Errorf("Expected %d sequential rule creates, got %d", sequential, got)
+			}
+
+			// Once the endpoint turned out to be missing, it isn't tried
+			// again; a 404 API error doesn't tell so
+			otherReq := ctrl.Request{NamespacedName: types.NamespacedName{Name: other.Name, Namespace: other.Namespace}}
+			if _, err := reconciler.Reconcile(ctx, otherReq); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			batches := 1
+			if tt.supported || tt.notFound {
+				batches = 2
+			}
+			if got := fakePangolin.Count(http.MethodPost, "/resources:batchCreate"); got != batches {
+				t.Errorf("Expected %d transactional creates, got %d", batches, got)
+			}
+		})
+	}
+}
+
+func TestOwnsTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		expected bool
+	}{
+		{name: "untagged", expected: true},
+		{name: "tagged with the ingress", metadata: map[string]string{"kubernetes.ingress": "default/app"}, expected: true},
+		{name: "tagged with another ingress", metadata: map[string]string{"kubernetes.ingress": "default/other"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &pangolin.Target{Metadata: tt.metadata}
+			if got := ownsTarget(target, "default/app"); got != tt.expected {
+				t.Errorf("Expected ownsTarget %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_readinessPolling(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	fakePangolin.SetSiteProxyIP(fakeSiteNiceID, "")
+	ingress := newTestIngress("pending", "app.example.com", "app-service", 80)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	// First poll: no proxy IP yet, so the Ingress is requeued without status
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != defaultStatusPollInterval {
+		t.Errorf("Expected requeue after %v, got %v", defaultStatusPollInterval, result.RequeueAfter)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if len(updated.Status.LoadBalancer.Ingress) != 0 {
+		t.Errorf("Expected no status before the resource is ready, got %+v", updated.Status.LoadBalancer.Ingress)
+	}
+
+	// Second poll: the proxy IP is available and lands in status
+	fakePangolin.SetSiteProxyIP(fakeSiteNiceID, fakeProxyIP)
+	result, err = reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("Expected no requeue once ready, got %v", result.RequeueAfter)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	lb := updated.Status.LoadBalancer.Ingress
+	if len(lb) != 1 || lb[0].IP != fakeProxyIP {
+		t.Errorf("Expected status IP %q, got %+v", fakeProxyIP, lb)
+	}
+}
+
+func TestIngressReconciler_multiSite(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	fakePangolin.AddSite(pangolin.Site{ID: 5, NiceID: "eu-site", ProxyIP: "203.0.113.20", Online: true})
+	fakePangolin.AddSite(pangolin.Site{ID: 9, NiceID: "us-site", Online: true})
+	ingress := newTestIngress("multi", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/site-ids": "eu-site, us-site"}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	// us-site has no proxy IP yet, so the status waits for it
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != defaultStatusPollInterval {
+		t.Errorf("Expected requeue after %v, got %v", defaultStatusPollInterval, result.RequeueAfter)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	if got := fakePangolin.Resource(id).SiteIDs; !reflect.DeepEqual(got, []string{"eu-site", "us-site"}) {
+		t.Errorf("Expected the resource to be placed on both sites, got %v", got)
+	}
+
+	fakePangolin.SetSiteProxyIP("us-site", "198.51.100.7")
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	expected := []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.20"}, {IP: "198.51.100.7"}}
+	if !reflect.DeepEqual(updated.Status.LoadBalancer.Ingress, expected) {
+		t.Errorf("Expected status %+v, got %+v", expected, updated.Status.LoadBalancer.Ingress)
+	}
+
+	// Unknown sites fail the reconcile
+	updated.Annotations["pangolin.ingress.k8s.io/site-ids"] = "eu-site,missing-site"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err == nil || !strings.Contains(err.Error(), "site missing-site from annotation pangolin.ingress.k8s.io/site-ids does not exist") {
+		t.Errorf("Expected an error about the missing site, got %v", err)
+	}
+}
+
+func TestLoadBalancerAddressesEqual(t *testing.T) {
+	ip := func(ip string) networkingv1.IngressLoadBalancerIngress {
+		return networkingv1.IngressLoadBalancerIngress{IP: ip}
+	}
+
+	tests := []struct {
+		name     string
+		current  []networkingv1.IngressLoadBalancerIngress
+		desired  []networkingv1.IngressLoadBalancerIngress
+		expected bool
+	}{
+		{name: "both empty", expected: true},
+		{name: "no status yet", desired: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10")}},
+		{
+			name:     "same IP",
+			current:  []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10")},
+			desired:  []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10")},
+			expected: true,
+		},
+		{
+			name:    "hostname added to an IP-only entry",
+			current: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10")},
+			desired: []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.10", Hostname: "edge.example.com"}},
+		},
+		{
+			name:     "multiple entries in another order",
+			current:  []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10"), ip("198.51.100.7")},
+			desired:  []networkingv1.IngressLoadBalancerIngress{ip("198.51.100.7"), ip("203.0.113.10")},
+			expected: true,
+		},
+		{
+			name:    "entry added after the first",
+			current: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10")},
+			desired: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10"), ip("198.51.100.7")},
+		},
+		{
+			name:    "duplicates don't hide a missing entry",
+			current: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10"), ip("203.0.113.10")},
+			desired: []networkingv1.IngressLoadBalancerIngress{ip("203.0.113.10"), ip("198.51.100.7")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadBalancerAddressesEqual(tt.current, tt.desired); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_nextReadinessPoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		timeout  time.Duration
+		expected []time.Duration
+	}{
+		{
+			name: "defaults",
+			// The last delay is cut short so that polling stops after 1m
+			expected: []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second},
+		},
+		{
+			name:     "configured interval and timeout",
+			interval: time.Second,
+			timeout:  5 * time.Second,
+			expected: []time.Duration{time.Second, 2 * time.Second, 2 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reconciler := &IngressReconciler{StatusPollInterval: tt.interval, StatusPollTimeout: tt.timeout}
+			key := types.NamespacedName{Name: "app", Namespace: "default"}
+
+			for i, expected := range tt.expected {
+				delay, ok := reconciler.nextReadinessPoll(key)
+				if !ok || delay != expected {
+					t.Fatalf("Attempt %d: expected delay %v, got %v (ok=%v)", i+1, expected, delay, ok)
+				}
+			}
+			if _, ok := reconciler.nextReadinessPoll(key); ok {
+				t.Errorf("Expected polling to stop after %d attempts", len(tt.expected))
+			}
+
+			reconciler.resetReadinessPoll(key)
+			if delay, ok := reconciler.nextReadinessPoll(key); !ok || delay != tt.expected[0] {
+				t.Errorf("Expected polling to restart after reset, got %v (ok=%v)", delay, ok)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_lookupSite(t *testing.T) {
+	fakePangolin := newFakePangolin(t)
+	fakePangolin.AddSite(pangolin.Site{ID: 3, NiceID: "offline-site", Online: false})
+	fakePangolin.AddSite(pangolin.Site{ID: 5, NiceID: "edge-site", ProxyIP: "203.0.113.20", Online: true, Region: "us-east"})
+	fakePangolin.AddSite(pangolin.Site{ID: 9, NiceID: "backup-site", ProxyIP: "203.0.113.30", Online: true, Region: "eu-west"})
+	fakePangolin.AddSite(pangolin.Site{ID: 11, NiceID: "eu-site", ProxyIP: "203.0.113.40", Online: true, Region: "eu-west"})
+	fakePangolin.AddSite(pangolin.Site{ID: 2, NiceID: "offline-eu-site", Online: false, Region: "eu-west"})
+
+	tests := []struct {
+		name           string
+		siteNiceID     string
+		region         string
+		annotations    map[string]string
+		resource       *pangolin.Resource
+		expectedSite   string
+		expectedSource string
+		expectError    bool
+	}{
+		{
+			name:           "resource site wins over annotation",
+			siteNiceID:     fakeSiteNiceID,
+			annotations:    map[string]string{"pangolin.ingress.k8s.io/site": "edge-site"},
+			resource:       &pangolin.Resource{ID: 1, SiteID: 9},
+			expectedSite:   "backup-site",
+			expectedSource: siteSourceResource,
+		},
+		{
+			name:           "annotation wins over default",
+			siteNiceID:     fakeSiteNiceID,
+			annotations:    map[string]string{"pangolin.ingress.k8s.io/site": "edge-site"},
+			resource:       &pangolin.Resource{ID: 1},
+			expectedSite:   "edge-site",
+			expectedSource: siteSourceAnnotation,
+		},
+		{
+			name:           "configured default site",
+			siteNiceID:     fakeSiteNiceID,
+			expectedSite:   fakeSiteNiceID,
+			expectedSource: siteSourceDefault,
+		},
+		{
+			name:           "configured default site wins over region",
+			siteNiceID:     fakeSiteNiceID,
+			region:         "eu-west",
+			expectedSite:   fakeSiteNiceID,
+			expectedSource: siteSourceDefault,
+		},
+		{
+			name:           "first online site in the default region",
+			region:         "EU-West",
+			expectedSite:   "backup-site",
+			expectedSource: siteSourceRegion,
+		},
+		{
+			name:           "no online site in the default region",
+			region:         "ap-south",
+			expectedSite:   "edge-site",
+			expectedSource: siteSourceFirstOnline,
+		},
+		{
+			name:           "first online site as last resort",
+			expectedSite:   "edge-site",
+			expectedSource: siteSourceFirstOnline,
+		},
+		{
+			name:        "unknown annotated site",
+			annotations: map[string]string{"pangolin.ingress.k8s.io/site": "missing-site"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reconciler := &IngressReconciler{
+				PangolinClient:    fakePangolin.client(),
+				OrgID:             fakeOrgID,
+				SiteNiceID:        tt.siteNiceID,
+				DefaultSiteRegion: tt.region,
+			}
+
+			site, source, err := reconciler.lookupSite(context.Background(), tt.annotations, tt.resource)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got site %q", site.NiceID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if site.NiceID != tt.expectedSite {
+				t.Errorf("Expected site %q, got %q", tt.expectedSite, site.NiceID)
+			}
+			if source != tt.expectedSource {
+				t.Errorf("Expected source %q, got %q", tt.expectedSource, source)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_deletionProtection(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		expectDeleted bool
+		expectEvent   bool
+	}{
+		{
+			name:          "unprotected resource is deleted",
+			expectDeleted: true,
+		},
+		{
+			name:          "protected resource is retained",
+			annotations:   map[string]string{"pangolin.ingress.k8s.io/deletion-protection": "true"},
+			expectDeleted: false,
+			expectEvent:   true,
+		},
+		{
+			name:          "explicitly unprotected resource is deleted",
+			annotations:   map[string]string{"pangolin.ingress.k8s.io/deletion-protection": "false"},
+			expectDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("protected", "app.example.com", "app-service", 80)
+			ingress.Annotations = tt.annotations
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			ctx := context.Background()
+
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			created := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, created); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(created.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", created.Annotations)
+			}
+
+			if err := fakeClient.Delete(ctx, created); err != nil {
+				t.Fatalf("Failed to delete ingress: %v", err)
+			}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if deleted := fakePangolin.Resource(id) == nil; deleted != tt.expectDeleted {
+				t.Errorf("Expected resource deleted=%v, got %v", tt.expectDeleted, deleted)
+			}
+			if err := fakeClient.Get(ctx, req.NamespacedName, &networkingv1.Ingress{}); err == nil {
+				t.Errorf("Expected ingress to be gone once the finalizer was removed")
+			}
+
+			retained := false
+			for len(recorder.Events) > 0 {
+				if e := <-recorder.Events; strings.Contains(e, "ResourceRetained") {
+					retained = true
+				}
+			}
+			if retained != tt.expectEvent {
+				t.Errorf("Expected ResourceRetained event=%v, got %v", tt.expectEvent, retained)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_labelSelectorCleanup(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("relabeled", "app.example.com", "app-service", 80)
+	ingress.Labels = map[string]string{"team": "web"}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	selector, _ := labels.Parse("team=web")
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		LabelSelector:  selector,
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	// The Ingress leaves the selector, then is deleted
+	updated.Labels = map[string]string{"team": "other"}
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if err := fakeClient.Delete(ctx, updated); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted", id)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, &networkingv1.Ingress{}); err == nil {
+		t.Errorf("Expected ingress to be gone once the finalizer was removed")
+	}
+}
+
+func TestIngressReconciler_cleanupOnUnmanage(t *testing.T) {
+	tests := []struct {
+		name              string
+		cleanupOnUnmanage bool
+	}{
+		{name: "resources left in place"},
+		{name: "resources cleaned up", cleanupOnUnmanage: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("moved", "app.example.com", "app-service", 80)
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:            fakeClient,
+				Scheme:            scheme,
+				IngressClass:      "pangolin",
+				PangolinClient:    fakePangolin.client(),
+				OrgID:             fakeOrgID,
+				SiteNiceID:        fakeSiteNiceID,
+				CleanupOnUnmanage: tt.cleanupOnUnmanage,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			ctx := context.Background()
+
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+
+			// The Ingress moves to another class
+			otherClass := "nginx"
+			updated.Spec.IngressClassName = &otherClass
+			if err := fakeClient.Update(ctx, updated); err != nil {
+				t.Fatalf("Failed to update ingress: %v", err)
+			}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			moved := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, moved); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			hasFinalizer := controllerutil.ContainsFinalizer(moved, defaultFinalizerName)
+			_, hasResourceID := moved.Annotations["pangolin.ingress.k8s.io/resource-id"]
+			deleted := fakePangolin.Resource(id) == nil
+			if tt.cleanupOnUnmanage {
+				if !deleted || hasFinalizer || hasResourceID {
+					t.Errorf("Expected the resource, finalizer and resource-id annotation to be removed, got deleted=%v finalizer=%v annotations=%v",
+						deleted, hasFinalizer, moved.Annotations)
+				}
+			} else {
+				if deleted || !hasFinalizer || !hasResourceID {
+					t.Errorf("Expected the resource, finalizer and resource-id annotation to be kept, got deleted=%v finalizer=%v annotations=%v",
+						deleted, hasFinalizer, moved.Annotations)
+				}
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_deleteUntrackedResources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ctx := context.Background()
+	ingress := newTestIngress("untracked", "app.example.com", "app-service", 80)
+
+	// A resource of the Ingress whose ID was never recorded, and one of
+	// another Ingress
+	untracked, err := fakePangolin.client().CreateResource(ctx, &pangolin.CreateResourceRequest{
+		Name: "leftover", Subdomain: "old", HTTP: true, Protocol: "tcp", DomainID: "domain-1",
+		Metadata: map[string]string{"kubernetes.ingress": "default/untracked"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	foreign, err := fakePangolin.client().CreateResource(ctx, &pangolin.CreateResourceRequest{
+		Name: "foreign", Subdomain: "other", HTTP: true, Protocol: "tcp", DomainID: "domain-1",
+		Metadata: map[string]string{"kubernetes.ingress": "default/other"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	if err := fakeClient.Delete(ctx, updated); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, deleted := range []int{id, untracked.ID} {
+		if fakePangolin.Resource(deleted) != nil {
+			t.Errorf("Expected resource %d to be deleted", deleted)
+		}
+	}
+	if fakePangolin.Resource(foreign.ID) == nil {
+		t.Errorf("Expected resource %d of another Ingress to be kept", foreign.ID)
+	}
+}
+
+func TestIngressReconciler_instanceID(t *testing.T) {
+	tests := []struct {
+		name          string
+		tagged        string
+		allowForeign  bool
+		expectedError string
+		expectedTag   string
+	}{
+		{name: "untagged resource is adopted", expectedTag: "blue"},
+		{name: "own resource", tagged: "blue", expectedTag: "blue"},
+		{name: "foreign resource is left alone", tagged: "green", expectedError: `managed by controller instance "green"`, expectedTag: "green"},
+		{name: "foreign resource with override", tagged: "green", allowForeign: true, expectedTag: "blue"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ctx := context.Background()
+			metadata := map[string]string{}
+			if tt.tagged != "" {
+				metadata["kubernetes.instance-id"] = tt.tagged
+			}
+			existing, err := fakePangolin.client().CreateResource(ctx, &pangolin.CreateResourceRequest{
+				Name: "existing", Subdomain: "app", HTTP: true, Protocol: "tcp", DomainID: "domain-1", Metadata: metadata,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create resource: %v", err)
+			}
+			ingress := newTestIngress("tagged", "app.example.com", "app-service", 80)
+			ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/resource-id": strconv.Itoa(existing.ID)}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:                        fakeClient,
+				Scheme:                        scheme,
+				Recorder:                      recorder,
+				IngressClass:                  "pangolin",
+				PangolinClient:                fakePangolin.client(),
+				OrgID:                         fakeOrgID,
+				SiteNiceID:                    fakeSiteNiceID,
+				InstanceID:                    "blue",
+				AllowForeignInstanceResources: tt.allowForeign,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			updates := fakePangolin.Count(http.MethodPost, fmt.Sprintf("/resource/%d", existing.ID))
+
+			_, err = reconciler.Reconcile(ctx, req)
+			if tt.expectedError == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.expectedError, err)
+				}
+				if got := fakePangolin.Count(http.MethodPost, fmt.Sprintf("/resource/%d", existing.ID)) - updates; got != 0 {
+					t.Errorf("Expected the foreign resource not to be updated, got %d updates", got)
+				}
+				if got := fakePangolin.Count(http.MethodPut, "/resource"); got != 1 {
+					t.Errorf("Expected no resource to be created, got %d creates", got-1)
+				}
+				dropFinalizerEvents(recorder)
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, "ForeignInstanceResource") {
+						t.Errorf("Expected a ForeignInstanceResource event, got %q", event)
+					}
+				default:
+					t.Error("Expected a ForeignInstanceResource event, got none")
+				}
+			}
+			if got := fakePangolin.Resource(existing.ID).Metadata["kubernetes.instance-id"]; got != tt.expectedTag {
+				t.Errorf("Expected instance ID %q, got %q", tt.expectedTag, got)
+			}
+
+			// Deletion leaves a foreign resource in place
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			controllerutil.AddFinalizer(updated, "pangolin.ingress.k8s.io/finalizer")
+			if err := fakeClient.Update(ctx, updated); err != nil {
+				t.Fatalf("Failed to update ingress: %v", err)
+			}
+			if err := fakeClient.Delete(ctx, updated); err != nil {
+				t.Fatalf("Failed to delete ingress: %v", err)
+			}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if kept := fakePangolin.Resource(existing.ID) != nil; kept != (tt.expectedError != "") {
+				t.Errorf("Expected the resource to be kept only if foreign, kept: %v", kept)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_exclusiveHosts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	web := newTestIngress("web", "app.example.com", "web-service", 80)
+	api := newTestIngress("api", "app.example.com", "api-service", 8080)
+	api.Spec.Rules[0].HTTP.Paths[0].Path = "/api"
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(web, api, newTestService("web-service", 80), newTestService("api-service", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	newReconciler := func() *IngressReconciler {
+		return &IngressReconciler{
+			Client:         fakeClient,
+			Scheme:         scheme,
+			Recorder:       recorder,
+			IngressClass:   "pangolin",
+			PangolinClient: fakePangolin.client(),
+			OrgID:          fakeOrgID,
+			SiteNiceID:     fakeSiteNiceID,
+			ExclusiveHosts: true,
+		}
+	}
+	reconciler := newReconciler()
+	ctx := context.Background()
+	reconcile := func(r *IngressReconciler, name string) error {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}
+		_, err := r.Reconcile(ctx, req)
+		return err
+	}
+	resourceID := func(name string) string {
+		t.Helper()
+		ingress := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, ingress); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		return ingress.Annotations["pangolin.ingress.k8s.io/resource-id"]
+	}
+	expectConflict := func(r *IngressReconciler) {
+		t.Helper()
+		err := reconcile(r, "api")
+		if err == nil || !strings.Contains(err.Error(), "host app.example.com is already claimed by Ingress default/web") {
+			t.Fatalf("Expected a host conflict, got %v", err)
+		}
+		dropFinalizerEvents(recorder)
+		if len(recorder.Events) != 1 {
+			t.Fatalf("Expected a single event, got %d", len(recorder.Events))
+		}
+		if e := <-recorder.Events; !strings.Contains(e, "Warning HostConflict Host app.example.com is already claimed by Ingress default/web") {
+			t.Errorf("Expected a HostConflict event, got %q", e)
+		}
+		if id := resourceID("api"); id != "" {
+			t.Errorf("Expected no resource for the refused Ingress, got %s", id)
+		}
+	}
+
+	if err := reconcile(reconciler, "web"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dropFinalizerEvents(recorder)
+	expectConflict(reconciler)
+
+	id, err := strconv.Atoi(resourceID("web"))
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", err)
+	}
+	if got := fakePangolin.Resource(id).Metadata["kubernetes.owners"]; got != "default/web" {
+		t.Errorf("Expected the resource to stay owned by default/web, got %q", got)
+	}
+	if targets := fakePangolin.Targets(id); len(targets) != 1 || targets[0].Metadata["kubernetes.ingress"] != "default/web" {
+		t.Errorf("Expected only the target of default/web, got %+v", targets)
+	}
+
+	// A restarted controller has no claims yet, but finds the resource owned
+	// by the other Ingress
+	expectConflict(newReconciler())
+
+	// Deleting the Ingress releases its claim, and the other one takes over
+	if err := fakeClient.Delete(ctx, web); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	if err := reconcile(reconciler, "web"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(reconciler.hostOwners) != 0 {
+		t.Errorf("Expected all claims to be released, got %v", reconciler.hostOwners)
+	}
+	if err := reconcile(reconciler, "api"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := reconciler.hostOwners["app.example.com"]; got != "default/api" {
+		t.Errorf("Expected default/api to claim the host, got %q", got)
+	}
+	if resourceID("api") == "" {
+		t.Errorf("Expected a resource for default/api")
+	}
+}
+
+func TestIngressReconciler_sharedHost(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	web := newTestIngress("web", "app.example.com", "web-service", 80)
+	api := newTestIngress("api", "app.example.com", "api-service", 8080)
+	api.Spec.Rules[0].HTTP.Paths[0].Path = "/api"
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(web, api, newTestService("web-service", 80), newTestService("api-service", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	ctx := context.Background()
+	reconcile := func(name string) {
+		t.Helper()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}
+		if _, err := reconciler.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error reconciling %s: %v", name, err)
+		}
+	}
+	resourceID := func(name string) int {
+		t.Helper()
+		ingress := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, ingress); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		id, err := strconv.Atoi(ingress.Annotations["pangolin.ingress.k8s.io/resource-id"])
+		if err != nil {
+			t.Fatalf("Expected resource ID annotation, got %v", ingress.Annotations)
+		}
+		return id
+	}
+	rulePaths := func(id int) map[string]int {
+		priorities := make(map[string]int)
+		for _, rule := range fakePangolin.Rules(id) {
+			priorities[rule.Path] = rule.Priority
+		}
+		return priorities
+	}
+
+	reconcile("web")
+	reconcile("api")
+	id := resourceID("web")
+	if got := resourceID("api"); got != id {
+		t.Fatalf("Expected both Ingresses to share resource %d, got %d", id, got)
+	}
+	if got := fakePangolin.Resource(id).Metadata["kubernetes.owners"]; got != "default/api,default/web" {
+		t.Errorf("Expected both Ingresses to own the resource, got %q", got)
+	}
+
+	// Each Ingress keeps the other's targets and rules, and both agree on
+	// the rule order, so reconciling again changes nothing
+	reconcile("web")
+	seen := len(fakePangolin.Requests())
+	reconcile("api")
+	reconcile("web")
+	for _, r := range fakePangolin.Requests()[seen:] {
+		if strings.Contains(r, "/rule") && !strings.HasPrefix(r, http.MethodGet+" ") {
+			t.Errorf("Expected the rules to be stable, got %s", r)
+		}
+	}
+	if got := fakePangolin.Count(http.MethodDelete, ""); got != 0 {
+		t.Errorf("Expected nothing to be deleted, got %d deletes", got)
+	}
+	if targets := fakePangolin.Targets(id); len(targets) != 2 {
+		t.Errorf("Expected a target per Ingress, got %+v", targets)
+	}
+	expected := map[string]int{"/api": 1, "/": 2}
+	if got := rulePaths(id); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected rules %v, got %v", expected, got)
+	}
+
+	// Deleting one Ingress only removes its paths from the resource
+	if err := fakeClient.Delete(ctx, web); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	reconcile("web")
+	res := fakePangolin.Resource(id)
+	if res == nil {
+		t.Fatalf("Expected resource %d to be kept for the remaining Ingress", id)
+	}
+	if got := res.Metadata["kubernetes.owners"]; got != "default/api" {
+		t.Errorf("Expected only the api Ingress to own the resource, got %q", got)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Metadata["kubernetes.ingress"] != "default/api" {
+		t.Errorf("Expected only the api target to remain, got %+v", targets)
+	}
+	if got := rulePaths(id); !reflect.DeepEqual(got, map[string]int{"/api": 1}) {
+		t.Errorf("Expected only the api rule to remain, got %v", got)
+	}
+
+	// The last owner deletes the resource
+	if err := fakeClient.Delete(ctx, api); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	reconcile("api")
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted with its last owner", id)
+	}
+}
+
+func TestIngressReconciler_finalizerName(t *testing.T) {
+	const finalizer = "example.com/pangolin-eu"
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("custom-finalizer", "app.example.com", "app-service", 80)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		FinalizerName:  finalizer,
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if !reflect.DeepEqual(updated.Finalizers, []string{finalizer}) {
+		t.Fatalf("Expected only finalizer %s, got %v", finalizer, updated.Finalizers)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	if err := fakeClient.Delete(ctx, updated); err != nil {
+		t.Fatalf("Failed to delete ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted", id)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, &networkingv1.Ingress{}); err == nil {
+		t.Errorf("Expected ingress to be gone once the custom finalizer was removed")
+	}
+}
+
+func TestIngressReconciler_ignore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("parked", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/ignore": "true"}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		Recorder:       recorder,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+	setIgnore := func(value string) *networkingv1.Ingress {
+		t.Helper()
+		updated := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		updated.Annotations["pangolin.ingress.k8s.io/ignore"] = value
+		if err := fakeClient.Update(ctx, updated); err != nil {
+			t.Fatalf("Failed to update ingress: %v", err)
+		}
+		if _, err := reconciler.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		return updated
+	}
+
+	// An ignored Ingress gets the finalizer but no resource
+	updated := setIgnore("true")
+	if got := fakePangolin.Count(http.MethodPut, "/resource"); got != 0 {
+		t.Errorf("Expected no resources for an ignored Ingress, got %d created", got)
+	}
+	if !reflect.DeepEqual(updated.Finalizers, []string{defaultFinalizerName}) {
+		t.Errorf("Expected the finalizer on an ignored Ingress, got %v", updated.Finalizers)
+	}
+
+	// Once no longer ignored, the resource is created
+	updated = setIgnore("false")
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil || fakePangolin.Resource(id) == nil {
+		t.Fatalf("Expected a resource once the Ingress is no longer ignored, got %v", updated.Annotations)
+	}
+
+	// Ignoring it again deletes the existing resource
+	updated = setIgnore("true")
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted", id)
+	}
+	if v, ok := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; ok {
+		t.Errorf("Expected the resource ID annotation to be removed, got %q", v)
+	}
+	dropFinalizerEvents(recorder)
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "ResourceDeleted") {
+			t.Errorf("Expected a ResourceDeleted event, got %q", event)
+		}
+	default:
+		t.Error("Expected a ResourceDeleted event")
+	}
+}
+
+func TestIngressReconciler_emptyIngress(t *testing.T) {
+	tests := []struct {
+		name         string
+		rulesRemoved bool
+		wantEvent    string
+	}{
+		{name: "created without rules", wantEvent: "NothingToRoute"},
+		{name: "rules removed", rulesRemoved: true, wantEvent: "ResourceDeleted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("empty", "app.example.com", "app-service", 80)
+			if !tt.rulesRemoved {
+				ingress.Spec.Rules = nil
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			ctx := context.Background()
+
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+
+			if tt.rulesRemoved {
+				id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+				if err != nil {
+					t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+				}
+				updated.Spec.Rules = nil
+				if err := fakeClient.Update(ctx, updated); err != nil {
+					t.Fatalf("Failed to update ingress: %v", err)
+				}
+				if _, err := reconciler.Reconcile(ctx, req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+					t.Fatalf("Failed to get ingress: %v", err)
+				}
+				if fakePangolin.Resource(id) != nil {
+					t.Errorf("Expected resource %d to be deleted", id)
+				}
+			} else if got := fakePangolin.Count(http.MethodPut, "/resource"); got != 0 {
+				t.Errorf("Expected no resource for an empty Ingress, got %d created", got)
+			}
+
+			if v, ok := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; ok {
+				t.Errorf("Expected no resource ID annotation, got %q", v)
+			}
+			if len(updated.Finalizers) != 0 {
+				t.Errorf("Expected no finalizer on an empty Ingress, got %v", updated.Finalizers)
+			}
+			found := false
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, tt.wantEvent) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected a %s event", tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_pathRules(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("multipath", "app.example.com", "web", 80)
+	pathTypeExact := networkingv1.PathTypeExact
+	base := ingress.Spec.Rules[0].HTTP.Paths[0]
+	backend := func(path, service string, port int32) networkingv1.HTTPIngressPath {
+		p := base
+		p.Path = path
+		p.Backend.Service = &networkingv1.IngressServiceBackend{
+			Name: service,
+			Port: networkingv1.ServiceBackendPort{Number: port},
+		}
+		return p
+	}
+	health := backend("/healthz", "health", 8081)
+	health.PathType = &pathTypeExact
+	ingress.Spec.Rules[0].HTTP.Paths = []networkingv1.HTTPIngressPath{
+		backend("/", "web", 80),
+		backend("/api", "api", 8080),
+		health,
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 8080), newTestService("health", 8081)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	// linkage maps each rule path to the service host its target points at
+	linkage := func() map[string]string {
+		targets := make(map[int]pangolin.Target)
+		for _, target := range fakePangolin.Targets(id) {
+			targets[target.ID] = target
+		}
+		out := make(map[string]string)
+		for _, rule := range fakePangolin.Rules(id) {
+			target, ok := targets[rule.TargetID]
+			if !ok {
+				t.Errorf("Rule for path %s points at unknown target %d", rule.Path, rule.TargetID)
+				continue
+			}
+			out[rule.Path] = fmt.Sprintf("%s:%d", target.IP, target.Port)
+		}
+		return out
+	}
+
+	if got := len(fakePangolin.Targets(id)); got != 3 {
+		t.Errorf("Expected 3 targets, got %d", got)
+	}
+	rules := fakePangolin.Rules(id)
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+	expectedOrder := []string{"/healthz", "/api", "/"}
+	for i, rule := range rules {
+		if rule.Path != expectedOrder[i] {
+			t.Errorf("Expected rule %d to match %s, got %s", i+1, expectedOrder[i], rule.Path)
+		}
+	}
+	if rules[0].PathMatchType != "exact" || rules[1].PathMatchType != "prefix" {
+		t.Errorf("Expected exact and prefix match types, got %q and %q", rules[0].PathMatchType, rules[1].PathMatchType)
+	}
+	expectedLinkage := map[string]string{
+		"/":        "web.default.svc.cluster.local:80",
+		"/api":     "api.default.svc.cluster.local:8080",
+		"/healthz": "health.default.svc.cluster.local:8081",
+	}
+	if got := linkage(); !reflect.DeepEqual(got, expectedLinkage) {
+		t.Errorf("Expected rule linkage %v, got %v", expectedLinkage, got)
+	}
+
+	// Removing a path removes its rule and target
+	updated.Spec.Rules[0].HTTP.Paths = updated.Spec.Rules[0].HTTP.Paths[:2]
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	delete(expectedLinkage, "/healthz")
+	if got := linkage(); !reflect.DeepEqual(got, expectedLinkage) {
+		t.Errorf("Expected rule linkage %v after removing a path, got %v", expectedLinkage, got)
+	}
+	if got := len(fakePangolin.Targets(id)); got != 2 {
+		t.Errorf("Expected 2 targets after removing a path, got %d", got)
+	}
+}
+
+func TestIngressReconciler_exactTrailingSlash(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		expected []string
+	}{
+		{name: "preserved by default", expected: []string{"/docs", "/api/"}},
+		{name: "preserve", mode: "preserve", expected: []string{"/docs", "/api/"}},
+		{name: "strip", mode: "strip", expected: []string{"/docs", "/api"}},
+		{name: "append", mode: "Append", expected: []string{"/docs/", "/api/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("exact", "app.example.com", "web", 80)
+			if tt.mode != "" {
+				ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/exact-trailing-slash": tt.mode}
+			}
+			pathTypeExact := networkingv1.PathTypeExact
+			base := ingress.Spec.Rules[0].HTTP.Paths[0]
+			base.PathType = &pathTypeExact
+			docs, api := base, base
+			docs.Path = "/docs"
+			api.Path = "/api/"
+			ingress.Spec.Rules[0].HTTP.Paths = []networkingv1.HTTPIngressPath{docs, api}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("web", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+
+			var rulePaths []string
+			for _, rule := range fakePangolin.Rules(id) {
+				if rule.PathMatchType != "exact" {
+					t.Errorf("Expected an exact rule for %s, got %q", rule.Path, rule.PathMatchType)
+				}
+				rulePaths = append(rulePaths, rule.Path)
+			}
+			if !reflect.DeepEqual(rulePaths, tt.expected) {
+				t.Errorf("Expected rule paths %v, got %v", tt.expected, rulePaths)
+			}
+			targetPaths := make(map[string]bool)
+			for _, target := range fakePangolin.Targets(id) {
+				targetPaths[target.Path] = true
+			}
+			for _, path := range tt.expected {
+				if !targetPaths[path] {
+					t.Errorf("Expected a target for path %s, got %v", path, targetPaths)
+				}
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_duplicatePaths(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          string
+		expectedService string
+	}{
+		{name: "first wins by default", expectedService: "web"},
+		{name: "first wins", policy: duplicatePathFirstWins, expectedService: "web"},
+		{name: "last wins", policy: duplicatePathLastWins, expectedService: "api"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			// The second rule repeats the host and routes / to another service
+			ingress := newTestIngress("dup", "app.example.com", "web", 80)
+			other := newTestIngress("dup", "app.example.com", "api", 80)
+			ingress.Spec.Rules = append(ingress.Spec.Rules, other.Spec.Rules[0])
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:              fakeClient,
+				Scheme:              scheme,
+				IngressClass:        "pangolin",
+				PangolinClient:      fakePangolin.client(),
+				OrgID:               fakeOrgID,
+				SiteNiceID:          fakeSiteNiceID,
+				Recorder:            recorder,
+				DuplicatePathPolicy: tt.policy,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 {
+				t.Fatalf("Expected one target for the duplicate path, got %+v", targets)
+			}
+			if !strings.HasPrefix(targets[0].IP, tt.expectedService+".") {
+				t.Errorf("Expected the target to route to %s, got %s", tt.expectedService, targets[0].IP)
+			}
+			if rules := fakePangolin.Rules(id); len(rules) > 1 {
+				t.Errorf("Expected at most one rule for the duplicate path, got %+v", rules)
+			}
+
+			var warned bool
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.Contains(event, "Warning DuplicatePath") {
+					warned = true
+				}
+			}
+			if !warned {
+				t.Error("Expected a DuplicatePath warning event")
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_hostlessRule(t *testing.T) {
+	tests := []struct {
+		name              string
+		defaultDomain     string
+		expectedSubdomain string
+	}{
+		{name: "skipped without default domain"},
+		{name: "routed to default domain", defaultDomain: "default.example.com", expectedSubdomain: "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("hostless", "", "app-service", 80)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				DefaultDomain:  tt.defaultDomain,
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			rawID := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]
+
+			if tt.defaultDomain == "" {
+				if rawID != "" {
+					t.Errorf("Expected no resource for a host-less rule, got %s", rawID)
+				}
+				return
+			}
+			id, err := strconv.Atoi(rawID)
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			res := fakePangolin.Resource(id)
+			if res == nil || res.Subdomain != tt.expectedSubdomain || res.DomainID != "domain-1" {
+				t.Errorf("Expected default resource %s.example.com, got %+v", tt.expectedSubdomain, res)
+			}
+			if got := len(fakePangolin.Targets(id)); got != 1 {
+				t.Errorf("Expected 1 target on the default resource, got %d", got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_nilPathType(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("untyped", "app.example.com", "app-service", 80)
+	paths := ingress.Spec.Rules[0].HTTP.Paths
+	paths[0].PathType = nil
+	// A resource backend has no Service and is skipped
+	apiGroup := "example.com"
+	paths = append(paths, networkingv1.HTTPIngressPath{
+		Path: "/static",
+		Backend: networkingv1.IngressBackend{
+			Resource: &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: "Bucket", Name: "assets"},
+		},
+	})
+	ingress.Spec.Rules[0].HTTP.Paths = paths
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 {
+		t.Fatalf("Expected 1 target for the service path, got %d", len(targets))
+	}
+	if targets[0].PathMatchType != "regex" {
+		t.Errorf("Expected a path without PathType to be matched like ImplementationSpecific, got %q", targets[0].PathMatchType)
+	}
+}
+
+func TestIngressReconciler_rateLimit(t *testing.T) {
+	tests := []struct {
+		name              string
+		annotations       map[string]string
+		expectedRateLimit *pangolin.RateLimit
+		expectInvalid     bool
+	}{
+		{
+			name: "no rate limit",
+		},
+		{
+			name:              "rps only",
+			annotations:       map[string]string{"pangolin.ingress.k8s.io/rate-limit-rps": "50"},
+			expectedRateLimit: &pangolin.RateLimit{RequestsPerSecond: 50},
+		},
+		{
+			name: "rps and burst",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/rate-limit-rps":   "50",
+				"pangolin.ingress.k8s.io/rate-limit-burst": "100",
+			},
+			expectedRateLimit: &pangolin.RateLimit{RequestsPerSecond: 50, Burst: 100},
+		},
+		{
+			name:          "non-numeric rps",
+			annotations:   map[string]string{"pangolin.ingress.k8s.io/rate-limit-rps": "fast"},
+			expectInvalid: true,
+		},
+		{
+			name:          "zero rps",
+			annotations:   map[string]string{"pangolin.ingress.k8s.io/rate-limit-rps": "0"},
+			expectInvalid: true,
+		},
+		{
+			name: "negative burst",
+			annotations: map[string]string{
+				"pangolin.ingress.k8s.io/rate-limit-rps":   "50",
+				"pangolin.ingress.k8s.io/rate-limit-burst": "-1",
+			},
+			expectInvalid: true,
+		},
+		{
+			name:          "burst without rps",
+			annotations:   map[string]string{"pangolin.ingress.k8s.io/rate-limit-burst": "10"},
+			expectInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("limited", "app.example.com", "app-service", 80)
+			ingress.Annotations = tt.annotations
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			result, err := reconciler.Reconcile(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.expectInvalid {
+				if result.Requeue || result.RequeueAfter != 0 {
+					t.Errorf("Expected no requeue for invalid annotations, got %+v", result)
+				}
+				if got := fakePangolin.Count("PUT", "/resource"); got != 0 {
+					t.Errorf("Expected no resource to be created, got %d creates", got)
+				}
+				select {
+				case e := <-recorder.Events:
+					if !strings.Contains(e, "InvalidAnnotation") {
+						t.Errorf("Expected InvalidAnnotation event, got %q", e)
+					}
+				default:
+					t.Errorf("Expected an InvalidAnnotation event")
+				}
+				return
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			if got := fakePangolin.Resource(id).RateLimit; !reflect.DeepEqual(got, tt.expectedRateLimit) {
+				t.Errorf("Expected rate limit %+v, got %+v", tt.expectedRateLimit, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_targetDrain(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("draining", "app.example.com", "web", 80)
+	api := ingress.Spec.Rules[0].HTTP.Paths[0]
+	api.Path = "/api"
+	api.Backend.Service = &networkingv1.IngressServiceBackend{
+		Name: "api",
+		Port: networkingv1.ServiceBackendPort{Number: 8080},
+	}
+	ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, api)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	drainPeriod := time.Minute
+	reconciler := &IngressReconciler{
+		Client:            fakeClient,
+		Scheme:            scheme,
+		IngressClass:      "pangolin",
+		PangolinClient:    fakePangolin.client(),
+		OrgID:             fakeOrgID,
+		SiteNiceID:        fakeSiteNiceID,
+		TargetDrainPeriod: drainPeriod,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("Expected no requeue without draining targets, got %v", result.RequeueAfter)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	apiTarget := func() *pangolin.Target {
+		for _, target := range fakePangolin.Targets(id) {
+			if target.Port == 8080 {
+				return &target
+			}
+		}
+		return nil
+	}
+	target := apiTarget()
+	if target == nil {
+		t.Fatalf("Expected a target for the api path")
+	}
+	if got := target.Metadata["kubernetes.ingress"]; got != "default/draining" {
+		t.Errorf("Expected target to record its Ingress, got %q", got)
+	}
+
+	// Remove the api path: its target is drained instead of deleted
+	updated.Spec.Rules[0].HTTP.Paths = updated.Spec.Rules[0].HTTP.Paths[:1]
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	result, err = reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != drainPeriod {
+		t.Errorf("Expected requeue after the drain period %v, got %v", drainPeriod, result.RequeueAfter)
+	}
+	target = apiTarget()
+	if target == nil {
+		t.Fatalf("Expected the api target to be kept while draining")
+	}
+	if target.Weight != 0 {
+		t.Errorf("Expected draining target to have weight 0, got %d", target.Weight)
+	}
+	if _, ok := target.Metadata["kubernetes.drain-started"]; !ok {
+		t.Errorf("Expected drain start in target metadata, got %v", target.Metadata)
+	}
+	if got := target.Metadata["kubernetes.ingress"]; got != "default/draining" {
+		t.Errorf("Expected draining target to keep its metadata, got %q", got)
+	}
+
+	// Reconciling again before the period has elapsed keeps waiting
+	result, err = reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter <= drainPeriod-5*time.Second || result.RequeueAfter > drainPeriod {
+		t.Errorf("Expected requeue after the remaining drain time, got %v", result.RequeueAfter)
+	}
+	if apiTarget() == nil {
+		t.Fatalf("Expected the api target to be kept until the drain period elapsed")
+	}
+	if got := fakePangolin.Count("DELETE", "/target/"+strconv.Itoa(target.ID)); got != 0 {
+		t.Errorf("Expected no target deletes while draining, got %d", got)
+	}
+
+	// Once the period has elapsed, the target is deleted
+	fakePangolin.SetTargetMetadata(target.ID, "kubernetes.drain-started",
+		time.Now().Add(-2*drainPeriod).UTC().Format(time.RFC3339))
+	result, err = reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("Expected no requeue after draining, got %v", result.RequeueAfter)
+	}
+	if apiTarget() != nil {
+		t.Errorf("Expected the drained api target to be deleted")
+	}
+	if got := len(fakePangolin.Targets(id)); got != 1 {
+		t.Errorf("Expected 1 remaining target, got %d", got)
+	}
+}
+
+func TestIngressReconciler_metadata(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("tagged", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/metadata": "team=payments,cost-center=42",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	expected := map[string]string{
+		"team":               "payments",
+		"cost-center":        "42",
+		"kubernetes.ingress": "default/tagged",
+	}
+	expectedResource := map[string]string{"kubernetes.owners": "default/tagged"}
+	for k, v := range expected {
+		expectedResource[k] = v
+	}
+	if got := fakePangolin.Resource(id).Metadata; !reflect.DeepEqual(got, expectedResource) {
+		t.Errorf("Expected resource metadata %v, got %v", expectedResource, got)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 {
+		t.Fatalf("Expected 1 target, got %d", len(targets))
+	}
+	if got := targets[0].Metadata; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected target metadata %v, got %v", expected, got)
+	}
+}
+
+func TestIngressReconciler_mirrorLabels(t *testing.T) {
+	labels := map[string]string{
+		"team":                      "payments",
+		"env":                       "prod",
+		"app.kubernetes.io/name":    "shop",
+		"app.kubernetes.io/part-of": "store",
+		"kubernetes.ingress":        "spoofed",
+	}
+
+	tests := []struct {
+		name         string
+		mirrorLabels []string
+		annotations  map[string]string
+		expected     map[string]string
+	}{
+		{
+			name:     "nothing mirrored by default",
+			expected: map[string]string{},
+		},
+		{
+			name:         "explicit keys",
+			mirrorLabels: []string{"team", "missing"},
+			expected:     map[string]string{"team": "payments"},
+		},
+		{
+			name:         "key prefix",
+			mirrorLabels: []string{"app.kubernetes.io/*"},
+			expected:     map[string]string{"app.kubernetes.io/name": "shop", "app.kubernetes.io/part-of": "store"},
+		},
+		{
+			name:         "reserved keys are skipped",
+			mirrorLabels: []string{"*"},
+			expected: map[string]string{
+				"team":                      "payments",
+				"env":                       "prod",
+				"app.kubernetes.io/name":    "shop",
+				"app.kubernetes.io/part-of": "store",
+			},
+		},
+		{
+			name:         "metadata annotation takes precedence",
+			mirrorLabels: []string{"team", "env"},
+			annotations:  map[string]string{"pangolin.ingress.k8s.io/metadata": "team=checkout"},
+			expected:     map[string]string{"team": "checkout", "env": "prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("shop", "shop.example.com", "shop-service", 80)
+			ingress.Labels = labels
+			ingress.Annotations = tt.annotations
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("shop-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+				MirrorLabels:   tt.mirrorLabels,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+
+			expected := map[string]string{"kubernetes.ingress": "default/shop"}
+			for k, v := range tt.expected {
+				expected[k] = v
+			}
+			expectedResource := map[string]string{"kubernetes.owners": "default/shop"}
+			for k, v := range expected {
+				expectedResource[k] = v
+			}
+			if got := fakePangolin.Resource(id).Metadata; !reflect.DeepEqual(got, expectedResource) {
+				t.Errorf("Expected resource metadata %v, got %v", expectedResource, got)
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 {
+				t.Fatalf("Expected 1 target, got %d", len(targets))
+			}
+			if got := targets[0].Metadata; !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected target metadata %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_webSocket(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{name: "disabled by default", expected: false},
+		{name: "enabled by annotation", annotations: map[string]string{"pangolin.ingress.k8s.io/websocket": "true"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("chat", "chat.example.com", "chat-service", 80)
+			ingress.Annotations = tt.annotations
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("chat-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			if got := fakePangolin.Resource(id).WebSocket; got != tt.expected {
+				t.Errorf("Expected websocket %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_lastSyncMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+	}{
+		{name: "set after a successful reconcile"},
+		{name: "disabled", disabled: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress(fmt.Sprintf("synced-%d", i), "app.example.com", "app-service", 80)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:                fakeClient,
+				Scheme:                scheme,
+				IngressClass:          "pangolin",
+				PangolinClient:        fakePangolin.client(),
+				OrgID:                 fakeOrgID,
+				SiteNiceID:            fakeSiteNiceID,
+				DisableIngressMetrics: tt.disabled,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			ctx := context.Background()
+
+			before := time.Now().Unix()
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.disabled {
+				if ingressLastSync.DeleteLabelValues(ingress.Namespace, ingress.Name) {
+					t.Error("Expected no last sync series while Ingress metrics are disabled")
+				}
+				return
+			}
+			if got := testutil.ToFloat64(ingressLastSync.WithLabelValues(ingress.Namespace, ingress.Name)); got < float64(before) {
+				t.Errorf("Expected the last sync timestamp to be at least %d, got %v", before, got)
+			}
+
+			// The series is removed with the Ingress
+			if err := fakeClient.Delete(ctx, ingress); err != nil {
+				t.Fatalf("Failed to delete ingress: %v", err)
+			}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ingressLastSync.DeleteLabelValues(ingress.Namespace, ingress.Name) {
+				t.Error("Expected the last sync series to be removed with the Ingress")
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_maintenance(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    string
+		expectedDelay time.Duration
+		expectError   bool
+	}{
+		{name: "maintenance window", retryAfter: "600", expectedDelay: 10 * time.Minute},
+		{name: "transient unavailability", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			fakePangolin.unavailable(http.MethodPut, tt.retryAfter)
+			ingress := newTestIngress("maintenance", "app.example.com", "app-service", 80)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			result, err := reconciler.Reconcile(context.Background(), req)
+			if tt.expectError != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if result.RequeueAfter != tt.expectedDelay {
+				t.Errorf("Expected requeue after %v, got %v", tt.expectedDelay, result.RequeueAfter)
+			}
+
+			dropFinalizerEvents(recorder)
+			select {
+			case event := <-recorder.Events:
+				if tt.expectError || !strings.Contains(event, "PangolinMaintenance") {
+					t.Errorf("Unexpected event %q", event)
+				}
+			default:
+				if !tt.expectError {
+					t.Error("Expected a PangolinMaintenance event, got none")
+				}
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_operationPending(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	fakePangolin.accepted = http.MethodPut
+	ingress := newTestIngress("async", "app.example.com", "app-service", 80)
+	// An earlier reconcile failed
+	lastError := "2024-05-01T10:30:00Z services \"app-service\" not found"
+	ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/last-error": lastError}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		Recorder:       recorder,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	// Without polling, the Ingress is requeued instead of failing
+	result, err := reconciler.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RequeueAfter != operationPendingRequeue {
+		t.Errorf("Expected requeue after %v, got %v", operationPendingRequeue, result.RequeueAfter)
+	}
+	if got := fakePangolin.Count(http.MethodGet, "/operation/1"); got != 0 {
+		t.Errorf("Expected the operation not to be polled, got %d polls", got)
+	}
+	// The pending write hasn't succeeded yet, so the last error is kept
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if got := updated.Annotations["pangolin.ingress.k8s.io/last-error"]; got != lastError {
+		t.Errorf("Expected the last-error annotation %q to be kept, got %q", lastError, got)
+	}
+
+	dropFinalizerEvents(recorder)
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "OperationPending") {
+			t.Errorf("Unexpected event %q", event)
+		}
+	default:
+		t.Error("Expected an OperationPending event, got none")
+	}
+}
+
+func TestIngressReconciler_requeueJitter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	fakePangolin.unavailable(http.MethodPut, "600")
+
+	const ingresses = 10
+	objs := []runtime.Object{newTestService("app-service", 80)}
+	for i := 0; i < ingresses; i++ {
+		objs = append(objs, newTestIngress(fmt.Sprintf("app-%d", i), fmt.Sprintf("app-%d.example.com", i), "app-service", 80))
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(objs...).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		RequeueJitter:  0.2,
+	}
+
+	// Every Ingress hits the same maintenance window, but they must not all
+	// come back at the same time
+	minDelay, maxDelay := 10*time.Minute, 12*time.Minute
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < ingresses; i++ {
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: fmt.Sprintf("app-%d", i), Namespace: "default"}}
+		result, err := reconciler.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.RequeueAfter < minDelay || result.RequeueAfter > maxDelay {
+			t.Errorf("Expected %s to be requeued after %v to %v, got %v", req.Name, minDelay, maxDelay, result.RequeueAfter)
+		}
+		delays[result.RequeueAfter] = true
+	}
+	if len(delays) < 2 {
+		t.Errorf("Expected jittered requeue delays, got %v for all Ingresses", delays)
+	}
+}
+
+func TestIngressReconciler_annotationRemovalReverts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("revert", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/enabled":           "false",
+		"pangolin.ingress.k8s.io/websocket":         "true",
+		"pangolin.ingress.k8s.io/forwarded-headers": "strip",
+		"pangolin.ingress.k8s.io/rate-limit-rps":    "50",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	res := fakePangolin.Resource(id)
+	if res.Enabled || !res.WebSocket || res.ForwardedHeaders != "strip" || res.RateLimit == nil {
+		t.Fatalf("Expected the annotations to be applied, got %+v", res)
+	}
+
+	// Removing the annotations reverts the settings to Pangolin's defaults
+	for _, name := range []string{"enabled", "websocket", "forwarded-headers", "rate-limit-rps"} {
+		delete(updated.Annotations, "pangolin.ingress.k8s.io/"+name)
+	}
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res = fakePangolin.Resource(id)
+	if !res.Enabled || res.WebSocket || res.ForwardedHeaders != "trust" || res.RateLimit != nil {
+		t.Errorf("Expected the settings to revert, got %+v", res)
+	}
+}
+
+func TestIngressReconciler_forwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		expected      string
+		expectInvalid bool
+	}{
+		{name: "trust by default", expected: "trust"},
+		{name: "trust", policy: "trust", expected: "trust"},
+		{name: "overwrite", policy: "overwrite", expected: "overwrite"},
+		{name: "strip", policy: "strip", expected: "strip"},
+		{name: "invalid policy", policy: "append", expectInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+			if tt.policy != "" {
+				ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/forwarded-headers": tt.policy}
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			if tt.expectInvalid {
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, "InvalidAnnotation") || !strings.Contains(event, "forwarded-headers") {
+						t.Errorf("Expected an InvalidAnnotation event for forwarded-headers, got %q", event)
+					}
+				default:
+					t.Error("Expected an InvalidAnnotation event")
+				}
+				if _, ok := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; ok {
+					t.Errorf("Expected no resource for an invalid policy")
+				}
+				return
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			if got := fakePangolin.Resource(id).ForwardedHeaders; got != tt.expected {
+				t.Errorf("Expected forwarded headers policy %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_responseHeaders(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("secure", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/response-headers": `{"Strict-Transport-Security":"max-age=63072000","X-Content-Type-Options":"nosniff"}`,
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	expected := map[string]string{
+		"Strict-Transport-Security": "max-age=63072000",
+		"X-Content-Type-Options":    "nosniff",
+	}
+	if got := fakePangolin.Resource(id).ResponseHeaders; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected response headers %v, got %v", expected, got)
+	}
+
+	// Removing the annotation clears the headers
+	delete(updated.Annotations, "pangolin.ingress.k8s.io/response-headers")
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Resource(id).ResponseHeaders; len(got) != 0 {
+		t.Errorf("Expected the response headers to be cleared, got %v", got)
+	}
+}
+
+func TestIngressReconciler_priority(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	plain := newTestIngress("plain", "app.example.com", "app-service", 80)
+	specific := newTestIngress("specific", "api.example.com", "app-service", 80)
+	specific.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/priority": "10",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(plain, specific, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		Recorder:       record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+
+	reconcile := func(ingress *networkingv1.Ingress) (*networkingv1.Ingress, int) {
+		t.Helper()
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+		if _, err := reconciler.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updated := &networkingv1.Ingress{}
+		if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+		if err != nil {
+			t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+		}
+		return updated, id
+	}
+
+	if _, id := reconcile(plain); fakePangolin.Resource(id).Priority != defaultResourcePriority {
+		t.Errorf("Expected the default priority %d without the annotation, got %d", defaultResourcePriority, fakePangolin.Resource(id).Priority)
+	}
+	updated, id := reconcile(specific)
+	if got := fakePangolin.Resource(id).Priority; got != 10 {
+		t.Errorf("Expected priority 10, got %d", got)
+	}
+
+	// Removing the annotation reverts to the default priority
+	delete(updated.Annotations, "pangolin.ingress.k8s.io/priority")
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	reconcile(updated)
+	if got := fakePangolin.Resource(id).Priority; got != defaultResourcePriority {
+		t.Errorf("Expected the priority to revert to %d, got %d", defaultResourcePriority, got)
+	}
+}
+
+func TestIngressReconciler_allowedMethods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("readonly", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/allowed-methods": "GET,HEAD",
+	}
+	invalid := newTestIngress("invalid", "other.example.com", "app-service", 80)
+	invalid.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/allowed-methods": "GET,BREW",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, invalid, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		Recorder:       recorder,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	if got := fakePangolin.Resource(id).AllowedMethods; !reflect.DeepEqual(got, []string{"GET", "HEAD"}) {
+		t.Errorf("Expected allowed methods [GET HEAD], got %v", got)
+	}
+
+	// Removing the annotation allows all methods again
+	delete(updated.Annotations, "pangolin.ingress.k8s.io/allowed-methods")
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Resource(id).AllowedMethods; len(got) != 0 {
+		t.Errorf("Expected the allowed methods to be cleared, got %v", got)
+	}
+
+	// An unknown method is rejected without creating anything
+	creates := fakePangolin.Count(http.MethodPut, "/resource")
+	invalidReq := ctrl.Request{NamespacedName: types.NamespacedName{Name: invalid.Name, Namespace: invalid.Namespace}}
+	_, _ = reconciler.Reconcile(ctx, invalidReq)
+	if got := fakePangolin.Count(http.MethodPut, "/resource"); got != creates {
+		t.Errorf("Expected no resource to be created for an unknown method, got %d creates", got-creates)
+	}
+	found := false
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, `unknown HTTP method "BREW"`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected an event naming the unknown method")
+	}
+}
+
+func TestIngressReconciler_accessCIDRs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("office", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/allow-cidrs": "10.0.0.0/8,192.168.0.0/16",
+		"pangolin.ingress.k8s.io/deny-cidrs":  "10.0.13.0/24",
+	}
+	invalid := newTestIngress("invalid", "other.example.com", "app-service", 80)
+	invalid.Annotations = map[string]string{
+		"pangolin.ingress.k8s.io/allow-cidrs": "10.0.0.0/8,office",
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, invalid, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+		Recorder:       recorder,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	res := fakePangolin.Resource(id)
+	if !reflect.DeepEqual(res.AllowCIDRs, []string{"10.0.0.0/8", "192.168.0.0/16"}) || !reflect.DeepEqual(res.DenyCIDRs, []string{"10.0.13.0/24"}) {
+		t.Errorf("Expected allow [10.0.0.0/8 192.168.0.0/16] and deny [10.0.13.0/24], got allow %v and deny %v", res.AllowCIDRs, res.DenyCIDRs)
+	}
+
+	// Removing the annotations lets every client through again
+	delete(updated.Annotations, "pangolin.ingress.k8s.io/allow-cidrs")
+	delete(updated.Annotations, "pangolin.ingress.k8s.io/deny-cidrs")
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res := fakePangolin.Resource(id); len(res.AllowCIDRs) != 0 || len(res.DenyCIDRs) != 0 {
+		t.Errorf("Expected the CIDR lists to be cleared, got allow %v and deny %v", res.AllowCIDRs, res.DenyCIDRs)
+	}
+
+	// A malformed CIDR is rejected without creating anything
+	creates := fakePangolin.Count(http.MethodPut, "/resource")
+	invalidReq := ctrl.Request{NamespacedName: types.NamespacedName{Name: invalid.Name, Namespace: invalid.Namespace}}
+	_, _ = reconciler.Reconcile(ctx, invalidReq)
+	if got := fakePangolin.Count(http.MethodPut, "/resource"); got != creates {
+		t.Errorf("Expected no resource to be created for a malformed CIDR, got %d creates", got-creates)
+	}
+}
+func TestIngressReconciler_targetWeight(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("weighted", "app.example.com", "app-service", 80)
+	ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/target-weight": "50"}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Weight != 50 {
+		t.Fatalf("Expected a single target with weight 50, got %+v", targets)
+	}
+	targetID := targets[0].ID
+
+	// Changing only the weight updates the target in place
+	updated.Annotations["pangolin.ingress.k8s.io/target-weight"] = "80"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update ingress: %v", err)
+	}
+	updates := fakePangolin.Count(http.MethodPost, fmt.Sprintf("/target/%d", targetID))
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	targets = fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].ID != targetID || targets[0].Weight != 80 {
+		t.Errorf("Expected target %d to have weight 80, got %+v", targetID, targets)
+	}
+	if got := fakePangolin.Count(http.MethodPost, fmt.Sprintf("/target/%d", targetID)) - updates; got != 1 {
+		t.Errorf("Expected 1 target update, got %d", got)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/target"); got != 1 {
+		t.Errorf("Expected the target to be created only once, got %d creates", got)
+	}
+	if got := fakePangolin.Count(http.MethodDelete, "/target/"+strconv.Itoa(targetID)); got != 0 {
+		t.Errorf("Expected the target not to be deleted, got %d deletes", got)
+	}
+}
+
+func TestIngressReconciler_defaultTargetWeight(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultWeight int
+		annotation    string
+		expected      int
+	}{
+		{name: "built-in default", expected: 100},
+		{name: "controller default", defaultWeight: 250, expected: 250},
+		{name: "annotation overrides the controller default", defaultWeight: 250, annotation: "50", expected: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("weighted", "app.example.com", "app-service", 80)
+			if tt.annotation != "" {
+				ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/target-weight": tt.annotation}
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:              fakeClient,
+				Scheme:              scheme,
+				IngressClass:        "pangolin",
+				PangolinClient:      fakePangolin.client(),
+				OrgID:               fakeOrgID,
+				SiteNiceID:          fakeSiteNiceID,
+				DefaultTargetWeight: tt.defaultWeight,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+			ctx := context.Background()
+
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 || targets[0].Weight != tt.expected {
+				t.Errorf("Expected a single target with weight %d, got %+v", tt.expected, targets)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_namedPortDuringRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("named", "app.example.com", "app-service", 0)
+	ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+	service := newTestService("app-service", 8080)
+	service.Spec.Ports[0].Name = "http"
+
+	reconciler := &IngressReconciler{
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, service).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		WithIndex(&networkingv1.Ingress{}, backendServiceIndex, reconciler.ingressBackendServices).
+		Build()
+	reconciler.Client = fakeClient
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+	ctx := context.Background()
+	// setPorts updates the Service and reconciles the Ingress only through
+	// the Service watch, as the manager would
+	setPorts := func(ports ...corev1.ServicePort) {
+		t.Helper()
+		current := &corev1.Service{}
+		if err := fakeClient.Get(ctx, types.NamespacedName{Name: "app-service", Namespace: "default"}, current); err != nil {
+			t.Fatalf("Failed to get service: %v", err)
+		}
+		old := current.DeepCopy()
+		current.Spec.Ports = ports
+		if err := fakeClient.Update(ctx, current); err != nil {
+			t.Fatalf("Failed to update service: %v", err)
+		}
+		if !(servicePortsChangedPredicate{}).Update(event.UpdateEvent{ObjectOld: old, ObjectNew: current}) {
+			t.Fatalf("Expected the port change to pass the Service watch")
+		}
+		requests := reconciler.ingressesForService(ctx, current)
+		if len(requests) != 1 || requests[0] != req {
+			t.Fatalf("Expected the port change to enqueue %v, got %v", req, requests)
+		}
+		if _, err := reconciler.Reconcile(ctx, requests[0]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Port != 8080 || targets[0].Metadata["kubernetes.named-port"] != "http=8080" {
+		t.Fatalf("Expected a single target on port 8080 recording the named port, got %+v", targets)
+	}
+	targetID := targets[0].ID
+
+	// While the named port is missing, the last known number is kept
+	setPorts(corev1.ServicePort{Name: "metrics", Port: 9090})
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Expected the last known port to be used, got %v", err)
+			}
+		}
+		targets = fakePangolin.Targets(id)
+		if len(targets) != 1 || targets[0].ID != targetID || targets[0].Port != 8080 {
+			t.Fatalf("Expected target %d to stay on port 8080, got %+v", targetID, targets)
+		}
+	}
+	if got := fakePangolin.Count(http.MethodDelete, "/target/"+strconv.Itoa(targetID)); got != 0 {
+		t.Errorf("Expected the target not to be deleted, got %d deletes", got)
+	}
+
+	// Once the port reappears with a new number, the target follows it
+	setPorts(corev1.ServicePort{Name: "http", Port: 8081})
+	targets = fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Port != 8081 || targets[0].Metadata["kubernetes.named-port"] != "http=8081" {
+		t.Errorf("Expected a single target on port 8081, got %+v", targets)
+	}
+}
+
+func TestIngressReconciler_namedPortMissing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("named", "app.example.com", "app-service", 0)
+	ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	// Without a previously resolved port there is nothing to fall back to
+	_, err := reconciler.Reconcile(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "could not determine service port") {
+		t.Fatalf("Expected an unresolved port error, got %v", err)
+	}
+	if got := fakePangolin.Count(http.MethodPut, "/resource"); got != 0 {
+		t.Errorf("Expected no resource to be created, got %d creates", got)
+	}
+}
+
+func TestIngressReconciler_servicePortValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		port          networkingv1.ServiceBackendPort
+		expectedPort  int
+		expectedEvent string
+	}{
+		{name: "valid numeric port", port: networkingv1.ServiceBackendPort{Number: 8080}, expectedPort: 8080},
+		{name: "invalid numeric port", port: networkingv1.ServiceBackendPort{Number: 9090}, expectedEvent: "Warning InvalidServicePort Service default/app-service has no port 9090, skipping path /"},
+		{name: "named port", port: networkingv1.ServiceBackendPort{Name: "http"}, expectedPort: 8080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("ports", "app.example.com", "app-service", 0)
+			ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = tt.port
+			service := newTestService("app-service", 8080)
+			service.Spec.Ports[0].Name = "http"
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, service).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var ports []int
+			for _, target := range fakePangolin.allTargets() {
+				ports = append(ports, target.Port)
+			}
+			if tt.expectedPort == 0 && len(ports) != 0 {
+				t.Errorf("Expected no targets, got ports %v", ports)
+			}
+			if tt.expectedPort != 0 && !reflect.DeepEqual(ports, []int{tt.expectedPort}) {
+				t.Errorf("Expected a target on port %d, got ports %v", tt.expectedPort, ports)
+			}
+
+			dropFinalizerEvents(recorder)
+			select {
+			case event := <-recorder.Events:
+				if event != tt.expectedEvent {
+					t.Errorf("Expected event %q, got %q", tt.expectedEvent, event)
+				}
+			default:
+				if tt.expectedEvent != "" {
+					t.Errorf("Expected event %q, got none", tt.expectedEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveServicePort(t *testing.T) {
+	service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "http", Port: 8080},
+		{Name: "metrics", Port: 9090},
+	}}}
+
+	tests := []struct {
+		name         string
+		port         networkingv1.ServiceBackendPort
+		expectedPort int32
+		expectedName string
+	}{
+		{name: "numeric", port: networkingv1.ServiceBackendPort{Number: 9090}, expectedPort: 9090},
+		{name: "named", port: networkingv1.ServiceBackendPort{Name: "http"}, expectedPort: 8080, expectedName: "http"},
+		{name: "number takes precedence", port: networkingv1.ServiceBackendPort{Name: "http", Number: 9090}, expectedPort: 9090},
+		{name: "undeclared name", port: networkingv1.ServiceBackendPort{Name: "grpc"}, expectedName: "grpc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, name := resolveServicePort(service, tt.port)
+			if port != tt.expectedPort || name != tt.expectedName {
+				t.Errorf("Expected port %d (%q), got %d (%q)", tt.expectedPort, tt.expectedName, port, name)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_targetAddress(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+	}{
+		{name: "cluster DNS name by default", expected: "app-service.default.svc.cluster.local"},
+		{
+			name:        "overridden by annotation",
+			annotations: map[string]string{"pangolin.ingress.k8s.io/target-address": "10.0.0.12"},
+			expected:    "10.0.0.12",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+			ingress.Annotations = tt.annotations
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 || targets[0].IP != tt.expected || targets[0].Port != 80 {
+				t.Errorf("Expected a single target %s:80, got %+v", tt.expected, targets)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_serviceResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          string
+		headless      bool
+		externalName  bool
+		expectedError string
+	}{
+		{name: "any service without the annotation", headless: true},
+		{name: "cluster IP service", mode: "clusterip"},
+		{name: "headless service", mode: "headless", headless: true},
+		{name: "headless mode with a cluster IP service", mode: "headless", expectedError: "service resolution is headless, but Service default/app-service has a cluster IP"},
+		{name: "cluster IP mode with a headless service", mode: "clusterip", headless: true, expectedError: "service resolution is clusterip, but Service default/app-service is headless"},
+		{name: "cluster IP mode with an ExternalName service", mode: "clusterip", externalName: true, expectedError: "service resolution is clusterip, but Service default/app-service is of type ExternalName"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("app", "app.example.com", "app-service", 80)
+			if tt.mode != "" {
+				ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/service-resolution": tt.mode}
+			}
+			service := newTestService("app-service", 80)
+			if tt.headless {
+				service.Spec.ClusterIP = corev1.ClusterIPNone
+			}
+			if tt.externalName {
+				service.Spec.Type = corev1.ServiceTypeExternalName
+				service.Spec.ExternalName = "app.internal.example.com"
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, service).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &IngressReconciler{
+				Client:         fakeClient,
+				Scheme:         scheme,
+				Recorder:       recorder,
+				IngressClass:   "pangolin",
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+				SiteNiceID:     fakeSiteNiceID,
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			_, err := reconciler.Reconcile(context.Background(), req)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected error %q, got %v", tt.expectedError, err)
+				}
+				if targets := fakePangolin.allTargets(); len(targets) != 0 {
+					t.Errorf("Expected no targets, got %+v", targets)
+				}
+				dropFinalizerEvents(recorder)
+				expectedEvent := "Warning ServiceResolutionMismatch " + tt.expectedError
+				select {
+				case event := <-recorder.Events:
+					if event != expectedEvent {
+						t.Errorf("Expected event %q, got %q", expectedEvent, event)
+					}
+				default:
+					t.Errorf("Expected event %q, got none", expectedEvent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var targets []string
+			for _, target := range fakePangolin.allTargets() {
+				targets = append(targets, target.IP)
+			}
+			if !reflect.DeepEqual(targets, []string{"app-service.default.svc.cluster.local"}) {
+				t.Errorf("Expected a target for the cluster DNS name, got %v", targets)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_repeatedHost(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ingress := newTestIngress("split", "app.example.com", "web", 80)
+	base := ingress.Spec.Rules[0]
+	withPaths := func(paths ...networkingv1.HTTPIngressPath) networkingv1.IngressRule {
+		rule := base
+		rule.HTTP = &networkingv1.HTTPIngressRuleValue{Paths: paths}
+		return rule
+	}
+	backend := func(path, service string, port int32) networkingv1.HTTPIngressPath {
+		p := base.HTTP.Paths[0]
+		p.Path = path
+		p.Backend.Service = &networkingv1.IngressServiceBackend{
+			Name: service,
+			Port: networkingv1.ServiceBackendPort{Number: port},
+		}
+		return p
+	}
+	ingress.Spec.Rules = []networkingv1.IngressRule{
+		withPaths(backend("/", "web", 80)),
+		// The same host again, with a new path and a duplicate of "/"
+		withPaths(backend("/api", "api", 8080), backend("/", "api", 8080)),
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("web", 80), newTestService("api", 8080)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	for i := 0; i < 2; i++ {
+		if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if got := fakePangolin.Count("PUT", "/resource"); got != 1 {
+		t.Errorf("Expected a single resource for the repeated host, got %d creates", got)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	targets := make(map[int]pangolin.Target)
+	for _, target := range fakePangolin.Targets(id) {
+		targets[target.ID] = target
+	}
+	if len(targets) != 2 {
+		t.Errorf("Expected 2 targets, got %d", len(targets))
+	}
+	routes := make(map[string]int)
+	for _, rule := range fakePangolin.Rules(id) {
+		routes[rule.Path] = targets[rule.TargetID].Port
+	}
+	expected := map[string]int{"/": 80, "/api": 8080}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected routes %v, got %v", expected, routes)
+	}
+}
+
+func TestIngressReconciler_initPangolinClientSigning(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          map[string][]byte
+		expectedError string
+	}{
+		{
+			name: "api key and hmac key",
+			data: map[string][]byte{"api-key": []byte("test-key"), "hmac-key": []byte("test-secret")},
+		},
+		{
+			name: "hmac key only",
+			data: map[string][]byte{"hmac-key": []byte("test-secret")},
+		},
+		{
+			name:          "missing hmac key",
+			data:          map[string][]byte{"api-key": []byte("test-key")},
+			expectedError: "hmac-key not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signature string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				signature = r.Header.Get(pangolin.HMACSignatureHeader)
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/v1/api-key/info" {
+					_, _ = w.Write([]byte(`{"data":{"orgId":"test-org","scopes":["resource:write","target:write"]}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+			}))
+			defer server.Close()
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "pangolin-api-key", Namespace: "pangolin-system"},
+				Data:       tt.data,
+			}
+			reconciler := &IngressReconciler{
+				Client:          fake.NewClientBuilder().WithObjects(secret).Build(),
+				PangolinBaseURL: server.URL,
+				APIKeySecret:    secret.Name,
+				APIKeyNamespace: secret.Namespace,
+				RequestSigning:  "hmac-sha256",
+				OrgID:           fakeOrgID,
+			}
+
+			err := reconciler.initPangolinClient(context.Background())
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if _, err := reconciler.PangolinClient.ListSites(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if signature == "" {
+				t.Errorf("Expected requests to be signed")
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_verifyAPIKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokenInfo     *pangolin.TokenInfo
+		expectedError string
+	}{
+		{
+			name:      "sufficient scopes",
+			tokenInfo: &pangolin.TokenInfo{OrgID: fakeOrgID, Scopes: []string{"resource:write", "target:write", "site:read"}},
+		},
+		{
+			name:          "insufficient scopes",
+			tokenInfo:     &pangolin.TokenInfo{OrgID: fakeOrgID, Scopes: []string{"resource:read", "target:write"}},
+			expectedError: "API key is missing required scopes: resource:write",
+		},
+		{
+			name:          "other organization",
+			tokenInfo:     &pangolin.TokenInfo{OrgID: "other-org", Scopes: []string{"resource:write", "target:write"}},
+			expectedError: `API key belongs to organization "other-org"`,
+		},
+		{
+			name: "key info not supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePangolin := newFakePangolin(t)
+			fakePangolin.SetTokenInfo(tt.tokenInfo)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "pangolin-api-key", Namespace: "pangolin-system"},
+				Data:       map[string][]byte{"api-key": []byte("test-key")},
+			}
+			reconciler := &IngressReconciler{
+				Client:          fake.NewClientBuilder().WithObjects(secret).Build(),
+				PangolinBaseURL: fakePangolin.URL,
+				APIKeySecret:    secret.Name,
+				APIKeyNamespace: secret.Namespace,
+				OrgID:           fakeOrgID,
+			}
+
+			err := reconciler.initPangolinClient(context.Background())
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if reconciler.PangolinClient != nil {
+					t.Errorf("Expected no client to be kept for a rejected API key")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if reconciler.PangolinClient == nil {
+				t.Errorf("Expected the client to be initialized")
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_resourceName(t *testing.T) {
+	r := &IngressReconciler{ResourcePrefix: "k8s"}
+	app := newTestIngress("app", "app.example.com", "app-service", 80)
+	other := newTestIngress("app", "app.example.com", "app-service", 80)
+	other.Namespace = "staging"
+
+	name := r.resourceName(app, "app.example.com")
+	if !strings.HasPrefix(name, "k8s-app.example.com-") {
+		t.Errorf("Expected name to start with the prefix and host, got %q", name)
+	}
+	if again := r.resourceName(app.DeepCopy(), "app.example.com"); again != name {
+		t.Errorf("Expected a stable name, got %q and %q", name, again)
+	}
+	if got := r.resourceName(other, "app.example.com"); got == name {
+		t.Errorf("Expected Ingresses in different namespaces to get different names, both got %q", got)
+	}
+	if got := r.resourceName(app, "api.example.com"); got == name {
+		t.Errorf("Expected different hosts to get different names, both got %q", got)
+	}
+
+	// Names stay the same across reconciles of an unchanged Ingress
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	fakePangolin := newFakePangolin(t)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(app, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		IngressClass:   "pangolin",
+		ResourcePrefix: "k8s",
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: app.Name, Namespace: app.Namespace}}
+	for i := 0; i < 2; i++ {
+		if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updated := &networkingv1.Ingress{}
+		if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+		if err != nil {
+			t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+		}
+		if got := fakePangolin.Resource(id).Name; got != name {
+			t.Errorf("Reconcile %d: expected resource name %q, got %q", i+1, name, got)
+		}
+	}
+}
+
+func TestIngressReconciler_maxResources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	ctx := context.Background()
+	// One resource managed by the controller and one created by someone else
+	for _, name := range []string{"pangolin-controller-existing.example.com", "manual"} {
+		if _, err := fakePangolin.client().CreateResource(ctx, &pangolin.CreateResourceRequest{Name: name, Protocol: "tcp"}); err != nil {
+			t.Fatalf("Failed to create resource: %v", err)
+		}
+	}
+
+	ingress := newTestIngress("limited", "app.example.com", "app-service", 80)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &IngressReconciler{
+		Client:         fakeClient,
+		Scheme:         scheme,
+		Recorder:       recorder,
+		IngressClass:   "pangolin",
+		MaxResources:   1,
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+		SiteNiceID:     fakeSiteNiceID,
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+	_, err := reconciler.Reconcile(ctx, req)
+	if err == nil || !strings.Contains(err.Error(), "limit is 1") {
+		t.Fatalf("Expected resource limit error, got %v", err)
+	}
+	if got := fakePangolin.Count("PUT", "/resource"); got != 2 {
+		t.Errorf("Expected no resource to be created beyond the limit, got %d creates", got)
+	}
+	if got := testutil.ToFloat64(managedResources); got != 1 {
+		t.Errorf("Expected 1 managed resource to be counted, got %v", got)
+	}
+	dropFinalizerEvents(recorder)
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, "ResourceLimitReached") {
+			t.Errorf("Expected ResourceLimitReached event, got %q", e)
+		}
+	default:
+		t.Errorf("Expected a ResourceLimitReached event")
+	}
+
+	// Raising the limit lets the resource be created
+	reconciler.MaxResources = 2
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count("PUT", "/resource"); got != 3 {
+		t.Errorf("Expected the resource to be created below the limit, got %d creates", got)
+	}
+}
+
+func TestIngressReconciler_minReconcileInterval(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	web := newTestIngress("web", "web.example.com", "web-service", 80)
+	api := newTestIngress("api", "api.example.com", "web-service", 80)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(web, api, newTestService("web-service", 80)).
+		WithStatusSubresource(&networkingv1.Ingress{}).
+		Build()
+	reconciler := &IngressReconciler{
+		Client:               fakeClient,
+		Scheme:               scheme,
+		IngressClass:         "pangolin",
+		PangolinClient:       fakePangolin.client(),
+		OrgID:                fakeOrgID,
+		SiteNiceID:           fakeSiteNiceID,
+		MinReconcileInterval: time.Hour,
+	}
+	ctx := context.Background()
+	webKey := types.NamespacedName{Name: "web", Namespace: "default"}
+	apiKey := types.NamespacedName{Name: "api", Namespace: "default"}
+
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: webKey}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &networkingv1.Ingress{}
+	if err := fakeClient.Get(ctx, webKey, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	resourcePath := "/v1/resource/" + updated.Annotations["pangolin.ingress.k8s.io/resource-id"]
+	writes := fakePangolin.Count("POST", resourcePath)
+
+	// Another controller toggles an annotation over and over
+	for i := 0; i < 5; i++ {
+		if err := fakeClient.Get(ctx, webKey, updated); err != nil {
+			t.Fatalf("Failed to get ingress: %v", err)
+		}
+		updated.Annotations["pangolin.ingress.k8s.io/sticky-session"] = strconv.FormatBool(i%2 == 0)
+		if err := fakeClient.Update(ctx, updated); err != nil {
+			t.Fatalf("Failed to update ingress: %v", err)
+		}
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: webKey})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+			t.Errorf("Expected the reconcile to be postponed by up to 1h, got %v", result.RequeueAfter)
+		}
+	}
+	if got := fakePangolin.Count("POST", resourcePath); got != writes {
+		t.Errorf("Expected no resource updates within the interval, got %d", got-writes)
+	}
+
+	// The limit is per Ingress
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: apiKey}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := fakeClient.Get(ctx, apiKey, updated); err != nil {
+		t.Fatalf("Failed to get ingress: %v", err)
+	}
+	if updated.Annotations["pangolin.ingress.k8s.io/resource-id"] == "" {
+		t.Errorf("Expected the other Ingress to be reconciled, got annotations %v", updated.Annotations)
+	}
+
+	// Once the interval has passed, the edits collapse into one update
+	reconciler.throttleMu.Lock()
+	reconciler.lastReconciles[webKey] = time.Now().Add(-time.Hour)
+	reconciler.throttleMu.Unlock()
+	if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: webKey}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count("POST", resourcePath); got != writes+1 {
+		t.Errorf("Expected a single resource update after the interval, got %d", got-writes)
+	}
+}
+
+func TestIngressReconciler_resourceIDsPerHost(t *testing.T) {
+	tests := []struct {
+		name string
+		// legacyHost, if set, gets a resource recorded in the resource-id
+		// annotation only, like before IDs were recorded per host
+		legacyHost string
+	}{
+		{name: "new Ingress"},
+		{name: "legacy annotation of the second host", legacyHost: "web.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			ingress := newTestIngress("multi", "api.example.com", "app-service", 80)
+			webRule := *ingress.Spec.Rules[0].DeepCopy()
+			webRule.Host = "web.example.com"
+			ingress.Spec.Rules = append(ingress.Spec.Rules, webRule)
+
+			reconciler := &IngressReconciler{
+				IngressClass: "pangolin",
+				OrgID:        fakeOrgID,
+				SiteNiceID:   fakeSiteNiceID,
+			}
+			legacyID := 0
+			if tt.legacyHost != "" {
+				res, err := fakePangolin.client().CreateResource(context.Background(), &pangolin.CreateResourceRequest{
+					Name:      reconciler.resourceName(ingress, tt.legacyHost),
+					Subdomain: "web",
+					HTTP:      true,
+					DomainID:  "domain-1",
+				})
+				if err != nil {
+					t.Fatalf("Failed to create legacy resource: %v", err)
+				}
+				legacyID = res.ID
+				ingress.Annotations = map[string]string{"pangolin.ingress.k8s.io/resource-id": strconv.Itoa(res.ID)}
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(ingress, newTestService("app-service", 80)).
+				WithStatusSubresource(&networkingv1.Ingress{}).
+				Build()
+			reconciler.Client = fakeClient
+			reconciler.Scheme = scheme
+			reconciler.PangolinClient = fakePangolin.client()
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}}
+
+			// Every reconcile must leave each host with its own resource
+			for i := 0; i < 2; i++ {
+				if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			updated := &networkingv1.Ingress{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get ingress: %v", err)
+			}
+			var ids map[string]string
+			if err := json.Unmarshal([]byte(updated.Annotations["pangolin.ingress.k8s.io/resource-ids"]), &ids); err != nil {
+				t.Fatalf("Expected a resource-ids annotation, got %v", updated.Annotations)
+			}
+			if len(ids) != 2 || ids["api.example.com"] == ids["web.example.com"] {
+				t.Fatalf("Expected distinct resources for both hosts, got %v", ids)
+			}
+			if got := updated.Annotations["pangolin.ingress.k8s.io/resource-id"]; got != ids["api.example.com"] {
+				t.Errorf("Expected resource-id to hold the resource of the first host %s, got %s", ids["api.example.com"], got)
+			}
+			if legacyID != 0 && ids["web.example.com"] != strconv.Itoa(legacyID) {
+				t.Errorf("Expected the legacy resource %d to stay with its host, got %v", legacyID, ids)
+			}
+			for host, rawID := range ids {
+				id, _ := strconv.Atoi(rawID)
+				res := fakePangolin.Resource(id)
+				if res == nil {
+					t.Fatalf("Expected resource %d of host %s to exist", id, host)
+				}
+				if subdomain, _ := parseHost(host); res.Subdomain != subdomain {
+					t.Errorf("Expected resource %d to serve %s, got subdomain %q", id, host, res.Subdomain)
+				}
+				if res.Name != reconciler.resourceName(ingress, host) {
+					t.Errorf("Expected resource %d to be named %q, got %q", id, reconciler.resourceName(ingress, host), res.Name)
+				}
+			}
+			count := len(fakePangolin.Resources())
+			if count != 2 {
+				t.Errorf("Expected 2 resources, got %d", count)
+			}
+		})
+	}
+}
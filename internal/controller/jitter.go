@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"math/rand"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// jitter returns d lengthened by a random amount of up to fraction of d, so
+// that objects failing at the same time, e.g. during a Pangolin outage, don't
+// all retry at the same time again. A non-positive fraction returns d
+// unchanged.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 || fraction <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Float64()*fraction*float64(d))
+}
+
+// jitteredRateLimiter applies jitter to the error backoff of a workqueue rate
+// limiter
+type jitteredRateLimiter struct {
+	workqueue.RateLimiter
+	fraction float64
+}
+
+// jitterRateLimiter wraps rl so that its delays are jittered by fraction. A
+// non-positive fraction returns rl unchanged.
+func jitterRateLimiter(rl workqueue.RateLimiter, fraction float64) workqueue.RateLimiter {
+	if fraction <= 0 {
+		return rl
+	}
+	return &jitteredRateLimiter{RateLimiter: rl, fraction: fraction}
+}
+
+func (l *jitteredRateLimiter) When(item interface{}) time.Duration {
+	return jitter(l.RateLimiter.When(item), l.fraction)
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestJitterRateLimiter(t *testing.T) {
+	base := 100 * time.Millisecond
+	rl := jitterRateLimiter(workqueue.NewItemExponentialFailureRateLimiter(base, time.Minute), 0.5)
+
+	// The backoff still doubles per failure, each step jittered by up to half
+	for i := 0; i < 5; i++ {
+		delay := rl.When("item")
+		min := base << i
+		if delay < min || delay > min+min/2 {
+			t.Errorf("Failure %d: expected a delay between %v and %v, got %v", i+1, min, min+min/2, delay)
+		}
+	}
+	if n := rl.NumRequeues("item"); n != 5 {
+		t.Errorf("Expected 5 requeues, got %d", n)
+	}
+	rl.Forget("item")
+	if n := rl.NumRequeues("item"); n != 0 {
+		t.Errorf("Expected requeues to be reset, got %d", n)
+	}
+
+	if unjittered := workqueue.NewItemExponentialFailureRateLimiter(base, time.Minute); jitterRateLimiter(unjittered, 0) != unjittered {
+		t.Error("Expected a zero fraction to keep the rate limiter")
+	}
+}
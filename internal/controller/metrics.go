@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// staleAnnotationTotal counts resource-id annotations found pointing at a
+	// Pangolin resource that no longer exists (e.g. deleted out-of-band)
+	staleAnnotationTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pangolin_stale_annotation_total",
+		Help: "Number of times a resource-id annotation referenced a nonexistent Pangolin resource",
+	})
+
+	// managedResources is the number of Pangolin resources carrying the
+	// controller's name prefix, as last counted before creating a resource
+	managedResources = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pangolin_managed_resources",
+		Help: "Number of Pangolin resources managed by the controller, as last counted before creating a resource",
+	})
+
+	// apiUp is 1 if the last periodic probe reached the Pangolin API and 0
+	// otherwise
+	apiUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pangolin_api_up",
+		Help: "Whether the last probe of the Pangolin API succeeded (1) or failed (0)",
+	})
+
+	// ingressLastSync is the time of the last successful reconcile of each
+	// Ingress. It has one series per managed Ingress and can be disabled with
+	// DisableIngressMetrics.
+	ingressLastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pangolin_ingress_last_sync_timestamp_seconds",
+		Help: "Unix time of the last successful reconcile of an Ingress",
+	}, []string{"namespace", "name"})
+
+	// finalizerOperationsTotal counts the finalizers the controller added to
+	// or removed from Ingresses and Services
+	finalizerOperationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pangolin_finalizer_operations_total",
+		Help: "Number of finalizers added to or removed from Ingresses and Services",
+	}, []string{"kind", "operation"})
+)
+
+// Values of the operation label of finalizerOperationsTotal
+const (
+	finalizerAdded   = "add"
+	finalizerRemoved = "remove"
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		staleAnnotationTotal,
+		managedResources,
+		apiUp,
+		ingressLastSync,
+		finalizerOperationsTotal,
+	)
+}
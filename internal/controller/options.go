@@ -0,0 +1,416 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+const (
+	defaultIngressClass   = "pangolin"
+	defaultResourcePrefix = "pangolin-controller"
+)
+
+// ReconcilerOptions configures an IngressReconciler created with
+// NewIngressReconciler. Zero values are replaced by their defaults.
+type ReconcilerOptions struct {
+	// Recorder emits Kubernetes events; optional
+	Recorder record.EventRecorder
+
+	// IngressClass is the IngressClass managed by the controller; defaults
+	// to pangolin
+	IngressClass string
+	// ControllerName, if set, must be the controller of the IngressClass for
+	// Ingresses selecting it through spec.ingressClassName to be managed
+	ControllerName string
+	// DisableLegacyIngressClassAnnotation ignores the kubernetes.io/ingress.class
+	// annotation when selecting Ingresses
+	DisableLegacyIngressClassAnnotation bool
+	// IngressLabelSelector restricts the managed Ingresses to those matching
+	// the label selector; optional
+	IngressLabelSelector string
+	// ResourcePrefix prefixes Pangolin resource names; defaults to
+	// pangolin-controller
+	ResourcePrefix string
+	// AnnotationPrefix is the prefix for all annotations read and written by
+	// the controller; defaults to pangolin.ingress.k8s.io
+	AnnotationPrefix string
+	// FinalizerName is the finalizer added to managed Ingresses; defaults to
+	// pangolin.ingress.k8s.io/finalizer
+	FinalizerName string
+	// TargetConcurrency bounds parallel target reconciliation per host;
+	// defaults to 4
+	TargetConcurrency int
+	// DefaultTargetWeight is the weight of targets of Ingresses without the
+	// target-weight annotation, 1 to 1000; defaults to 100
+	DefaultTargetWeight int
+	// DefaultDomain is the host that rules without a host are routed to;
+	// optional
+	DefaultDomain string
+	// MaxResources caps the number of Pangolin resources the controller
+	// creates; zero means no limit
+	MaxResources int
+	// TargetDrainPeriod is how long stale targets are drained before they
+	// are deleted; zero deletes them right away
+	TargetDrainPeriod time.Duration
+	// StatusPollInterval is the first delay before re-checking whether a
+	// resource has a proxy IP; defaults to 2s
+	StatusPollInterval time.Duration
+	// StatusPollTimeout bounds how long the controller waits for a proxy IP;
+	// defaults to 1m and must be greater than StatusPollInterval
+	StatusPollTimeout time.Duration
+	// ReconcileDebounce coalesces Ingress events within the delay into one
+	// reconcile; zero reconciles right away
+	ReconcileDebounce time.Duration
+	// MinReconcileInterval postpones reconciles of an Ingress until this
+	// long after its previous one; zero disables the limit
+	MinReconcileInterval time.Duration
+	// RequeueJitter lengthens requeue delays and error backoff by a random
+	// amount of up to this fraction, 0 to 1; zero disables the jitter
+	RequeueJitter float64
+
+	// PangolinClient is used as is when set; otherwise a client is created on
+	// first use from PangolinBaseURL and the API key secret
+	PangolinClient *pangolin.Client
+	// PangolinBaseURL is the Pangolin API base URL
+	PangolinBaseURL string
+	// MaxResponseBytes limits the size of Pangolin API responses; defaults to
+	// pangolin.DefaultMaxResponseBytes
+	MaxResponseBytes int64
+	// UserAgent replaces the default User-Agent of Pangolin API requests
+	UserAgent string
+	// MaxConcurrentWrites caps the Pangolin API write requests in flight;
+	// zero means no limit
+	MaxConcurrentWrites int
+	// WriteLatencyThreshold lowers the write limit while the p95 API latency
+	// exceeds it; zero keeps the limit fixed
+	WriteLatencyThreshold time.Duration
+	// MaxConcurrentRequests caps the Pangolin API requests of any kind in
+	// flight; zero means no limit
+	MaxConcurrentRequests int
+	// RequestCompressionThreshold is the size in bytes from which Pangolin
+	// API request bodies are gzipped; zero disables compression
+	RequestCompressionThreshold int
+	// ResourceCacheTTL is how long GetResource results are cached; zero
+	// disables the cache
+	ResourceCacheTTL time.Duration
+	// OperationTimeout is how long an asynchronous Pangolin API write is
+	// polled until it completes; zero requeues the Ingress instead
+	OperationTimeout time.Duration
+	// FieldNaming is camelCase (the default) or snake_case, for Pangolin
+	// versions naming API fields in snake_case
+	FieldNaming string
+	// DisableHTTP2 forces HTTP/1.1 for Pangolin API requests instead of
+	// negotiating HTTP/2
+	DisableHTTP2 bool
+	// APIKeySecret and APIKeyNamespace locate the Secret holding the API key
+	APIKeySecret    string
+	APIKeyNamespace string
+	// RequestSigning is empty or hmac-sha256, which signs requests with the
+	// hmac-key of the API key secret
+	RequestSigning string
+	// OrgID is the Pangolin organization; required
+	OrgID string
+	// SiteNiceID is the default site for targets; optional
+	SiteNiceID string
+	// DefaultSiteRegion makes the fallback without a default site prefer an
+	// online site in this region; optional
+	DefaultSiteRegion string
+	// StartupSelfTest creates and deletes a throwaway Pangolin resource at
+	// startup and keeps the replica unready until that succeeds
+	StartupSelfTest bool
+	// ProbeTimeout bounds each periodic probe of the Pangolin API; defaults
+	// to 10s
+	ProbeTimeout time.Duration
+	// DisableIngressMetrics turns off the metrics with one series per
+	// Ingress
+	DisableIngressMetrics bool
+	// InstanceID tags created resources; optional, must be a valid label
+	// value
+	InstanceID string
+	// AllowForeignInstanceResources lets the controller modify and delete
+	// resources tagged with another instance ID
+	AllowForeignInstanceResources bool
+	// CleanupOnUnmanage deletes the Pangolin resources of an Ingress that
+	// moves to another class and removes its finalizer
+	CleanupOnUnmanage bool
+	// TransactionalCreate creates new resources together with their
+	// targets and rules in one request where the Pangolin API supports it
+	TransactionalCreate bool
+	// DuplicatePathPolicy is first-wins or last-wins; defaults to first-wins
+	DuplicatePathPolicy string
+	// TLSOnlyHosts is skip or placeholder; defaults to skip
+	TLSOnlyHosts string
+	// ExclusiveHosts refuses Ingresses declaring a host already routed by
+	// another Ingress instead of sharing its resource
+	ExclusiveHosts bool
+	// MirrorLabels lists the Ingress label keys, or key prefixes ending in *,
+	// copied into resource and target metadata; optional
+	MirrorLabels []string
+}
+
+// validate checks the options and reports all problems at once
+func (o *ReconcilerOptions) validate() error {
+	var errs []error
+
+	if o.OrgID == "" {
+		errs = append(errs, fmt.Errorf("pangolin org id is required"))
+	}
+	if o.PangolinClient == nil {
+		if o.PangolinBaseURL == "" {
+			errs = append(errs, fmt.Errorf("pangolin base URL is required"))
+		}
+		if o.APIKeySecret == "" || o.APIKeyNamespace == "" {
+			errs = append(errs, fmt.Errorf("pangolin API key secret name and namespace are required"))
+		}
+	}
+	if o.RequestSigning != "" && o.RequestSigning != requestSigningHMACSHA256 {
+		errs = append(errs, fmt.Errorf("unsupported request signing %q, must be empty or %s", o.RequestSigning, requestSigningHMACSHA256))
+	}
+	if o.DuplicatePathPolicy != "" && o.DuplicatePathPolicy != duplicatePathFirstWins && o.DuplicatePathPolicy != duplicatePathLastWins {
+		errs = append(errs, fmt.Errorf("unsupported duplicate path policy %q, must be %s or %s", o.DuplicatePathPolicy, duplicatePathFirstWins, duplicatePathLastWins))
+	}
+	if o.TLSOnlyHosts != "" && o.TLSOnlyHosts != tlsOnlyHostsSkip && o.TLSOnlyHosts != tlsOnlyHostsPlaceholder {
+		errs = append(errs, fmt.Errorf("unsupported TLS-only hosts behavior %q, must be %s or %s", o.TLSOnlyHosts, tlsOnlyHostsSkip, tlsOnlyHostsPlaceholder))
+	}
+	if _, err := labels.Parse(o.IngressLabelSelector); err != nil {
+		errs = append(errs, fmt.Errorf("invalid ingress label selector %q: %w", o.IngressLabelSelector, err))
+	}
+	if o.AnnotationPrefix != "" {
+		if msgs := validation.IsDNS1123Subdomain(o.AnnotationPrefix); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid annotation prefix %q: %s", o.AnnotationPrefix, strings.Join(msgs, ", ")))
+		}
+	}
+	if o.FinalizerName != "" {
+		if err := validateFinalizerName(o.FinalizerName); err != nil {
+			errs = append(errs, err)
+		} else if err := validateFinalizerName(o.FinalizerName + serviceFinalizerSuffix); err != nil {
+			errs = append(errs, fmt.Errorf("finalizer name %q leaves no room for the Service finalizer: %w", o.FinalizerName, err))
+		}
+	}
+	if o.DefaultDomain != "" {
+		if msgs := validation.IsDNS1123Subdomain(o.DefaultDomain); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("invalid default domain %q: %s", o.DefaultDomain, strings.Join(msgs, ", ")))
+		}
+	}
+	if o.TargetConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("target concurrency must not be negative, got %d", o.TargetConcurrency))
+	}
+	if o.DefaultTargetWeight < 0 || o.DefaultTargetWeight > maxTargetWeight {
+		errs = append(errs, fmt.Errorf("default target weight must be between 1 and %d, got %d", maxTargetWeight, o.DefaultTargetWeight))
+	}
+	if o.MaxResponseBytes < 0 {
+		errs = append(errs, fmt.Errorf("max response bytes must not be negative, got %d", o.MaxResponseBytes))
+	}
+	if o.MaxResources < 0 {
+		errs = append(errs, fmt.Errorf("max resources must not be negative, got %d", o.MaxResources))
+	}
+	if o.TargetDrainPeriod < 0 {
+		errs = append(errs, fmt.Errorf("target drain period must not be negative, got %v", o.TargetDrainPeriod))
+	}
+	if o.StatusPollInterval < 0 {
+		errs = append(errs, fmt.Errorf("status poll interval must not be negative, got %v", o.StatusPollInterval))
+	}
+	if o.StatusPollTimeout < 0 {
+		errs = append(errs, fmt.Errorf("status poll timeout must not be negative, got %v", o.StatusPollTimeout))
+	}
+	interval, timeout := o.StatusPollInterval, o.StatusPollTimeout
+	if interval == 0 {
+		interval = defaultStatusPollInterval
+	}
+	if timeout == 0 {
+		timeout = defaultStatusPollTimeout
+	}
+	if interval > 0 && timeout > 0 && interval >= timeout {
+		errs = append(errs, fmt.Errorf("status poll interval %v must be less than the status poll timeout %v", interval, timeout))
+	}
+	if o.MaxConcurrentWrites < 0 {
+		errs = append(errs, fmt.Errorf("max concurrent writes must not be negative, got %d", o.MaxConcurrentWrites))
+	}
+	if o.ProbeTimeout < 0 {
+		errs = append(errs, fmt.Errorf("probe timeout must not be negative, got %v", o.ProbeTimeout))
+	}
+	if o.MaxConcurrentRequests < 0 {
+		errs = append(errs, fmt.Errorf("max concurrent requests must not be negative, got %d", o.MaxConcurrentRequests))
+	}
+	if o.RequestCompressionThreshold < 0 {
+		errs = append(errs, fmt.Errorf("request compression threshold must not be negative, got %d", o.RequestCompressionThreshold))
+	}
+	if o.FieldNaming != "" && o.FieldNaming != string(pangolin.FieldNamingCamelCase) && o.FieldNaming != string(pangolin.FieldNamingSnakeCase) {
+		errs = append(errs, fmt.Errorf("unsupported field naming %q, must be %s or %s", o.FieldNaming, pangolin.FieldNamingCamelCase, pangolin.FieldNamingSnakeCase))
+	}
+	if o.ResourceCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("resource cache TTL must not be negative, got %v", o.ResourceCacheTTL))
+	}
+	if o.OperationTimeout < 0 {
+		errs = append(errs, fmt.Errorf("operation timeout must not be negative, got %v", o.OperationTimeout))
+	}
+	if o.WriteLatencyThreshold < 0 {
+		errs = append(errs, fmt.Errorf("write latency threshold must not be negative, got %v", o.WriteLatencyThreshold))
+	}
+	if msgs := validation.IsValidLabelValue(o.InstanceID); len(msgs) > 0 {
+		errs = append(errs, fmt.Errorf("invalid instance id %q: %s", o.InstanceID, strings.Join(msgs, ", ")))
+	}
+	if o.ReconcileDebounce < 0 {
+		errs = append(errs, fmt.Errorf("reconcile debounce must not be negative, got %v", o.ReconcileDebounce))
+	}
+	if o.MinReconcileInterval < 0 {
+		errs = append(errs, fmt.Errorf("min reconcile interval must not be negative, got %v", o.MinReconcileInterval))
+	}
+	if o.RequeueJitter < 0 || o.RequeueJitter > 1 {
+		errs = append(errs, fmt.Errorf("requeue jitter must be between 0 and 1, got %v", o.RequeueJitter))
+	}
+	for _, pattern := range o.MirrorLabels {
+		if err := validateMirrorLabel(pattern); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// applyDefaults fills in the defaults of unset options
+func (o *ReconcilerOptions) applyDefaults() {
+	if o.IngressClass == "" {
+		o.IngressClass = defaultIngressClass
+	}
+	if o.ResourcePrefix == "" {
+		o.ResourcePrefix = defaultResourcePrefix
+	}
+	if o.AnnotationPrefix == "" {
+		o.AnnotationPrefix = defaultAnnotationPrefix
+	}
+	if o.FinalizerName == "" {
+		o.FinalizerName = defaultFinalizerName
+	}
+	if o.TargetConcurrency == 0 {
+		o.TargetConcurrency = defaultTargetConcurrency
+	}
+	if o.DefaultTargetWeight == 0 {
+		o.DefaultTargetWeight = defaultTargetWeight
+	}
+	if o.DuplicatePathPolicy == "" {
+		o.DuplicatePathPolicy = duplicatePathFirstWins
+	}
+	if o.TLSOnlyHosts == "" {
+		o.TLSOnlyHosts = tlsOnlyHostsSkip
+	}
+	if o.MaxResponseBytes == 0 {
+		o.MaxResponseBytes = pangolin.DefaultMaxResponseBytes
+	}
+	if o.StatusPollInterval == 0 {
+		o.StatusPollInterval = defaultStatusPollInterval
+	}
+	if o.StatusPollTimeout == 0 {
+		o.StatusPollTimeout = defaultStatusPollTimeout
+	}
+	if o.ProbeTimeout == 0 {
+		o.ProbeTimeout = defaultProbeTimeout
+	}
+}
+
+// NewIngressReconciler validates opts, applies defaults and returns a
+// configured IngressReconciler
+func NewIngressReconciler(c client.Client, scheme *runtime.Scheme, opts ReconcilerOptions) (*IngressReconciler, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid reconciler options: %w", err)
+	}
+	opts.applyDefaults()
+
+	var selector labels.Selector
+	if opts.IngressLabelSelector != "" {
+		// Already validated above
+		selector, _ = labels.Parse(opts.IngressLabelSelector)
+	}
+
+	return &IngressReconciler{
+		Client:                              c,
+		Scheme:                              scheme,
+		Recorder:                            opts.Recorder,
+		IngressClass:                        opts.IngressClass,
+		ControllerName:                      opts.ControllerName,
+		DisableLegacyIngressClassAnnotation: opts.DisableLegacyIngressClassAnnotation,
+		LabelSelector:                       selector,
+		ResourcePrefix:                      opts.ResourcePrefix,
+		AnnotationPrefix:                    opts.AnnotationPrefix,
+		FinalizerName:                       opts.FinalizerName,
+		TargetConcurrency:                   opts.TargetConcurrency,
+		DefaultTargetWeight:                 opts.DefaultTargetWeight,
+		DefaultDomain:                       opts.DefaultDomain,
+		TargetDrainPeriod:                   opts.TargetDrainPeriod,
+		ReconcileDebounce:                   opts.ReconcileDebounce,
+		MinReconcileInterval:                opts.MinReconcileInterval,
+		RequeueJitter:                       opts.RequeueJitter,
+		StatusPollInterval:                  opts.StatusPollInterval,
+		StatusPollTimeout:                   opts.StatusPollTimeout,
+		MaxResources:                        opts.MaxResources,
+		PangolinClient:                      opts.PangolinClient,
+		PangolinBaseURL:                     opts.PangolinBaseURL,
+		MaxResponseBytes:                    opts.MaxResponseBytes,
+		UserAgent:                           opts.UserAgent,
+		MaxConcurrentWrites:                 opts.MaxConcurrentWrites,
+		WriteLatencyThreshold:               opts.WriteLatencyThreshold,
+		MaxConcurrentRequests:               opts.MaxConcurrentRequests,
+		RequestCompressionThreshold:         opts.RequestCompressionThreshold,
+		ResourceCacheTTL:                    opts.ResourceCacheTTL,
+		OperationTimeout:                    opts.OperationTimeout,
+		FieldNaming:                         opts.FieldNaming,
+		DisableHTTP2:                        opts.DisableHTTP2,
+		APIKeySecret:                        opts.APIKeySecret,
+		APIKeyNamespace:                     opts.APIKeyNamespace,
+		RequestSigning:                      opts.RequestSigning,
+		OrgID:                               opts.OrgID,
+		SiteNiceID:                          opts.SiteNiceID,
+		DefaultSiteRegion:                   opts.DefaultSiteRegion,
+		StartupSelfTest:                     opts.StartupSelfTest,
+		ProbeTimeout:                        opts.ProbeTimeout,
+		DisableIngressMetrics:               opts.DisableIngressMetrics,
+		InstanceID:                          opts.InstanceID,
+		AllowForeignInstanceResources:       opts.AllowForeignInstanceResources,
+		CleanupOnUnmanage:                   opts.CleanupOnUnmanage,
+		TransactionalCreate:                 opts.TransactionalCreate,
+		DuplicatePathPolicy:                 opts.DuplicatePathPolicy,
+		TLSOnlyHosts:                        opts.TLSOnlyHosts,
+		ExclusiveHosts:                      opts.ExclusiveHosts,
+		MirrorLabels:                        opts.MirrorLabels,
+	}, nil
+}
+
+// validateFinalizerName checks name against the Kubernetes rules for custom
+// finalizers: a qualified name with a domain prefix, e.g. example.com/cleanup
+func validateFinalizerName(name string) error {
+	if msgs := validation.IsQualifiedName(name); len(msgs) > 0 {
+		return fmt.Errorf("invalid finalizer name %q: %s", name, strings.Join(msgs, ", "))
+	}
+	if !strings.Contains(name, "/") {
+		return fmt.Errorf("invalid finalizer name %q: must be domain-prefixed, e.g. example.com/%s", name, name)
+	}
+	return nil
+}
+
+// validateMirrorLabel checks an entry of MirrorLabels: a label key, or a key
+// prefix ending in *. Reserved metadata keys can't be mirrored.
+func validateMirrorLabel(pattern string) error {
+	prefix, isPrefix := strings.CutSuffix(pattern, "*")
+	switch {
+	case pattern == "":
+		return fmt.Errorf("invalid mirror label: must not be empty")
+	case strings.HasPrefix(prefix, reservedMetadataPrefix):
+		return fmt.Errorf("invalid mirror label %q: keys starting with %s are reserved", pattern, reservedMetadataPrefix)
+	case isPrefix:
+		return nil
+	}
+	if msgs := validation.IsQualifiedName(pattern); len(msgs) > 0 {
+		return fmt.Errorf("invalid mirror label %q: %s", pattern, strings.Join(msgs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+func TestNewIngressReconciler(t *testing.T) {
+	valid := func() ReconcilerOptions {
+		return ReconcilerOptions{
+			PangolinBaseURL: "https://api.example.com",
+			APIKeySecret:    "pangolin-api-key",
+			APIKeyNamespace: "pangolin-system",
+			OrgID:           "test-org",
+		}
+	}
+
+	tests := []struct {
+		name          string
+		modify        func(*ReconcilerOptions)
+		expectedError []string
+	}{
+		{
+			name:   "valid options",
+			modify: func(*ReconcilerOptions) {},
+		},
+		{
+			name: "injected client does not need API key settings",
+			modify: func(o *ReconcilerOptions) {
+				o.PangolinClient = pangolin.NewClient("https://api.example.com", "key", "test-org")
+				o.PangolinBaseURL = ""
+				o.APIKeySecret = ""
+			},
+		},
+		{
+			name: "missing org id",
+			modify: func(o *ReconcilerOptions) {
+				o.OrgID = ""
+			},
+			expectedError: []string{"org id is required"},
+		},
+		{
+			name: "missing API key secret",
+			modify: func(o *ReconcilerOptions) {
+				o.APIKeyNamespace = ""
+			},
+			expectedError: []string{"API key secret"},
+		},
+		{
+			name: "invalid label selector",
+			modify: func(o *ReconcilerOptions) {
+				o.IngressLabelSelector = "team in (web"
+			},
+			expectedError: []string{"invalid ingress label selector"},
+		},
+		{
+			name: "finalizer name without domain",
+			modify: func(o *ReconcilerOptions) {
+				o.FinalizerName = "cleanup"
+			},
+			expectedError: []string{`invalid finalizer name "cleanup": must be domain-prefixed`},
+		},
+		{
+			name: "invalid finalizer name",
+			modify: func(o *ReconcilerOptions) {
+				o.FinalizerName = "example.com/not a name"
+			},
+			expectedError: []string{`invalid finalizer name "example.com/not a name"`},
+		},
+		{
+			name: "finalizer name too long for services",
+			modify: func(o *ReconcilerOptions) {
+				o.FinalizerName = "example.com/" + strings.Repeat("a", 60)
+			},
+			expectedError: []string{"leaves no room for the Service finalizer"},
+		},
+		{
+			name: "invalid instance id",
+			modify: func(o *ReconcilerOptions) {
+				o.InstanceID = "blue/green"
+			},
+			expectedError: []string{`invalid instance id "blue/green"`},
+		},
+		{
+			name: "reserved mirror label",
+			modify: func(o *ReconcilerOptions) {
+				o.MirrorLabels = []string{"team", "kubernetes.*"}
+			},
+			expectedError: []string{`invalid mirror label "kubernetes.*": keys starting with kubernetes. are reserved`},
+		},
+		{
+			name: "invalid mirror label",
+			modify: func(o *ReconcilerOptions) {
+				o.MirrorLabels = []string{"not a label"}
+			},
+			expectedError: []string{`invalid mirror label "not a label"`},
+		},
+		{
+			name: "status poll interval not below timeout",
+			modify: func(o *ReconcilerOptions) {
+				o.StatusPollInterval = 2 * time.Minute
+			},
+			expectedError: []string{"status poll interval 2m0s must be less than the status poll timeout 1m0s"},
+		},
+		{
+			name: "all problems are reported",
+			modify: func(o *ReconcilerOptions) {
+				o.AnnotationPrefix = "Not_A_Prefix"
+				o.DefaultDomain = "bad domain"
+				o.TargetConcurrency = -1
+				o.MaxResponseBytes = -1
+				o.TargetDrainPeriod = -time.Second
+				o.RequestSigning = "md5"
+				o.MaxResources = -1
+				o.ReconcileDebounce = -time.Second
+				o.MinReconcileInterval = -time.Second
+				o.StatusPollTimeout = -time.Second
+				o.MaxConcurrentWrites = -1
+				o.WriteLatencyThreshold = -time.Second
+				o.MaxConcurrentRequests = -1
+				o.ProbeTimeout = -time.Second
+				o.RequestCompressionThreshold = -1
+				o.DefaultTargetWeight = 1001
+				o.DuplicatePathPolicy = "random"
+				o.ResourceCacheTTL = -time.Second
+				o.OperationTimeout = -time.Second
+				o.FieldNaming = "kebab-case"
+				o.RequeueJitter = 1.5
+				o.TLSOnlyHosts = "ignore"
+			},
+			expectedError: []string{"min reconcile interval", "operation timeout", "TLS-only hosts", "requeue jitter", "field naming", "resource cache TTL", "duplicate path policy", "default target weight", "request compression threshold", "probe timeout", "max concurrent requests", "max concurrent writes", "write latency threshold", "status poll timeout", "reconcile debounce", "max resources", "annotation prefix", "default domain", "target concurrency", "max response bytes", "target drain period", "request signing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid()
+			tt.modify(&opts)
+
+			r, err := NewIngressReconciler(fake.NewClientBuilder().Build(), runtime.NewScheme(), opts)
+			if len(tt.expectedError) > 0 {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				for _, want := range tt.expectedError {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to mention %q, got %v", want, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if r.OrgID != opts.OrgID || r.PangolinClient != opts.PangolinClient {
+				t.Errorf("Expected options to be carried over, got %+v", r)
+			}
+		})
+	}
+}
+
+func TestNewIngressReconciler_defaults(t *testing.T) {
+	r, err := NewIngressReconciler(fake.NewClientBuilder().Build(), runtime.NewScheme(), ReconcilerOptions{
+		PangolinBaseURL: "https://api.example.com",
+		APIKeySecret:    "pangolin-api-key",
+		APIKeyNamespace: "pangolin-system",
+		OrgID:           "test-org",
+		ResourcePrefix:  "custom",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if r.IngressClass != "pangolin" {
+		t.Errorf("Expected default ingress class, got %q", r.IngressClass)
+	}
+	if r.ResourcePrefix != "custom" {
+		t.Errorf("Expected explicit resource prefix to be kept, got %q", r.ResourcePrefix)
+	}
+	if r.AnnotationPrefix != defaultAnnotationPrefix {
+		t.Errorf("Expected default annotation prefix, got %q", r.AnnotationPrefix)
+	}
+	if r.FinalizerName != defaultFinalizerName {
+		t.Errorf("Expected default finalizer name, got %q", r.FinalizerName)
+	}
+	if r.TargetConcurrency != defaultTargetConcurrency {
+		t.Errorf("Expected default target concurrency, got %d", r.TargetConcurrency)
+	}
+	if r.DefaultTargetWeight != defaultTargetWeight {
+		t.Errorf("Expected default target weight, got %d", r.DefaultTargetWeight)
+	}
+	if r.DuplicatePathPolicy != duplicatePathFirstWins {
+		t.Errorf("Expected default duplicate path policy, got %q", r.DuplicatePathPolicy)
+	}
+	if r.MaxResponseBytes != pangolin.DefaultMaxResponseBytes {
+		t.Errorf("Expected default max response bytes, got %d", r.MaxResponseBytes)
+	}
+}
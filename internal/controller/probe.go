@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// apiProbeInterval is how often the Pangolin API is probed to update
+	// pangolin_api_up and the readiness check
+	apiProbeInterval = 30 * time.Second
+
+	// defaultProbeTimeout bounds a single probe unless overridden via
+	// IngressReconciler.ProbeTimeout
+	defaultProbeTimeout = 10 * time.Second
+
+	// cacheSyncCheckTimeout bounds how long the readiness check waits for
+	// the informer caches
+	cacheSyncCheckTimeout = time.Second
+)
+
+// errProbePending is reported by the readiness check until the first probe of
+// the Pangolin API has finished
+var errProbePending = errors.New("Pangolin API has not been probed yet")
+
+// probePangolinAPI checks that the Pangolin API is reachable with the
+// configured credentials and records the result in pangolin_api_up
+func (r *IngressReconciler) probePangolinAPI(ctx context.Context) error {
+	err := r.initPangolinClient(ctx)
+	if err == nil {
+		_, err = r.PangolinClient.ListSites(ctx)
+	}
+	if err != nil {
+		apiUp.Set(0)
+		return err
+	}
+	apiUp.Set(1)
+	return nil
+}
+
+// apiProbe periodically probes the Pangolin API and reports the outcome of
+// the last probe as a readiness check. It runs on every replica, not just the
+// leader, so that each one reports whether it can reach Pangolin.
+type apiProbe struct {
+	r        *IngressReconciler
+	interval time.Duration
+	timeout  time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+func newAPIProbe(r *IngressReconciler, interval, timeout time.Duration) *apiProbe {
+	return &apiProbe{r: r, interval: interval, timeout: timeout, err: errProbePending}
+}
+
+// Start probes the API every interval until ctx is done
+func (p *apiProbe) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("api-probe")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.run(ctx); err != nil {
+			log.Error(err, "Pangolin API is unreachable")
+		}
+	}, p.interval)
+	return nil
+}
+
+// run probes the API once, bounded by the probe timeout, and records the
+// outcome
+func (p *apiProbe) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	err := p.r.probePangolinAPI(ctx)
+	if err != nil {
+		err = fmt.Errorf("Pangolin API probe failed: %w", err)
+	}
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+	return err
+}
+
+// Check implements healthz.Checker
+func (p *apiProbe) Check(_ *http.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (p *apiProbe) NeedLeaderElection() bool {
+	return false
+}
+
+// cacheSyncedCheck returns a readiness check that passes once the informer
+// caches of c have synced, so that a replica isn't ready before it can see
+// the Ingresses it manages
+func cacheSyncedCheck(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx := context.Background()
+		if req != nil {
+			ctx = req.Context()
+		}
+		ctx, cancel := context.WithTimeout(ctx, cacheSyncCheckTimeout)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer caches have not synced yet")
+		}
+		return nil
+	}
+}
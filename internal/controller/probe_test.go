@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIngressReconciler_probePangolinAPI(t *testing.T) {
+	tests := []struct {
+		name        string
+		unreachable bool
+		expected    float64
+	}{
+		{name: "reachable", expected: 1},
+		{name: "unreachable", unreachable: true, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePangolin := newFakePangolin(t)
+			reconciler := &IngressReconciler{
+				PangolinClient: fakePangolin.client(),
+				OrgID:          fakeOrgID,
+			}
+			if tt.unreachable {
+				fakePangolin.Close()
+			}
+			// Start from the opposite value to see the probe update it
+			apiUp.Set(1 - tt.expected)
+
+			err := reconciler.probePangolinAPI(context.Background())
+			if tt.unreachable && err == nil {
+				t.Errorf("Expected an error for an unreachable API")
+			}
+			if !tt.unreachable && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if got := testutil.ToFloat64(apiUp); got != tt.expected {
+				t.Errorf("Expected pangolin_api_up %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAPIProbe_readiness(t *testing.T) {
+	fakePangolin := newFakePangolin(t)
+	probe := newAPIProbe(&IngressReconciler{
+		PangolinClient: fakePangolin.client(),
+		OrgID:          fakeOrgID,
+	}, apiProbeInterval, time.Second)
+
+	if err := probe.Check(nil); !errors.Is(err, errProbePending) {
+		t.Errorf("Expected the check to be pending before the first probe, got %v", err)
+	}
+
+	if err := probe.run(context.Background()); err != nil {
+		t.Fatalf("Unexpected probe error: %v", err)
+	}
+	if err := probe.Check(nil); err != nil {
+		t.Errorf("Expected the check to pass after a successful probe, got %v", err)
+	}
+
+	fakePangolin.Close()
+	if err := probe.run(context.Background()); err == nil {
+		t.Fatal("Expected the probe to fail for an unreachable API")
+	}
+	if err := probe.Check(nil); err == nil {
+		t.Error("Expected the check to fail after a failed probe")
+	}
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// throttleReconcile returns how long a reconcile of the Ingress must wait
+// while MinReconcileInterval has not passed since its last one. Otherwise it
+// records now as the time of the last reconcile and returns zero.
+func (r *IngressReconciler) throttleReconcile(key types.NamespacedName, now time.Time) time.Duration {
+	if r.MinReconcileInterval <= 0 {
+		return 0
+	}
+	r.throttleMu.Lock()
+	defer r.throttleMu.Unlock()
+	if last, ok := r.lastReconciles[key]; ok {
+		if wait := last.Add(r.MinReconcileInterval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	if r.lastReconciles == nil {
+		r.lastReconciles = make(map[types.NamespacedName]time.Time)
+	}
+	r.lastReconciles[key] = now
+	return 0
+}
+
+// forgetReconcile drops the time of the last reconcile of an Ingress, e.g.
+// once it is deleted
+func (r *IngressReconciler) forgetReconcile(key types.NamespacedName) {
+	r.throttleMu.Lock()
+	delete(r.lastReconciles, key)
+	r.throttleMu.Unlock()
+}
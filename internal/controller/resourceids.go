@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"sort"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// recordedResourceIDs returns the resource IDs recorded per host in the
+// resource-ids annotation of an Ingress. An unparsable value counts as no
+// IDs, so that the resources are found again by name or metadata.
+func (r *IngressReconciler) recordedResourceIDs(ingress *networkingv1.Ingress) map[string]string {
+	ids := map[string]string{}
+	value := ingress.Annotations[r.annotationKey(annotationResourceIDs)]
+	if value == "" {
+		return ids
+	}
+	if err := json.Unmarshal([]byte(value), &ids); err != nil {
+		return map[string]string{}
+	}
+	return ids
+}
+
+// recordedResourceID returns the ID of the resource recorded for host. An
+// Ingress annotated before IDs were recorded per host only has the
+// resource-id annotation, which may belong to any of its hosts; legacy is
+// set for such an ID so that the caller checks it serves host.
+func (r *IngressReconciler) recordedResourceID(ingress *networkingv1.Ingress, host string) (id string, legacy bool) {
+	ids := r.recordedResourceIDs(ingress)
+	if len(ids) > 0 {
+		return ids[host], false
+	}
+	id = ingress.Annotations[r.annotationKey(annotationResourceID)]
+	return id, id != ""
+}
+
+// allResourceIDs returns the IDs of all resources recorded for an Ingress,
+// sorted and without duplicates
+func (r *IngressReconciler) allResourceIDs(ingress *networkingv1.Ingress) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	add(ingress.Annotations[r.annotationKey(annotationResourceID)])
+	for _, id := range r.recordedResourceIDs(ingress) {
+		add(id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// recordResourceID records id as the resource of host and reports whether
+// the annotations changed
+func (r *IngressReconciler) recordResourceID(ingress *networkingv1.Ingress, host, id string) bool {
+	ids := r.recordedResourceIDs(ingress)
+	if ids[host] == id && ingress.Annotations[r.annotationKey(annotationResourceIDs)] != "" {
+		return false
+	}
+	ids[host] = id
+	return r.setResourceIDs(ingress, ids)
+}
+
+// pruneResourceIDs drops the IDs recorded for hosts not in keep and reports
+// whether the annotations changed. The resources themselves are left to the
+// cleanup on deletion, which finds them through their metadata.
+func (r *IngressReconciler) pruneResourceIDs(ingress *networkingv1.Ingress, keep map[string]bool) bool {
+	ids := r.recordedResourceIDs(ingress)
+	pruned := false
+	for host := range ids {
+		if !keep[host] {
+			delete(ids, host)
+			pruned = true
+		}
+	}
+	if !pruned || len(ids) == 0 {
+		// The last ID is kept until the resources are deleted
+		return false
+	}
+	return r.setResourceIDs(ingress, ids)
+}
+
+// setResourceIDs writes ids to the resource-ids annotation and the ID of the
+// first host in sorted order to the resource-id annotation, from which the
+// load balancer status is derived. It reports whether the annotations
+// changed.
+func (r *IngressReconciler) setResourceIDs(ingress *networkingv1.Ingress, ids map[string]string) bool {
+	hosts := make([]string, 0, len(ids))
+	for host := range ids {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	// Maps are marshalled with sorted keys, so the value is stable
+	value, _ := json.Marshal(ids)
+
+	if ingress.Annotations == nil {
+		ingress.Annotations = make(map[string]string)
+	}
+	idsKey, idKey := r.annotationKey(annotationResourceIDs), r.annotationKey(annotationResourceID)
+	if ingress.Annotations[idsKey] == string(value) && ingress.Annotations[idKey] == ids[hosts[0]] {
+		return false
+	}
+	ingress.Annotations[idsKey] = string(value)
+	ingress.Annotations[idKey] = ids[hosts[0]]
+	r.pruneCertificateFingerprints(ingress)
+	return true
+}
+
+// forgetResourceIDs removes the resource-id and resource-ids annotations,
+// and the certificate fingerprints of the resources
+func (r *IngressReconciler) forgetResourceIDs(ingress *networkingv1.Ingress) {
+	delete(ingress.Annotations, r.annotationKey(annotationResourceID))
+	delete(ingress.Annotations, r.annotationKey(annotationResourceIDs))
+	delete(ingress.Annotations, r.annotationKey(annotationCertificateFingerprints))
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+// selfTestRetryInterval is how often a failed startup self-test is repeated
+const selfTestRetryInterval = 30 * time.Second
+
+// errSelfTestPending is reported by the readiness check until the first
+// self-test has finished
+var errSelfTestPending = errors.New("Pangolin API self-test has not completed yet")
+
+// selfTestLeftoverError reports a self-test resource that was created but
+// could not be deleted. Until it is deleted, the self-test only retries the
+// delete, so that a key lacking delete permission doesn't leak a resource on
+// every retry.
+type selfTestLeftoverError struct {
+	resourceID string
+	name       string
+	err        error
+}
+
+func (e *selfTestLeftoverError) Error() string {
+	return fmt.Sprintf("failed to delete self-test resource %s (%s), it must be removed by hand: %v", e.resourceID, e.name, e.err)
+}
+
+func (e *selfTestLeftoverError) Unwrap() error {
+	return e.err
+}
+
+// runSelfTest checks end to end that the API key may manage resources by
+// creating a throwaway raw TCP resource, reading it back and deleting it
+func (r *IngressReconciler) runSelfTest(ctx context.Context) error {
+	if err := r.initPangolinClient(ctx); err != nil {
+		return err
+	}
+
+	prefix := r.ResourcePrefix
+	if prefix == "" {
+		prefix = defaultResourcePrefix
+	}
+	name := fmt.Sprintf("%s-self-test-%s", prefix, rand.String(8))
+	resource, err := r.PangolinClient.CreateResource(ctx, &pangolin.CreateResourceRequest{
+		Name:     name,
+		HTTP:     false,
+		Protocol: "tcp",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create self-test resource: %w", err)
+	}
+	resourceID := strconv.Itoa(resource.ID)
+
+	if _, err := r.PangolinClient.GetResource(ctx, resourceID); err != nil {
+		err = fmt.Errorf("failed to read back self-test resource %s: %w", resourceID, err)
+		if delErr := r.PangolinClient.DeleteResource(ctx, resourceID); delErr != nil {
+			err = errors.Join(err, &selfTestLeftoverError{resourceID: resourceID, name: name, err: delErr})
+		}
+		return err
+	}
+	if err := r.PangolinClient.DeleteResource(ctx, resourceID); err != nil {
+		return &selfTestLeftoverError{resourceID: resourceID, name: name, err: err}
+	}
+	return nil
+}
+
+// deleteSelfTestResource retries the delete of a self-test resource left
+// over by an earlier run. A resource that is already gone counts as deleted.
+func (r *IngressReconciler) deleteSelfTestResource(ctx context.Context, leftover *selfTestLeftoverError) error {
+	if err := r.initPangolinClient(ctx); err != nil {
+		return err
+	}
+	if err := r.PangolinClient.DeleteResource(ctx, leftover.resourceID); err != nil && !pangolin.IsNotFound(err) {
+		return &selfTestLeftoverError{resourceID: leftover.resourceID, name: leftover.name, err: err}
+	}
+	return nil
+}
+
+// selfTest runs the startup self-test and reports its outcome as a readiness
+// check. A failed self-test is repeated every interval until it passes, so
+// that the replica becomes ready once the problem is fixed. It runs on every
+// replica, not just the leader.
+type selfTest struct {
+	r        *IngressReconciler
+	interval time.Duration
+
+	mu  sync.Mutex
+	err error
+	// leftover is the self-test resource whose delete failed, if any
+	leftover *selfTestLeftoverError
+}
+
+func newSelfTest(r *IngressReconciler, interval time.Duration) *selfTest {
+	return &selfTest{r: r, interval: interval, err: errSelfTestPending}
+}
+
+// Start runs the self-test until it passes or ctx is done
+func (s *selfTest) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("self-test")
+	_ = wait.PollUntilContextCancel(ctx, s.interval, true, func(ctx context.Context) (bool, error) {
+		if err := s.run(ctx); err != nil {
+			log.Error(err, "Pangolin API self-test failed, retrying", "after", s.interval)
+			return false, nil
+		}
+		log.Info("Pangolin API self-test passed")
+		return true, nil
+	})
+	return nil
+}
+
+// run runs the self-test once and records its outcome. While a resource of
+// an earlier run is left over, only its delete is retried and no new
+// resource is created.
+func (s *selfTest) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+	var err error
+	if s.leftover != nil {
+		err = s.r.deleteSelfTestResource(ctx, s.leftover)
+	} else {
+		err = s.r.runSelfTest(ctx)
+	}
+	s.leftover = nil
+	var leftover *selfTestLeftoverError
+	if errors.As(err, &leftover) {
+		s.leftover = leftover
+	}
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	return err
+}
+
+// Check implements healthz.Checker
+func (s *selfTest) Check(_ *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (s *selfTest) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin/pangolintest"
+)
+
+func TestIngressReconciler_runSelfTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		fault     *pangolintest.Fault
+		wantErr   string
+		remaining int
+	}{
+		{
+			name: "passes and cleans up",
+		},
+		{
+			name:    "create forbidden",
+			fault:   &pangolintest.Fault{Method: http.MethodPut, Path: "/v1/org/", Status: http.StatusForbidden},
+			wantErr: "failed to create self-test resource",
+		},
+		{
+			name:      "delete forbidden",
+			fault:     &pangolintest.Fault{Method: http.MethodDelete, Path: "/v1/resource/", Status: http.StatusForbidden},
+			wantErr:   "failed to delete self-test resource",
+			remaining: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := pangolintest.NewFakeServer()
+			defer server.Close()
+			if tt.fault != nil {
+				server.InjectFault(*tt.fault)
+			}
+			r := &IngressReconciler{PangolinClient: client, OrgID: pangolintest.OrgID, ResourcePrefix: "k8s"}
+
+			err := r.runSelfTest(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Expected the self-test to pass, got %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+
+			server.ClearFaults()
+			resources, err := client.ListResources(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to list resources: %v", err)
+			}
+			if len(resources) != tt.remaining {
+				t.Errorf("Expected %d remaining resources, got %+v", tt.remaining, resources)
+			}
+			for _, res := range resources {
+				if !strings.HasPrefix(res.Name, "k8s-self-test-") {
+					t.Errorf("Expected a self-test resource name, got %q", res.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSelfTest_readiness(t *testing.T) {
+	server, client := pangolintest.NewFakeServer()
+	defer server.Close()
+	server.InjectFault(pangolintest.Fault{Method: http.MethodPut, Path: "/v1/org/", Status: http.StatusForbidden, Times: 1})
+	st := newSelfTest(&IngressReconciler{PangolinClient: client, OrgID: pangolintest.OrgID}, 10*time.Millisecond)
+
+	if err := st.Check(nil); !errors.Is(err, errSelfTestPending) {
+		t.Errorf("Expected the check to be pending before the first run, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- st.Start(ctx) }()
+
+	// The first run fails, the retry passes and ends the self-test
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected Start to return nil, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Expected the self-test to pass on retry")
+	}
+	if err := st.Check(nil); err != nil {
+		t.Errorf("Expected the check to pass, got %v", err)
+	}
+}
+
+func TestSelfTest_leftoverResource(t *testing.T) {
+	server, client := pangolintest.NewFakeServer()
+	defer server.Close()
+	server.InjectFault(pangolintest.Fault{Method: http.MethodDelete, Path: "/v1/resource/", Status: http.StatusForbidden})
+	st := newSelfTest(&IngressReconciler{PangolinClient: client, OrgID: pangolintest.OrgID}, time.Second)
+
+	// Runs after a failed delete retry the delete instead of creating more
+	// resources
+	for i := 0; i < 3; i++ {
+		if err := st.run(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to delete self-test resource") {
+			t.Fatalf("Run %d: expected a delete error, got %v", i, err)
+		}
+		if err := st.Check(nil); err == nil {
+			t.Fatalf("Run %d: expected the check to fail", i)
+		}
+	}
+	server.ClearFaults()
+	resources, err := client.ListResources(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list resources: %v", err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("Expected a single leftover resource, got %+v", resources)
+	}
+
+	// Once the delete passes, so does the check
+	if err := st.run(context.Background()); err != nil {
+		t.Fatalf("Expected the delete retry to pass, got %v", err)
+	}
+	if err := st.Check(nil); err != nil {
+		t.Errorf("Expected the check to pass, got %v", err)
+	}
+	if resources, _ := client.ListResources(context.Background()); len(resources) != 0 {
+		t.Errorf("Expected the leftover resource to be deleted, got %+v", resources)
+	}
+}
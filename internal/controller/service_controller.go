@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+const (
+	// serviceFinalizerSuffix is appended to the Ingress finalizer name to form
+	// the finalizer of exposed Services, so that instances with distinct
+	// finalizer names don't fight over the same Services
+	serviceFinalizerSuffix = "-service"
+
+	// annotationExpose requests raw TCP/UDP exposure of a Service
+	annotationExpose = "expose"
+)
+
+// httpOnlyAnnotations are the annotations of HTTP features, which a Service
+// exposed as a raw TCP/UDP resource must not set
+var httpOnlyAnnotations = []string{
+	annotationWebSocket,
+	annotationForwardedHeaders,
+	annotationResponseHeaders,
+	annotationAllowedMethods,
+}
+
+// ServiceReconciler exposes Services annotated with the expose annotation as
+// raw TCP/UDP Pangolin resources, independently of any Ingress. It shares the
+// Pangolin client, configuration and caches of the Ingress reconciler.
+type ServiceReconciler struct {
+	client.Client
+	Ingress *IngressReconciler
+}
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups="",resources=services/finalizers,verbs=update
+
+// Reconcile creates, updates or deletes the L4 Pangolin resource for a Service
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.Ingress.initPangolinClient(ctx); err != nil {
+		log.Error(err, "Failed to initialize Pangolin client")
+		return ctrl.Result{}, err
+	}
+
+	service := &corev1.Service{}
+	if err := r.Get(ctx, req.NamespacedName, service); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Service")
+		return ctrl.Result{}, err
+	}
+
+	protocol := strings.ToLower(strings.TrimSpace(service.Annotations[r.Ingress.annotationKey(annotationExpose)]))
+
+	// Handle deletion, and Services that are no longer exposed
+	if !service.DeletionTimestamp.IsZero() || protocol == "" {
+		if controllerutil.ContainsFinalizer(service, r.finalizerName()) {
+			if err := r.deleteResource(ctx, service); err != nil {
+				log.Error(err, "Failed to delete Pangolin resource for Service")
+				r.Ingress.recordEvent(service, corev1.EventTypeWarning, "CleanupFailed",
+					"Keeping finalizer %s, failed to delete Pangolin resource: %v", r.finalizerName(), err)
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(service, r.finalizerName())
+			delete(service.Annotations, r.Ingress.annotationKey(annotationResourceID))
+			if err := r.Update(ctx, service); err != nil {
+				return ctrl.Result{}, err
+			}
+			r.Ingress.recordFinalizerChange(service, "service", finalizerRemoved, r.finalizerName())
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if protocol != "tcp" && protocol != "udp" {
+		r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+			"Annotation %s must be tcp or udp, got %q", r.Ingress.annotationKey(annotationExpose), protocol)
+		log.Info("Ignoring Service with invalid expose annotation", "protocol", protocol)
+		return ctrl.Result{}, nil
+	}
+
+	// Features that only exist for HTTP can't be honored by raw TCP/UDP
+	// resources. Turning one off explicitly is fine.
+	for _, name := range httpOnlyAnnotations {
+		key := r.Ingress.annotationKey(name)
+		if value := strings.ToLower(strings.TrimSpace(service.Annotations[key])); value == "" || value == "false" {
+			continue
+		}
+		r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+			"Annotation %s is only supported for http/https resources, not %s", key, protocol)
+		log.Info("Ignoring Service with an HTTP-only annotation on a raw resource", "annotation", key, "protocol", protocol)
+		return ctrl.Result{}, nil
+	}
+
+	proxyProtocol := strings.ToLower(strings.TrimSpace(service.Annotations[r.Ingress.annotationKey(annotationProxyProtocol)]))
+	switch {
+	case proxyProtocol != "" && proxyProtocol != "v1" && proxyProtocol != "v2":
+		r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+			"Annotation %s must be v1 or v2, got %q", r.Ingress.annotationKey(annotationProxyProtocol), proxyProtocol)
+		log.Info("Ignoring Service with invalid proxy-protocol annotation", "proxyProtocol", proxyProtocol)
+		return ctrl.Result{}, nil
+	case proxyProtocol != "" && protocol != "tcp":
+		r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+			"Annotation %s is only supported for tcp resources, not %s", r.Ingress.annotationKey(annotationProxyProtocol), protocol)
+		log.Info("Ignoring Service with proxy-protocol annotation on a non-tcp resource", "protocol", protocol)
+		return ctrl.Result{}, nil
+	}
+
+	listenPort := 0
+	if v := strings.TrimSpace(service.Annotations[r.Ingress.annotationKey(annotationListenPort)]); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+				"Annotation %s must be a port between 1 and 65535, got %q", r.Ingress.annotationKey(annotationListenPort), v)
+			log.Info("Ignoring Service with invalid listen-port annotation", "listenPort", v)
+			return ctrl.Result{}, nil
+		}
+		listenPort = port
+	}
+
+	targetAddress := strings.ToLower(strings.TrimSpace(service.Annotations[r.Ingress.annotationKey(annotationTargetAddress)]))
+	if targetAddress != "" {
+		if err := validateTargetAddress(targetAddress); err != nil {
+			r.Ingress.recordEvent(service, corev1.EventTypeWarning, "InvalidAnnotation",
+				"Annotation %s %v", r.Ingress.annotationKey(annotationTargetAddress), err)
+			log.Info("Ignoring Service with invalid target-address annotation", "targetAddress", targetAddress)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if !controllerutil.ContainsFinalizer(service, r.finalizerName()) {
+		controllerutil.AddFinalizer(service, r.finalizerName())
+		if err := r.Update(ctx, service); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.Ingress.recordFinalizerChange(service, "service", finalizerAdded, r.finalizerName())
+	}
+
+	if err := r.createOrUpdateResource(ctx, service, protocol, proxyProtocol, targetAddress, listenPort); err != nil {
+		log.Error(err, "Failed to expose Service", "protocol", protocol)
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Successfully reconciled Service exposure", "name", service.Name, "protocol", protocol)
+	return ctrl.Result{}, nil
+}
+
+// createOrUpdateResource ensures the L4 resource and its single target exist.
+// proxyProtocol is empty, v1 or v2; a non-empty targetAddress replaces the
+// cluster DNS name of the Service as the target host. A non-zero listenPort
+// is the public port of the resource; otherwise Pangolin picks one.
+func (r *ServiceReconciler) createOrUpdateResource(ctx context.Context, service *corev1.Service, protocol, proxyProtocol, targetAddress string, listenPort int) error {
+	log := log.FromContext(ctx)
+	pc := r.Ingress.PangolinClient
+
+	servicePort, err := exposedServicePort(service, protocol)
+	if err != nil {
+		return err
+	}
+
+	prefix := r.Ingress.ResourcePrefix
+	if prefix == "" {
+		prefix = defaultResourcePrefix
+	}
+	resourceName := fmt.Sprintf("%s-%s-%s", prefix, service.Namespace, service.Name)
+
+	resourceID := service.Annotations[r.Ingress.annotationKey(annotationResourceID)]
+	if resourceID != "" {
+		res, err := pc.GetResource(ctx, resourceID)
+		if err != nil {
+			if !pangolin.IsNotFound(err) {
+				return fmt.Errorf("failed to get Pangolin resource %s: %w", resourceID, err)
+			}
+			staleAnnotationTotal.Inc()
+			r.Ingress.recordEvent(service, corev1.EventTypeWarning, "StaleResourceID",
+				"Pangolin resource %s referenced by annotation no longer exists, recreating it", resourceID)
+			resourceID = ""
+		} else if err := r.Ingress.checkInstance(service, res); err != nil {
+			return err
+		} else if res.Protocol != protocol {
+			// The protocol of a resource can't be changed; it is replaced by
+			// a resource of the new protocol
+			if err := pc.DeleteResource(ctx, resourceID); err != nil && !pangolin.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s Pangolin resource %s to recreate it for %s: %w", res.Protocol, resourceID, protocol, err)
+			}
+			log.Info("Deleted Pangolin L4 resource of another protocol, recreating it", "resourceID", resourceID, "from", res.Protocol, "to", protocol)
+			resourceID = ""
+		} else if listenPort != 0 && res.ListenPort != listenPort {
+			if _, err := pc.UpdateResource(ctx, resourceID, &pangolin.UpdateResourceRequest{ListenPort: &listenPort}); err != nil {
+				return fmt.Errorf("failed to change listen port of Pangolin resource %s to %d: %w", resourceID, listenPort, err)
+			}
+			log.Info("Updated listen port of Pangolin L4 resource", "resourceID", resourceID, "from", res.ListenPort, "to", listenPort)
+		}
+	}
+
+	if resourceID == "" {
+		if err := r.Ingress.checkResourceLimit(ctx, service); err != nil {
+			return err
+		}
+		req := &pangolin.CreateResourceRequest{
+			Name:       resourceName,
+			HTTP:       false,
+			Protocol:   protocol,
+			ListenPort: listenPort,
+			Metadata:   map[string]string{},
+		}
+		r.Ingress.tagInstance(req.Metadata)
+		resource, err := pc.CreateResource(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to create Pangolin %s resource for Service %s/%s: %w", protocol, service.Namespace, service.Name, err)
+		}
+		resourceID = strconv.Itoa(resource.ID)
+		log.Info("Created Pangolin L4 resource", "resourceID", resourceID, "name", resourceName, "protocol", protocol, "listenPort", resource.ListenPort)
+
+		if service.Annotations == nil {
+			service.Annotations = make(map[string]string)
+		}
+		service.Annotations[r.Ingress.annotationKey(annotationResourceID)] = resourceID
+		if err := r.applyAnnotations(ctx, service); err != nil {
+			return err
+		}
+	}
+
+	site, err := r.Ingress.resolveSite(ctx, service.Annotations, nil)
+	if err != nil {
+		return err
+	}
+
+	targetIP := fmt.Sprintf("%s.%s.svc.cluster.local", service.Name, service.Namespace)
+	if targetAddress != "" {
+		targetIP = targetAddress
+	}
+	targetPort := int(servicePort)
+	targetReq := &pangolin.CreateTargetRequest{
+		SiteID:        site.ID,
+		IP:            targetIP,
+		Port:          targetPort,
+		Enabled:       true,
+		ProxyProtocol: proxyProtocol,
+	}
+
+	existingTargets, err := pc.ListTargets(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+	}
+
+	activeTargetID := 0
+	for _, t := range existingTargets {
+		if t.SiteID == site.ID && t.IP == targetIP && t.Port == targetPort {
+			activeTargetID = t.ID
+			if t.ProxyProtocol != proxyProtocol {
+				if _, err := pc.UpdateTarget(ctx, strconv.Itoa(t.ID), targetReq); err != nil {
+					return fmt.Errorf("failed to update Pangolin target for Service %s/%s: %w", service.Namespace, service.Name, err)
+				}
+				log.Info("Updated Pangolin L4 target", "targetID", t.ID, "proxyProtocol", proxyProtocol)
+			}
+			break
+		}
+	}
+	if activeTargetID == 0 {
+		target, err := pc.CreateTarget(ctx, resourceID, targetReq)
+		if err != nil {
+			return fmt.Errorf("failed to create Pangolin target for Service %s/%s: %w", service.Namespace, service.Name, err)
+		}
+		activeTargetID = target.ID
+		log.Info("Created Pangolin L4 target", "targetID", target.ID, "port", targetPort)
+	}
+
+	var errs []error
+	for _, t := range existingTargets {
+		if t.ID == activeTargetID {
+			continue
+		}
+		staleID := strconv.Itoa(t.ID)
+		if err := pc.DeleteTarget(ctx, staleID); err != nil && !pangolin.IsNotFound(err) {
+			log.Error(err, "Failed to delete stale Pangolin target", "targetID", staleID)
+			errs = append(errs, fmt.Errorf("failed to delete stale Pangolin target %s: %w", staleID, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteResource deletes the L4 resource recorded on the Service, if any,
+// unless it belongs to another controller instance
+func (r *ServiceReconciler) deleteResource(ctx context.Context, service *corev1.Service) error {
+	resourceID := service.Annotations[r.Ingress.annotationKey(annotationResourceID)]
+	if resourceID == "" {
+		return nil
+	}
+	res, err := r.Ingress.PangolinClient.GetResource(ctx, resourceID)
+	if err != nil {
+		if pangolin.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get Pangolin resource %s: %w", resourceID, err)
+	}
+	if other := r.Ingress.foreignInstance(res); other != "" {
+		log.FromContext(ctx).Info("Leaving Pangolin L4 resource of another controller instance", "resourceID", resourceID, "instanceID", other)
+		return nil
+	}
+	if err := r.Ingress.PangolinClient.DeleteResource(ctx, resourceID); err != nil && !pangolin.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Pangolin resource %s: %w", resourceID, err)
+	}
+	log.FromContext(ctx).Info("Deleted Pangolin L4 resource", "resourceID", resourceID)
+	return nil
+}
+
+// exposedServicePort returns the first Service port matching protocol
+func exposedServicePort(service *corev1.Service, protocol string) (int32, error) {
+	for _, port := range service.Spec.Ports {
+		portProtocol := port.Protocol
+		if portProtocol == "" {
+			portProtocol = corev1.ProtocolTCP
+		}
+		if strings.EqualFold(string(portProtocol), protocol) {
+			return port.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service %s/%s has no %s port to expose", service.Namespace, service.Name, protocol)
+}
+
+// finalizerName returns the finalizer added to exposed Services, derived
+// from the Ingress finalizer name
+func (r *ServiceReconciler) finalizerName() string {
+	return r.Ingress.finalizerName() + serviceFinalizerSuffix
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	exposeKey := r.Ingress.annotationKey(annotationExpose)
+	exposed := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		_, ok := obj.GetAnnotations()[exposeKey]
+		return ok || controllerutil.ContainsFinalizer(obj, r.finalizerName())
+	})
+
+	// Services don't bump metadata.generation on spec changes, so every update
+	// of an exposed Service is reconciled
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}, builder.WithPredicates(exposed)).
+		WithOptions(controller.Options{
+			RateLimiter: jitterRateLimiter(workqueue.DefaultControllerRateLimiter(), r.Ingress.RequeueJitter),
+		}).
+		Complete(r)
+}
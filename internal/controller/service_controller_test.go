@@ -0,0 +1,518 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestServiceReconciler_Reconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "postgres",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"pangolin.ingress.k8s.io/expose": "tcp",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "metrics", Port: 9187, Protocol: corev1.ProtocolUDP},
+				{Name: "postgres", Port: 5432, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(service).
+		Build()
+	reconciler := &ServiceReconciler{
+		Client: fakeClient,
+		Ingress: &IngressReconciler{
+			Client:         fakeClient,
+			Scheme:         scheme,
+			PangolinClient: fakePangolin.client(),
+			OrgID:          fakeOrgID,
+			SiteNiceID:     fakeSiteNiceID,
+		},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+	ctx := context.Background()
+
+	// Creation
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &corev1.Service{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	if !controllerutil.ContainsFinalizer(updated, "pangolin.ingress.k8s.io/finalizer-service") {
+		t.Errorf("Expected service finalizer to be added")
+	}
+	id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	res := fakePangolin.Resource(id)
+	if res == nil {
+		t.Fatalf("Expected resource %d to exist", id)
+	}
+	if res.HTTP || res.Protocol != "tcp" {
+		t.Errorf("Expected raw tcp resource, got http=%v protocol=%q", res.HTTP, res.Protocol)
+	}
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Port != 5432 || targets[0].IP != "postgres.default.svc.cluster.local" {
+		t.Errorf("Expected a single target for the tcp port, got %+v", targets)
+	}
+
+	// Deletion
+	if err := fakeClient.Delete(ctx, updated); err != nil {
+		t.Fatalf("Failed to delete service: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fakePangolin.Resource(id) != nil {
+		t.Errorf("Expected resource %d to be deleted", id)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, &corev1.Service{}); err == nil {
+		t.Errorf("Expected service to be gone once the finalizer was removed")
+	}
+}
+
+func TestServiceReconciler_finalizerName(t *testing.T) {
+	tests := []struct {
+		finalizerName string
+		expected      string
+	}{
+		{finalizerName: "", expected: "pangolin.ingress.k8s.io/finalizer-service"},
+		{finalizerName: "example.com/blue", expected: "example.com/blue-service"},
+	}
+	for _, tt := range tests {
+		r := &ServiceReconciler{Ingress: &IngressReconciler{FinalizerName: tt.finalizerName}}
+		if got := r.finalizerName(); got != tt.expected {
+			t.Errorf("Expected %q for finalizer name %q, got %q", tt.expected, tt.finalizerName, got)
+		}
+	}
+}
+
+func TestServiceReconciler_invalidProtocol(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{"pangolin.ingress.k8s.io/expose": "http"},
+		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+	reconciler := &ServiceReconciler{
+		Client: fakeClient,
+		Ingress: &IngressReconciler{
+			Client:         fakeClient,
+			PangolinClient: fakePangolin.client(),
+			SiteNiceID:     fakeSiteNiceID,
+		},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+
+	if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := fakePangolin.Count("PUT", "/resource"); got != 0 {
+		t.Errorf("Expected no resource to be created for an invalid protocol, got %d creates", got)
+	}
+}
+
+func TestServiceReconciler_httpOnlyAnnotationOnRawResource(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotation    string
+		value         string
+		expectInvalid bool
+	}{
+		{name: "websocket", annotation: "websocket", value: "true", expectInvalid: true},
+		{name: "websocket turned off", annotation: "websocket", value: "false"},
+		{name: "forwarded headers", annotation: "forwarded-headers", value: "set", expectInvalid: true},
+		{name: "response headers", annotation: "response-headers", value: "X-Frame-Options: DENY", expectInvalid: true},
+		{name: "allowed methods", annotation: "allowed-methods", value: "GET", expectInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "postgres",
+					Namespace: "default",
+					Annotations: map[string]string{
+						"pangolin.ingress.k8s.io/expose":           "tcp",
+						"pangolin.ingress.k8s.io/" + tt.annotation: tt.value,
+					},
+				},
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432}}},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &ServiceReconciler{
+				Client: fakeClient,
+				Ingress: &IngressReconciler{
+					Client:         fakeClient,
+					Recorder:       recorder,
+					PangolinClient: fakePangolin.client(),
+					SiteNiceID:     fakeSiteNiceID,
+				},
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !tt.expectInvalid {
+				if got := fakePangolin.Count("PUT", "/resource"); got != 1 {
+					t.Errorf("Expected the resource to be created, got %d creates", got)
+				}
+				return
+			}
+			if got := fakePangolin.Count("PUT", "/resource"); got != 0 {
+				t.Errorf("Expected no resource to be created for %s on a tcp resource, got %d creates", tt.annotation, got)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.Contains(event, "InvalidAnnotation") || !strings.Contains(event, tt.annotation) {
+					t.Errorf("Expected an InvalidAnnotation event for %s, got %q", tt.annotation, event)
+				}
+			default:
+				t.Errorf("Expected an InvalidAnnotation event")
+			}
+		})
+	}
+}
+
+func TestServiceReconciler_proxyProtocol(t *testing.T) {
+	tests := []struct {
+		name          string
+		expose        string
+		proxyProtocol string
+		expected      string
+		expectInvalid bool
+	}{
+		{name: "v1", expose: "tcp", proxyProtocol: "v1", expected: "v1"},
+		{name: "v2 is normalized", expose: "tcp", proxyProtocol: " V2 ", expected: "v2"},
+		{name: "unknown version", expose: "tcp", proxyProtocol: "v3", expectInvalid: true},
+		{name: "udp resource", expose: "udp", proxyProtocol: "v2", expectInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "postgres",
+					Namespace: "default",
+					Annotations: map[string]string{
+						"pangolin.ingress.k8s.io/expose":         tt.expose,
+						"pangolin.ingress.k8s.io/proxy-protocol": tt.proxyProtocol,
+					},
+				},
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432, Protocol: corev1.Protocol(strings.ToUpper(tt.expose))}}},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &ServiceReconciler{
+				Client: fakeClient,
+				Ingress: &IngressReconciler{
+					Client:         fakeClient,
+					Recorder:       recorder,
+					PangolinClient: fakePangolin.client(),
+					SiteNiceID:     fakeSiteNiceID,
+				},
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+
+			if _, err := reconciler.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.expectInvalid {
+				if got := fakePangolin.Count("PUT", "/resource"); got != 0 {
+					t.Errorf("Expected no resource to be created, got %d creates", got)
+				}
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, "InvalidAnnotation") {
+						t.Errorf("Expected an InvalidAnnotation event, got %q", event)
+					}
+				default:
+					t.Errorf("Expected an InvalidAnnotation event")
+				}
+				return
+			}
+
+			updated := &corev1.Service{}
+			if err := fakeClient.Get(context.Background(), req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get service: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			targets := fakePangolin.Targets(id)
+			if len(targets) != 1 || targets[0].ProxyProtocol != tt.expected {
+				t.Errorf("Expected a single target with proxy protocol %q, got %+v", tt.expected, targets)
+			}
+		})
+	}
+}
+
+func TestServiceReconciler_listenPort(t *testing.T) {
+	tests := []struct {
+		name          string
+		expose        string
+		listenPort    string
+		expected      int
+		expectInvalid bool
+	}{
+		{name: "tcp resource", expose: "tcp", listenPort: "2222", expected: 2222},
+		{name: "udp resource", expose: "udp", listenPort: " 51820 ", expected: 51820},
+		{name: "port out of range", expose: "tcp", listenPort: "70000", expectInvalid: true},
+		{name: "zero port", expose: "tcp", listenPort: "0", expectInvalid: true},
+		{name: "not a number", expose: "tcp", listenPort: "ssh", expectInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+
+			fakePangolin := newFakePangolin(t)
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ssh",
+					Namespace: "default",
+					Annotations: map[string]string{
+						"pangolin.ingress.k8s.io/expose":      tt.expose,
+						"pangolin.ingress.k8s.io/listen-port": tt.listenPort,
+					},
+				},
+				Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 22, Protocol: corev1.Protocol(strings.ToUpper(tt.expose))}}},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &ServiceReconciler{
+				Client: fakeClient,
+				Ingress: &IngressReconciler{
+					Client:         fakeClient,
+					Recorder:       recorder,
+					PangolinClient: fakePangolin.client(),
+					SiteNiceID:     fakeSiteNiceID,
+				},
+			}
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+			ctx := context.Background()
+
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.expectInvalid {
+				if got := fakePangolin.Count("PUT", "/resource"); got != 0 {
+					t.Errorf("Expected no resource to be created, got %d creates", got)
+				}
+				select {
+				case event := <-recorder.Events:
+					if !strings.Contains(event, "InvalidAnnotation") || !strings.Contains(event, "listen-port") {
+						t.Errorf("Expected an InvalidAnnotation event for listen-port, got %q", event)
+					}
+				default:
+					t.Errorf("Expected an InvalidAnnotation event")
+				}
+				return
+			}
+
+			updated := &corev1.Service{}
+			if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+				t.Fatalf("Failed to get service: %v", err)
+			}
+			id, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+			if err != nil {
+				t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+			}
+			if got := fakePangolin.Resource(id).ListenPort; got != tt.expected {
+				t.Errorf("Expected listen port %d, got %d", tt.expected, got)
+			}
+
+			// Changing the annotation moves the existing resource
+			updated.Annotations["pangolin.ingress.k8s.io/listen-port"] = strconv.Itoa(tt.expected + 1)
+			if err := fakeClient.Update(ctx, updated); err != nil {
+				t.Fatalf("Failed to update service: %v", err)
+			}
+			if _, err := reconciler.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := fakePangolin.Resource(id).ListenPort; got != tt.expected+1 {
+				t.Errorf("Expected listen port %d after the change, got %d", tt.expected+1, got)
+			}
+			if got := fakePangolin.Count("PUT", "/resource"); got != 1 {
+				t.Errorf("Expected the resource to be updated in place, got %d creates", got)
+			}
+		})
+	}
+}
+
+func TestServiceReconciler_protocolChange(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "dns",
+			Namespace:   "default",
+			Annotations: map[string]string{"pangolin.ingress.k8s.io/expose": "tcp"},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "dns-tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+				{Name: "dns-udp", Port: 5353, Protocol: corev1.ProtocolUDP},
+			},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+	reconciler := &ServiceReconciler{
+		Client: fakeClient,
+		Ingress: &IngressReconciler{
+			Client:         fakeClient,
+			Recorder:       record.NewFakeRecorder(10),
+			PangolinClient: fakePangolin.client(),
+			SiteNiceID:     fakeSiteNiceID,
+		},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	updated := &corev1.Service{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	tcpID, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+
+	// Switching to udp replaces the tcp resource
+	updated.Annotations["pangolin.ingress.k8s.io/expose"] = "udp"
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update service: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	udpID, err := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	if err != nil {
+		t.Fatalf("Expected resource ID annotation, got %v", updated.Annotations)
+	}
+	if udpID == tcpID {
+		t.Fatalf("Expected a new resource for the udp exposure, got resource %d again", udpID)
+	}
+	if fakePangolin.Resource(tcpID) != nil {
+		t.Errorf("Expected tcp resource %d to be deleted", tcpID)
+	}
+	res := fakePangolin.Resource(udpID)
+	if res == nil || res.Protocol != "udp" {
+		t.Fatalf("Expected a udp resource, got %+v", res)
+	}
+	targets := fakePangolin.Targets(udpID)
+	if len(targets) != 1 || targets[0].Port != 5353 {
+		t.Errorf("Expected a single target for the udp port, got %+v", targets)
+	}
+}
+
+func TestServiceReconciler_staleTargetDeleteFails(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	fakePangolin := newFakePangolin(t)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "postgres",
+			Namespace:   "default",
+			Annotations: map[string]string{"pangolin.ingress.k8s.io/expose": "tcp"},
+		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 5432, Protocol: corev1.ProtocolTCP}}},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(service).Build()
+	reconciler := &ServiceReconciler{
+		Client: fakeClient,
+		Ingress: &IngressReconciler{
+			Client:         fakeClient,
+			Recorder:       record.NewFakeRecorder(10),
+			PangolinClient: fakePangolin.client(),
+			SiteNiceID:     fakeSiteNiceID,
+		},
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: service.Name, Namespace: service.Namespace}}
+	ctx := context.Background()
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Moving the Service to another port leaves the old target stale, and
+	// its delete fails
+	updated := &corev1.Service{}
+	if err := fakeClient.Get(ctx, req.NamespacedName, updated); err != nil {
+		t.Fatalf("Failed to get service: %v", err)
+	}
+	updated.Spec.Ports[0].Port = 5433
+	if err := fakeClient.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update service: %v", err)
+	}
+	fakePangolin.unavailable("DELETE", "")
+	if _, err := reconciler.Reconcile(ctx, req); err == nil {
+		t.Fatalf("Expected the failed delete of the stale target to fail the reconcile")
+	}
+
+	fakePangolin.ClearFaults()
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, _ := strconv.Atoi(updated.Annotations["pangolin.ingress.k8s.io/resource-id"])
+	targets := fakePangolin.Targets(id)
+	if len(targets) != 1 || targets[0].Port != 5433 {
+		t.Errorf("Expected only the target of the new port, got %+v", targets)
+	}
+}
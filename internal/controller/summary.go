@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Pangolin objects whose changes are counted in a reconcile summary
+const (
+	summaryResources = iota
+	summaryTargets
+	summaryRules
+)
+
+// Changes counted in a reconcile summary
+const (
+	summaryCreated = iota
+	summaryUpdated
+	summaryDeleted
+)
+
+var (
+	summaryObjects    = [...]string{"resources", "targets", "rules"}
+	summaryOperations = [...]string{"Created", "Updated", "Deleted"}
+)
+
+// reconcileSummary counts the Pangolin objects a reconcile created, updated
+// and deleted, so that the outcome can be logged in a single line. Targets
+// are reconciled in parallel, so counting is synchronized.
+type reconcileSummary struct {
+	mu     sync.Mutex
+	counts [len(summaryObjects)][len(summaryOperations)]int
+	// managed is set once the reconcile found an Ingress of this controller
+	managed bool
+	// deferred is set if the reconcile was cut short by a Pangolin
+	// maintenance window or a pending operation
+	deferred bool
+}
+
+type reconcileSummaryKey struct{}
+
+// withReconcileSummary returns a context counting the changes of a reconcile
+// in summary
+func withReconcileSummary(ctx context.Context, summary *reconcileSummary) context.Context {
+	return context.WithValue(ctx, reconcileSummaryKey{}, summary)
+}
+
+// summaryFrom returns the summary of ctx, or nil if it has none
+func summaryFrom(ctx context.Context) *reconcileSummary {
+	summary, _ := ctx.Value(reconcileSummaryKey{}).(*reconcileSummary)
+	return summary
+}
+
+// countChange counts a change of a Pangolin object in the summary of ctx, if
+// it has one
+func countChange(ctx context.Context, object, operation int) {
+	summary := summaryFrom(ctx)
+	if summary == nil {
+		return
+	}
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	summary.counts[object][operation]++
+}
+
+// markManaged records in the summary of ctx, if it has one, that the
+// reconciled Ingress is managed by this controller
+func markManaged(ctx context.Context) {
+	summary := summaryFrom(ctx)
+	if summary == nil {
+		return
+	}
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	summary.managed = true
+}
+
+// markDeferred records in the summary of ctx, if it has one, that the
+// reconcile was cut short to be retried later without an error
+func markDeferred(ctx context.Context) {
+	summary := summaryFrom(ctx)
+	if summary == nil {
+		return
+	}
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+	summary.deferred = true
+}
+
+// isManaged reports whether the reconcile found an Ingress of this controller
+func (s *reconcileSummary) isManaged() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.managed
+}
+
+// isDeferred reports whether the reconcile was cut short to be retried later
+func (s *reconcileSummary) isDeferred() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deferred
+}
+
+// keysAndValues returns the counts and the outcome of a reconcile as
+// structured log fields, e.g. targetsCreated=2
+func (s *reconcileSummary) keysAndValues(result ctrl.Result, err error) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kv []interface{}
+	for object, name := range summaryObjects {
+		for operation, op := range summaryOperations {
+			kv = append(kv, name+op, s.counts[object][operation])
+		}
+	}
+	switch {
+	case err != nil:
+		kv = append(kv, "outcome", "error", "error", err.Error())
+	case result.RequeueAfter > 0:
+		kv = append(kv, "outcome", "requeue", "requeueAfter", result.RequeueAfter)
+	case result.Requeue:
+		kv = append(kv, "outcome", "requeue")
+	default:
+		kv = append(kv, "outcome", "success")
+	}
+	return kv
+}
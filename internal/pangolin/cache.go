@@ -0,0 +1,81 @@
+package pangolin
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourceCache holds GetResource response bodies for a short time, keyed by
+// resource ID. Any write to a resource path drops the entry of that resource,
+// and any write to a target path drops all entries.
+type resourceCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedResource
+	// generation is increased by every invalidation, so that a read that was
+	// in flight during a write doesn't store what it read before the write
+	generation uint64
+}
+
+type cachedResource struct {
+	body    []byte
+	expires time.Time
+}
+
+func newResourceCache(ttl time.Duration) *resourceCache {
+	return &resourceCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedResource),
+	}
+}
+
+// get returns the cached body of a resource and whether it was found and is
+// still fresh. Otherwise it returns the generation to pass to put.
+func (c *resourceCache) get(resourceID string) ([]byte, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[resourceID]
+	if ok && c.now().Before(entry.expires) {
+		return entry.body, 0, true
+	}
+	delete(c.entries, resourceID)
+	return nil, c.generation, false
+}
+
+// put stores the body of a resource read at generation, unless the cache was
+// invalidated since
+func (c *resourceCache) put(resourceID string, body []byte, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries[resourceID] = cachedResource{body: body, expires: c.now().Add(c.ttl)}
+}
+
+// invalidate drops the entry of the resource a request path refers to, if
+// any. A path of a target, such as /v1/target/{id}, doesn't name the resource
+// the target belongs to, so it drops all entries. It is called before and
+// after every write request.
+func (c *resourceCache) invalidate(path string) {
+	if strings.HasPrefix(path, "/v1/target/") {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.generation++
+		clear(c.entries)
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "/v1/resource/")
+	if !ok {
+		return
+	}
+	resourceID, _, _ := strings.Cut(rest, "/")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, resourceID)
+}
@@ -2,11 +2,20 @@ package pangolin
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -14,26 +23,236 @@ import (
 
 const (
 	defaultTimeout = 30 * time.Second
+
+	// DefaultMaxResponseBytes is the default limit on the size of API
+	// response bodies read by the client
+	DefaultMaxResponseBytes = 4 << 20
+
+	// maxRetries is how often an idempotent request is retried after a
+	// transient failure; the delay before each retry doubles, starting at
+	// defaultRetryBackoff
+	maxRetries          = 2
+	defaultRetryBackoff = 500 * time.Millisecond
 )
 
+// Version is the controller version reported in the default User-Agent. It is
+// set at build time with
+// -ldflags "-X github.com/vinzenz/pangolin-ingress-controller/internal/pangolin.Version=<version>".
+var Version = "dev"
+
+// DefaultUserAgent returns the User-Agent sent with every request unless
+// overridden with WithUserAgent
+func DefaultUserAgent() string {
+	return "pangolin-ingress-controller/" + Version
+}
+
+// ErrResponseTooLarge is returned when an API response body exceeds the
+// client's size limit
+var ErrResponseTooLarge = errors.New("response body too large")
+
 // Client represents a Pangolin API client
 type Client struct {
 	baseURL    string
 	apiKey     string
 	orgID      string
 	httpClient *http.Client
+	transport  *http.Transport
+
+	// maxResponseBytes caps how much of a response body is read
+	maxResponseBytes int64
+
+	// signer, if set, signs every request after its headers are set
+	signer RequestSigner
+
+	// userAgent is sent as the User-Agent header of every request
+	userAgent string
+
+	// defaultHeaders are added to every request, keyed by canonical name
+	defaultHeaders map[string]string
+
+	// retryBackoff is the delay before the first retry of a request
+	retryBackoff time.Duration
+
+	// writeLimiter, if set, bounds the number of concurrent write requests
+	writeLimiter *adaptiveLimiter
+
+	// requestSlots, if set, bounds the number of concurrent requests of any
+	// kind; a slot is held until the response body is closed
+	requestSlots chan struct{}
+
+	// compressThreshold, if positive, is the size from which request bodies
+	// are gzipped; compressionRejected is set once the API refused them
+	compressThreshold   int
+	compressionRejected atomic.Bool
+
+	// fieldNaming is the naming scheme of fields in request and response
+	// bodies
+	fieldNaming FieldNaming
+
+	// resourceCache, if set, serves GetResource for a short time after a
+	// resource was read
+	resourceCache *resourceCache
+
+	// operationTimeout bounds how long the operation of a write answered
+	// with 202 Accepted is polled; zero, the default, disables polling
+	operationTimeout      time.Duration
+	operationPollInterval time.Duration
+}
+
+// ClientOption configures optional behavior of a Client
+type ClientOption func(*Client)
+
+// WithRequestSigner makes the client pass every request to signer once all
+// headers are set, e.g. to add an HMAC signature
+func WithRequestSigner(signer RequestSigner) ClientOption {
+	return func(c *Client) {
+		c.signer = signer
+	}
+}
+
+// WithUserAgent replaces the default User-Agent of the client's requests. An
+// empty userAgent keeps the default.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		if userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// reservedHeaders are set by the client itself and can't be replaced with
+// WithDefaultHeaders
+var reservedHeaders = map[string]bool{
+	"Authorization":    true,
+	"Content-Type":     true,
+	"Content-Encoding": true,
+	"Accept":           true,
+	"User-Agent":       true,
+}
+
+// WithDefaultHeaders adds headers to every request, e.g. a tenant header or
+// tracing baggage expected by a proxy in front of Pangolin. Headers the client
+// sets itself (Authorization, Content-Type, Content-Encoding, Accept and
+// User-Agent) are never overridden; use WithUserAgent for the latter.
+// Repeated calls add to the headers of earlier ones.
+func WithDefaultHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) {
+		for name, value := range headers {
+			name = http.CanonicalHeaderKey(name)
+			if reservedHeaders[name] {
+				continue
+			}
+			if c.defaultHeaders == nil {
+				c.defaultHeaders = make(map[string]string, len(headers))
+			}
+			c.defaultHeaders[name] = value
+		}
+	}
+}
+
+// WithAdaptiveWriteConcurrency limits the client to max concurrent write
+// (non-GET) requests. While the p95 latency of recent requests exceeds
+// threshold, the limit is lowered to relieve the API, and it is raised back
+// towards max as latency recovers. A zero threshold keeps the limit fixed.
+func WithAdaptiveWriteConcurrency(max int, threshold time.Duration) ClientOption {
+	return func(c *Client) {
+		if max > 0 {
+			c.writeLimiter = newAdaptiveLimiter(max, threshold)
+		}
+	}
+}
+
+// WithMaxConcurrentRequests limits the client to max requests in flight at
+// once, shared by all callers, e.g. to protect the API while many Ingresses
+// are reconciled at the same time. A request is in flight from the moment it
+// is sent until its response body is closed; retries queue up again.
+func WithMaxConcurrentRequests(max int) ClientOption {
+	return func(c *Client) {
+		if max > 0 {
+			c.requestSlots = make(chan struct{}, max)
+		}
+	}
+}
+
+// WithRequestCompression gzips request bodies of at least threshold bytes,
+// e.g. resources with large metadata or header maps, and sends them with
+// Content-Encoding: gzip to save bandwidth on slow links. The API must accept
+// compressed bodies; if it answers one with 415 Unsupported Media Type, the
+// request is repeated uncompressed and the client stops compressing. A
+// threshold <= 0 disables compression.
+func WithRequestCompression(threshold int) ClientOption {
+	return func(c *Client) {
+		c.compressThreshold = threshold
+	}
 }
 
-// NewClient creates a new Pangolin API client
-func NewClient(baseURL, apiKey, orgID string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		apiKey:  apiKey,
-		orgID:   orgID,
+// WithResourceCache makes GetResource serve a resource from memory for ttl
+// after it was read from the API, e.g. to save requests while the same
+// resources are checked over and over. Every write to a resource, including
+// its targets, rules and certificate, drops its cached copy, so reads after a
+// write always reach the API. A ttl <= 0 disables the cache.
+func WithResourceCache(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		if ttl > 0 {
+			c.resourceCache = newResourceCache(ttl)
+		}
+	}
+}
+
+// WithHTTP2 controls whether the client negotiates HTTP/2 with HTTPS API
+// endpoints, which it does by default. Disabling it forces HTTP/1.1, e.g. for
+// proxies in front of Pangolin that misbehave under HTTP/2.
+func WithHTTP2(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.transport.ForceAttemptHTTP2 = enabled
+		if enabled {
+			c.transport.TLSNextProto = nil
+		} else {
+			// A non-nil empty map keeps the transport from enabling HTTP/2
+			c.transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	}
+}
+
+// NewClient creates a new Pangolin API client. If apiKey is empty, requests
+// are sent without bearer authentication, which only makes sense together
+// with a request signer.
+func NewClient(baseURL, apiKey, orgID string, opts ...ClientOption) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &Client{
+		baseURL:   baseURL,
+		apiKey:    apiKey,
+		orgID:     orgID,
+		transport: transport,
 		httpClient: &http.Client{
-			Timeout: defaultTimeout,
+			Timeout:   defaultTimeout,
+			Transport: transport,
 		},
+		maxResponseBytes:      DefaultMaxResponseBytes,
+		retryBackoff:          defaultRetryBackoff,
+		operationPollInterval: defaultOperationPollInterval,
+		userAgent:             DefaultUserAgent(),
+		fieldNaming:           FieldNamingCamelCase,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// SetMaxResponseBytes sets the maximum size of response bodies read by the
+// client. Values <= 0 restore the default.
+func (c *Client) SetMaxResponseBytes(n int64) {
+	if n <= 0 {
+		n = DefaultMaxResponseBytes
+	}
+	c.maxResponseBytes = n
+}
+
+// Close closes the client's idle connections. It is safe to call Close more
+// than once; the client must not be used afterwards.
+func (c *Client) Close() {
+	c.transport.CloseIdleConnections()
 }
 
 // OrgID returns the configured Pangolin organization identifier
@@ -41,35 +260,269 @@ func (c *Client) OrgID() string {
 	return c.orgID
 }
 
-// doRequest performs an HTTP request with authentication
+// sensitiveBody is implemented by request bodies whose contents must never be
+// written to the debug log (e.g. private keys)
+type sensitiveBody interface {
+	sensitive()
+}
+
+// Do calls an arbitrary endpoint of the Pangolin API, for endpoints the client
+// has no typed method for. path is relative to the base URL, e.g.
+// "/v1/org/"+c.OrgID()+"/idp". body, if not nil, is sent as JSON, and the data
+// field of the response envelope is decoded into out, if not nil. Requests
+// are authenticated, retried and limited like those of the typed methods, and
+// failures are reported with the same error types, e.g. NotFoundError.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path %q must start with /", path)
+	}
+
+	resp, err := c.doRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+
+	data, err := c.readBody(resp)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	return c.decodeData(data, out)
+}
+
+// doRequest performs an HTTP request with authentication. A write the API
+// accepted with 202 Accepted is handed to acceptedResponse once the request
+// no longer holds a write slot.
 func (c *Client) doRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
-	var reqBody io.Reader
+	resp, err := c.sendRequest(ctx, method, path, body)
+	if err == nil && resp.StatusCode == http.StatusAccepted && method != http.MethodGet {
+		return c.acceptedResponse(ctx, method, path, resp)
+	}
+	return resp, err
+}
+
+// sendRequest sends a request, retrying GET and DELETE requests up to
+// maxRetries times after a network error or a transient status (429, 502,
+// 503, 504). Other requests wait for a slot of the write limiter, if any,
+// and every attempt waits for a request slot.
+func (c *Client) sendRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
+		if err == nil {
+			jsonData, err = c.encodeFields(jsonData)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		log.FromContext(ctx).V(1).Info("Pangolin API request", "method", method, "path", path, "body", string(jsonData))
-		reqBody = bytes.NewBuffer(jsonData)
+		if _, ok := body.(sensitiveBody); ok {
+			log.FromContext(ctx).V(1).Info("Pangolin API request", "method", method, "path", path, "body", "<redacted>")
+		} else {
+			log.FromContext(ctx).V(1).Info("Pangolin API request", "method", method, "path", path, "body", string(jsonData))
+		}
+	}
+
+	if c.resourceCache != nil && method != http.MethodGet {
+		c.resourceCache.invalidate(path)
+		defer c.resourceCache.invalidate(path)
+	}
+
+	if c.writeLimiter != nil && method != http.MethodGet {
+		if err := c.writeLimiter.acquire(ctx); err != nil {
+			requestTotal.WithLabelValues(requestResultError).Inc()
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		}
+		defer c.writeLimiter.release()
 	}
 
-	url := c.baseURL + path
-	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	idempotent := method == http.MethodGet || method == http.MethodDelete
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendLimited(ctx, method, path, jsonData)
+		if !idempotent || attempt == maxRetries || !retryable(ctx, resp, err) {
+			if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				requestTotal.WithLabelValues(requestResultSuccess).Inc()
+			} else {
+				requestTotal.WithLabelValues(requestResultError).Inc()
+			}
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		log.FromContext(ctx).V(1).Info("Retrying Pangolin API request", "method", method, "path", path, "attempt", attempt+1, "after", backoff)
+		requestRetriesTotal.Inc()
+		select {
+		case <-ctx.Done():
+			requestTotal.WithLabelValues(requestResultError).Inc()
+			return nil, fmt.Errorf("failed to execute request: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable reports whether a request that ended with resp or err may succeed
+// when sent again. A 503 with a Retry-After header announces a maintenance
+// window, which is not retried right away.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Only failures to reach the API are worth retrying, not errors
+		// building or signing the request
+		var urlErr *url.Error
+		return errors.As(err, &urlErr) && ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable:
+		_, maintenance := retryAfter(resp, time.Now())
+		return !maintenance
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the positive delay requested by the Retry-After header
+// of resp, given in seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now), true
+	}
+	return 0, false
+}
+
+// sendLimited is send holding one of the request slots, if they are
+// limited, until the response body is closed
+func (c *Client) sendLimited(ctx context.Context, method, path string, jsonData []byte) (*http.Response, error) {
+	if c.requestSlots == nil {
+		return c.send(ctx, method, path, jsonData)
+	}
+
+	select {
+	case c.requestSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to execute request: %w", ctx.Err())
+	}
+	release := func() { <-c.requestSlots }
+
+	resp, err := c.send(ctx, method, path, jsonData)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// slotBody releases a request slot when the response body is closed
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// send performs a single attempt of an HTTP request with authentication
+func (c *Client) send(ctx context.Context, method, path string, jsonData []byte) (*http.Response, error) {
+	compressed, err := c.compressBody(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %w", err)
+	}
+	var reqBody io.Reader
+	switch {
+	case compressed != nil:
+		reqBody = bytes.NewReader(compressed)
+	case jsonData != nil:
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if compressed != nil {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	for name, value := range c.defaultHeaders {
+		req.Header.Set(name, value)
+	}
+	if c.signer != nil {
+		if err := c.signer(req); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
 
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
+	latency := time.Since(start)
+	requestDuration.WithLabelValues(method).Observe(latency.Seconds())
+	if c.writeLimiter != nil {
+		c.writeLimiter.observe(latency)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 
+	if compressed != nil && resp.StatusCode == http.StatusUnsupportedMediaType {
+		resp.Body.Close()
+		c.compressionRejected.Store(true)
+		log.FromContext(ctx).Info("Pangolin API does not accept compressed request bodies, sending them uncompressed from now on",
+			"method", method, "path", path)
+		return c.send(ctx, method, path, jsonData)
+	}
+
 	return resp, nil
 }
 
+// compressBody returns jsonData gzipped if compression is enabled, has not
+// been rejected by the API and jsonData reaches the threshold; otherwise it
+// returns nil
+func (c *Client) compressBody(jsonData []byte) ([]byte, error) {
+	if c.compressThreshold <= 0 || len(jsonData) < c.compressThreshold || c.compressionRejected.Load() {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(jsonData); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // ConflictError is returned when the API responds with 409 Conflict
 type ConflictError struct {
 	Message string
@@ -85,16 +538,111 @@ func IsConflict(err error) bool {
 	return ok
 }
 
-// checkResponse checks the HTTP response for errors
-func checkResponse(resp *http.Response) error {
+// NotFoundError is returned when the API responds with 404 Not Found
+type NotFoundError struct {
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns true if the error is a 404 Not Found
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+// MaintenanceError is returned when the API responds with 503 Service
+// Unavailable and a Retry-After header, as Pangolin does during maintenance
+// windows
+type MaintenanceError struct {
+	Message string
+	// RetryAfter is the delay after which the API expects to be back
+	RetryAfter time.Duration
+}
+
+func (e *MaintenanceError) Error() string {
+	return e.Message
+}
+
+// IsMaintenance reports whether err is, or wraps, a MaintenanceError and
+// returns the delay requested by the API
+func IsMaintenance(err error) (time.Duration, bool) {
+	var maintenance *MaintenanceError
+	if errors.As(err, &maintenance) {
+		return maintenance.RetryAfter, true
+	}
+	return 0, false
+}
+
+// readBody reads the response body, failing with ErrResponseTooLarge instead
+// of buffering more than maxResponseBytes
+func (c *Client) readBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > c.maxResponseBytes {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, c.maxResponseBytes)
+	}
+	return body, nil
+}
+
+// checkResponse checks the HTTP response for errors, including successful
+// responses that are not JSON (e.g. HTML pages served by a proxy in front of
+// Pangolin)
+func (c *Client) checkResponse(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return nil
+		return c.checkContentType(resp)
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	msg := fmt.Sprintf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	if resp.StatusCode == http.StatusConflict {
+	var detail string
+	body, err := c.readBody(resp)
+	switch {
+	case errors.Is(err, ErrResponseTooLarge):
+		detail = fmt.Sprintf("<error body exceeds %d bytes>", c.maxResponseBytes)
+	case err != nil:
+		detail = fmt.Sprintf("<failed to read error body: %v>", err)
+	default:
+		detail = string(body)
+	}
+	msg := fmt.Sprintf("API request failed with status %d: %s", resp.StatusCode, detail)
+	switch resp.StatusCode {
+	case http.StatusConflict:
 		return &ConflictError{Message: msg}
+	case http.StatusNotFound:
+		return &NotFoundError{Message: msg}
+	case http.StatusServiceUnavailable:
+		if delay, ok := retryAfter(resp, time.Now()); ok {
+			return &MaintenanceError{Message: fmt.Sprintf("%s (under maintenance, retry after %v)", msg, delay), RetryAfter: delay}
+		}
 	}
 	return fmt.Errorf("%s", msg)
 }
+
+// maxContentTypeSnippet limits how much of an unexpected response body is
+// quoted in the error
+const maxContentTypeSnippet = 256
+
+// checkContentType returns a descriptive error if a response with a body is
+// not JSON
+func (c *Client) checkContentType(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if isJSON(contentType) {
+		return nil
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxContentTypeSnippet))
+	return fmt.Errorf("unexpected response content type %q with status %d, expected application/json (is a proxy in front of Pangolin?): %s",
+		contentType, resp.StatusCode, strings.TrimSpace(string(snippet)))
+}
+
+// isJSON reports whether contentType is a JSON media type
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,1022 @@
+package pangolin
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClient_Close(t *testing.T) {
+	var closedConns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closedConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org")
+	if _, err := c.ListSites(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	c.Close()
+	c.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for closedConns.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if closedConns.Load() == 0 {
+		t.Errorf("Expected Close to close idle connections")
+	}
+}
+
+func TestClient_responseSizeLimit(t *testing.T) {
+	const limit = 1024
+	// Far more than the limit; the handler stops once the client hangs up
+	const served = 64 << 20
+
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "oversized success body", status: http.StatusOK},
+		{name: "oversized error body", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				chunk := []byte(strings.Repeat("x", 32<<10))
+				for written := 0; written < served; written += len(chunk) {
+					if _, err := w.Write(chunk); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org")
+			c.SetMaxResponseBytes(limit)
+			defer c.Close()
+
+			_, err := c.ListSites(context.Background())
+			if err == nil {
+				t.Fatalf("Expected an error for an oversized response")
+			}
+			if tt.status == http.StatusOK {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("Expected ErrResponseTooLarge, got %v", err)
+				}
+			} else if !strings.Contains(err.Error(), "status 500") || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+				t.Errorf("Expected a bounded status error, got %v", err)
+			}
+			if len(err.Error()) > limit {
+				t.Errorf("Expected the error message to stay bounded, got %d bytes", len(err.Error()))
+			}
+		})
+	}
+}
+
+func TestClient_contentNegotiation(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		body          string
+		expectedError string
+	}{
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"data":{"sites":[]}}`,
+		},
+		{
+			name:        "json suffix",
+			contentType: "application/problem+json",
+			body:        `{"data":{"sites":[]}}`,
+		},
+		{
+			name:          "html page from a proxy",
+			contentType:   "text/html; charset=utf-8",
+			body:          "<html><body>Please log in</body></html>",
+			expectedError: `unexpected response content type "text/html; charset=utf-8"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org")
+			defer c.Close()
+
+			_, err := c.ListSites(context.Background())
+			if accept != "application/json" {
+				t.Errorf("Expected Accept: application/json, got %q", accept)
+			}
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected an error for content type %q", tt.contentType)
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) || !strings.Contains(err.Error(), "Please log in") {
+				t.Errorf("Expected a descriptive content type error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_GetTokenInfo(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedMissing []string
+	}{
+		{
+			name: "sufficient scopes",
+			body: `{"data":{"orgId":"test-org","scopes":["resource:write","target:write","site:read"]}}`,
+		},
+		{
+			name:            "insufficient scopes",
+			body:            `{"data":{"orgId":"test-org","scopes":["resource:read","target:write"]}}`,
+			expectedMissing: []string{ScopeResourceWrite},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/api-key/info" {
+					t.Errorf("Unexpected request path %s", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org")
+			defer c.Close()
+			info, err := c.GetTokenInfo(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.OrgID != "test-org" {
+				t.Errorf("Expected org test-org, got %q", info.OrgID)
+			}
+			missing := info.MissingScopes(ScopeResourceWrite, ScopeTargetWrite)
+			if strings.Join(missing, ",") != strings.Join(tt.expectedMissing, ",") {
+				t.Errorf("Expected missing scopes %v, got %v", tt.expectedMissing, missing)
+			}
+		})
+	}
+}
+
+func TestClient_Do(t *testing.T) {
+	type idp struct {
+		ID   int    `json:"idpId"`
+		Name string `json:"name"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Expected the API key to be sent, got %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/org/test-org/idp":
+			var body idp
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Failed to decode request body: %v", err)
+			}
+			body.ID = 7
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": body})
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/idp/7":
+			_, _ = w.Write([]byte(`{"data":{}}`))
+		default:
+			http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org")
+	defer c.Close()
+	ctx := context.Background()
+
+	var created idp
+	if err := c.Do(ctx, http.MethodPut, "/v1/org/"+c.OrgID()+"/idp", idp{Name: "oidc"}, &created); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if created.ID != 7 || created.Name != "oidc" {
+		t.Errorf("Expected the created idp to be decoded, got %+v", created)
+	}
+
+	if err := c.Do(ctx, http.MethodDelete, "/v1/idp/7", nil, nil); err != nil {
+		t.Errorf("Unexpected error without a response value: %v", err)
+	}
+
+	if err := c.Do(ctx, http.MethodGet, "/v1/idp/8", nil, &created); !IsNotFound(err) {
+		t.Errorf("Expected a NotFoundError, got %v", err)
+	}
+
+	if err := c.Do(ctx, http.MethodGet, "v1/idp/7", nil, nil); err == nil || !strings.Contains(err.Error(), "must start with /") {
+		t.Errorf("Expected a relative path to be rejected, got %v", err)
+	}
+}
+
+func TestClient_BatchCreateResource(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		// plain answers with a plain text body instead of an API error
+		plain           bool
+		wantUnsupported bool
+		wantNotFound    bool
+		wantErr         bool
+	}{
+		{name: "created", status: http.StatusOK},
+		{name: "endpoint missing", status: http.StatusNotFound, plain: true, wantUnsupported: true, wantErr: true},
+		{name: "organization not found", status: http.StatusNotFound, wantNotFound: true, wantErr: true},
+		{name: "method not allowed", status: http.StatusMethodNotAllowed, wantUnsupported: true, wantErr: true},
+		{name: "not implemented", status: http.StatusNotImplemented, wantUnsupported: true, wantErr: true},
+		{name: "conflict", status: http.StatusConflict, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/org/test-org/resources:batchCreate" {
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				var req BatchCreateResourceRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("Failed to decode request body: %v", err)
+				}
+				if tt.plain {
+					// Like a router that doesn't know the path
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(`{"message":"failed"}`))
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": BatchCreateResourceResponse{
+					Resource: Resource{ID: 1, Name: req.Resource.Name},
+					Targets:  []Target{{ID: 10, Port: req.Targets[0].Port}},
+					Rules:    []ResourceRule{{ID: 20, TargetID: 10, Path: req.Rules[0].Path}},
+				}})
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org")
+			defer c.Close()
+
+			created, err := c.BatchCreateResource(context.Background(), &BatchCreateResourceRequest{
+				Resource: &CreateResourceRequest{Name: "web", HTTP: true, Protocol: "tcp"},
+				Targets:  []CreateTargetRequest{{IP: "web.default.svc.cluster.local", Port: 80, Method: "http"}},
+				Rules:    []BatchResourceRule{{TargetIndex: 0, Path: "/", PathMatchType: "prefix", Priority: 1, Enabled: true}},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if IsBatchCreateUnsupported(err) != tt.wantUnsupported {
+				t.Errorf("Expected IsBatchCreateUnsupported to be %v for %v", tt.wantUnsupported, err)
+			}
+			if IsNotFound(err) != tt.wantNotFound {
+				t.Errorf("Expected IsNotFound to be %v for %v", tt.wantNotFound, err)
+			}
+			if err != nil {
+				return
+			}
+			if created.Resource.ID != 1 || len(created.Targets) != 1 || len(created.Rules) != 1 || created.Rules[0].TargetID != 10 {
+				t.Errorf("Expected the created resource, target and rule to be decoded, got %+v", created)
+			}
+		})
+	}
+}
+
+func TestClient_requestCompression(t *testing.T) {
+	large := CreateResourceRequest{Name: "web", Metadata: map[string]string{"notes": strings.Repeat("x", 2048)}}
+	small := CreateResourceRequest{Name: "web"}
+
+	tests := []struct {
+		name       string
+		rejectGzip bool
+		// expected Content-Encoding of the requests for small, large and
+		// again large bodies, as received by the server
+		expected []string
+	}{
+		{name: "bodies above the threshold are compressed", expected: []string{"", "gzip", "gzip"}},
+		{name: "fallback when the server rejects compression", rejectGzip: true, expected: []string{"", "gzip", "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encodings []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding := r.Header.Get("Content-Encoding")
+				encodings = append(encodings, encoding)
+				if encoding == "gzip" && tt.rejectGzip {
+					w.WriteHeader(http.StatusUnsupportedMediaType)
+					return
+				}
+
+				var body io.Reader = r.Body
+				if encoding == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Errorf("Failed to open gzip body: %v", err)
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+					body = zr
+				}
+				var req CreateResourceRequest
+				if err := json.NewDecoder(body).Decode(&req); err != nil {
+					t.Errorf("Failed to decode request body: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": Resource{ID: 1, Name: req.Name, Metadata: req.Metadata}})
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", WithRequestCompression(1024))
+			defer c.Close()
+
+			for _, req := range []CreateResourceRequest{small, large, large} {
+				created, err := c.CreateResource(context.Background(), &req)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if created.Metadata["notes"] != req.Metadata["notes"] {
+					t.Errorf("Expected the body to arrive intact, got metadata of %d bytes", len(created.Metadata["notes"]))
+				}
+			}
+			if strings.Join(encodings, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected content encodings %q, got %q", tt.expected, encodings)
+			}
+		})
+	}
+}
+
+func TestClient_resourceCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// between runs between the first and the second read of resource 1
+		between func(c *Client, now *time.Time) error
+		// expected number of GET requests for both reads
+		expectedGets int
+	}{
+		{
+			name:         "read within TTL is cached",
+			between:      func(*Client, *time.Time) error { return nil },
+			expectedGets: 1,
+		},
+		{
+			name: "expired entry is read again",
+			between: func(_ *Client, now *time.Time) error {
+				*now = now.Add(time.Minute)
+				return nil
+			},
+			expectedGets: 2,
+		},
+		{
+			name: "update invalidates",
+			between: func(c *Client, _ *time.Time) error {
+				_, err := c.UpdateResource(context.Background(), "1", &UpdateResourceRequest{Name: "renamed"})
+				return err
+			},
+			expectedGets: 2,
+		},
+		{
+			name: "target write invalidates",
+			between: func(c *Client, _ *time.Time) error {
+				_, err := c.CreateTarget(context.Background(), "1", &CreateTargetRequest{IP: "web", Port: 80})
+				return err
+			},
+			expectedGets: 2,
+		},
+		{
+			name: "target update invalidates",
+			between: func(c *Client, _ *time.Time) error {
+				_, err := c.UpdateTarget(context.Background(), "7", &CreateTargetRequest{IP: "web", Port: 8080})
+				return err
+			},
+			expectedGets: 2,
+		},
+		{
+			name: "target delete invalidates",
+			between: func(c *Client, _ *time.Time) error {
+				return c.DeleteTarget(context.Background(), "7")
+			},
+			expectedGets: 2,
+		},
+		{
+			name: "write to another resource keeps the entry",
+			between: func(c *Client, _ *time.Time) error {
+				return c.DeleteResource(context.Background(), "2")
+			},
+			expectedGets: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					gets++
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": Resource{ID: 1, Name: fmt.Sprintf("web-%d", gets)}})
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", WithResourceCache(30*time.Second))
+			defer c.Close()
+			now := time.Now()
+			c.resourceCache.now = func() time.Time { return now }
+
+			first, err := c.GetResource(context.Background(), "1")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := tt.between(c, &now); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			second, err := c.GetResource(context.Background(), "1")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if gets != tt.expectedGets {
+				t.Errorf("Expected %d GET requests, got %d", tt.expectedGets, gets)
+			}
+			if tt.expectedGets == 1 && second.Name != first.Name {
+				t.Errorf("Expected the cached resource %q, got %q", first.Name, second.Name)
+			}
+			if tt.expectedGets > 1 && second.Name == first.Name {
+				t.Errorf("Expected a fresh copy of the resource, got the cached %q", second.Name)
+			}
+		})
+	}
+}
+
+func TestClient_fieldNaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		naming   FieldNaming
+		expected []string
+		absent   []string
+	}{
+		{
+			name:     "camelCase by default",
+			expected: []string{`"domainId"`, `"stickySession"`, `"requestsPerSecond"`, `"siteIds"`},
+			absent:   []string{`"domain_id"`},
+		},
+		{
+			name:     "snake_case",
+			naming:   FieldNamingSnakeCase,
+			expected: []string{`"domain_id"`, `"sticky_session"`, `"requests_per_second"`, `"site_ids"`},
+			absent:   []string{`"domainId"`, `"stickySession"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The server echoes the request body as the created resource,
+			// so the response uses the same naming as the request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				for _, key := range tt.expected {
+					if !strings.Contains(string(body), key) {
+						t.Errorf("Expected field %s in request body %s", key, body)
+					}
+				}
+				for _, key := range tt.absent {
+					if strings.Contains(string(body), key) {
+						t.Errorf("Expected no field %s in request body %s", key, body)
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"data":%s}`, body)
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", WithFieldNaming(tt.naming))
+			defer c.Close()
+
+			req := &CreateResourceRequest{
+				Name:          "web",
+				DomainID:      "example.com",
+				StickySession: true,
+				RateLimit:     &RateLimit{RequestsPerSecond: 10},
+				SiteIDs:       []string{"edge"},
+				Metadata:      map[string]string{"kubernetes.ingress": "default/web", "team_name": "web", "ownerId": "42"},
+			}
+			created, err := c.CreateResource(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if created.DomainID != req.DomainID || !created.StickySession || created.RateLimit == nil || created.RateLimit.RequestsPerSecond != 10 ||
+				!reflect.DeepEqual(created.SiteIDs, req.SiteIDs) {
+				t.Errorf("Expected the resource to round-trip, got %+v", created)
+			}
+			if !reflect.DeepEqual(created.Metadata, req.Metadata) {
+				t.Errorf("Expected metadata keys to be kept, got %v", created.Metadata)
+			}
+		})
+	}
+}
+
+func TestClient_retries(t *testing.T) {
+	tests := []struct {
+		name            string
+		failures        int32
+		retryAfter      string
+		create          bool
+		expectError     bool
+		expectedCalls   int32
+		expectedRetries float64
+		expectedResult  string
+	}{
+		{name: "transient failures are retried", failures: 2, expectedCalls: 3, expectedRetries: 2, expectedResult: requestResultSuccess},
+		{name: "retries are bounded", failures: 5, expectError: true, expectedCalls: 3, expectedRetries: 2, expectedResult: requestResultError},
+		{name: "creates are not retried", failures: 1, create: true, expectError: true, expectedCalls: 1, expectedResult: requestResultError},
+		{name: "maintenance is not retried", failures: 5, retryAfter: "600", expectError: true, expectedCalls: 1, expectedResult: requestResultError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org")
+			c.retryBackoff = time.Millisecond
+			retries := testutil.ToFloat64(requestRetriesTotal)
+			results := testutil.ToFloat64(requestTotal.WithLabelValues(tt.expectedResult))
+
+			var err error
+			if tt.create {
+				_, err = c.CreateTarget(context.Background(), "1", &CreateTargetRequest{IP: "10.0.0.1", Port: 80})
+			} else {
+				_, err = c.ListSites(context.Background())
+			}
+			if tt.expectError && err == nil {
+				t.Error("Expected an error")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if got := calls.Load(); got != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, got)
+			}
+			if got := testutil.ToFloat64(requestRetriesTotal) - retries; got != tt.expectedRetries {
+				t.Errorf("Expected pangolin_request_retries_total to grow by %v, got %v", tt.expectedRetries, got)
+			}
+			if got := testutil.ToFloat64(requestTotal.WithLabelValues(tt.expectedResult)) - results; got != 1 {
+				t.Errorf("Expected pangolin_request_total{result=%q} to grow by 1, got %v", tt.expectedResult, got)
+			}
+		})
+	}
+}
+
+func TestClient_maintenance(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter string
+		expected   time.Duration
+		ok         bool
+	}{
+		{name: "seconds", retryAfter: "900", expected: 15 * time.Minute, ok: true},
+		{name: "HTTP date", retryAfter: now.Add(time.Hour).Format(http.TimeFormat), expected: time.Hour, ok: true},
+		{name: "date in the past", retryAfter: now.Add(-time.Hour).Format(http.TimeFormat)},
+		{name: "zero", retryAfter: "0"},
+		{name: "invalid", retryAfter: "soon"},
+		{name: "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			got, ok := retryAfter(resp, now)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("Expected %v (%v), got %v (%v)", tt.expected, tt.ok, got, ok)
+			}
+		})
+	}
+
+	// The delay survives wrapping by callers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, err := NewClient(server.URL, "test-key", "test-org").ListSites(context.Background())
+	if delay, ok := IsMaintenance(fmt.Errorf("failed to list sites: %w", err)); !ok || delay != 2*time.Minute {
+		t.Errorf("Expected a maintenance error with a 2m delay, got %v (%v, %v)", err, delay, ok)
+	}
+}
+
+func TestClient_adaptiveWriteConcurrency(t *testing.T) {
+	const maxWrites = 8
+	var slow atomic.Bool
+	var inFlight, peak atomic.Int32
+	slow.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		if slow.Load() {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org", WithAdaptiveWriteConcurrency(maxWrites, 5*time.Millisecond))
+	defer c.Close()
+	deleteTargets := func(n int) {
+		t.Helper()
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			go func() { errs <- c.DeleteTarget(context.Background(), "1") }()
+		}
+		for i := 0; i < n; i++ {
+			if err := <-errs; err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+
+	// Slow responses throttle writes down to one at a time
+	deleteTargets(70)
+	if got := c.writeLimiter.currentLimit(); got != 1 {
+		t.Fatalf("Expected writes to be throttled to 1, got limit %d", got)
+	}
+	if got := testutil.ToFloat64(writeConcurrencyLimit); got != 1 {
+		t.Errorf("Expected pangolin_write_concurrency_limit to be 1, got %v", got)
+	}
+	peak.Store(0)
+	deleteTargets(10)
+	if got := peak.Load(); got != 1 {
+		t.Errorf("Expected at most 1 write in flight while throttled, got %d", got)
+	}
+
+	// Reads are never throttled
+	peak.Store(0)
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func() {
+			_, err := c.ListSites(context.Background())
+			errs <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-errs
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("Expected reads to run in parallel while writes are throttled, got peak %d", got)
+	}
+
+	// As latency recovers, the limit is restored
+	slow.Store(false)
+	for i := 0; i < 20 && c.writeLimiter.currentLimit() < maxWrites; i++ {
+		deleteTargets(maxWrites * 4)
+	}
+	if got := c.writeLimiter.currentLimit(); got != maxWrites {
+		t.Errorf("Expected the limit to recover to %d, got %d", maxWrites, got)
+	}
+}
+
+func TestClient_maxConcurrentRequests(t *testing.T) {
+	const maxRequests = 3
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org", WithMaxConcurrentRequests(maxRequests))
+	defer c.Close()
+
+	// Reads and writes share the limit
+	const n = 30
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		i := i
+		go func() {
+			if i%2 == 0 {
+				_, err := c.ListSites(context.Background())
+				errs <- err
+				return
+			}
+			errs <- c.DeleteTarget(context.Background(), "1")
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := peak.Load(); got > maxRequests {
+		t.Errorf("Expected at most %d requests in flight, got %d", maxRequests, got)
+	}
+	if got := peak.Load(); got < 2 {
+		t.Errorf("Expected requests to run in parallel up to the limit, got peak %d", got)
+	}
+	if got := len(c.requestSlots); got != 0 {
+		t.Errorf("Expected all request slots to be released, %d still held", got)
+	}
+
+	// A request waiting for a slot gives up with its context
+	for i := 0; i < maxRequests; i++ {
+		c.requestSlots <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.ListSites(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the request to time out waiting for a slot, got %v", err)
+	}
+}
+
+func TestClient_userAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ClientOption
+		expected string
+	}{
+		{name: "default", expected: "pangolin-ingress-controller/" + Version},
+		{name: "empty override keeps the default", opts: []ClientOption{WithUserAgent("")}, expected: "pangolin-ingress-controller/" + Version},
+		{name: "override", opts: []ClientOption{WithUserAgent("acme-gitops/1.2")}, expected: "acme-gitops/1.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("User-Agent")
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", tt.opts...)
+			defer c.Close()
+			if _, err := c.ListSites(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected User-Agent %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClient_defaultHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org",
+		WithUserAgent("acme-gitops/1.2"),
+		WithDefaultHeaders(map[string]string{
+			"x-tenant":      "acme",
+			"Authorization": "Bearer stolen",
+			"content-type":  "text/plain",
+			"User-Agent":    "other",
+		}),
+		WithDefaultHeaders(map[string]string{"Baggage": "team=web"}),
+	)
+	defer c.Close()
+	if _, err := c.ListSites(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"X-Tenant":      "acme",
+		"Baggage":       "team=web",
+		"Authorization": "Bearer test-key",
+		"Content-Type":  "application/json",
+		"User-Agent":    "acme-gitops/1.2",
+	}
+	for name, value := range expected {
+		if got.Get(name) != value {
+			t.Errorf("Expected header %s %q, got %q", name, value, got.Get(name))
+		}
+	}
+}
+
+func TestClient_http2(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []ClientOption
+		expectedProto string
+	}{
+		{name: "HTTP/2 by default", expectedProto: "HTTP/2.0"},
+		{name: "HTTP/2 allowed", opts: []ClientOption{WithHTTP2(true)}, expectedProto: "HTTP/2.0"},
+		{name: "HTTP/1.1 forced", opts: []ClientOption{WithHTTP2(false)}, expectedProto: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Proto
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{"sites":[]}}`))
+			}))
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", tt.opts...)
+			defer c.Close()
+			roots := x509.NewCertPool()
+			roots.AddCert(server.Certificate())
+			c.transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+			if _, err := c.ListSites(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expectedProto {
+				t.Errorf("Expected %s, got %s", tt.expectedProto, got)
+			}
+			forced := tt.expectedProto == "HTTP/2.0"
+			if c.transport.ForceAttemptHTTP2 != forced {
+				t.Errorf("Expected ForceAttemptHTTP2 %v, got %v", forced, c.transport.ForceAttemptHTTP2)
+			}
+		})
+	}
+}
+
+func TestClient_asyncOperations(t *testing.T) {
+	tests := []struct {
+		name string
+		// pendingPolls is the number of polls answered with a pending
+		// operation before final is returned; negative never completes
+		pendingPolls int
+		final        string
+		timeout      time.Duration
+		noLocation   bool
+		expectedName string
+		expectErr    func(error) bool
+	}{
+		{
+			name:         "poll until complete",
+			pendingPolls: 2,
+			final:        `{"data":{"id":"op-1","status":"succeeded","result":{"resourceId":42,"name":"web"}}}`,
+			timeout:      time.Second,
+			expectedName: "web",
+		},
+		{
+			name:         "failed operation keeps its status code",
+			pendingPolls: 1,
+			final:        `{"data":{"id":"op-1","status":"failed","error":"name taken","code":409}}`,
+			timeout:      time.Second,
+			expectErr:    IsConflict,
+		},
+		{
+			name:         "poll until timeout",
+			pendingPolls: -1,
+			timeout:      50 * time.Millisecond,
+			expectErr: func(err error) bool {
+				return errors.Is(err, ErrOperationTimeout) && IsOperationPending(err)
+			},
+		},
+		{
+			name:      "polling disabled",
+			expectErr: IsOperationPending,
+		},
+		{
+			name:       "missing operation URL",
+			timeout:    time.Second,
+			noLocation: true,
+			expectErr: func(err error) bool {
+				return strings.Contains(err.Error(), "no operation URL") && !IsOperationPending(err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodPut && r.URL.Path == "/v1/org/test-org/resource":
+					if !tt.noLocation {
+						w.Header().Set("Location", "/v1/operation/op-1")
+					}
+					w.WriteHeader(http.StatusAccepted)
+					_, _ = w.Write([]byte(`{"data":{"id":"op-1","status":"pending"}}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/v1/operation/op-1":
+					n := int(polls.Add(1))
+					if tt.pendingPolls < 0 || n <= tt.pendingPolls {
+						_, _ = w.Write([]byte(`{"data":{"id":"op-1","status":"running"}}`))
+						return
+					}
+					_, _ = w.Write([]byte(tt.final))
+				default:
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, "test-key", "test-org", WithOperationTimeout(tt.timeout))
+			defer c.Close()
+			c.operationPollInterval = time.Millisecond
+
+			resource, err := c.CreateResource(context.Background(), &CreateResourceRequest{Name: "web"})
+			if tt.expectErr != nil {
+				if err == nil || !tt.expectErr(err) {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if tt.timeout <= 0 && polls.Load() != 0 {
+					t.Errorf("Expected no polls with polling disabled, got %d", polls.Load())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resource.ID != 42 || resource.Name != tt.expectedName {
+				t.Errorf("Expected resource 42 %q, got %d %q", tt.expectedName, resource.ID, resource.Name)
+			}
+			if got := int(polls.Load()); got != tt.pendingPolls+1 {
+				t.Errorf("Expected %d polls, got %d", tt.pendingPolls+1, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package pangolin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// ResourceSnapshot is a resource together with its targets and rules, as
+// returned by Export
+type ResourceSnapshot struct {
+	Resource Resource       `json:"resource"`
+	Targets  []Target       `json:"targets"`
+	Rules    []ResourceRule `json:"rules"`
+}
+
+// Export returns a snapshot of every resource of the organization for which
+// include returns true, for backup or migration. A nil include exports all
+// resources.
+func (c *Client) Export(ctx context.Context, include func(*Resource) bool) ([]ResourceSnapshot, error) {
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+
+	snapshots := make([]ResourceSnapshot, 0, len(resources))
+	for i := range resources {
+		res := &resources[i]
+		if include != nil && !include(res) {
+			continue
+		}
+		resourceID := strconv.Itoa(res.ID)
+		targets, err := c.ListTargets(ctx, resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list targets of resource %s: %w", resourceID, err)
+		}
+		rules, err := c.ListResourceRules(ctx, resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list rules of resource %s: %w", resourceID, err)
+		}
+		snapshots = append(snapshots, ResourceSnapshot{Resource: *res, Targets: targets, Rules: rules})
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,70 @@
+package pangolin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newExportServer serves two resources, of which only the first belongs to
+// the controller, together with their targets and rules
+func newExportServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	responses := map[string]string{
+		"/v1/org/test-org/resources": `{"data":{"resources":[
+			{"resourceId":1,"name":"pangolin-controller-app.example.com-1a2b3c4d","http":true,"metadata":{"kubernetes.ingress":"default/app"}},
+			{"resourceId":2,"name":"manual","http":true}]}}`,
+		"/v1/resource/1/targets": `{"data":{"targets":[{"targetId":10,"siteId":7,"ip":"app.default.svc.cluster.local","port":80,"enabled":true,"weight":100}]}}`,
+		"/v1/resource/1/rules":   `{"data":{"rules":[{"ruleId":20,"resourceId":1,"targetId":10,"path":"/","pathMatchType":"prefix","priority":1,"enabled":true}]}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_Export(t *testing.T) {
+	server := newExportServer(t)
+	c := NewClient(server.URL, "test-key", "test-org")
+	defer c.Close()
+
+	snapshots, err := c.Export(context.Background(), func(res *Resource) bool {
+		return strings.HasPrefix(res.Name, "pangolin-controller-")
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Resource.ID != 1 {
+		t.Fatalf("Expected only resource 1 to be exported, got %+v", snapshots)
+	}
+	if len(snapshots[0].Targets) != 1 || snapshots[0].Targets[0].ID != 10 {
+		t.Errorf("Expected target 10 in the snapshot, got %+v", snapshots[0].Targets)
+	}
+	if len(snapshots[0].Rules) != 1 || snapshots[0].Rules[0].TargetID != 10 {
+		t.Errorf("Expected a rule for target 10 in the snapshot, got %+v", snapshots[0].Rules)
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %v", err)
+	}
+	var decoded []ResourceSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, snapshots) {
+		t.Errorf("Expected the snapshot to round-trip through JSON, got %+v, want %+v", decoded, snapshots)
+	}
+}
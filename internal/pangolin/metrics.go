@@ -0,0 +1,52 @@
+package pangolin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Values of the result label of requestTotal
+const (
+	requestResultSuccess = "success"
+	requestResultError   = "error"
+)
+
+var (
+	// requestRetriesTotal counts retries of API requests after a transient
+	// failure
+	requestRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pangolin_request_retries_total",
+		Help: "Number of Pangolin API requests retried after a transient failure",
+	})
+
+	// requestTotal counts API requests by their final outcome, after retries.
+	// Only 2xx responses count as success.
+	requestTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pangolin_request_total",
+		Help: "Number of Pangolin API requests by final result (success or error), after retries",
+	}, []string{"result"})
+
+	// requestDuration observes the latency of every single attempt of an API
+	// request
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pangolin_request_duration_seconds",
+		Help:    "Latency of Pangolin API requests in seconds, per attempt",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// writeConcurrencyLimit is the current limit of concurrent write
+	// requests set by adaptive concurrency
+	writeConcurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pangolin_write_concurrency_limit",
+		Help: "Number of Pangolin API write requests currently allowed in parallel",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		requestRetriesTotal,
+		requestTotal,
+		requestDuration,
+		writeConcurrencyLimit,
+	)
+}
@@ -0,0 +1,119 @@
+package pangolin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// FieldNaming is the naming scheme of the fields of API request and response
+// bodies, which differs between Pangolin versions
+type FieldNaming string
+
+const (
+	// FieldNamingCamelCase names fields like siteId and proxyPort. It is the
+	// default and matches the JSON tags of the types in this package.
+	FieldNamingCamelCase FieldNaming = "camelCase"
+	// FieldNamingSnakeCase names fields like site_id and proxy_port
+	FieldNamingSnakeCase FieldNaming = "snake_case"
+)
+
+// freeFormFields hold maps with user-defined keys, which are never renamed
+var freeFormFields = map[string]bool{
+	"metadata":        true,
+	"responseHeaders": true,
+}
+
+// WithFieldNaming makes the client send and expect field names in the given
+// scheme, e.g. FieldNamingSnakeCase for Pangolin versions using snake_case.
+// Keys of metadata and header maps are passed through unchanged. An empty
+// naming keeps the default, FieldNamingCamelCase.
+func WithFieldNaming(naming FieldNaming) ClientOption {
+	return func(c *Client) {
+		if naming != "" {
+			c.fieldNaming = naming
+		}
+	}
+}
+
+// encodeFields converts a request body from the naming of the JSON tags to
+// the naming of the API
+func (c *Client) encodeFields(data []byte) ([]byte, error) {
+	if c.fieldNaming != FieldNamingSnakeCase {
+		return data, nil
+	}
+	return renameFields(data, camelToSnake)
+}
+
+// decodeFields converts response data from the naming of the API to the
+// naming of the JSON tags
+func (c *Client) decodeFields(data []byte) ([]byte, error) {
+	if c.fieldNaming != FieldNamingSnakeCase {
+		return data, nil
+	}
+	return renameFields(data, snakeToCamel)
+}
+
+// renameFields renames the object keys of a JSON document with rename
+func renameFields(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(v, rename))
+}
+
+func renameKeys(v interface{}, rename func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if freeFormFields[snakeToCamel(key)] {
+				renamed[rename(key)] = value
+				continue
+			}
+			renamed[rename(key)] = renameKeys(value, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i := range v {
+			v[i] = renameKeys(v[i], rename)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// camelToSnake converts e.g. proxyPort to proxy_port
+func camelToSnake(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// snakeToCamel converts e.g. proxy_port to proxyPort
+func snakeToCamel(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
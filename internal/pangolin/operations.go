@@ -0,0 +1,224 @@
+package pangolin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// defaultOperationPollInterval is the delay before the first poll of an
+	// operation; it doubles up to maxOperationPollInterval
+	defaultOperationPollInterval = 500 * time.Millisecond
+	maxOperationPollInterval     = 5 * time.Second
+)
+
+// Operation states reported by the operation endpoint
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// ErrOperationTimeout is wrapped by the OperationPendingError returned when
+// a polled operation did not complete within the operation timeout
+var ErrOperationTimeout = errors.New("timed out waiting for Pangolin operation")
+
+// OperationPendingError is returned for a write the API accepted with 202
+// Accepted to process asynchronously, if the client doesn't poll operations
+// or the operation is still running after the operation timeout. Sending the
+// write again later finds its outcome: a create then conflicts with the
+// created resource, and a delete finds it gone.
+type OperationPendingError struct {
+	// Operation is the path of the operation, below the API base URL
+	Operation string
+	Message   string
+	err       error
+}
+
+func (e *OperationPendingError) Error() string {
+	return e.Message
+}
+
+func (e *OperationPendingError) Unwrap() error {
+	return e.err
+}
+
+// IsOperationPending reports whether err is, or wraps, an
+// OperationPendingError
+func IsOperationPending(err error) bool {
+	var pending *OperationPendingError
+	return errors.As(err, &pending)
+}
+
+// Operation is the state of an asynchronous API call, as returned by the
+// operation URL of a 202 Accepted response
+type Operation struct {
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	// Result is the object the call would have returned synchronously, set
+	// once the operation succeeded
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error and Code describe a failed operation; Code is the HTTP status
+	// the call would have failed with synchronously
+	Error string `json:"error,omitempty"`
+	Code  int    `json:"code,omitempty"`
+}
+
+// WithOperationTimeout makes the client poll the operation of a write
+// answered with 202 Accepted for up to timeout, so that the write returns its
+// outcome like a synchronous one. Polling blocks the caller, but not the
+// write limiter. By default, or with a timeout <= 0, operations are not
+// polled and such writes fail with an OperationPendingError right away.
+func WithOperationTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.operationTimeout = timeout
+	}
+}
+
+// acceptedResponse handles the 202 Accepted response to a write. A delete
+// accepted without an operation URL is taken as done; any other write
+// without one fails, since there is no result to return. With an operation
+// timeout, the operation is polled until it completes, otherwise the write
+// fails with an OperationPendingError.
+func (c *Client) acceptedResponse(ctx context.Context, method, path string, accepted *http.Response) (*http.Response, error) {
+	location := accepted.Header.Get("Location")
+	if location == "" && method == http.MethodDelete {
+		return accepted, nil
+	}
+	accepted.Body.Close()
+	if location == "" {
+		return nil, fmt.Errorf("%s %s was accepted for asynchronous processing, but the response has no operation URL in its Location header", method, path)
+	}
+	opPath, err := c.operationPath(path, location)
+	if err != nil {
+		return nil, err
+	}
+	if c.operationTimeout <= 0 {
+		return nil, &OperationPendingError{
+			Operation: opPath,
+			Message:   fmt.Sprintf("%s %s was accepted for asynchronous processing as operation %s", method, path, opPath),
+		}
+	}
+
+	resp, err := c.awaitOperation(ctx, method, path, opPath)
+	if c.resourceCache != nil {
+		// Reads during the operation may have cached its intermediate state
+		c.resourceCache.invalidate(path)
+	}
+	return resp, err
+}
+
+// awaitOperation polls an operation until it completes. A succeeded
+// operation is turned into a response carrying its result, and a failed one
+// into an error response with its status code, so callers handle both as if
+// the write had been synchronous.
+func (c *Client) awaitOperation(ctx context.Context, method, path, opPath string) (*http.Response, error) {
+	log.FromContext(ctx).V(1).Info("Waiting for Pangolin operation", "method", method, "path", path, "operation", opPath)
+	deadline := time.Now().Add(c.operationTimeout)
+	interval := c.operationPollInterval
+	for {
+		wait := interval
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for operation %s: %w", opPath, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		op, err := c.getOperation(ctx, opPath)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Status {
+		case OperationSucceeded:
+			data := op.Result
+			if len(data) == 0 {
+				data = json.RawMessage("{}")
+			}
+			return operationResponse(http.StatusOK, "application/json", []byte(`{"data":`+string(data)+`}`)), nil
+		case OperationFailed:
+			code := op.Code
+			if code < 400 || code > 599 {
+				code = http.StatusInternalServerError
+			}
+			return operationResponse(code, "text/plain", []byte(fmt.Sprintf("operation %s failed: %s", opPath, op.Error))), nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, &OperationPendingError{
+				Operation: opPath,
+				Message:   fmt.Sprintf("%v: operation %s of %s %s is still %s after %v", ErrOperationTimeout, opPath, method, path, op.Status, c.operationTimeout),
+				err:       ErrOperationTimeout,
+			}
+		}
+		interval *= 2
+		if interval > maxOperationPollInterval {
+			interval = maxOperationPollInterval
+		}
+	}
+}
+
+// getOperation reads the state of an operation
+func (c *Client) getOperation(ctx context.Context, opPath string) (*Operation, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, opPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, fmt.Errorf("failed to poll operation %s: %w", opPath, err)
+	}
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	var op Operation
+	if err := c.decodeData(body, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// operationPath resolves the Location of a 202 response to a request path
+// below the API base URL
+func (c *Client) operationPath(path, location string) (string, error) {
+	base, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return "", fmt.Errorf("invalid request URL: %w", err)
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid operation URL %q: %w", location, err)
+	}
+	opPath, ok := strings.CutPrefix(base.ResolveReference(ref).String(), c.baseURL)
+	if !ok || !strings.HasPrefix(opPath, "/") {
+		return "", fmt.Errorf("operation URL %q is outside the API base URL %s", location, c.baseURL)
+	}
+	return opPath, nil
+}
+
+// operationResponse builds the response handed to the caller of a write once
+// its operation completed
+func operationResponse(status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
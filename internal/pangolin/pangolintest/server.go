@@ -0,0 +1,681 @@
+// Package pangolintest provides an in-memory Pangolin API server for tests of
+// code built on the pangolin client.
+package pangolintest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+const (
+	// OrgID is the organization served by the fake server
+	OrgID = "test-org"
+	// APIKey is the API key of the client returned by NewFakeServer; the
+	// server doesn't check it
+	APIKey = "test-key"
+)
+
+// Fault makes the server answer matching requests with an error status
+// instead of handling them, e.g. 409, 429 or 500
+type Fault struct {
+	// Method matches the request method; empty matches any
+	Method string
+	// Path matches requests whose path starts with it, e.g. "/v1/resource/";
+	// empty matches any
+	Path string
+	// Status is the status code returned
+	Status int
+	// RetryAfter, if set, is sent as the Retry-After header, e.g. with a 429
+	// or 503
+	RetryAfter string
+	// Times is the number of requests that fail before the fault is
+	// removed; zero fails every matching request
+	Times int
+}
+
+// Server is an in-memory implementation of the resource, target, rule, site,
+// domain and API key endpoints of the Pangolin API, including transactional
+// resource creation. It is safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server
+	URL string
+
+	server *httptest.Server
+
+	mu           sync.Mutex
+	nextID       int
+	resources    map[int]*pangolin.Resource
+	targets      map[int]*target
+	rules        map[int]*pangolin.ResourceRule
+	certificates map[int]pangolin.UploadCertificateRequest
+	sites        map[string]*pangolin.Site
+	domains      []pangolin.Domain
+	faults       []*Fault
+	tokenInfo    *pangolin.TokenInfo
+	requests     []string
+	intercept    func(http.ResponseWriter, *http.Request) bool
+}
+
+type target struct {
+	pangolin.Target
+	resourceID int
+}
+
+// NewFakeServer starts an empty fake server for OrgID and returns it together
+// with a client pointed at it. Call Close when done.
+func NewFakeServer() (*Server, *pangolin.Client) {
+	s := &Server{
+		nextID:       100,
+		resources:    make(map[int]*pangolin.Resource),
+		targets:      make(map[int]*target),
+		rules:        make(map[int]*pangolin.ResourceRule),
+		certificates: make(map[int]pangolin.UploadCertificateRequest),
+		sites:        make(map[string]*pangolin.Site),
+		tokenInfo: &pangolin.TokenInfo{
+			OrgID:  OrgID,
+			Scopes: []string{pangolin.ScopeResourceWrite, pangolin.ScopeTargetWrite},
+		},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	return s, pangolin.NewClient(s.URL, APIKey, OrgID)
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddSite registers a site, replacing one with the same nice ID
+func (s *Server) AddSite(site pangolin.Site) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sites[site.NiceID] = &site
+}
+
+// AddDomain registers a domain of the organization
+func (s *Server) AddDomain(domain pangolin.Domain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domains = append(s.domains, domain)
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Intercept installs a handler run before faults and the API itself, e.g. to
+// answer some requests in a way no Fault can. It returns whether it answered
+// the request; if not, it must leave the request body unread or restore it.
+// It must not call the Server's methods.
+func (s *Server) Intercept(intercept func(http.ResponseWriter, *http.Request) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.intercept = intercept
+}
+
+// SetTokenInfo sets the API key info served; nil answers 404 like Pangolin
+// versions without the endpoint
+func (s *Server) SetTokenInfo(info *pangolin.TokenInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenInfo = info
+}
+
+// Requests returns the method and path, e.g. "GET /v1/resource/101", of
+// every request received so far, including those answered by a fault
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Count returns how many requests with the given method and a path ending in
+// pathSuffix were received
+func (s *Server) Count(method, pathSuffix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.requests {
+		if strings.HasPrefix(r, method+" ") && strings.HasSuffix(r, pathSuffix) {
+			n++
+		}
+	}
+	return n
+}
+
+// Resources returns copies of all resources ordered by ID
+func (s *Server) Resources() []pangolin.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listResources()
+}
+
+// Resource returns a copy of the resource with the given ID, or nil
+func (s *Server) Resource(id int) *pangolin.Resource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.resources[id]
+	if !ok {
+		return nil
+	}
+	out := *res
+	return &out
+}
+
+// Targets returns the targets of a resource ordered by ID
+func (s *Server) Targets(resourceID int) []pangolin.Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resourceTargets(resourceID)
+}
+
+// Rules returns the rules of a resource ordered by priority
+func (s *Server) Rules(resourceID int) []pangolin.ResourceRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resourceRules(resourceID)
+}
+
+// SetTargetMetadata sets a metadata entry of a target behind the client's
+// back, e.g. to simulate a change made in the Pangolin UI
+func (s *Server) SetTargetMetadata(id int, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.targets[id]
+	if !ok {
+		return
+	}
+	metadata := map[string]string{key: value}
+	for k, v := range t.Metadata {
+		if k != key {
+			metadata[k] = v
+		}
+	}
+	t.Metadata = metadata
+}
+
+// SetSiteProxyIP changes the proxy IP reported for a site
+func (s *Server) SetSiteProxyIP(niceID, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if site, ok := s.sites[niceID]; ok {
+		site.ProxyIP = ip
+	}
+}
+
+// Certificate returns the certificate uploaded for a resource, if any
+func (s *Server) Certificate(resourceID int) (pangolin.UploadCertificateRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cert, ok := s.certificates[resourceID]
+	return cert, ok
+}
+
+func (s *Server) handle(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+	intercept := s.intercept
+	s.mu.Unlock()
+	if intercept != nil && intercept(w, req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f := s.fault(req); f != nil {
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		http.Error(w, "injected fault", f.Status)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		http.NotFound(w, req)
+		return
+	}
+	parts = parts[1:]
+
+	switch {
+	case len(parts) == 2 && parts[0] == "api-key" && parts[1] == "info":
+		if s.tokenInfo == nil {
+			http.NotFound(w, req)
+			return
+		}
+		reply(w, s.tokenInfo)
+	case len(parts) >= 3 && parts[0] == "org" && parts[1] != OrgID:
+		http.Error(w, "organization not found", http.StatusNotFound)
+	case len(parts) == 3 && parts[0] == "org" && parts[2] == "resource" && req.Method == http.MethodPut:
+		s.createResource(w, req)
+	case len(parts) == 3 && parts[0] == "org" && parts[2] == "resources:batchCreate" && req.Method == http.MethodPost:
+		s.batchCreateResource(w, req)
+	case len(parts) == 3 && parts[0] == "org" && parts[2] == "resources":
+		reply(w, map[string]interface{}{"resources": s.listResources()})
+	case len(parts) == 3 && parts[0] == "org" && parts[2] == "sites":
+		list := make([]pangolin.Site, 0, len(s.sites))
+		for _, site := range s.sites {
+			list = append(list, *site)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		reply(w, map[string]interface{}{"sites": list})
+	case len(parts) == 4 && parts[0] == "org" && parts[2] == "site":
+		site, ok := s.sites[parts[3]]
+		if !ok {
+			http.Error(w, "site not found", http.StatusNotFound)
+			return
+		}
+		reply(w, site)
+	case len(parts) == 3 && parts[0] == "org" && parts[2] == "domains":
+		reply(w, map[string]interface{}{"domains": s.domains})
+	case len(parts) == 4 && parts[0] == "org" && parts[2] == "domain":
+		for _, domain := range s.domains {
+			if domain.ID == parts[3] {
+				reply(w, domain)
+				return
+			}
+		}
+		http.Error(w, "domain not found", http.StatusNotFound)
+	case len(parts) == 2 && parts[0] == "site":
+		id, _ := strconv.Atoi(parts[1])
+		for _, site := range s.sites {
+			if site.ID == id {
+				reply(w, site)
+				return
+			}
+		}
+		http.Error(w, "site not found", http.StatusNotFound)
+	case len(parts) == 2 && parts[0] == "resource":
+		s.handleResource(w, req, parts[1])
+	case len(parts) == 3 && parts[0] == "resource":
+		res := s.lookupResource(w, parts[1])
+		if res == nil {
+			return
+		}
+		s.handleResourceChild(w, req, res, parts[2])
+	case len(parts) == 4 && parts[0] == "resource" && parts[2] == "rule":
+		res := s.lookupResource(w, parts[1])
+		if res == nil {
+			return
+		}
+		s.handleRule(w, req, res, parts[3])
+	case len(parts) == 2 && parts[0] == "target":
+		s.handleTarget(w, req, parts[1])
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// fault returns the first fault matching req, consuming it
+func (s *Server) fault(req *http.Request) *Fault {
+	for i, f := range s.faults {
+		if (f.Method != "" && f.Method != req.Method) || !strings.HasPrefix(req.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) createResource(w http.ResponseWriter, req *http.Request) {
+	var body pangolin.CreateResourceRequest
+	if !decode(w, req, &body) {
+		return
+	}
+	if s.hostTaken(&body) {
+		http.Error(w, "resource already exists", http.StatusConflict)
+		return
+	}
+	reply(w, s.addResource(&body))
+}
+
+func (s *Server) batchCreateResource(w http.ResponseWriter, req *http.Request) {
+	var body pangolin.BatchCreateResourceRequest
+	if !decode(w, req, &body) {
+		return
+	}
+	if body.Resource == nil {
+		http.Error(w, "resource is required", http.StatusBadRequest)
+		return
+	}
+	for _, r := range body.Rules {
+		if r.TargetIndex < 0 || r.TargetIndex >= len(body.Targets) {
+			http.Error(w, "rule refers to an unknown target", http.StatusBadRequest)
+			return
+		}
+	}
+	if s.hostTaken(body.Resource) {
+		http.Error(w, "resource already exists", http.StatusConflict)
+		return
+	}
+
+	res := s.addResource(body.Resource)
+	created := pangolin.BatchCreateResourceResponse{Resource: *res}
+	for i := range body.Targets {
+		s.nextID++
+		t := &target{Target: targetFromRequest(s.nextID, &body.Targets[i]), resourceID: res.ID}
+		s.targets[t.ID] = t
+		created.Targets = append(created.Targets, t.Target)
+	}
+	for _, r := range body.Rules {
+		s.nextID++
+		rule := ruleFromRequest(s.nextID, res.ID, &pangolin.ResourceRuleRequest{
+			TargetID:      created.Targets[r.TargetIndex].ID,
+			Path:          r.Path,
+			PathMatchType: r.PathMatchType,
+			Priority:      r.Priority,
+			Enabled:       r.Enabled,
+		})
+		s.rules[rule.ID] = &rule
+		created.Rules = append(created.Rules, rule)
+	}
+	reply(w, created)
+}
+
+// hostTaken reports whether an HTTP resource for the host of body exists
+func (s *Server) hostTaken(body *pangolin.CreateResourceRequest) bool {
+	for _, res := range s.resources {
+		if body.HTTP && res.HTTP && res.Subdomain == body.Subdomain && res.DomainID == body.DomainID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) addResource(body *pangolin.CreateResourceRequest) *pangolin.Resource {
+	s.nextID++
+	res := &pangolin.Resource{
+		ID:               s.nextID,
+		OrgID:            OrgID,
+		Name:             body.Name,
+		Subdomain:        body.Subdomain,
+		DomainID:         body.DomainID,
+		HTTP:             body.HTTP,
+		Protocol:         body.Protocol,
+		Enabled:          true,
+		StickySession:    body.StickySession,
+		WebSocket:        body.WebSocket,
+		ForwardedHeaders: body.ForwardedHeaders,
+		ResponseHeaders:  body.ResponseHeaders,
+		AllowedMethods:   body.AllowedMethods,
+		AllowCIDRs:       body.AllowCIDRs,
+		DenyCIDRs:        body.DenyCIDRs,
+		ListenPort:       body.ListenPort,
+		Priority:         body.Priority,
+		RateLimit:        body.RateLimit,
+		Metadata:         body.Metadata,
+		SiteIDs:          body.SiteIDs,
+	}
+	s.resources[res.ID] = res
+	return res
+}
+
+func (s *Server) handleResource(w http.ResponseWriter, req *http.Request, rawID string) {
+	res := s.lookupResource(w, rawID)
+	if res == nil {
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		reply(w, res)
+	case http.MethodPost:
+		var body pangolin.UpdateResourceRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		if body.Name != "" {
+			res.Name = body.Name
+		}
+		if body.Subdomain != "" {
+			res.Subdomain = body.Subdomain
+		}
+		if body.DomainID != "" {
+			res.DomainID = body.DomainID
+		}
+		if body.Enabled != nil {
+			res.Enabled = *body.Enabled
+		}
+		if body.StickySession != nil {
+			res.StickySession = *body.StickySession
+		}
+		if body.WebSocket != nil {
+			res.WebSocket = *body.WebSocket
+		}
+		if body.ForwardedHeaders != nil {
+			res.ForwardedHeaders = *body.ForwardedHeaders
+		}
+		if body.ResponseHeaders != nil {
+			res.ResponseHeaders = *body.ResponseHeaders
+		}
+		if body.AllowedMethods != nil {
+			res.AllowedMethods = *body.AllowedMethods
+		}
+		if body.AllowCIDRs != nil {
+			res.AllowCIDRs = *body.AllowCIDRs
+		}
+		if body.DenyCIDRs != nil {
+			res.DenyCIDRs = *body.DenyCIDRs
+		}
+		if body.ListenPort != nil {
+			res.ListenPort = *body.ListenPort
+		}
+		if body.Priority != nil {
+			res.Priority = *body.Priority
+		}
+		if body.SiteIDs != nil {
+			res.SiteIDs = *body.SiteIDs
+		}
+		res.RateLimit = body.RateLimit
+		res.Metadata = body.Metadata
+		reply(w, res)
+	case http.MethodDelete:
+		delete(s.resources, res.ID)
+		delete(s.certificates, res.ID)
+		for id, t := range s.targets {
+			if t.resourceID == res.ID {
+				delete(s.targets, id)
+			}
+		}
+		for id, rule := range s.rules {
+			if rule.ResourceID == res.ID {
+				delete(s.rules, id)
+			}
+		}
+		reply(w, map[string]interface{}{})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleResourceChild(w http.ResponseWriter, req *http.Request, res *pangolin.Resource, child string) {
+	switch {
+	case child == "target" && req.Method == http.MethodPut:
+		var body pangolin.CreateTargetRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		s.nextID++
+		t := &target{Target: targetFromRequest(s.nextID, &body), resourceID: res.ID}
+		s.targets[t.ID] = t
+		reply(w, t.Target)
+	case child == "targets" && req.Method == http.MethodGet:
+		reply(w, map[string]interface{}{"targets": s.resourceTargets(res.ID)})
+	case child == "rule" && req.Method == http.MethodPut:
+		var body pangolin.ResourceRuleRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		s.nextID++
+		rule := ruleFromRequest(s.nextID, res.ID, &body)
+		s.rules[rule.ID] = &rule
+		reply(w, rule)
+	case child == "rules" && req.Method == http.MethodGet:
+		reply(w, map[string]interface{}{"rules": s.resourceRules(res.ID)})
+	case child == "certificate" && req.Method == http.MethodPut:
+		var body pangolin.UploadCertificateRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		s.certificates[res.ID] = body
+		reply(w, map[string]interface{}{})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) handleRule(w http.ResponseWriter, req *http.Request, res *pangolin.Resource, rawID string) {
+	id, _ := strconv.Atoi(rawID)
+	rule, ok := s.rules[id]
+	if !ok || rule.ResourceID != res.ID {
+		http.Error(w, "rule not found", http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodPost:
+		var body pangolin.ResourceRuleRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		*rule = ruleFromRequest(id, res.ID, &body)
+		reply(w, rule)
+	case http.MethodDelete:
+		delete(s.rules, id)
+		reply(w, map[string]interface{}{})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleTarget(w http.ResponseWriter, req *http.Request, rawID string) {
+	id, _ := strconv.Atoi(rawID)
+	t, ok := s.targets[id]
+	if !ok {
+		http.Error(w, "target not found", http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodPost:
+		var body pangolin.CreateTargetRequest
+		if !decode(w, req, &body) {
+			return
+		}
+		t.Target = targetFromRequest(id, &body)
+		reply(w, t.Target)
+	case http.MethodDelete:
+		delete(s.targets, id)
+		reply(w, map[string]interface{}{})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) lookupResource(w http.ResponseWriter, rawID string) *pangolin.Resource {
+	id, _ := strconv.Atoi(rawID)
+	res, ok := s.resources[id]
+	if !ok {
+		http.Error(w, "resource not found", http.StatusNotFound)
+		return nil
+	}
+	return res
+}
+
+func (s *Server) listResources() []pangolin.Resource {
+	list := make([]pangolin.Resource, 0, len(s.resources))
+	for _, res := range s.resources {
+		list = append(list, *res)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *Server) resourceTargets(resourceID int) []pangolin.Target {
+	list := []pangolin.Target{}
+	for _, t := range s.targets {
+		if t.resourceID == resourceID {
+			list = append(list, t.Target)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *Server) resourceRules(resourceID int) []pangolin.ResourceRule {
+	list := []pangolin.ResourceRule{}
+	for _, rule := range s.rules {
+		if rule.ResourceID == resourceID {
+			list = append(list, *rule)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Priority < list[j].Priority })
+	return list
+}
+
+func decode(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func reply(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func targetFromRequest(id int, req *pangolin.CreateTargetRequest) pangolin.Target {
+	weight := 100
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+	return pangolin.Target{
+		ID:            id,
+		SiteID:        req.SiteID,
+		IP:            req.IP,
+		Method:        req.Method,
+		Port:          req.Port,
+		Enabled:       req.Enabled,
+		Path:          req.Path,
+		PathMatchType: req.PathMatchType,
+		Weight:        weight,
+		ProxyProtocol: req.ProxyProtocol,
+		Metadata:      req.Metadata,
+	}
+}
+
+func ruleFromRequest(id, resourceID int, req *pangolin.ResourceRuleRequest) pangolin.ResourceRule {
+	return pangolin.ResourceRule{
+		ID:            id,
+		ResourceID:    resourceID,
+		TargetID:      req.TargetID,
+		Path:          req.Path,
+		PathMatchType: req.PathMatchType,
+		Priority:      req.Priority,
+		Enabled:       req.Enabled,
+	}
+}
@@ -0,0 +1,283 @@
+package pangolintest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vinzenz/pangolin-ingress-controller/internal/pangolin"
+)
+
+func TestServer_resources(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	created, err := c.CreateResource(ctx, &pangolin.CreateResourceRequest{
+		Name: "app", Subdomain: "app", HTTP: true, Protocol: "tcp", DomainID: "domain-1",
+		Metadata: map[string]string{"team": "web"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	id := strconv.Itoa(created.ID)
+
+	got, err := c.GetResource(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed to get resource: %v", err)
+	}
+	if !reflect.DeepEqual(got, created) {
+		t.Errorf("Expected %+v, got %+v", created, got)
+	}
+
+	// The same host can't be created twice
+	_, err = c.CreateResource(ctx, &pangolin.CreateResourceRequest{Name: "other", Subdomain: "app", HTTP: true, DomainID: "domain-1"})
+	if !pangolin.IsConflict(err) {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+
+	disabled := false
+	if _, err := c.UpdateResource(ctx, id, &pangolin.UpdateResourceRequest{Name: "renamed", Enabled: &disabled}); err != nil {
+		t.Fatalf("Failed to update resource: %v", err)
+	}
+	res := server.Resource(created.ID)
+	if res == nil || res.Name != "renamed" || res.Enabled {
+		t.Errorf("Expected the update to be stored, got %+v", res)
+	}
+
+	list, err := c.ListResources(ctx)
+	if err != nil || len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("Expected the resource to be listed, got %+v (%v)", list, err)
+	}
+
+	if err := c.DeleteResource(ctx, id); err != nil {
+		t.Fatalf("Failed to delete resource: %v", err)
+	}
+	if _, err := c.GetResource(ctx, id); !pangolin.IsNotFound(err) {
+		t.Errorf("Expected the resource to be gone, got %v", err)
+	}
+}
+
+func TestServer_targetsAndRules(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	res, err := c.CreateResource(ctx, &pangolin.CreateResourceRequest{Name: "app", Subdomain: "app", HTTP: true, DomainID: "domain-1"})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	resourceID := strconv.Itoa(res.ID)
+
+	target, err := c.CreateTarget(ctx, resourceID, &pangolin.CreateTargetRequest{SiteID: 7, IP: "10.0.0.1", Port: 80, Enabled: true})
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	targetID := strconv.Itoa(target.ID)
+	if _, err := c.UpdateTarget(ctx, targetID, &pangolin.CreateTargetRequest{SiteID: 7, IP: "10.0.0.2", Port: 8080, Enabled: true}); err != nil {
+		t.Fatalf("Failed to update target: %v", err)
+	}
+	targets, err := c.ListTargets(ctx, resourceID)
+	if err != nil {
+		t.Fatalf("Failed to list targets: %v", err)
+	}
+	if len(targets) != 1 || targets[0].IP != "10.0.0.2" || targets[0].Port != 8080 || targets[0].Weight != 100 {
+		t.Errorf("Expected the updated target, got %+v", targets)
+	}
+
+	rule, err := c.CreateResourceRule(ctx, resourceID, &pangolin.ResourceRuleRequest{TargetID: target.ID, Path: "/api", Priority: 1, Enabled: true})
+	if err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	ruleID := strconv.Itoa(rule.ID)
+	if _, err := c.UpdateResourceRule(ctx, resourceID, ruleID, &pangolin.ResourceRuleRequest{TargetID: target.ID, Path: "/v2", Priority: 2, Enabled: true}); err != nil {
+		t.Fatalf("Failed to update rule: %v", err)
+	}
+	if rules := server.Rules(res.ID); len(rules) != 1 || rules[0].Path != "/v2" || rules[0].Priority != 2 {
+		t.Errorf("Expected the updated rule, got %+v", rules)
+	}
+	if err := c.DeleteResourceRule(ctx, resourceID, ruleID); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+	if rules, err := c.ListResourceRules(ctx, resourceID); err != nil || len(rules) != 0 {
+		t.Errorf("Expected no rules, got %+v (%v)", rules, err)
+	}
+
+	if err := c.DeleteTarget(ctx, targetID); err != nil {
+		t.Fatalf("Failed to delete target: %v", err)
+	}
+	if targets := server.Targets(res.ID); len(targets) != 0 {
+		t.Errorf("Expected no targets, got %+v", targets)
+	}
+	if err := c.DeleteTarget(ctx, targetID); !pangolin.IsNotFound(err) {
+		t.Errorf("Expected deleting a missing target to fail with not found, got %v", err)
+	}
+}
+
+func TestServer_sitesAndDomains(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	site := pangolin.Site{ID: 7, NiceID: "edge", ProxyIP: "203.0.113.10", Online: true}
+	server.AddSite(site)
+	server.AddDomain(pangolin.Domain{ID: "domain-1", BaseDomain: "example.com"})
+
+	byNiceID, err := c.GetSiteByNiceID(ctx, "edge")
+	if err != nil || !reflect.DeepEqual(*byNiceID, site) {
+		t.Errorf("Expected site %+v, got %+v (%v)", site, byNiceID, err)
+	}
+	byID, err := c.GetSite(ctx, "7")
+	if err != nil || !reflect.DeepEqual(*byID, site) {
+		t.Errorf("Expected site %+v, got %+v (%v)", site, byID, err)
+	}
+	if _, err := c.GetSiteByNiceID(ctx, "missing"); !pangolin.IsNotFound(err) {
+		t.Errorf("Expected a missing site to fail with not found, got %v", err)
+	}
+	if domains, err := c.ListDomains(ctx); err != nil || len(domains) != 1 || domains[0].BaseDomain != "example.com" {
+		t.Errorf("Expected the domain to be listed, got %+v (%v)", domains, err)
+	}
+	if info, err := c.GetTokenInfo(ctx); err != nil || len(info.MissingScopes(pangolin.ScopeResourceWrite, pangolin.ScopeTargetWrite)) != 0 {
+		t.Errorf("Expected a token with all scopes, got %+v (%v)", info, err)
+	}
+}
+
+func TestServer_faults(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+	create := func() error {
+		_, err := c.CreateResource(ctx, &pangolin.CreateResourceRequest{Name: "app", Subdomain: "app", HTTP: true, DomainID: "domain-1"})
+		return err
+	}
+
+	server.InjectFault(Fault{Method: http.MethodPut, Path: "/v1/org/", Status: http.StatusConflict, Times: 1})
+	if err := create(); !pangolin.IsConflict(err) {
+		t.Errorf("Expected an injected conflict, got %v", err)
+	}
+
+	server.InjectFault(Fault{Status: http.StatusTooManyRequests, Times: 1})
+	if err := create(); err == nil || !strings.Contains(err.Error(), "status 429") {
+		t.Errorf("Expected an injected 429, got %v", err)
+	}
+
+	// Faults with Times set are used up
+	if err := create(); err != nil {
+		t.Fatalf("Expected the faults to be used up, got %v", err)
+	}
+
+	// Faults without Times apply until cleared
+	server.InjectFault(Fault{Method: http.MethodGet, Path: "/v1/org/" + OrgID + "/sites", Status: http.StatusInternalServerError})
+	for i := 0; i < 2; i++ {
+		if _, err := c.ListSites(ctx); err == nil || !strings.Contains(err.Error(), "status 500") {
+			t.Errorf("Expected an injected 500, got %v", err)
+		}
+	}
+	if _, err := c.ListResources(ctx); err != nil {
+		t.Errorf("Expected other requests to be unaffected, got %v", err)
+	}
+	server.ClearFaults()
+	if _, err := c.ListSites(ctx); err != nil {
+		t.Errorf("Expected no error once faults are cleared, got %v", err)
+	}
+
+	server.InjectFault(Fault{Status: http.StatusServiceUnavailable, RetryAfter: "120", Times: 1})
+	resp, err := http.Get(server.URL + "/v1/org/" + OrgID + "/sites")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "120" {
+		t.Errorf("Expected a 503 with Retry-After 120, got %d with %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestServer_batchCreate(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	created, err := c.BatchCreateResource(ctx, &pangolin.BatchCreateResourceRequest{
+		Resource: &pangolin.CreateResourceRequest{Name: "app", Subdomain: "app", HTTP: true, DomainID: "domain-1"},
+		Targets:  []pangolin.CreateTargetRequest{{SiteID: 7, IP: "10.0.0.1", Port: 80, Enabled: true}},
+		Rules:    []pangolin.BatchResourceRule{{TargetIndex: 0, Path: "/api", Priority: 1, Enabled: true}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	targets := server.Targets(created.Resource.ID)
+	if len(targets) != 1 || targets[0].ID != created.Targets[0].ID {
+		t.Errorf("Expected the target to be stored, got %+v", targets)
+	}
+	rules := server.Rules(created.Resource.ID)
+	if len(rules) != 1 || rules[0].TargetID != created.Targets[0].ID || rules[0].Path != "/api" {
+		t.Errorf("Expected the rule to route to the created target, got %+v", rules)
+	}
+
+	// The same host can't be created twice
+	_, err = c.BatchCreateResource(ctx, &pangolin.BatchCreateResourceRequest{
+		Resource: &pangolin.CreateResourceRequest{Name: "other", Subdomain: "app", HTTP: true, DomainID: "domain-1"},
+	})
+	if !pangolin.IsConflict(err) {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+	if got := server.Count(http.MethodPost, "/resources:batchCreate"); got != 2 {
+		t.Errorf("Expected 2 batch creates to be counted, got %d", got)
+	}
+}
+
+func TestServer_hooks(t *testing.T) {
+	server, c := NewFakeServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	server.AddSite(pangolin.Site{ID: 7, NiceID: "edge", ProxyIP: "203.0.113.10", Online: true})
+	server.SetSiteProxyIP("edge", "203.0.113.20")
+	if site, err := c.GetSiteByNiceID(ctx, "edge"); err != nil || site.ProxyIP != "203.0.113.20" {
+		t.Errorf("Expected the changed proxy IP, got %+v (%v)", site, err)
+	}
+
+	res, err := c.CreateResource(ctx, &pangolin.CreateResourceRequest{Name: "app", Subdomain: "app", HTTP: true, DomainID: "domain-1"})
+	if err != nil {
+		t.Fatalf("Failed to create resource: %v", err)
+	}
+	target, err := c.CreateTarget(ctx, strconv.Itoa(res.ID), &pangolin.CreateTargetRequest{
+		SiteID: 7, IP: "10.0.0.1", Port: 80, Enabled: true, Metadata: map[string]string{"team": "web"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	server.SetTargetMetadata(target.ID, "owner", "ui")
+	if targets := server.Targets(res.ID); !reflect.DeepEqual(targets[0].Metadata, map[string]string{"team": "web", "owner": "ui"}) {
+		t.Errorf("Expected the metadata entry to be added, got %+v", targets[0].Metadata)
+	}
+
+	server.SetTokenInfo(nil)
+	if _, err := c.GetTokenInfo(ctx); !pangolin.IsNotFound(err) {
+		t.Errorf("Expected the API key info to be missing, got %v", err)
+	}
+
+	// Intercepted requests are counted but never reach the API
+	server.Intercept(func(w http.ResponseWriter, req *http.Request) bool {
+		if req.Method != http.MethodDelete {
+			return false
+		}
+		http.Error(w, "intercepted", http.StatusTeapot)
+		return true
+	})
+	if err := c.DeleteResource(ctx, strconv.Itoa(res.ID)); err == nil || !strings.Contains(err.Error(), "status 418") {
+		t.Errorf("Expected the intercepted status, got %v", err)
+	}
+	if server.Resource(res.ID) == nil {
+		t.Errorf("Expected the intercepted delete not to be carried out")
+	}
+	if got := server.Count(http.MethodDelete, "/resource/"+strconv.Itoa(res.ID)); got != 1 {
+		t.Errorf("Expected the intercepted delete to be counted, got %d", got)
+	}
+	if got := len(server.Resources()); got != 1 {
+		t.Errorf("Expected a single resource, got %d", got)
+	}
+}
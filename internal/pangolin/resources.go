@@ -3,47 +3,120 @@ package pangolin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
 )
 
 // Resource represents a Pangolin proxy resource
 type Resource struct {
-	ID            int    `json:"resourceId"`
-	GUID          string `json:"resourceGuid"`
-	OrgID         string `json:"orgId"`
-	NiceID        string `json:"niceId"`
-	Name          string `json:"name"`
-	Subdomain     string `json:"subdomain"`
-	FullDomain    string `json:"fullDomain"`
-	DomainID      string `json:"domainId"`
-	HTTP          bool   `json:"http"`
-	Protocol      string `json:"protocol"`
-	Enabled       bool   `json:"enabled"`
-	StickySession bool   `json:"stickySession"`
+	ID            int      `json:"resourceId"`
+	GUID          string   `json:"resourceGuid"`
+	OrgID         string   `json:"orgId"`
+	NiceID        string   `json:"niceId"`
+	Name          string   `json:"name"`
+	Subdomain     string   `json:"subdomain"`
+	FullDomain    string   `json:"fullDomain"`
+	DomainID      string   `json:"domainId"`
+	SiteID        int      `json:"siteId,omitempty"`
+	SiteIDs       []string `json:"siteIds,omitempty"`
+	HTTP          bool     `json:"http"`
+	Protocol      string   `json:"protocol"`
+	Enabled       bool     `json:"enabled"`
+	StickySession bool     `json:"stickySession"`
+	WebSocket     bool     `json:"websocket"`
+	// ForwardedHeaders is the X-Forwarded-* policy: trust, overwrite or strip
+	ForwardedHeaders string `json:"forwardedHeaders,omitempty"`
+	// ListenPort is the public port of a raw TCP/UDP resource
+	ListenPort int `json:"proxyPort,omitempty"`
+	// Priority orders resources whose domains overlap, e.g. a wildcard and
+	// a host below it; lower values are matched first
+	Priority int `json:"priority,omitempty"`
+	// ResponseHeaders are added by the proxy to every response
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	// AllowedMethods are the HTTP methods passed on to the targets; empty
+	// allows all
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	// AllowCIDRs, if not empty, are the only client networks let through;
+	// DenyCIDRs are refused even if allowed
+	AllowCIDRs []string          `json:"allowCidrs,omitempty"`
+	DenyCIDRs  []string          `json:"denyCidrs,omitempty"`
+	RateLimit  *RateLimit        `json:"rateLimit,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
 }
 
 // Target represents a backend target for a resource
 type Target struct {
-	ID           int    `json:"targetId"`
-	SiteID       int    `json:"siteId"`
-	IP           string `json:"ip"`
-	Method       string `json:"method"`
-	Port         int    `json:"port"`
-	Enabled      bool   `json:"enabled"`
-	HealthStatus string `json:"healthStatus"`
+	ID            int               `json:"targetId"`
+	SiteID        int               `json:"siteId"`
+	IP            string            `json:"ip"`
+	Method        string            `json:"method"`
+	Port          int               `json:"port"`
+	Enabled       bool              `json:"enabled"`
+	Path          string            `json:"path,omitempty"`
+	PathMatchType string            `json:"pathMatchType,omitempty"`
+	HealthStatus  string            `json:"healthStatus"`
+	Weight        int               `json:"weight,omitempty"`
+	ProxyProtocol string            `json:"proxyProtocol,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 }
 
 // CreateResourceRequest represents the request to create a resource
 type CreateResourceRequest struct {
-	Name          string `json:"name"`
-	Subdomain     string `json:"subdomain,omitempty"`
-	HTTP          bool   `json:"http"`
-	Protocol      string `json:"protocol"`
-	DomainID      string `json:"domainId"`
-	StickySession bool   `json:"stickySession,omitempty"`
-	PostAuthPath  string `json:"postAuthPath,omitempty"`
+	Name             string            `json:"name"`
+	Subdomain        string            `json:"subdomain,omitempty"`
+	HTTP             bool              `json:"http"`
+	Protocol         string            `json:"protocol"`
+	DomainID         string            `json:"domainId,omitempty"`
+	StickySession    bool              `json:"stickySession,omitempty"`
+	WebSocket        bool              `json:"websocket,omitempty"`
+	ForwardedHeaders string            `json:"forwardedHeaders,omitempty"`
+	PostAuthPath     string            `json:"postAuthPath,omitempty"`
+	ResponseHeaders  map[string]string `json:"responseHeaders,omitempty"`
+	AllowedMethods   []string          `json:"allowedMethods,omitempty"`
+	AllowCIDRs       []string          `json:"allowCidrs,omitempty"`
+	DenyCIDRs        []string          `json:"denyCidrs,omitempty"`
+	RateLimit        *RateLimit        `json:"rateLimit,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+	// SiteIDs lists the nice IDs of the sites serving the resource, for
+	// resources placed on more than one site
+	SiteIDs []string `json:"siteIds,omitempty"`
+	// ListenPort is the public port of a raw TCP/UDP resource; Pangolin
+	// picks one if it is zero
+	ListenPort int `json:"proxyPort,omitempty"`
+	// Priority orders resources whose domains overlap; lower values are
+	// matched first
+	Priority int `json:"priority,omitempty"`
+}
+
+// X-Forwarded-* header policies of a resource
+const (
+	// ForwardedHeadersTrust passes forwarded headers from the client through
+	ForwardedHeadersTrust = "trust"
+	// ForwardedHeadersOverwrite replaces them with values set by the proxy
+	ForwardedHeadersOverwrite = "overwrite"
+	// ForwardedHeadersStrip removes them
+	ForwardedHeadersStrip = "strip"
+)
+
+// Metadata keys linking a resource to the Kubernetes Ingresses it belongs to
+const (
+	// MetadataIngress is the namespace/name of the Ingress that created the
+	// resource or target
+	MetadataIngress = "kubernetes.ingress"
+	// MetadataOwners lists the Ingresses (comma-separated namespace/name)
+	// sharing a resource
+	MetadataOwners = "kubernetes.owners"
+	// MetadataInstanceID is the instance ID of the controller that created
+	// the resource
+	MetadataInstanceID = "kubernetes.instance-id"
+)
+
+// RateLimit limits the request rate a resource accepts
+type RateLimit struct {
+	RequestsPerSecond int `json:"requestsPerSecond"`
+	Burst             int `json:"burst,omitempty"`
 }
 
 // Header represents a custom proxy header
@@ -52,52 +125,99 @@ type Header struct {
 	Value string `json:"value"`
 }
 
-// UpdateResourceRequest represents the request to update a resource
+// UpdateResourceRequest represents the request to update a resource. Nil
+// fields are left unchanged; Headers and SiteIDs are cleared by pointing to an
+// empty list, ResponseHeaders by pointing to an empty map and AllowedMethods,
+// AllowCIDRs and DenyCIDRs by pointing to an empty list, which allows all
+// methods and clients. The rate limit is always sent, and nil removes it.
 type UpdateResourceRequest struct {
-	Name                  string   `json:"name,omitempty"`
-	Subdomain             string   `json:"subdomain,omitempty"`
-	DomainID              string   `json:"domainId,omitempty"`
-	Enabled               *bool    `json:"enabled,omitempty"`
-	SSO                   *bool    `json:"sso,omitempty"`
-	SSL                   *bool    `json:"ssl,omitempty"`
-	BlockAccess           *bool    `json:"blockAccess,omitempty"`
-	EmailWhitelistEnabled *bool    `json:"emailWhitelistEnabled,omitempty"`
-	ApplyRules            *bool    `json:"applyRules,omitempty"`
-	StickySession         *bool    `json:"stickySession,omitempty"`
-	TLSServerName         *string  `json:"tlsServerName,omitempty"`
-	SetHostHeader         *string  `json:"setHostHeader,omitempty"`
-	Headers               []Header `json:"headers,omitempty"`
-	PostAuthPath          *string  `json:"postAuthPath,omitempty"`
+	Name                  string             `json:"name,omitempty"`
+	Subdomain             string             `json:"subdomain,omitempty"`
+	DomainID              string             `json:"domainId,omitempty"`
+	Enabled               *bool              `json:"enabled,omitempty"`
+	SSO                   *bool              `json:"sso,omitempty"`
+	SSL                   *bool              `json:"ssl,omitempty"`
+	BlockAccess           *bool              `json:"blockAccess,omitempty"`
+	EmailWhitelistEnabled *bool              `json:"emailWhitelistEnabled,omitempty"`
+	ApplyRules            *bool              `json:"applyRules,omitempty"`
+	StickySession         *bool              `json:"stickySession,omitempty"`
+	WebSocket             *bool              `json:"websocket,omitempty"`
+	ForwardedHeaders      *string            `json:"forwardedHeaders,omitempty"`
+	TLSServerName         *string            `json:"tlsServerName,omitempty"`
+	SetHostHeader         *string            `json:"setHostHeader,omitempty"`
+	Headers               *[]Header          `json:"headers,omitempty"`
+	ResponseHeaders       *map[string]string `json:"responseHeaders,omitempty"`
+	AllowedMethods        *[]string          `json:"allowedMethods,omitempty"`
+	AllowCIDRs            *[]string          `json:"allowCidrs,omitempty"`
+	DenyCIDRs             *[]string          `json:"denyCidrs,omitempty"`
+	ListenPort            *int               `json:"proxyPort,omitempty"`
+	Priority              *int               `json:"priority,omitempty"`
+	PostAuthPath          *string            `json:"postAuthPath,omitempty"`
+	RateLimit             *RateLimit         `json:"rateLimit"`
+	Metadata              map[string]string  `json:"metadata,omitempty"`
+	SiteIDs               *[]string          `json:"siteIds,omitempty"`
 }
 
 // CreateTargetRequest represents the request to create a target
 type CreateTargetRequest struct {
-	SiteID              int      `json:"siteId"`
-	IP                  string   `json:"ip"`
-	Method              string   `json:"method,omitempty"`
-	Port                int      `json:"port"`
-	Enabled             bool     `json:"enabled"`
-	Path                string   `json:"path,omitempty"`
-	PathMatchType       string   `json:"pathMatchType,omitempty"`
-	RewritePath         string   `json:"rewritePath,omitempty"`
-	RewritePathType     string   `json:"rewritePathType,omitempty"`
-	Priority            int      `json:"priority,omitempty"`
-	HCEnabled           *bool    `json:"hcEnabled,omitempty"`
-	HCPath              *string  `json:"hcPath,omitempty"`
-	HCScheme            *string  `json:"hcScheme,omitempty"`
-	HCMode              *string  `json:"hcMode,omitempty"`
-	HCHostname          *string  `json:"hcHostname,omitempty"`
-	HCPort              *int     `json:"hcPort,omitempty"`
-	HCInterval          *int     `json:"hcInterval,omitempty"`
-	HCUnhealthyInterval *int     `json:"hcUnhealthyInterval,omitempty"`
-	HCTimeout           *int     `json:"hcTimeout,omitempty"`
-	HCHeaders           []Header `json:"hcHeaders,omitempty"`
-	HCFollowRedirects   *bool    `json:"hcFollowRedirects,omitempty"`
-	HCMethod            *string  `json:"hcMethod,omitempty"`
-	HCStatus            *int     `json:"hcStatus,omitempty"`
-	HCTLSServerName     *string  `json:"hcTlsServerName,omitempty"`
+	SiteID              int               `json:"siteId"`
+	IP                  string            `json:"ip"`
+	Method              string            `json:"method,omitempty"`
+	Port                int               `json:"port"`
+	Enabled             bool              `json:"enabled"`
+	Path                string            `json:"path,omitempty"`
+	PathMatchType       string            `json:"pathMatchType,omitempty"`
+	RewritePath         string            `json:"rewritePath,omitempty"`
+	RewritePathType     string            `json:"rewritePathType,omitempty"`
+	Priority            int               `json:"priority,omitempty"`
+	Weight              *int              `json:"weight,omitempty"`
+	ProxyProtocol       string            `json:"proxyProtocol,omitempty"`
+	Metadata            map[string]string `json:"metadata,omitempty"`
+	HCEnabled           *bool             `json:"hcEnabled,omitempty"`
+	HCPath              *string           `json:"hcPath,omitempty"`
+	HCScheme            *string           `json:"hcScheme,omitempty"`
+	HCMode              *string           `json:"hcMode,omitempty"`
+	HCHostname          *string           `json:"hcHostname,omitempty"`
+	HCPort              *int              `json:"hcPort,omitempty"`
+	HCInterval          *int              `json:"hcInterval,omitempty"`
+	HCUnhealthyInterval *int              `json:"hcUnhealthyInterval,omitempty"`
+	HCTimeout           *int              `json:"hcTimeout,omitempty"`
+	HCHeaders           []Header          `json:"hcHeaders,omitempty"`
+	HCFollowRedirects   *bool             `json:"hcFollowRedirects,omitempty"`
+	HCMethod            *string           `json:"hcMethod,omitempty"`
+	HCStatus            *int              `json:"hcStatus,omitempty"`
+	HCTLSServerName     *string           `json:"hcTlsServerName,omitempty"`
+}
+
+// ResourceRule routes requests matching a path to a specific target of a
+// resource
+type ResourceRule struct {
+	ID            int    `json:"ruleId"`
+	ResourceID    int    `json:"resourceId"`
+	TargetID      int    `json:"targetId"`
+	Path          string `json:"path"`
+	PathMatchType string `json:"pathMatchType"`
+	Priority      int    `json:"priority"`
+	Enabled       bool   `json:"enabled"`
 }
 
+// ResourceRuleRequest represents the request to create or update a resource rule
+type ResourceRuleRequest struct {
+	TargetID      int    `json:"targetId"`
+	Path          string `json:"path"`
+	PathMatchType string `json:"pathMatchType,omitempty"`
+	Priority      int    `json:"priority"`
+	Enabled       bool   `json:"enabled"`
+}
+
+// UploadCertificateRequest represents the request to attach a TLS certificate to a resource
+type UploadCertificateRequest struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privateKey"`
+}
+
+func (*UploadCertificateRequest) sensitive() {}
+
 // Site represents a Pangolin site (proxy location)
 type Site struct {
 	ID      int    `json:"siteId"`
@@ -107,6 +227,7 @@ type Site struct {
 	ProxyIP string `json:"proxyIp"`
 	Online  bool   `json:"online"`
 	Type    string `json:"type"`
+	Region  string `json:"region,omitempty"`
 }
 
 // Domain represents a Pangolin domain
@@ -115,6 +236,33 @@ type Domain struct {
 	BaseDomain string `json:"baseDomain"`
 }
 
+// Scopes an API key needs to manage resources and their targets
+const (
+	ScopeResourceWrite = "resource:write"
+	ScopeTargetWrite   = "target:write"
+)
+
+// TokenInfo describes the API key a client authenticates with
+type TokenInfo struct {
+	OrgID  string   `json:"orgId"`
+	Scopes []string `json:"scopes"`
+}
+
+// MissingScopes returns the scopes of required that the key does not have
+func (t *TokenInfo) MissingScopes(required ...string) []string {
+	granted := make(map[string]bool, len(t.Scopes))
+	for _, s := range t.Scopes {
+		granted[s] = true
+	}
+	var missing []string
+	for _, s := range required {
+		if !granted[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
 // CreateResource creates a new resource in Pangolin proxy
 func (c *Client) CreateResource(ctx context.Context, req *CreateResourceRequest) (*Resource, error) {
 	resp, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/v1/org/%s/resource", c.orgID), req)
@@ -123,44 +271,136 @@ func (c *Client) CreateResource(ctx context.Context, req *CreateResourceRequest)
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var resource Resource
-	if err := decodeData(body, &resource); err != nil {
+	if err := c.decodeData(body, &resource); err != nil {
 		return nil, err
 	}
 
 	return &resource, nil
 }
 
-// GetResource retrieves a resource by ID
+// ErrBatchCreateUnsupported is returned by BatchCreateResource when the API
+// has no transactional create endpoint
+var ErrBatchCreateUnsupported = errors.New("transactional resource creation is not supported by the Pangolin API")
+
+// IsBatchCreateUnsupported reports whether err is, or wraps,
+// ErrBatchCreateUnsupported
+func IsBatchCreateUnsupported(err error) bool {
+	return errors.Is(err, ErrBatchCreateUnsupported)
+}
+
+// BatchCreateResourceRequest creates a resource together with its targets and
+// rules in a single transaction: either all of them are created or none is
+type BatchCreateResourceRequest struct {
+	Resource *CreateResourceRequest `json:"resource"`
+	Targets  []CreateTargetRequest  `json:"targets"`
+	Rules    []BatchResourceRule    `json:"rules"`
+}
+
+// BatchResourceRule is a rule of a BatchCreateResourceRequest, which refers to
+// its target by position since the target has no ID yet
+type BatchResourceRule struct {
+	// TargetIndex is the index in Targets of the target the rule routes to
+	TargetIndex   int    `json:"targetIndex"`
+	Path          string `json:"path"`
+	PathMatchType string `json:"pathMatchType,omitempty"`
+	Priority      int    `json:"priority"`
+	Enabled       bool   `json:"enabled"`
+}
+
+// BatchCreateResourceResponse holds what a BatchCreateResourceRequest created
+type BatchCreateResourceResponse struct {
+	Resource Resource       `json:"resource"`
+	Targets  []Target       `json:"targets"`
+	Rules    []ResourceRule `json:"rules"`
+}
+
+// BatchCreateResource creates a resource with its targets and rules in one
+// request. It fails with ErrBatchCreateUnsupported if the API doesn't offer
+// the endpoint, in which case they must be created one by one: the request
+// is answered with 405 or 501, or with a 404 that carries no API error. A
+// 404 with an API error, e.g. for an unknown organization, comes from the
+// endpoint itself and is returned as a NotFoundError.
+func (c *Client) BatchCreateResource(ctx context.Context, req *BatchCreateResourceRequest) (*BatchCreateResourceResponse, error) {
+	resp, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/v1/org/%s/resources:batchCreate", c.orgID), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		if isJSON(resp.Header.Get("Content-Type")) {
+			break
+		}
+		fallthrough
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, fmt.Errorf("%w: %v", ErrBatchCreateUnsupported, c.checkResponse(resp))
+	}
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var created BatchCreateResourceResponse
+	if err := c.decodeData(body, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// GetResource retrieves a resource by ID. With WithResourceCache, a resource
+// read recently is returned without a request.
 func (c *Client) GetResource(ctx context.Context, resourceID string) (*Resource, error) {
+	var generation uint64
+	if c.resourceCache != nil {
+		body, gen, ok := c.resourceCache.get(resourceID)
+		if ok {
+			var resource Resource
+			if err := c.decodeData(body, &resource); err != nil {
+				return nil, err
+			}
+			return &resource, nil
+		}
+		generation = gen
+	}
+
 	resp, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/v1/resource/%s", resourceID), nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var resource Resource
-	if err := decodeData(body, &resource); err != nil {
+	if err := c.decodeData(body, &resource); err != nil {
 		return nil, err
 	}
+	if c.resourceCache != nil {
+		c.resourceCache.put(resourceID, body, generation)
+	}
 
 	return &resource, nil
 }
@@ -173,11 +413,11 @@ func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -185,13 +425,44 @@ func (c *Client) ListResources(ctx context.Context) ([]Resource, error) {
 	var list struct {
 		Resources []Resource `json:"resources"`
 	}
-	if err := decodeData(body, &list); err != nil {
+	if err := c.decodeData(body, &list); err != nil {
 		return nil, err
 	}
 
 	return list.Resources, nil
 }
 
+// ListResourcesForIngress lists the resources belonging to the Ingress
+// namespace/name, i.e. those naming it in their MetadataIngress or
+// MetadataOwners metadata. The API can't filter by metadata, so all
+// resources of the organization are listed and filtered client-side.
+func (c *Client) ListResourcesForIngress(ctx context.Context, namespace, name string) ([]Resource, error) {
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resourcesForIngress(resources, namespace+"/"+name), nil
+}
+
+// resourcesForIngress returns the resources of which owner (namespace/name)
+// is the creating Ingress or one of the owners
+func resourcesForIngress(resources []Resource, owner string) []Resource {
+	var result []Resource
+	for _, res := range resources {
+		if res.Metadata[MetadataIngress] == owner {
+			result = append(result, res)
+			continue
+		}
+		for _, o := range strings.Split(res.Metadata[MetadataOwners], ",") {
+			if o == owner {
+				result = append(result, res)
+				break
+			}
+		}
+	}
+	return result
+}
+
 // UpdateResource updates an existing resource
 func (c *Client) UpdateResource(ctx context.Context, resourceID string, req *UpdateResourceRequest) (*Resource, error) {
 	resp, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/v1/resource/%s", resourceID), req)
@@ -200,17 +471,17 @@ func (c *Client) UpdateResource(ctx context.Context, resourceID string, req *Upd
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var resource Resource
-	if err := decodeData(body, &resource); err != nil {
+	if err := c.decodeData(body, &resource); err != nil {
 		return nil, err
 	}
 
@@ -225,7 +496,7 @@ func (c *Client) DeleteResource(ctx context.Context, resourceID string) error {
 	}
 	defer resp.Body.Close()
 
-	return checkResponse(resp)
+	return c.checkResponse(resp)
 }
 
 // CreateTarget creates a new target for a resource
@@ -236,17 +507,17 @@ func (c *Client) CreateTarget(ctx context.Context, resourceID string, req *Creat
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var target Target
-	if err := decodeData(body, &target); err != nil {
+	if err := c.decodeData(body, &target); err != nil {
 		return nil, err
 	}
 
@@ -261,17 +532,17 @@ func (c *Client) UpdateTarget(ctx context.Context, targetID string, req *CreateT
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var target Target
-	if err := decodeData(body, &target); err != nil {
+	if err := c.decodeData(body, &target); err != nil {
 		return nil, err
 	}
 
@@ -286,11 +557,11 @@ func (c *Client) ListTargets(ctx context.Context, resourceID string) ([]Target,
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -298,7 +569,7 @@ func (c *Client) ListTargets(ctx context.Context, resourceID string) ([]Target,
 	var list struct {
 		Targets []Target `json:"targets"`
 	}
-	if err := decodeData(body, &list); err != nil {
+	if err := c.decodeData(body, &list); err != nil {
 		return nil, err
 	}
 
@@ -313,7 +584,111 @@ func (c *Client) DeleteTarget(ctx context.Context, targetID string) error {
 	}
 	defer resp.Body.Close()
 
-	return checkResponse(resp)
+	return c.checkResponse(resp)
+}
+
+// CreateResourceRule creates a new rule for a resource
+func (c *Client) CreateResourceRule(ctx context.Context, resourceID string, req *ResourceRuleRequest) (*ResourceRule, error) {
+	resp, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/v1/resource/%s/rule", resourceID), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var rule ResourceRule
+	if err := c.decodeData(body, &rule); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// UpdateResourceRule updates an existing rule of a resource by ID
+func (c *Client) UpdateResourceRule(ctx context.Context, resourceID, ruleID string, req *ResourceRuleRequest) (*ResourceRule, error) {
+	resp, err := c.doRequest(ctx, http.MethodPost, fmt.Sprintf("/v1/resource/%s/rule/%s", resourceID, ruleID), req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var rule ResourceRule
+	if err := c.decodeData(body, &rule); err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// ListResourceRules lists all rules of a resource
+func (c *Client) ListResourceRules(ctx context.Context, resourceID string) ([]ResourceRule, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, fmt.Sprintf("/v1/resource/%s/rules", resourceID), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var list struct {
+		Rules []ResourceRule `json:"rules"`
+	}
+	if err := c.decodeData(body, &list); err != nil {
+		return nil, err
+	}
+
+	return list.Rules, nil
+}
+
+// DeleteResourceRule deletes a rule of a resource by ID
+func (c *Client) DeleteResourceRule(ctx context.Context, resourceID, ruleID string) error {
+	resp, err := c.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/v1/resource/%s/rule/%s", resourceID, ruleID), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return c.checkResponse(resp)
+}
+
+// UploadCertificate uploads a PEM-encoded certificate/key pair to a resource,
+// replacing any certificate previously attached to it
+func (c *Client) UploadCertificate(ctx context.Context, resourceID string, certPEM, keyPEM []byte) error {
+	req := &UploadCertificateRequest{
+		Certificate: string(certPEM),
+		PrivateKey:  string(keyPEM),
+	}
+	resp, err := c.doRequest(ctx, http.MethodPut, fmt.Sprintf("/v1/resource/%s/certificate", resourceID), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return c.checkResponse(resp)
 }
 
 // GetSite retrieves site information by ID
@@ -324,17 +699,17 @@ func (c *Client) GetSite(ctx context.Context, siteID string) (*Site, error) {
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var site Site
-	if err := decodeData(body, &site); err != nil {
+	if err := c.decodeData(body, &site); err != nil {
 		return nil, err
 	}
 
@@ -349,17 +724,17 @@ func (c *Client) GetSiteByNiceID(ctx context.Context, niceID string) (*Site, err
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var site Site
-	if err := decodeData(body, &site); err != nil {
+	if err := c.decodeData(body, &site); err != nil {
 		return nil, err
 	}
 
@@ -374,11 +749,11 @@ func (c *Client) ListSites(ctx context.Context) ([]Site, error) {
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -386,7 +761,7 @@ func (c *Client) ListSites(ctx context.Context) ([]Site, error) {
 	var sites struct {
 		Sites []Site `json:"sites"`
 	}
-	if err := decodeData(body, &sites); err != nil {
+	if err := c.decodeData(body, &sites); err != nil {
 		return nil, err
 	}
 
@@ -401,11 +776,11 @@ func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -413,7 +788,7 @@ func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
 	var domains struct {
 		Domains []Domain `json:"domains"`
 	}
-	if err := decodeData(body, &domains); err != nil {
+	if err := c.decodeData(body, &domains); err != nil {
 		return nil, err
 	}
 
@@ -428,24 +803,49 @@ func (c *Client) GetDomain(ctx context.Context, domainID string) (*Domain, error
 	}
 	defer resp.Body.Close()
 
-	if err := checkResponse(resp); err != nil {
+	if err := c.checkResponse(resp); err != nil {
 		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.readBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	var domain Domain
-	if err := decodeData(body, &domain); err != nil {
+	if err := c.decodeData(body, &domain); err != nil {
 		return nil, err
 	}
 
 	return &domain, nil
 }
 
-func decodeData(body []byte, target interface{}) error {
+// GetTokenInfo retrieves the organization and scopes of the API key
+func (c *Client) GetTokenInfo(ctx context.Context) (*TokenInfo, error) {
+	resp, err := c.doRequest(ctx, http.MethodGet, "/v1/api-key/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := c.checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := c.readBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var info TokenInfo
+	if err := c.decodeData(body, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (c *Client) decodeData(body []byte, target interface{}) error {
 	var envelope struct {
 		Data json.RawMessage `json:"data"`
 	}
@@ -455,7 +855,11 @@ func decodeData(body []byte, target interface{}) error {
 	if len(envelope.Data) == 0 {
 		return fmt.Errorf("response missing data field")
 	}
-	if err := json.Unmarshal(envelope.Data, target); err != nil {
+	data, err := c.decodeFields(envelope.Data)
+	if err != nil {
+		return fmt.Errorf("failed to parse response data: %w", err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
 		return fmt.Errorf("failed to parse response data: %w", err)
 	}
 	return nil
@@ -0,0 +1,40 @@
+package pangolin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourcesForIngress(t *testing.T) {
+	resources := []Resource{
+		{ID: 1, Metadata: map[string]string{MetadataIngress: "default/web"}},
+		{ID: 2, Metadata: map[string]string{MetadataIngress: "default/api", MetadataOwners: "default/api,default/web"}},
+		{ID: 3, Metadata: map[string]string{MetadataIngress: "default/api", MetadataOwners: "default/api"}},
+		{ID: 4, Metadata: map[string]string{MetadataIngress: "other/web"}},
+		{ID: 5, Metadata: map[string]string{MetadataOwners: "default/webapp"}},
+		{ID: 6},
+	}
+
+	tests := []struct {
+		name     string
+		owner    string
+		expected []int
+	}{
+		{name: "creator and co-owner", owner: "default/web", expected: []int{1, 2}},
+		{name: "namespace is part of the reference", owner: "other/web", expected: []int{4}},
+		{name: "owners are matched exactly", owner: "default/webapp", expected: []int{5}},
+		{name: "no resources", owner: "default/missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, res := range resourcesForIngress(resources, tt.owner) {
+				got = append(got, res.ID)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected resources %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
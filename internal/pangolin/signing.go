@@ -0,0 +1,42 @@
+package pangolin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HMACSignatureHeader is the header NewHMACSigner stores the signature in
+const HMACSignatureHeader = "X-Pangolin-Signature"
+
+// RequestSigner signs an outgoing API request, typically by adding headers.
+// It is called after all other headers have been set.
+type RequestSigner func(*http.Request) error
+
+// NewHMACSigner returns a RequestSigner that sets HMACSignatureHeader to the
+// hex-encoded HMAC-SHA256, keyed with key, of the request method, path
+// (including the query) and body, each followed by a newline except the body.
+func NewHMACSigner(key []byte) RequestSigner {
+	return func(req *http.Request) error {
+		mac := hmac.New(sha256.New, key)
+		fmt.Fprintf(mac, "%s\n%s\n", req.Method, req.URL.RequestURI())
+
+		if req.GetBody != nil {
+			// Read a copy so that the body sent is left untouched
+			body, err := req.GetBody()
+			if err != nil {
+				return fmt.Errorf("failed to read request body: %w", err)
+			}
+			defer body.Close()
+			if _, err := io.Copy(mac, body); err != nil {
+				return fmt.Errorf("failed to read request body: %w", err)
+			}
+		}
+
+		req.Header.Set(HMACSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
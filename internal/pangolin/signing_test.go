@@ -0,0 +1,104 @@
+package pangolin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHMACSigner(t *testing.T) {
+	type captured struct {
+		signature string
+		auth      string
+		body      string
+	}
+
+	tests := []struct {
+		name              string
+		apiKey            string
+		call              func(*Client) error
+		expectedSignature string
+		expectedBody      string
+	}{
+		{
+			name:   "request without body",
+			apiKey: "test-key",
+			call: func(c *Client) error {
+				return c.DeleteTarget(context.Background(), "7")
+			},
+			expectedSignature: "70e76d1f98ac11b1c132582df975236d7da3108b0054046efd473ad79906160a",
+		},
+		{
+			name: "request with body and no bearer token",
+			call: func(c *Client) error {
+				_, err := c.CreateResourceRule(context.Background(), "5", &ResourceRuleRequest{
+					TargetID: 3,
+					Path:     "/",
+					Priority: 1,
+					Enabled:  true,
+				})
+				return err
+			},
+			expectedSignature: "2b2fb54aa7e30a818ca44f5026f1b6c0307c87fe6a304a02145ea307b8d4bfed",
+			expectedBody:      `{"targetId":3,"path":"/","priority":1,"enabled":true}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got captured
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				got = captured{
+					signature: r.Header.Get(HMACSignatureHeader),
+					auth:      r.Header.Get("Authorization"),
+					body:      string(body),
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{}}`))
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL, tt.apiKey, "test-org", WithRequestSigner(NewHMACSigner([]byte("test-secret"))))
+			if err := tt.call(c); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if got.signature != tt.expectedSignature {
+				t.Errorf("Expected signature %q, got %q", tt.expectedSignature, got.signature)
+			}
+			if got.body != tt.expectedBody {
+				t.Errorf("Expected the signed body to be sent unchanged, got %q", got.body)
+			}
+			if tt.apiKey == "" && got.auth != "" {
+				t.Errorf("Expected no Authorization header without an API key, got %q", got.auth)
+			}
+			if tt.apiKey != "" && got.auth != "Bearer "+tt.apiKey {
+				t.Errorf("Expected bearer authentication alongside the signature, got %q", got.auth)
+			}
+		})
+	}
+}
+
+func TestClient_requestSignerError(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "test-key", "test-org", WithRequestSigner(func(*http.Request) error {
+		return errors.New("no signing key")
+	}))
+	err := c.DeleteTarget(context.Background(), "7")
+	if err == nil || !strings.Contains(err.Error(), "failed to sign request: no signing key") {
+		t.Errorf("Expected signing error, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected unsigned request not to be sent, got %d requests", requests)
+	}
+}
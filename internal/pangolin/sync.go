@@ -0,0 +1,67 @@
+package pangolin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SyncKeyMetadata is the metadata key identifying a target across SyncTargets
+// calls
+const SyncKeyMetadata = "sync-key"
+
+// SyncTargets makes the targets of a resource match desired. Targets are
+// identified by their SyncKeyMetadata metadata, which every desired target
+// must carry: existing targets with a desired key are updated in place,
+// missing ones are created and all others, including targets without a key,
+// are deleted. It keeps going after a failure and returns all errors.
+func (c *Client) SyncTargets(ctx context.Context, resourceID string, desired []*CreateTargetRequest) error {
+	wanted := make(map[string]*CreateTargetRequest, len(desired))
+	for _, req := range desired {
+		key := req.Metadata[SyncKeyMetadata]
+		if key == "" {
+			return fmt.Errorf("desired target %s:%d has no %s metadata", req.IP, req.Port, SyncKeyMetadata)
+		}
+		if _, ok := wanted[key]; ok {
+			return fmt.Errorf("duplicate desired target %s %q", SyncKeyMetadata, key)
+		}
+		wanted[key] = req
+	}
+
+	existing, err := c.ListTargets(ctx, resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to list targets for resource %s: %w", resourceID, err)
+	}
+
+	var errs []error
+	synced := make(map[string]bool, len(desired))
+	for _, t := range existing {
+		targetID := strconv.Itoa(t.ID)
+		key := t.Metadata[SyncKeyMetadata]
+		req, ok := wanted[key]
+		if !ok || synced[key] {
+			// Not desired, or a duplicate of a target already kept
+			if err := c.DeleteTarget(ctx, targetID); err != nil && !IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to delete target %s: %w", targetID, err))
+			}
+			continue
+		}
+		synced[key] = true
+		if _, err := c.UpdateTarget(ctx, targetID, req); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update target %s: %w", targetID, err))
+		}
+	}
+
+	for _, req := range desired {
+		key := req.Metadata[SyncKeyMetadata]
+		if synced[key] {
+			continue
+		}
+		if _, err := c.CreateTarget(ctx, resourceID, req); err != nil {
+			errs = append(errs, fmt.Errorf("failed to create target %s: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,157 @@
+package pangolin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// targetServer is an in-memory store of the targets of resource 1
+type targetServer struct {
+	mu      sync.Mutex
+	nextID  int
+	targets map[int]Target
+	calls   []string
+}
+
+func newTargetServer(t *testing.T, existing ...Target) (*targetServer, *Client) {
+	t.Helper()
+	s := &targetServer{nextID: 100, targets: make(map[int]Target)}
+	for _, target := range existing {
+		s.targets[target.ID] = target
+	}
+	server := httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(server.Close)
+	c := NewClient(server.URL, "test-key", "test-org")
+	t.Cleanup(c.Close)
+	return s, c
+}
+
+func (s *targetServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, r.Method+" "+r.URL.Path)
+
+	var data interface{} = map[string]interface{}{}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/resource/1/targets":
+		list := make([]Target, 0, len(s.targets))
+		for _, t := range s.targets {
+			list = append(list, t)
+		}
+		data = map[string]interface{}{"targets": list}
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/resource/1/target":
+		var req CreateTargetRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.nextID++
+		s.targets[s.nextID] = Target{ID: s.nextID, IP: req.IP, Port: req.Port, Metadata: req.Metadata}
+		data = s.targets[s.nextID]
+	case strings.HasPrefix(r.URL.Path, "/v1/target/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/v1/target/"))
+		if _, ok := s.targets[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.targets, id)
+			break
+		}
+		var req CreateTargetRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		s.targets[id] = Target{ID: id, IP: req.IP, Port: req.Port, Metadata: req.Metadata}
+		data = s.targets[id]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// state returns "key=ip:port" for every stored target, sorted
+func (s *targetServer) state() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, t := range s.targets {
+		out = append(out, t.Metadata[SyncKeyMetadata]+"="+t.IP+":"+strconv.Itoa(t.Port))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestClient_SyncTargets(t *testing.T) {
+	desired := func(key, ip string, port int) *CreateTargetRequest {
+		return &CreateTargetRequest{IP: ip, Port: port, Enabled: true, Metadata: map[string]string{SyncKeyMetadata: key}}
+	}
+	existing := func(id int, key, ip string, port int) Target {
+		return Target{ID: id, IP: ip, Port: port, Metadata: map[string]string{SyncKeyMetadata: key}}
+	}
+
+	tests := []struct {
+		name     string
+		existing []Target
+		desired  []*CreateTargetRequest
+		expected []string
+		// unchanged lists targets that must keep their ID
+		unchanged []int
+	}{
+		{
+			name:     "create into an empty resource",
+			desired:  []*CreateTargetRequest{desired("/", "web", 80), desired("/api", "api", 8080)},
+			expected: []string{"/=web:80", "/api=api:8080"},
+		},
+		{
+			name:      "add, update and remove in one call",
+			existing:  []Target{existing(1, "/", "web", 80), existing(2, "/api", "api", 8080), existing(3, "/old", "old", 80)},
+			desired:   []*CreateTargetRequest{desired("/", "web", 80), desired("/api", "api-v2", 9090), desired("/new", "new", 80)},
+			expected:  []string{"/=web:80", "/api=api-v2:9090", "/new=new:80"},
+			unchanged: []int{1, 2},
+		},
+		{
+			name:     "untagged and duplicate targets are removed",
+			existing: []Target{{ID: 1, IP: "manual", Port: 80}, existing(2, "/", "web", 80), existing(3, "/", "web", 80)},
+			desired:  []*CreateTargetRequest{desired("/", "web", 80)},
+			expected: []string{"/=web:80"},
+		},
+		{
+			name:     "empty desired set removes everything",
+			existing: []Target{existing(1, "/", "web", 80)},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, c := newTargetServer(t, tt.existing...)
+			if err := c.SyncTargets(context.Background(), "1", tt.desired); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := server.state(); strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected targets %v, got %v", tt.expected, got)
+			}
+			for _, id := range tt.unchanged {
+				if _, ok := server.targets[id]; !ok {
+					t.Errorf("Expected target %d to be updated in place", id)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_SyncTargetsRequiresKey(t *testing.T) {
+	server, c := newTargetServer(t)
+	err := c.SyncTargets(context.Background(), "1", []*CreateTargetRequest{{IP: "web", Port: 80}})
+	if err == nil || !strings.Contains(err.Error(), SyncKeyMetadata) {
+		t.Errorf("Expected an error about the missing %s, got %v", SyncKeyMetadata, err)
+	}
+	if len(server.calls) != 0 {
+		t.Errorf("Expected no API calls for an invalid desired set, got %v", server.calls)
+	}
+}
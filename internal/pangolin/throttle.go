@@ -0,0 +1,135 @@
+package pangolin
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindow is how many recent request latencies the p95 is
+	// computed over
+	latencyWindow = 50
+	// minLatencySamples is how many latencies must be observed since the
+	// last change of the limit before it is changed again
+	minLatencySamples = 20
+)
+
+// adaptiveLimiter is a semaphore for write requests whose size follows the
+// observed API latency. While the p95 latency of recent requests exceeds the
+// threshold, the limit is halved, down to one request at a time; once it has
+// dropped below half the threshold, the limit grows by one again up to max.
+type adaptiveLimiter struct {
+	max       int
+	threshold time.Duration
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	// latencies holds the latencies observed since the limit last changed,
+	// at most latencyWindow of them
+	latencies []time.Duration
+	// changed is closed and replaced whenever a slot may have become free
+	changed chan struct{}
+}
+
+// newAdaptiveLimiter returns a limiter allowing max concurrent requests. A
+// zero threshold keeps the limit fixed at max.
+func newAdaptiveLimiter(max int, threshold time.Duration) *adaptiveLimiter {
+	writeConcurrencyLimit.Set(float64(max))
+	return &adaptiveLimiter{
+		max:       max,
+		threshold: threshold,
+		limit:     max,
+		changed:   make(chan struct{}),
+	}
+}
+
+// acquire blocks until a request may be sent or ctx is done
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release frees the slot taken by acquire
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.notify()
+}
+
+// observe records the latency of a request and adjusts the limit
+func (l *adaptiveLimiter) observe(d time.Duration) {
+	if l.threshold <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.latencies) == latencyWindow {
+		l.latencies = l.latencies[1:]
+	}
+	l.latencies = append(l.latencies, d)
+	if len(l.latencies) < minLatencySamples {
+		return
+	}
+
+	p95 := percentile(l.latencies, 0.95)
+	limit := l.limit
+	switch {
+	case p95 > l.threshold && limit > 1:
+		limit /= 2
+	case p95 < l.threshold/2 && limit < l.max:
+		limit++
+	default:
+		return
+	}
+	l.limit = limit
+	l.latencies = nil
+	writeConcurrencyLimit.Set(float64(limit))
+	l.notify()
+}
+
+// currentLimit returns the number of write requests currently allowed at once
+func (l *adaptiveLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// notify wakes up the requests waiting in acquire; l.mu must be held
+func (l *adaptiveLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// percentile returns the p-th percentile (0 < p <= 1) of latencies
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}